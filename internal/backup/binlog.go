@@ -0,0 +1,331 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+)
+
+// positionSuffix names the file next to a SQL dump that records its binlog
+// position. Directory-format backups keep it in metadata.json instead.
+const positionSuffix = ".binlog.json"
+
+// positionHeadBytes is how much of a dump is searched for its position, which
+// mysqldump writes before any table.
+const positionHeadBytes = 1 << 20
+
+// Defaults for ArchiveBinlogs.
+const (
+	DefaultUploadInterval = time.Minute
+	binlogRetryDelay      = 10 * time.Second
+	uploadedFile          = ".uploaded" // names of archived binlogs already uploaded
+)
+
+// BinlogPosition is where the snapshot of a full backup sits in the binary
+// log. Replaying binlogs from here brings a restore forward in time.
+type BinlogPosition struct {
+	Database     string    `json:"database"`
+	File         string    `json:"binlogFile"`
+	Pos          int64     `json:"binlogPos"`
+	GTIDExecuted string    `json:"gtidExecuted,omitempty"`
+	Started      time.Time `json:"started"`
+	Finished     time.Time `json:"finished"`
+}
+
+var (
+	sourcePositionRe = regexp.MustCompile(`(?:MASTER|SOURCE)_LOG_FILE='([^']+)',\s*(?:MASTER|SOURCE)_LOG_POS=(\d+)`)
+	gtidPurgedRe     = regexp.MustCompile(`GTID_PURGED='\+?([^']*)'`)
+)
+
+// readDumpPosition reads the position mysqldump --source-data=2 writes near
+// the top of a dump, and the GTID set from --set-gtid-purged=COMMENTED.
+func readDumpPosition(path string) (BinlogPosition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return BinlogPosition{}, err
+	}
+	defer f.Close()
+
+	head, err := io.ReadAll(io.LimitReader(f, positionHeadBytes))
+	if err != nil {
+		return BinlogPosition{}, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	m := sourcePositionRe.FindSubmatch(head)
+	if m == nil {
+		return BinlogPosition{}, fmt.Errorf("no binlog position found in %s; is binary logging enabled?", path)
+	}
+	pos := BinlogPosition{File: string(m[1])}
+	pos.Pos, _ = strconv.ParseInt(string(m[2]), 10, 64)
+	if g := gtidPurgedRe.FindSubmatch(head); g != nil {
+		pos.GTIDExecuted = strings.Join(strings.Fields(string(g[1])), "")
+	}
+	return pos, nil
+}
+
+// savePosition writes the binlog position of the dump at opts.Output next to
+// it, for point-in-time restores to find.
+func savePosition(opts BackupOptions, started time.Time) error {
+	pos, err := readDumpPosition(opts.Output)
+	if err != nil {
+		return err
+	}
+	pos.Database = opts.DBName
+	pos.Started = started
+	pos.Finished = time.Now()
+
+	data, err := json.MarshalIndent(pos, "", "  ")
+	if err != nil {
+		return err
+	}
+	console.Printf("Recorded binlog position %s:%d\n", pos.File, pos.Pos)
+	return fsutil.WriteFile(opts.Output+positionSuffix, append(data, '\n'), ArtifactPerm)
+}
+
+// backupPosition returns the recorded binlog position of a SQL dump or
+// directory-format backup, and false if it has none.
+func backupPosition(path string) (BinlogPosition, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return BinlogPosition{}, false
+	}
+
+	if info.IsDir() {
+		data, err := os.ReadFile(filepath.Join(path, metadataFile))
+		if err != nil {
+			return BinlogPosition{}, false
+		}
+		var meta DirMetadata
+		if json.Unmarshal(data, &meta) != nil || meta.BinlogFile == "" || !meta.Consistent {
+			return BinlogPosition{}, false
+		}
+		return BinlogPosition{
+			Database:     meta.Database,
+			File:         meta.BinlogFile,
+			Pos:          meta.BinlogPos,
+			GTIDExecuted: meta.GTIDExecuted,
+			Started:      meta.Started,
+			Finished:     meta.Finished,
+		}, true
+	}
+
+	data, err := os.ReadFile(path + positionSuffix)
+	if err != nil {
+		return BinlogPosition{}, false
+	}
+	var pos BinlogPosition
+	if json.Unmarshal(data, &pos) != nil || pos.File == "" {
+		return BinlogPosition{}, false
+	}
+	return pos, true
+}
+
+// BinlogArchiveOptions configures ArchiveBinlogs.
+type BinlogArchiveOptions struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Dir      string // local archive directory
+	ServerID int    // server_id mysqlbinlog connects as; 0 leaves it to mysqlbinlog
+
+	// Upload, if set, is called for each binlog once the server has moved
+	// on to the next one, every UploadInterval.
+	Upload         func(ctx context.Context, path string) error
+	UploadInterval time.Duration
+}
+
+// ArchiveBinlogs streams the server's binary logs into opts.Dir with
+// mysqlbinlog --read-from-remote-server --raw --stop-never until ctx is
+// cancelled. It resumes from the newest archived binlog, or starts from the
+// oldest one on the server. If the stream drops it reconnects; only a first
+// attempt that fails straight away (bad credentials, missing privileges) is
+// returned as an error.
+func ArchiveBinlogs(ctx context.Context, opts BinlogArchiveOptions) error {
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return fmt.Errorf("create binlog archive: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	if opts.Upload != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			uploadBinlogs(ctx, opts)
+		}()
+	}
+	defer wg.Wait()
+
+	for attempt := 0; ; attempt++ {
+		began := time.Now()
+		err := streamBinlogs(ctx, opts)
+		if ctx.Err() != nil {
+			return fmt.Errorf("binlog archiving stopped: %w", ctx.Err())
+		}
+		if attempt == 0 && time.Since(began) < binlogRetryDelay {
+			return err
+		}
+
+		console.Printf("Warning: binlog stream stopped (%v), reconnecting in %s\n", err, binlogRetryDelay)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("binlog archiving stopped: %w", ctx.Err())
+		case <-time.After(binlogRetryDelay):
+		}
+	}
+}
+
+// streamBinlogs runs mysqlbinlog once, from the newest archived binlog.
+func streamBinlogs(ctx context.Context, opts BinlogArchiveOptions) error {
+	start, err := firstBinlog(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	args := connArgs(opts.Host, opts.Port, opts.User, opts.Password)
+	args = append(args, "--read-from-remote-server", "--raw", "--stop-never",
+		"--result-file="+opts.Dir+string(os.PathSeparator))
+	if opts.ServerID > 0 {
+		args = append(args, fmt.Sprintf("--connection-server-id=%d", opts.ServerID))
+	}
+	args = append(args, start)
+
+	console.Printf("Archiving binlogs from %s into %s\n", start, opts.Dir)
+
+	var stderr bytes.Buffer
+	cmd := newCommand(ctx, "mysqlbinlog", args...)
+	cmd.Stdout = console.Out()
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	if err := runCommand(ctx, cmd); err != nil {
+		return fmt.Errorf("mysqlbinlog failed: %w", classifyClientError(err, stderr.String()))
+	}
+	return errors.New("mysqlbinlog exited")
+}
+
+// firstBinlog is the binlog to stream from: the newest one archived, which
+// mysqlbinlog rewrites from its start, or else the oldest on the server.
+func firstBinlog(ctx context.Context, opts BinlogArchiveOptions) (string, error) {
+	files, err := archivedBinlogs(opts.Dir)
+	if err != nil {
+		return "", err
+	}
+	if len(files) > 0 {
+		return files[len(files)-1], nil
+	}
+
+	rows, err := mysqlQuery(ctx, BackupOptions{
+		Host:     opts.Host,
+		Port:     opts.Port,
+		User:     opts.User,
+		Password: opts.Password,
+	}, "", "SHOW BINARY LOGS")
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", errors.New("server has no binary logs; is binary logging enabled?")
+	}
+	name, _, _ := strings.Cut(rows[0], "\t")
+	return name, nil
+}
+
+// archivedBinlogs lists the binlog files in dir, oldest first.
+func archivedBinlogs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read binlog archive: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") && binlogSeq(e.Name()) >= 0 {
+			files = append(files, e.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// binlogSeq returns the sequence number of a binlog file name such as
+// binlog.000042, or -1 if name is not one.
+func binlogSeq(name string) int64 {
+	i := strings.LastIndexByte(name, '.')
+	if i <= 0 {
+		return -1
+	}
+	n, err := strconv.ParseInt(name[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// uploadBinlogs uploads completed binlogs every opts.UploadInterval.
+func uploadBinlogs(ctx context.Context, opts BinlogArchiveOptions) {
+	interval := opts.UploadInterval
+	if interval <= 0 {
+		interval = DefaultUploadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := uploadCompleted(ctx, opts); err != nil && ctx.Err() == nil {
+			console.Println("Warning: binlog upload failed, retrying later:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// uploadCompleted uploads every archived binlog except the newest, which is
+// still being written, that has not been uploaded yet.
+func uploadCompleted(ctx context.Context, opts BinlogArchiveOptions) error {
+	files, err := archivedBinlogs(opts.Dir)
+	if err != nil || len(files) < 2 {
+		return err
+	}
+
+	statePath := filepath.Join(opts.Dir, uploadedFile)
+	data, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	uploaded := make(map[string]bool)
+	for _, name := range strings.Fields(string(data)) {
+		uploaded[name] = true
+	}
+
+	for _, name := range files[:len(files)-1] {
+		if uploaded[name] {
+			continue
+		}
+		if err := opts.Upload(ctx, filepath.Join(opts.Dir, name)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		console.Println("Uploaded binlog", name)
+
+		data = append(data, name+"\n"...)
+		if err := fsutil.WriteFile(statePath, data, 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
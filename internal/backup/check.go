@@ -0,0 +1,106 @@
+package backup
+
+import "fmt"
+
+// CheckOptions validates the settings of opts that can be judged without a
+// server: the engine, format, snapshot and dump options for its database
+// type, and file globs. The backup functions make the same checks when
+// they run.
+func CheckOptions(opts BackupOptions) error {
+	switch opts.DBType {
+	case "mysql":
+		if err := checkEngine(opts.Engine); err != nil {
+			return err
+		}
+		switch opts.Format {
+		case "", FormatSQL, FormatDir:
+		default:
+			return fmt.Errorf("%w: format %q (want %s or %s)", ErrDumpOptions, opts.Format, FormatSQL, FormatDir)
+		}
+		if err := opts.Dump.Validate(); err != nil {
+			return err
+		}
+		if opts.Engine == EngineNative || opts.Format == FormatDir {
+			return checkNativeDump(opts.Dump)
+		}
+	case "postgres":
+		switch opts.Format {
+		case "", FormatSQL, FormatBaseBackup:
+		default:
+			return fmt.Errorf("%w: format %q for postgres (want %s or %s)", ErrDumpOptions, opts.Format, FormatSQL, FormatBaseBackup)
+		}
+	case "redis":
+		if IsDirFormat(opts.Format) {
+			return fmt.Errorf("%w: format %q for redis (backups are single RDB files)", ErrDumpOptions, opts.Format)
+		}
+		switch opts.Snapshot {
+		case "", SnapshotSync, SnapshotBGSave:
+		default:
+			return fmt.Errorf("%w: snapshot %q (want %s or %s)", ErrDumpOptions, opts.Snapshot, SnapshotSync, SnapshotBGSave)
+		}
+	case "mssql":
+		switch opts.Format {
+		case "", FormatSQL, FormatFull, FormatLog:
+		default:
+			return fmt.Errorf("%w: format %q for mssql (want %s or %s)", ErrDumpOptions, opts.Format, FormatFull, FormatLog)
+		}
+	case "files":
+		if opts.Format != "" && opts.Format != FormatSQL {
+			return fmt.Errorf("%w: format %q for files (backups are tar files)", ErrDumpOptions, opts.Format)
+		}
+		return opts.Files.checkGlobs()
+	}
+	return nil
+}
+
+// BackupTools returns the client programs a backup with opts runs, which
+// must be on PATH.
+func BackupTools(opts BackupOptions) []string {
+	switch opts.DBType {
+	case "mysql":
+		if opts.Engine == EngineNative || opts.Format == FormatDir {
+			return nil
+		}
+		// mysql lists databases and tables for patterns and filters.
+		return []string{"mysqldump", "mysql"}
+	case "postgres":
+		if opts.Format == FormatBaseBackup {
+			return []string{"pg_basebackup"}
+		}
+		return []string{"pg_dump"}
+	case "mssql":
+		return []string{"sqlcmd"}
+	}
+	return nil
+}
+
+// RestoreTools returns the client programs a restore with opts runs, which
+// must be on PATH.
+func RestoreTools(opts RestoreOptions) []string {
+	switch opts.DBType {
+	case "mysql":
+		var tools []string
+		if opts.Engine != EngineNative {
+			tools = append(tools, "mysql")
+		}
+		if opts.BinlogDir != "" {
+			// Binlogs are replayed through the mysql client either way.
+			tools = append(tools, "mysqlbinlog")
+			if opts.Engine == EngineNative {
+				tools = append(tools, "mysql")
+			}
+		}
+		return tools
+	case "postgres":
+		if opts.DataDir != "" {
+			return nil
+		}
+		return []string{"psql"}
+	case "mssql":
+		return []string{"sqlcmd"}
+	}
+	return nil
+}
+
+// BinlogArchiveTools are the client programs ArchiveBinlogs runs.
+var BinlogArchiveTools = []string{"mysqlbinlog"}
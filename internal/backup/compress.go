@@ -1,38 +1,344 @@
 package backup
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+	"github.com/bhagashetti/db-backup-cli/internal/progress"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression algorithms.
+const (
+	CompressGzip  = "gzip"  // compress/gzip, single-threaded
+	CompressPgzip = "pgzip" // gzip compressed in parallel blocks; any gunzip reads it
+	CompressZstd  = "zstd"
+	CompressXZ    = "xz"
+	CompressLZ4   = "lz4"
 )
 
-// GzipFile compresses src into dst using gzip.
-func GzipFile(src, dst string) error {
+// zstdLongWindow is the window used for long-distance matching, as with
+// zstd --long (2^27 bytes).
+const zstdLongWindow = 1 << 27
+
+// ErrCompressOptions is returned for an unknown algorithm or a level out of
+// its range.
+var ErrCompressOptions = errors.New("invalid compression options")
+
+// CompressOptions selects and tunes a compressor.
+type CompressOptions struct {
+	Algorithm string // CompressGzip (default), CompressPgzip, CompressZstd, CompressXZ or CompressLZ4
+	Level     int    // 0 is the algorithm's default; see Codec.MaxLevel
+	Threads   int    // pgzip, zstd and lz4 workers, default the number of CPUs
+	Long      bool   // zstd long-distance matching over a 128 MiB window
+}
+
+// Codec describes a compression format.
+type Codec struct {
+	Name     string
+	Ext      string // file extension, with the dot
+	MinLevel int
+	MaxLevel int
+	magic    []byte
+	writer   func(w io.Writer, opts CompressOptions) (io.WriteCloser, error)
+	reader   func(r io.Reader) (io.ReadCloser, error)
+}
+
+var codecs = map[string]*Codec{
+	CompressGzip: {
+		Name: CompressGzip, Ext: ".gz", MinLevel: gzip.BestSpeed, MaxLevel: gzip.BestCompression,
+		magic: []byte{0x1f, 0x8b},
+		writer: func(w io.Writer, opts CompressOptions) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, gzipLevel(opts.Level))
+		},
+		reader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	CompressPgzip: {
+		Name: CompressPgzip, Ext: ".gz", MinLevel: pgzip.BestSpeed, MaxLevel: pgzip.BestCompression,
+		magic: []byte{0x1f, 0x8b},
+		writer: func(w io.Writer, opts CompressOptions) (io.WriteCloser, error) {
+			gw, err := pgzip.NewWriterLevel(w, gzipLevel(opts.Level))
+			if err != nil {
+				return nil, err
+			}
+			if err := gw.SetConcurrency(1<<20, 2*codecThreads(opts.Threads)); err != nil {
+				return nil, err
+			}
+			return gw, nil
+		},
+		reader: func(r io.Reader) (io.ReadCloser, error) {
+			return pgzip.NewReader(r)
+		},
+	},
+	CompressZstd: {
+		Name: CompressZstd, Ext: ".zst", MinLevel: 1, MaxLevel: 22,
+		magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+		writer: func(w io.Writer, opts CompressOptions) (io.WriteCloser, error) {
+			level := opts.Level
+			if level == 0 {
+				level = 3
+			}
+			zopts := []zstd.EOption{
+				zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+				zstd.WithEncoderConcurrency(codecThreads(opts.Threads)),
+			}
+			if opts.Long {
+				zopts = append(zopts, zstd.WithWindowSize(zstdLongWindow))
+			}
+			return zstd.NewWriter(w, zopts...)
+		},
+		reader: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r, zstd.WithDecoderMaxWindow(zstd.MaxWindowSize))
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		},
+	},
+	CompressXZ: {
+		Name: CompressXZ, Ext: ".xz", MinLevel: 1, MaxLevel: 9,
+		magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		writer: func(w io.Writer, opts CompressOptions) (io.WriteCloser, error) {
+			return xz.WriterConfig{DictCap: xzDictCap(opts.Level)}.NewWriter(w)
+		},
+		reader: func(r io.Reader) (io.ReadCloser, error) {
+			xr, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(xr), nil
+		},
+	},
+	CompressLZ4: {
+		Name: CompressLZ4, Ext: ".lz4", MinLevel: 1, MaxLevel: 9,
+		magic: []byte{0x04, 0x22, 0x4d, 0x18},
+		writer: func(w io.Writer, opts CompressOptions) (io.WriteCloser, error) {
+			lw := lz4.NewWriter(w)
+			// Level 0 is the fast compressor; 1-9 are lz4's HC levels.
+			level := lz4.Fast
+			if opts.Level > 0 {
+				level = lz4.CompressionLevel(1 << (8 + opts.Level))
+			}
+			err := lw.Apply(lz4.CompressionLevelOption(level), lz4.ConcurrencyOption(codecThreads(opts.Threads)))
+			return lw, err
+		},
+		reader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(lz4.NewReader(r)), nil
+		},
+	},
+}
+
+// gzipLevel maps level 0 to gzip's default.
+func gzipLevel(level int) int {
+	if level == 0 {
+		return gzip.DefaultCompression
+	}
+	return level
+}
+
+// xzDictCap returns the dictionary size of xz preset level, which is what
+// the presets mostly differ by. Level 0 is the default preset, 6.
+func xzDictCap(level int) int {
+	caps := []int{1 << 23, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+	return caps[level]
+}
+
+// codecThreads maps 0 to the number of CPUs.
+func codecThreads(n int) int {
+	if n <= 0 {
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// Codecs returns the names of the supported algorithms.
+func Codecs() []string {
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupCodec returns the codec for opts, checking its level. An empty
+// algorithm means gzip.
+func LookupCodec(opts CompressOptions) (*Codec, error) {
+	name := strings.ToLower(opts.Algorithm)
+	if name == "" {
+		name = CompressGzip
+	}
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown algorithm %q (want %s)", ErrCompressOptions, opts.Algorithm, strings.Join(Codecs(), ", "))
+	}
+	if opts.Level != 0 && (opts.Level < c.MinLevel || opts.Level > c.MaxLevel) {
+		return nil, fmt.Errorf("%w: %s level %d is out of range %d-%d", ErrCompressOptions, c.Name, opts.Level, c.MinLevel, c.MaxLevel)
+	}
+	if opts.Long && c.Name != CompressZstd {
+		return nil, fmt.Errorf("%w: long-distance matching is a zstd option", ErrCompressOptions)
+	}
+	if opts.Threads < 0 {
+		return nil, fmt.Errorf("%w: threads must not be negative", ErrCompressOptions)
+	}
+	return c, nil
+}
+
+// DetectCodec returns the codec whose magic bytes start head, or nil if head
+// does not look compressed. Gzip data is read with pgzip.
+func DetectCodec(head []byte) *Codec {
+	for _, name := range []string{CompressPgzip, CompressZstd, CompressXZ, CompressLZ4} {
+		if c := codecs[name]; bytes.HasPrefix(head, c.magic) {
+			return c
+		}
+	}
+	return nil
+}
+
+// StripCodecExt removes a compressed file extension from name.
+func StripCodecExt(name string) string {
+	for _, c := range codecs {
+		if strings.HasSuffix(name, c.Ext) {
+			return strings.TrimSuffix(name, c.Ext)
+		}
+	}
+	return name
+}
+
+// CompressFile compresses src into dst as opts selects. dst only appears
+// once it is complete; on failure or cancellation nothing is left behind.
+func CompressFile(ctx context.Context, src, dst string, opts CompressOptions) error {
+	c, err := LookupCodec(opts)
+	if err != nil {
+		return err
+	}
+
 	in, err := os.Open(src)
 	if err != nil {
-		return fmt.Errorf("open src for gzip: %w", err)
+		return fmt.Errorf("open src for %s: %w", c.Name, err)
 	}
 	defer in.Close()
 
-	out, err := os.Create(dst)
+	out, err := fsutil.Create(dst, ArtifactPerm)
 	if err != nil {
-		return fmt.Errorf("create dst for gzip: %w", err)
+		return fmt.Errorf("create dst for %s: %w", c.Name, err)
 	}
-	defer out.Close()
+	defer out.Abort()
 
-	gw := gzip.NewWriter(out)
-	// Optional: give the original name to the gzip header
-	gw.Name = src
+	stage := progress.FromContext(ctx)
+	bw := bufio.NewWriterSize(stage.OutputWriter(out), 1<<20)
+	cw, err := c.writer(bw, opts)
+	if err != nil {
+		return fmt.Errorf("start %s writer: %w", c.Name, err)
+	}
 
-	if _, err := io.Copy(gw, in); err != nil {
-		gw.Close()
-		return fmt.Errorf("copy to gzip writer: %w", err)
+	if _, err := io.Copy(cw, stage.Reader(contextReader{ctx, in})); err != nil {
+		cw.Close()
+		return fmt.Errorf("copy to %s writer: %w", c.Name, err)
+	}
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("close %s writer: %w", c.Name, err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("write %s: %w", c.Name, err)
 	}
 
-	if err := gw.Close(); err != nil {
-		return fmt.Errorf("close gzip writer: %w", err)
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("save %s: %w", c.Name, err)
 	}
+	return nil
+}
 
+// DecompressFile decompresses src into dst, recognising the format by its
+// magic bytes rather than its extension. dst only appears once it is
+// complete.
+func DecompressFile(ctx context.Context, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open src for decompression: %w", err)
+	}
+	defer in.Close()
+
+	br := bufio.NewReaderSize(in, 1<<20)
+	head, _ := br.Peek(8)
+	c := DetectCodec(head)
+	if c == nil {
+		return fmt.Errorf("%s is not in a known compressed format", src)
+	}
+
+	cr, err := c.reader(br)
+	if err != nil {
+		return fmt.Errorf("read %s header: %w", c.Name, err)
+	}
+	defer cr.Close()
+
+	out, err := fsutil.Create(dst, ArtifactPerm)
+	if err != nil {
+		return fmt.Errorf("create dst for decompression: %w", err)
+	}
+	defer out.Abort()
+
+	if _, err := io.Copy(out, contextReader{ctx, cr}); err != nil {
+		return fmt.Errorf("decompress %s: %w", c.Name, err)
+	}
+
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("save decompressed file: %w", err)
+	}
 	return nil
 }
+
+// NewReader returns a reader of r's content, decompressed if it starts with
+// the magic bytes of a supported format.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+	head, _ := br.Peek(8)
+	c := DetectCodec(head)
+	if c == nil {
+		return io.NopCloser(br), nil
+	}
+	cr, err := c.reader(br)
+	if err != nil {
+		return nil, fmt.Errorf("read %s header: %w", c.Name, err)
+	}
+	return cr, nil
+}
+
+// IsCompressed reports whether the file at path starts with the magic bytes
+// of a supported compression format.
+func IsCompressed(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 8)
+	n, _ := io.ReadFull(f, head)
+	return DetectCodec(head[:n]) != nil
+}
+
+// GzipFile compresses src into dst using gzip. dst only appears once it is
+// complete; on failure or cancellation nothing is left behind.
+func GzipFile(ctx context.Context, src, dst string) error {
+	return CompressFile(ctx, src, dst, CompressOptions{Algorithm: CompressGzip})
+}
+
+// GunzipFile decompresses src into dst. dst only appears once it is complete.
+func GunzipFile(ctx context.Context, src, dst string) error {
+	return DecompressFile(ctx, src, dst)
+}
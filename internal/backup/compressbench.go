@@ -0,0 +1,147 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+)
+
+// benchSlices is how many pieces a benchmark sample is taken in, spread
+// evenly through the file so it is not all schema or all one table.
+const benchSlices = 16
+
+// BenchResult is how one compressor did on a sample.
+type BenchResult struct {
+	Options     CompressOptions
+	InputBytes  int64
+	OutputBytes int64
+	Compress    time.Duration
+	Decompress  time.Duration
+}
+
+// Ratio is the input size over the compressed size.
+func (r BenchResult) Ratio() float64 {
+	if r.OutputBytes == 0 {
+		return 0
+	}
+	return float64(r.InputBytes) / float64(r.OutputBytes)
+}
+
+// CompressMBps and DecompressMBps are throughputs in MB of input per second.
+func (r BenchResult) CompressMBps() float64   { return mbps(r.InputBytes, r.Compress) }
+func (r BenchResult) DecompressMBps() float64 { return mbps(r.InputBytes, r.Decompress) }
+
+func mbps(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / 1e6 / d.Seconds()
+}
+
+// ReadSample reads about size bytes of path, in slices spread through the
+// file. A compressed file is read decompressed, so the sample is of the
+// dump itself.
+func ReadSample(ctx context.Context, path string, size int64) ([]byte, error) {
+	if IsCompressed(path) {
+		tmp, err := os.CreateTemp("", "compress-bench-*")
+		if err != nil {
+			return nil, err
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+		console.Println("Decompressing", path, "to sample it...")
+		if err := DecompressFile(ctx, path, tmp.Name()); err != nil {
+			return nil, err
+		}
+		path = tmp.Name()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() <= size {
+		return io.ReadAll(contextReader{ctx, f})
+	}
+	slice := size / benchSlices
+	stride := info.Size() / benchSlices
+	sample := make([]byte, 0, slice*benchSlices)
+	buf := make([]byte, slice)
+	for i := int64(0); i < benchSlices; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, err := f.ReadAt(buf, i*stride)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		sample = append(sample, buf[:n]...)
+	}
+	return sample, nil
+}
+
+// BenchCompression compresses and decompresses sample with each of
+// candidates in turn, checking the round trip.
+func BenchCompression(ctx context.Context, sample []byte, candidates []CompressOptions) ([]BenchResult, error) {
+	var results []BenchResult
+	for _, opts := range candidates {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		c, err := LookupCodec(opts)
+		if err != nil {
+			return results, err
+		}
+
+		var packed bytes.Buffer
+		start := time.Now()
+		cw, err := c.writer(&packed, opts)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		if _, err := cw.Write(sample); err != nil {
+			return results, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		if err := cw.Close(); err != nil {
+			return results, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		compressed := time.Since(start)
+		size := int64(packed.Len())
+
+		start = time.Now()
+		cr, err := c.reader(&packed)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		unpacked, err := io.ReadAll(cr)
+		cr.Close()
+		if err != nil {
+			return results, fmt.Errorf("%s: decompress: %w", c.Name, err)
+		}
+		decompressed := time.Since(start)
+		if !bytes.Equal(unpacked, sample) {
+			return results, fmt.Errorf("%s: round trip changed the data", c.Name)
+		}
+
+		opts.Algorithm = c.Name
+		results = append(results, BenchResult{
+			Options:     opts,
+			InputBytes:  int64(len(sample)),
+			OutputBytes: size,
+			Compress:    compressed,
+			Decompress:  decompressed,
+		})
+	}
+	return results, nil
+}
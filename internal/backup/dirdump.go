@@ -0,0 +1,528 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+)
+
+// Backup formats.
+const (
+	FormatSQL = "sql" // one SQL file (the default)
+	FormatDir = "dir" // a directory of per-table files, dumped and loaded in parallel
+)
+
+// Defaults for directory-format backups.
+const (
+	DefaultThreads   = 4
+	DefaultChunkRows = 1000000
+)
+
+// metadataFile describes a directory-format backup; restore reads it first.
+const metadataFile = "metadata.json"
+
+// DirMetadata is the contents of metadata.json.
+type DirMetadata struct {
+	Version       int        `json:"version"`
+	Database      string     `json:"database"`
+	ServerVersion string     `json:"serverVersion"`
+	Started       time.Time  `json:"started"`
+	Finished      time.Time  `json:"finished"`
+	Consistent    bool       `json:"consistent"` // all threads shared one snapshot
+	BinlogFile    string     `json:"binlogFile,omitempty"`
+	BinlogPos     int64      `json:"binlogPos,omitempty"`
+	GTIDExecuted  string     `json:"gtidExecuted,omitempty"`
+	Tables        []DirTable `json:"tables"`
+	Post          []string   `json:"post"` // views, routines and events, loaded last
+}
+
+// DirTable lists the files of one table.
+type DirTable struct {
+	Name     string   `json:"name"`
+	Schema   string   `json:"schema"`             // CREATE TABLE without secondary indexes
+	Indexes  string   `json:"indexes,omitempty"`  // secondary indexes and foreign keys, added after the data
+	Triggers string   `json:"triggers,omitempty"` // created after the data so they do not fire during the load
+	Chunks   []string `json:"chunks"`             // gzipped INSERTs
+	Rows     int64    `json:"rows"`
+}
+
+// dataChunk is one unit of work for a dump thread.
+type dataChunk struct {
+	table *DirTable
+	file  string
+	where string
+}
+
+// mysqlDirBackup dumps opts.DBName into the directory opts.Output with
+// opts.Threads connections sharing one snapshot. Tables with a single integer
+// primary key and more than opts.ChunkRows rows are split into key ranges.
+func mysqlDirBackup(ctx context.Context, opts BackupOptions) error {
+	if err := checkNativeDump(opts.Dump); err != nil {
+		return err
+	}
+	threads := opts.Threads
+	if threads < 1 {
+		threads = DefaultThreads
+	}
+
+	console.Printf("Dumping %s to directory %s with %d threads\n", opts.DBName, opts.Output, threads)
+
+	sqlDB, err := openMySQL(ctx, opts.Host, opts.Port, opts.User, opts.Password, opts.DBName)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(threads + 1)
+
+	dir, err := fsutil.CreateDir(opts.Output, 0700)
+	if err != nil {
+		return err
+	}
+	defer dir.Abort()
+
+	if err := dumpDir(ctx, sqlDB, dir.Path, threads, opts); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("directory dump interrupted: %w", ctx.Err())
+		}
+		return fmt.Errorf("directory dump failed: %w", classifyDriverError(err))
+	}
+
+	if err := dir.Commit(); err != nil {
+		return fmt.Errorf("save dump directory: %w", err)
+	}
+	return nil
+}
+
+func dumpDir(ctx context.Context, sqlDB *sql.DB, dir string, threads int, opts BackupOptions) error {
+	meta := DirMetadata{Version: 1, Database: opts.DBName, Started: time.Now().UTC()}
+
+	// The main connection reads the schema; the workers read rows.
+	conns := make([]*sql.Conn, threads+1)
+	for i := range conns {
+		conn, err := sqlDB.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		for _, stmt := range []string{"SET SESSION time_zone = '+00:00'", "SET SESSION sql_quote_show_create = 1"} {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("%s: %w", stmt, err)
+			}
+		}
+		conns[i] = conn
+	}
+
+	consistent, err := startSnapshots(ctx, conns, &meta)
+	if err != nil {
+		return err
+	}
+	meta.Consistent = consistent
+	for _, conn := range conns {
+		defer conn.ExecContext(context.WithoutCancel(ctx), "ROLLBACK")
+	}
+
+	main := &nativeDumper{conn: conns[0], schema: opts.DBName, opts: opts.Dump}
+	if err := main.conn.QueryRowContext(ctx, "SELECT VERSION()").Scan(&meta.ServerVersion); err != nil {
+		return fmt.Errorf("read server version: %w", err)
+	}
+
+	rows, err := main.queryStrings(ctx, "SHOW FULL TABLES FROM "+quoteIdent(opts.DBName))
+	if err != nil {
+		return fmt.Errorf("list tables: %w", err)
+	}
+	var names []string
+	isView := make(map[string]bool)
+	for _, r := range rows {
+		names = append(names, r[0])
+		isView[r[0]] = len(r) > 1 && r[1] == "VIEW"
+	}
+	plan, err := planTables(opts.DBName, names, opts.Tables)
+	if err != nil {
+		return err
+	}
+	schemaOnly := make(map[string]bool)
+	for _, t := range plan.schemaOnly {
+		schemaOnly[t] = true
+	}
+	selected := append(append(append([]string(nil), plan.full...), plan.schemaOnly...), plan.filtered...)
+	sort.Strings(selected)
+
+	chunkRows := opts.ChunkRows
+	if chunkRows < 1 {
+		chunkRows = DefaultChunkRows
+	}
+
+	var views []string
+	var chunks []dataChunk
+	meta.Tables = make([]DirTable, 0, len(selected))
+	for _, t := range selected {
+		if isView[t] {
+			views = append(views, t)
+			continue
+		}
+		meta.Tables = append(meta.Tables, DirTable{Name: t})
+	}
+
+	for i := range meta.Tables {
+		tbl := &meta.Tables[i]
+		if err := main.tableFiles(ctx, dir, tbl); err != nil {
+			return fmt.Errorf("table %s: %w", tbl.Name, err)
+		}
+		if schemaOnly[tbl.Name] {
+			continue
+		}
+		ranges, err := main.chunkRanges(ctx, tbl.Name, chunkRows)
+		if err != nil {
+			return fmt.Errorf("table %s: %w", tbl.Name, err)
+		}
+		for n, r := range ranges {
+			where := r
+			if w := plan.where[tbl.Name]; w != "" {
+				where = "(" + w + ")"
+				if r != "" {
+					where += " AND " + r
+				}
+			}
+			file := fmt.Sprintf("%s.%05d.sql.gz", fileName(tbl.Name), n)
+			tbl.Chunks = append(tbl.Chunks, file)
+			chunks = append(chunks, dataChunk{table: tbl, file: file, where: where})
+		}
+	}
+
+	if err := dumpChunks(ctx, conns[1:], dir, chunks, opts); err != nil {
+		return err
+	}
+
+	if err := main.postFiles(ctx, dir, views, &meta); err != nil {
+		return err
+	}
+
+	meta.Finished = time.Now().UTC()
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(filepath.Join(dir, metadataFile), data, ArtifactPerm)
+}
+
+// startSnapshots starts a consistent-snapshot transaction on every
+// connection. Under FLUSH TABLES WITH READ LOCK they all see the same point
+// in time, which is also recorded as the binlog position in meta. Without the
+// RELOAD privilege the lock is skipped and it reports false.
+func startSnapshots(ctx context.Context, conns []*sql.Conn, meta *DirMetadata) (bool, error) {
+	main := conns[0]
+	locked := true
+	if _, err := main.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+		console.Println("Warning: FLUSH TABLES WITH READ LOCK failed, threads may see slightly different snapshots:", err)
+		locked = false
+	}
+
+	for _, conn := range conns {
+		if _, err := conn.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+			return false, fmt.Errorf("set isolation level: %w", err)
+		}
+		if _, err := conn.ExecContext(ctx, "START TRANSACTION /*!40100 WITH CONSISTENT SNAPSHOT */"); err != nil {
+			return false, fmt.Errorf("start snapshot: %w", err)
+		}
+	}
+
+	if locked {
+		pos := currentBinlogPosition(ctx, main)
+		meta.BinlogFile, meta.BinlogPos, meta.GTIDExecuted = pos.File, pos.Pos, pos.GTIDExecuted
+		if _, err := main.ExecContext(ctx, "UNLOCK TABLES"); err != nil {
+			return false, fmt.Errorf("unlock tables: %w", err)
+		}
+	}
+	return locked, nil
+}
+
+// currentBinlogPosition returns the server's binlog coordinates, or a zero
+// position if binary logging is disabled.
+func currentBinlogPosition(ctx context.Context, conn *sql.Conn) BinlogPosition {
+	d := &nativeDumper{conn: conn}
+	var pos BinlogPosition
+	for _, query := range []string{"SHOW BINARY LOG STATUS", "SHOW MASTER STATUS"} {
+		rows, err := d.queryStrings(ctx, query)
+		if err != nil || len(rows) == 0 || len(rows[0]) < 2 {
+			continue
+		}
+		pos.File = rows[0][0]
+		pos.Pos, _ = strconv.ParseInt(rows[0][1], 10, 64)
+		if len(rows[0]) >= 5 {
+			pos.GTIDExecuted = strings.ReplaceAll(rows[0][4], "\n", "")
+		}
+		break
+	}
+	return pos
+}
+
+// tableFiles writes the schema, index and trigger files of tbl.
+func (d *nativeDumper) tableFiles(ctx context.Context, dir string, tbl *DirTable) error {
+	create, err := d.showCreate(ctx, "SHOW CREATE TABLE "+quoteIdent(tbl.Name), "Create Table")
+	if err != nil {
+		return err
+	}
+	table, indexes := splitIndexes(create)
+
+	tbl.Schema = fileName(tbl.Name) + "-schema.sql"
+	schema := fmt.Sprintf("DROP TABLE IF EXISTS %s;\n%s;\n", quoteIdent(tbl.Name), table)
+	if err := fsutil.WriteFile(filepath.Join(dir, tbl.Schema), []byte(schema), ArtifactPerm); err != nil {
+		return err
+	}
+
+	if len(indexes) > 0 {
+		tbl.Indexes = fileName(tbl.Name) + "-indexes.sql"
+		alter := fmt.Sprintf("ALTER TABLE %s\n  ADD %s;\n", quoteIdent(tbl.Name), strings.Join(indexes, ",\n  ADD "))
+		if err := fsutil.WriteFile(filepath.Join(dir, tbl.Indexes), []byte(alter), ArtifactPerm); err != nil {
+			return err
+		}
+	}
+
+	if !d.opts.Triggers {
+		return nil
+	}
+	return d.writeFile(ctx, dir, fileName(tbl.Name)+"-triggers.sql", &tbl.Triggers, func() error {
+		return d.triggers(ctx, tbl.Name)
+	})
+}
+
+// postFiles writes views, routines and events, which may refer to any table.
+func (d *nativeDumper) postFiles(ctx context.Context, dir string, views []string, meta *DirMetadata) error {
+	var name string
+	if err := d.writeFile(ctx, dir, "views.sql", &name, func() error { return d.views(ctx, views) }); err != nil {
+		return err
+	}
+	if name != "" {
+		meta.Post = append(meta.Post, name)
+	}
+
+	name = ""
+	err := d.writeFile(ctx, dir, "routines.sql", &name, func() error {
+		if d.opts.Routines {
+			if err := d.routines(ctx); err != nil {
+				return err
+			}
+		}
+		if d.opts.Events {
+			return d.events(ctx)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		meta.Post = append(meta.Post, name)
+	}
+	return nil
+}
+
+// writeFile runs write with d.w pointed at a new file in dir. The file is
+// only kept, and *name set, if write produced output.
+func (d *nativeDumper) writeFile(ctx context.Context, dir, file string, name *string, write func() error) error {
+	var buf strings.Builder
+	bw := bufio.NewWriter(&buf)
+	d.w = bw
+	defer func() { d.w = nil }()
+
+	if err := write(); err != nil {
+		return err
+	}
+	bw.Flush()
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	*name = file
+	return fsutil.WriteFile(filepath.Join(dir, file), []byte(buf.String()), ArtifactPerm)
+}
+
+// chunkRanges returns WHERE conditions splitting t into key ranges of about
+// chunkRows rows, or a single "" (the whole table) if t is small or has no
+// single-column integer primary key.
+func (d *nativeDumper) chunkRanges(ctx context.Context, t string, chunkRows int64) ([]string, error) {
+	cols, err := d.columns(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	var pk []column
+	for _, c := range cols {
+		if c.primary {
+			pk = append(pk, c)
+		}
+	}
+	if len(pk) != 1 || !strings.Contains(pk[0].dataType, "int") {
+		return []string{""}, nil
+	}
+
+	rows, err := d.queryStrings(ctx, fmt.Sprintf(
+		"SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = %s AND TABLE_NAME = %s",
+		quoteString(d.schema), quoteString(t)))
+	if err != nil || len(rows) == 0 {
+		return []string{""}, err
+	}
+	estimate, _ := strconv.ParseInt(rows[0][0], 10, 64)
+	if estimate <= chunkRows {
+		return []string{""}, nil
+	}
+
+	key := quoteIdent(pk[0].name)
+	bounds, err := d.queryStrings(ctx, fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s", key, key, quoteIdent(t)))
+	if err != nil {
+		return nil, err
+	}
+	lo, err1 := strconv.ParseInt(bounds[0][0], 10, 64)
+	hi, err2 := strconv.ParseInt(bounds[0][1], 10, 64)
+	if err1 != nil || err2 != nil || hi-lo < 0 {
+		return []string{""}, nil // empty, or unsigned keys beyond int64
+	}
+
+	n := (estimate + chunkRows - 1) / chunkRows
+	step := (hi-lo)/n + 1
+
+	// The first and last ranges are open so no row is missed if the
+	// threads' snapshots differ.
+	ranges := make([]string, n)
+	for i := range n {
+		start := lo + i*step
+		switch {
+		case n == 1:
+			ranges[i] = ""
+		case i == 0:
+			ranges[i] = fmt.Sprintf("%s < %d", key, start+step)
+		case i == n-1:
+			ranges[i] = fmt.Sprintf("%s >= %d", key, start)
+		default:
+			ranges[i] = fmt.Sprintf("%s >= %d AND %s < %d", key, start, key, start+step)
+		}
+	}
+	return ranges, nil
+}
+
+// dumpChunks writes the chunks with one worker per connection.
+func dumpChunks(ctx context.Context, conns []*sql.Conn, dir string, chunks []dataChunk, opts BackupOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan dataChunk)
+	errs := make(chan error, len(conns))
+	var mu sync.Mutex // guards DirTable.Rows
+	var wg sync.WaitGroup
+
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *sql.Conn) {
+			defer wg.Done()
+			d := &nativeDumper{conn: conn, schema: opts.DBName, opts: opts.Dump, limit: opts.DumpLimit}
+			for c := range work {
+				n, err := d.writeChunk(ctx, dir, c)
+				if err != nil {
+					errs <- fmt.Errorf("table %s: %w", c.table.Name, err)
+					cancel()
+					return
+				}
+				mu.Lock()
+				c.table.Rows += n
+				mu.Unlock()
+				console.Printf("  dumped %s: %d rows\n", c.file, n)
+			}
+		}(conn)
+	}
+
+feed:
+	for _, c := range chunks {
+		select {
+		case work <- c:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// writeChunk writes the rows of c to a gzipped file and returns their count.
+func (d *nativeDumper) writeChunk(ctx context.Context, dir string, c dataChunk) (int64, error) {
+	f, err := fsutil.Create(filepath.Join(dir, c.file), ArtifactPerm)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Abort()
+
+	gw := gzip.NewWriter(f)
+	d.w = bufio.NewWriterSize(dumpWriter(ctx, gw, d.limit), insertBatchBytes)
+	defer func() { d.w = nil }()
+
+	n, err := d.tableData(ctx, c.table.Name, c.where)
+	if err != nil {
+		return n, err
+	}
+	if err := d.w.Flush(); err != nil {
+		return n, err
+	}
+	if err := gw.Close(); err != nil {
+		return n, err
+	}
+	return n, f.Commit()
+}
+
+// splitIndexes separates the secondary indexes and foreign keys of a CREATE
+// TABLE statement, returned as ALTER TABLE ADD clauses, from the rest. The
+// primary key and any index on the AUTO_INCREMENT column stay in the table.
+func splitIndexes(create string) (string, []string) {
+	lines := strings.Split(create, "\n")
+	if len(lines) < 3 {
+		return create, nil
+	}
+
+	var autoCol string
+	for _, l := range lines[1 : len(lines)-1] {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "`") && strings.Contains(l, " AUTO_INCREMENT") {
+			autoCol = l[:strings.Index(l[1:], "`")+2]
+		}
+	}
+
+	var body, indexes []string
+	for _, l := range lines[1 : len(lines)-1] {
+		def := strings.TrimSuffix(strings.TrimSpace(l), ",")
+		isIndex := false
+		for _, prefix := range []string{"KEY ", "UNIQUE KEY ", "FULLTEXT KEY ", "SPATIAL KEY ", "CONSTRAINT "} {
+			if strings.HasPrefix(def, prefix) {
+				isIndex = true
+			}
+		}
+		if isIndex && (autoCol == "" || !strings.Contains(def, "("+autoCol)) {
+			indexes = append(indexes, def)
+			continue
+		}
+		body = append(body, "  "+def)
+	}
+
+	return lines[0] + "\n" + strings.Join(body, ",\n") + "\n" + lines[len(lines)-1], indexes
+}
+
+// fileName makes a table name safe to use in a file name.
+func fileName(table string) string {
+	return url.PathEscape(table)
+}
@@ -0,0 +1,307 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+	"github.com/bhagashetti/db-backup-cli/internal/progress"
+)
+
+// loadSession prepares each restore connection for a bulk load.
+var loadSession = []string{
+	"SET NAMES utf8mb4",
+	"SET SESSION time_zone = '+00:00'",
+	"SET SESSION foreign_key_checks = 0",
+	"SET SESSION unique_checks = 0",
+	"SET SESSION sql_mode = 'NO_AUTO_VALUE_ON_ZERO'",
+}
+
+// isDirBackup reports whether path is a directory-format backup or a tar of
+// one.
+func isDirBackup(path string) bool {
+	if strings.HasSuffix(path, ".tar") {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(path, metadataFile))
+	return err == nil
+}
+
+// mysqlDirRestore loads a directory-format backup with opts.Threads
+// connections: table schemas first, then data chunks in parallel, then
+// indexes and triggers in parallel, then views, routines and events.
+func mysqlDirRestore(ctx context.Context, opts RestoreOptions) error {
+	dir := opts.Input
+	if strings.HasSuffix(dir, ".tar") {
+		tmp, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+".*.tmp")
+		if err != nil {
+			return fmt.Errorf("create directory to unpack %s: %w", dir, err)
+		}
+		defer os.RemoveAll(tmp)
+		if err := untarDir(ctx, dir, tmp); err != nil {
+			return err
+		}
+		dir = tmp
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, metadataFile))
+	if err != nil {
+		return fmt.Errorf("read backup metadata: %w", err)
+	}
+	var meta DirMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return fmt.Errorf("parse %s: %w", metadataFile, err)
+	}
+
+	threads := opts.Threads
+	if threads < 1 {
+		threads = DefaultThreads
+	}
+	console.Printf("Restoring %d tables of %s from %s with %d threads\n", len(meta.Tables), meta.Database, opts.Input, threads)
+
+	sqlDB, err := openMySQL(ctx, opts.Host, opts.Port, opts.User, opts.Password, opts.DBName)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(threads)
+
+	conns := make([]*sql.Conn, threads)
+	for i := range conns {
+		conn, err := sqlDB.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("open restore connection: %w", classifyDriverError(err))
+		}
+		defer conn.Close()
+		for _, stmt := range loadSession {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("%s: %w", stmt, err)
+			}
+		}
+		conns[i] = conn
+	}
+
+	var schema, chunks, post [][]string
+	for _, t := range meta.Tables {
+		schema = append(schema, []string{t.Schema})
+		for _, c := range t.Chunks {
+			chunks = append(chunks, []string{c})
+		}
+		var p []string
+		for _, f := range []string{t.Indexes, t.Triggers} {
+			if f != "" {
+				p = append(p, f)
+			}
+		}
+		if len(p) > 0 {
+			post = append(post, p)
+		}
+	}
+	sortBySize(dir, chunks)
+
+	phases := []struct {
+		name  string
+		tasks [][]string
+		conns []*sql.Conn
+	}{
+		{"schema", schema, conns[:1]},
+		{"data", chunks, conns},
+		{"indexes", post, conns},
+		{"views and routines", [][]string{meta.Post}, conns[:1]},
+	}
+	for _, phase := range phases {
+		start := time.Now()
+		if err := loadFiles(ctx, phase.conns, dir, phase.tasks); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("directory restore interrupted: %w", ctx.Err())
+			}
+			return fmt.Errorf("directory restore failed loading %s: %w", phase.name, classifyDriverError(err))
+		}
+		console.Printf("  %s loaded in %s\n", phase.name, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// loadFiles runs the tasks with one worker per connection. The files of a
+// task are loaded in order on the same connection.
+func loadFiles(ctx context.Context, conns []*sql.Conn, dir string, tasks [][]string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan []string)
+	errs := make(chan error, len(conns))
+	var wg sync.WaitGroup
+
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *sql.Conn) {
+			defer wg.Done()
+			for task := range work {
+				for _, file := range task {
+					if err := loadFile(ctx, conn, filepath.Join(dir, file)); err != nil {
+						errs <- fmt.Errorf("%s: %w", file, err)
+						cancel()
+						return
+					}
+				}
+			}
+		}(conn)
+	}
+
+feed:
+	for _, task := range tasks {
+		select {
+		case work <- task:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// loadFile executes one SQL file of a backup, gunzipping it if needed.
+func loadFile(ctx context.Context, conn *sql.Conn, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	return execScript(ctx, conn, contextReader{ctx, r}, nil)
+}
+
+// sortBySize orders single-file tasks largest first, so the biggest chunks
+// do not end up running alone at the end.
+func sortBySize(dir string, tasks [][]string) {
+	size := make(map[string]int64, len(tasks))
+	for _, t := range tasks {
+		if info, err := os.Stat(filepath.Join(dir, t[0])); err == nil {
+			size[t[0]] = info.Size()
+		}
+	}
+	sort.SliceStable(tasks, func(i, j int) bool { return size[tasks[i][0]] > size[tasks[j][0]] })
+}
+
+// TarDir packs the files of a directory-format backup into one tar file, so
+// it can go through the encryption and upload stages. dst only appears once
+// it is complete.
+func TarDir(ctx context.Context, src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", src, err)
+	}
+
+	out, err := fsutil.Create(dst, ArtifactPerm)
+	if err != nil {
+		return fmt.Errorf("create tar: %w", err)
+	}
+	defer out.Abort()
+
+	tw := tar.NewWriter(progress.FromContext(ctx).Writer(out))
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if err := addToTar(ctx, tw, filepath.Join(src, e.Name())); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("close tar: %w", err)
+	}
+
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("save tar: %w", err)
+	}
+	return nil
+}
+
+func addToTar(ctx context.Context, tw *tar.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("tar %s: %w", path, err)
+	}
+	if _, err := io.Copy(tw, contextReader{ctx, f}); err != nil {
+		return fmt.Errorf("tar %s: %w", path, err)
+	}
+	return nil
+}
+
+// untarDir unpacks a tar made by TarDir into dst. Only plain files without
+// directory components are accepted.
+func untarDir(ctx context.Context, src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", src, err)
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", src, err)
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Name != filepath.Base(hdr.Name) || hdr.Name == ".." {
+			return fmt.Errorf("%s: unexpected entry %q in backup tar", src, hdr.Name)
+		}
+
+		out, err := os.OpenFile(filepath.Join(dst, hdr.Name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, ArtifactPerm)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, contextReader{ctx, tr})
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("unpack %s: %w", hdr.Name, err)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDumpOptions reports dump options that would break the backup pipeline.
+var ErrDumpOptions = errors.New("invalid dump options")
+
+// DumpOptions controls how mysqldump reads the database.
+type DumpOptions struct {
+	SingleTransaction bool // consistent InnoDB snapshot without locking tables
+	Routines          bool // stored procedures and functions
+	Triggers          bool
+	Events            bool
+	HexBlob           bool // binary columns as hex literals
+
+	// SetGTIDPurged is passed as --set-gtid-purged. Empty means OFF when the
+	// server has gtid_mode=ON, so the dump restores into any server, and the
+	// flag is left out otherwise (e.g. MariaDB, whose mysqldump lacks it).
+	SetGTIDPurged string
+
+	ExtraArgs []string // passed to mysqldump before the database name
+
+	// RecordPosition records the binlog position (and GTID set) of the
+	// dump's snapshot for point-in-time recovery. It needs the RELOAD and
+	// REPLICATION CLIENT privileges and binary logging on the server.
+	RecordPosition bool
+}
+
+// DefaultDumpOptions returns the options used unless a job overrides them.
+func DefaultDumpOptions() DumpOptions {
+	return DumpOptions{
+		SingleTransaction: true,
+		Routines:          true,
+		Triggers:          true,
+		Events:            true,
+		HexBlob:           true,
+	}
+}
+
+// gtidPurgedValues are the values mysqldump accepts for --set-gtid-purged.
+var gtidPurgedValues = []string{"OFF", "ON", "AUTO", "COMMENTED"}
+
+// deniedLongArgs are mysqldump options that would send the dump somewhere
+// other than stdout, change its format, or fight with options this tool sets.
+// Long options may be abbreviated to a unique prefix, so prefixes are denied too.
+var deniedLongArgs = []string{
+	"result-file", "tab", "xml", "databases", "all-databases", "tables", "where",
+	"host", "port", "user", "password", "set-gtid-purged",
+	"defaults-file", "defaults-extra-file", "no-defaults", "print-defaults",
+	"help", "version",
+}
+
+// deniedShortArgs are the single-letter forms of deniedLongArgs.
+const deniedShortArgs = "rTXBAwhPup?V"
+
+// valueShortArgs are the single-letter options that take the rest of their
+// argument as a value, so a cluster such as -qS/tmp/my.sock ends there.
+const valueShortArgs = "#hpPrSTuw"
+
+// Validate checks SetGTIDPurged and ExtraArgs.
+func (d DumpOptions) Validate() error {
+	var problems []string
+
+	if d.SetGTIDPurged != "" && !containsFold(gtidPurgedValues, d.SetGTIDPurged) {
+		problems = append(problems, fmt.Sprintf("setGtidPurged %q (want %s)", d.SetGTIDPurged, strings.Join(gtidPurgedValues, ", ")))
+	}
+
+	for _, arg := range d.ExtraArgs {
+		if reason := deniedArg(arg); reason != "" {
+			problems = append(problems, fmt.Sprintf("extraArgs %q: %s", arg, reason))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrDumpOptions, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// deniedArg returns why arg may not be passed to mysqldump, or "" if it may.
+func deniedArg(arg string) string {
+	switch {
+	case !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--":
+		return "positional arguments are not allowed"
+	case strings.HasPrefix(arg, "--"):
+		name, _, _ := strings.Cut(arg[2:], "=")
+		for _, prefix := range []string{"loose-", "skip-", "disable-", "enable-"} {
+			name = strings.TrimPrefix(name, prefix)
+		}
+		for _, denied := range deniedLongArgs {
+			if strings.HasPrefix(denied, name) {
+				return "--" + denied + " is set by this tool or breaks the backup pipeline"
+			}
+		}
+	default:
+		for _, c := range arg[1:] {
+			if strings.ContainsRune(deniedShortArgs, c) {
+				return "-" + string(c) + " is set by this tool or breaks the backup pipeline"
+			}
+			if strings.ContainsRune(valueShortArgs, c) {
+				break
+			}
+		}
+	}
+	return ""
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// stepArgs returns the options for one mysqldump invocation of a dump.
+// Routines and events belong to the database, so only the first invocation
+// includes them, and only the first records the binlog position, with
+// position (see positionOption), or GTID_PURGED.
+func (d DumpOptions) stepArgs(first bool, gtidPurged, position string) []string {
+	var args []string
+	if d.SingleTransaction {
+		args = append(args, "--single-transaction")
+	}
+	if d.Routines && first {
+		args = append(args, "--routines")
+	}
+	if !d.Triggers {
+		args = append(args, "--skip-triggers")
+	}
+	if d.Events && first {
+		args = append(args, "--events")
+	}
+	if d.HexBlob {
+		args = append(args, "--hex-blob")
+	}
+	if position != "" && first {
+		args = append(args, position+"=2")
+	}
+	if gtidPurged != "" {
+		if !first {
+			gtidPurged = "OFF"
+		}
+		args = append(args, "--set-gtid-purged="+strings.ToUpper(gtidPurged))
+	}
+	return append(args, d.ExtraArgs...)
+}
+
+// gtidPurged resolves the --set-gtid-purged value for a dump. An explicit
+// setting wins; otherwise the server's gtid_mode decides. A dump recording
+// its position gets the GTID set as a comment, so it still restores anywhere.
+func gtidPurged(ctx context.Context, opts BackupOptions) string {
+	if opts.Dump.SetGTIDPurged != "" {
+		return opts.Dump.SetGTIDPurged
+	}
+	rows, err := mysqlQuery(ctx, opts, "", "SELECT @@GLOBAL.gtid_mode")
+	if err != nil || len(rows) == 0 || !strings.EqualFold(rows[0], "ON") {
+		return ""
+	}
+	if opts.Dump.RecordPosition {
+		return "COMMENTED"
+	}
+	return "OFF"
+}
+
+// positionOption returns the mysqldump option that records the binlog
+// position of a dump, or "" if opts does not record it. mysqldump 8.0.26
+// renamed --master-data to --source-data; older clients and MariaDB's only
+// know the old name. The option is the client's, so the version of
+// mysqldump decides; the server's is asked only if that cannot be read.
+func positionOption(ctx context.Context, opts BackupOptions) string {
+	if !opts.Dump.RecordPosition {
+		return ""
+	}
+	var client, server string
+	if out, err := newCommand(ctx, "mysqldump", "--version").Output(); err == nil {
+		client = mysqldumpVersion(string(out))
+	}
+	if client == "" {
+		if rows, err := mysqlQuery(ctx, opts, "", "SELECT VERSION()"); err == nil && len(rows) > 0 {
+			server = rows[0]
+		}
+	}
+	return choosePositionOption(client, server)
+}
+
+// choosePositionOption returns the position option for a mysqldump of
+// version client dumping a server of version server; either may be ""
+// if unknown. The client's version wins, and the new name is used if
+// neither is known.
+func choosePositionOption(client, server string) string {
+	version := client
+	if version == "" {
+		version = server
+	}
+	if version == "" || hasSourceData(version) {
+		return "--source-data"
+	}
+	return "--master-data"
+}
+
+// mysqldumpVersion returns the version in the output of mysqldump
+// --version, or "" if it has none. The forms are:
+//
+//	mysqldump  Ver 8.0.36 for Linux on x86_64 (MySQL Community Server - GPL)
+//	mysqldump  Ver 10.13 Distrib 5.7.44, for Linux (x86_64)
+//	mysqldump  Ver 10.19 Distrib 10.6.16-MariaDB, for debian-linux-gnu (x86_64)
+//	mysqldump from 11.4.2-MariaDB, client 10.19 for debian-linux-gnu (x86_64)
+func mysqldumpVersion(out string) string {
+	fields := strings.Fields(out)
+	for _, key := range []string{"Distrib", "from", "Ver"} {
+		for i, f := range fields[:max(len(fields)-1, 0)] {
+			if f == key {
+				return strings.TrimRight(fields[i+1], ",")
+			}
+		}
+	}
+	return ""
+}
+
+// hasSourceData reports whether version, of mysqldump or of a server as
+// returned by SELECT VERSION(), names the option --source-data.
+func hasSourceData(version string) bool {
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		return false
+	}
+	var major, minor, patch int
+	fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch)
+	switch {
+	case major != 8:
+		return major > 8
+	case minor != 0:
+		return true
+	}
+	return patch >= 26
+}
@@ -0,0 +1,200 @@
+package backup
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDeniedArg(t *testing.T) {
+	tests := []struct {
+		arg    string
+		denied bool
+	}{
+		{"--quick", false},
+		{"--compact", false},
+		{"--no-data", false},
+		{"--skip-lock-tables", false},
+		{"--max-allowed-packet=1G", false},
+		{"--column-statistics=0", false},
+		{"--result-file=/tmp/x.sql", true},
+		{"--tab=/tmp", true},
+		{"--xml", true},
+		{"--databases", true},
+		{"--where=1=1", true},
+		{"--password=secret", true},
+		{"--set-gtid-purged=ON", true},
+		{"--defaults-extra-file=my.cnf", true},
+		{"--version", true},
+		{"--skip-set-gtid-purged", true},
+		{"--loose-result-file=x", true},
+		{"--enable-xml", true},
+		{"--res", true}, // abbreviation of --result-file
+		{"--ta", true},  // ambiguous between --tab and --tables
+		{"--h", true},
+		{"-q", false},
+		{"-K", false},
+		{"-qK", false},
+		{"-r/tmp/x.sql", true},
+		{"-qr/tmp/x.sql", true}, // a cluster is checked as a whole
+		{"-Kp", true},
+		{"-X", true},
+		{"-?", true},
+		{"-S/tmp/mysql.sock", false}, // the value ends the cluster
+		{"-qS/tmp/rp.sock", false},
+		{"-#d:t:o,/tmp/trace", false},
+		{"shop", true},
+		{"-", true},
+		{"--", true},
+	}
+	for _, tt := range tests {
+		if got := deniedArg(tt.arg); (got != "") != tt.denied {
+			t.Errorf("deniedArg(%q) = %q, want denied %v", tt.arg, got, tt.denied)
+		}
+	}
+}
+
+func TestDumpOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    DumpOptions
+		wantErr bool
+	}{
+		{"defaults", DefaultDumpOptions(), false},
+		{"gtid purged", DumpOptions{SetGTIDPurged: "auto"}, false},
+		{"bad gtid purged", DumpOptions{SetGTIDPurged: "maybe"}, true},
+		{"extra args", DumpOptions{ExtraArgs: []string{"--quick", "-K"}}, false},
+		{"denied extra arg", DumpOptions{ExtraArgs: []string{"--quick", "--tab=/tmp"}}, true},
+	}
+	for _, tt := range tests {
+		err := tt.opts.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrDumpOptions) {
+			t.Errorf("%s: error %v is not ErrDumpOptions", tt.name, err)
+		}
+	}
+}
+
+func TestStepArgs(t *testing.T) {
+	opts := DefaultDumpOptions()
+	opts.ExtraArgs = []string{"--quick"}
+	tests := []struct {
+		name       string
+		opts       DumpOptions
+		first      bool
+		gtidPurged string
+		position   string
+		want       []string
+	}{
+		{
+			name:  "first",
+			opts:  opts,
+			first: true,
+			want:  []string{"--single-transaction", "--routines", "--events", "--hex-blob", "--quick"},
+		},
+		{
+			name: "later steps skip database objects",
+			opts: opts,
+			want: []string{"--single-transaction", "--hex-blob", "--quick"},
+		},
+		{
+			name:       "position and gtid",
+			opts:       opts,
+			first:      true,
+			gtidPurged: "commented",
+			position:   "--master-data",
+			want:       []string{"--single-transaction", "--routines", "--events", "--hex-blob", "--master-data=2", "--set-gtid-purged=COMMENTED", "--quick"},
+		},
+		{
+			name:       "only the first step records the position",
+			opts:       opts,
+			gtidPurged: "ON",
+			position:   "--source-data",
+			want:       []string{"--single-transaction", "--hex-blob", "--set-gtid-purged=OFF", "--quick"},
+		},
+		{
+			name:  "everything off",
+			first: true,
+			want:  []string{"--skip-triggers"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.opts.stepArgs(tt.first, tt.gtidPurged, tt.position)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stepArgs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasSourceData(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"8.0.26", true},
+		{"8.0.36-log", true},
+		{"8.0.25", false},
+		{"8.0.4-rc", false},
+		{"8.4.0", true},
+		{"9.1.0", true},
+		{"5.7.44-log", false},
+		{"5.6.51", false},
+		{"10.11.6-MariaDB", false},
+		{"11.4.2-MariaDB-ubu2404", false},
+		{"5.5.5-10.6.16-MariaDB-log", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := hasSourceData(tt.version); got != tt.want {
+			t.Errorf("hasSourceData(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestMysqldumpVersion(t *testing.T) {
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{"mysqldump  Ver 8.0.36 for Linux on x86_64 (MySQL Community Server - GPL)\n", "8.0.36"},
+		{"mysqldump  Ver 8.4.0 for macos14 on arm64 (Homebrew)", "8.4.0"},
+		{"mysqldump  Ver 10.13 Distrib 5.7.44, for Linux (x86_64)", "5.7.44"},
+		{"mysqldump  Ver 10.19 Distrib 10.6.16-MariaDB, for debian-linux-gnu (x86_64)", "10.6.16-MariaDB"},
+		{"mysqldump from 11.4.2-MariaDB, client 10.19 for debian-linux-gnu (x86_64)", "11.4.2-MariaDB"},
+		{"mysqldump: unknown option", ""},
+		{"Ver", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := mysqldumpVersion(tt.out); got != tt.want {
+			t.Errorf("mysqldumpVersion(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestChoosePositionOption(t *testing.T) {
+	tests := []struct {
+		name           string
+		client, server string
+		want           string
+	}{
+		{"both new", "8.0.36", "8.0.36", "--source-data"},
+		{"both old", "5.7.44", "5.7.44", "--master-data"},
+		{"old client, new server", "5.7.44", "8.0.36", "--master-data"},
+		{"new client, old server", "8.0.36", "5.7.44-log", "--source-data"},
+		{"MariaDB client, MySQL server", "10.6.16-MariaDB", "8.4.0", "--master-data"},
+		{"MySQL client, MariaDB server", "8.4.0", "5.5.5-10.11.6-MariaDB", "--source-data"},
+		{"unknown client, old server", "", "5.7.44", "--master-data"},
+		{"unknown client, new server", "", "8.0.36", "--source-data"},
+		{"nothing known", "", "", "--source-data"},
+	}
+	for _, tt := range tests {
+		if got := choosePositionOption(tt.client, tt.server); got != tt.want {
+			t.Errorf("%s: choosePositionOption(%q, %q) = %q, want %q", tt.name, tt.client, tt.server, got, tt.want)
+		}
+	}
+}
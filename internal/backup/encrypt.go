@@ -1,55 +1,379 @@
 package backup
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+	"github.com/bhagashetti/db-backup-cli/internal/progress"
 )
 
-// EncryptFile encrypts src into dst using AES-256-GCM with the given key bytes.
-func EncryptFile(src, dst string, key []byte) error {
+// Encrypted files are AES-256-GCM in chunks, so files of any size are
+// encrypted and decrypted in constant memory. A file is a header, then the
+// sealed chunks:
+//
+//	"DBBAEAD" | version (1 byte) | chunk size (uint32) | nonce prefix (7 bytes)
+//	chunk 0 | chunk 1 | ... | final chunk
+//
+// Each chunk holds chunk size bytes of plaintext, except the final one,
+// which holds the rest and may be empty. Its nonce is the prefix, the
+// chunk's number as a uint32 and a byte that is 1 for the final chunk only,
+// and the header is its additional data. Chunks cannot be reordered,
+// dropped or taken from another file, and a file cut at a chunk boundary
+// fails to decrypt instead of looking complete.
+var encMagic = []byte("DBBAEAD")
+
+const (
+	encVersion     = 1
+	encChunkSize   = 1 << 20
+	encPrefixSize  = 7
+	encHeaderSize  = len("DBBAEAD") + 1 + 4 + encPrefixSize
+	maxEncChunk    = 64 << 20 // larger chunk sizes in a header are damage
+	maxLegacyInput = 64 << 30 // GCM's limit on one message, about 64 GiB
+)
+
+// ErrDecrypt is returned when a file fails authentication: the key is wrong
+// or the file is damaged or truncated.
+var ErrDecrypt = errors.New("wrong key or damaged file")
+
+// newGCM returns AES-256-GCM for key.
+func newGCM(key []byte) (cipher.AEAD, error) {
 	if len(key) != 32 {
-		return fmt.Errorf("encryption key must be 32 bytes for AES-256")
+		return nil, fmt.Errorf("encryption key must be 32 bytes for AES-256")
 	}
-
-	plaintext, err := os.ReadFile(src)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("new cipher: %w", err)
+	}
+	aesgcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return fmt.Errorf("read src for encrypt: %w", err)
+		return nil, fmt.Errorf("new GCM: %w", err)
 	}
+	return aesgcm, nil
+}
 
-	block, err := aes.NewCipher(key)
+// chunkNonce returns the nonce of chunk n of a file with the given prefix.
+func chunkNonce(nonce, prefix []byte, n uint32, final bool) []byte {
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encPrefixSize:], n)
+	nonce[encPrefixSize+4] = 0
+	if final {
+		nonce[encPrefixSize+4] = 1
+	}
+	return nonce
+}
+
+// encryptWriter seals what is written to it chunk by chunk.
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	nonce  []byte
+	buf    []byte // plaintext of the chunk being filled
+	sealed []byte
+	n      uint32
+	closed bool
+}
+
+// NewEncryptWriter returns a writer that encrypts what is written to it
+// into w with the 32-byte key. Close must be called to write the final
+// chunk; it does not close w.
+func NewEncryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	aesgcm, err := newGCM(key)
 	if err != nil {
-		return fmt.Errorf("new cipher: %w", err)
+		return nil, err
 	}
 
-	aesgcm, err := cipher.NewGCM(block)
+	header := make([]byte, 0, encHeaderSize)
+	header = append(header, encMagic...)
+	header = append(header, encVersion)
+	header = binary.BigEndian.AppendUint32(header, encChunkSize)
+	prefix := make([]byte, encPrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, fmt.Errorf("read nonce: %w", err)
+	}
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+
+	return &encryptWriter{
+		w:      w,
+		aead:   aesgcm,
+		header: header,
+		nonce:  make([]byte, aesgcm.NonceSize()),
+		buf:    make([]byte, 0, encChunkSize),
+		sealed: make([]byte, 0, encChunkSize+aesgcm.Overhead()),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+	var written int
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, so that the
+		// final chunk is always the one sealed by Close.
+		if len(e.buf) == cap(e.buf) {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals and writes the final chunk.
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	if !final && e.n == math.MaxUint32 {
+		return fmt.Errorf("encrypt: input exceeds %d chunks of %d bytes", uint64(math.MaxUint32)+1, encChunkSize)
+	}
+	nonce := chunkNonce(e.nonce, e.header[encHeaderSize-encPrefixSize:], e.n, final)
+	e.sealed = e.aead.Seal(e.sealed[:0], nonce, e.buf, e.header)
+	if _, err := e.w.Write(e.sealed); err != nil {
+		return fmt.Errorf("write ciphertext: %w", err)
+	}
+	e.buf = e.buf[:0]
+	e.n++
+	return nil
+}
+
+// decryptReader opens the chunks of an encrypted stream as they are read.
+type decryptReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	nonce  []byte
+	sealed []byte
+	opened []byte
+	plain  []byte // opened plaintext not yet returned
+	n      uint32
+	err    error
+}
+
+// NewDecryptReader returns a reader of the plaintext of r, which was
+// written by NewEncryptWriter with the same key. Reading fails with an
+// error wrapping ErrDecrypt if any chunk does not authenticate, or if the
+// stream ends before its final chunk.
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	aesgcm, err := newGCM(key)
 	if err != nil {
-		return fmt.Errorf("new GCM: %w", err)
+		return nil, err
 	}
 
-	nonce := make([]byte, aesgcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return fmt.Errorf("read nonce: %w", err)
+	header := make([]byte, encHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: header: %w", ErrDecrypt, err)
 	}
+	if !bytes.Equal(header[:len(encMagic)], encMagic) {
+		return nil, fmt.Errorf("%w: not an encrypted backup", ErrDecrypt)
+	}
+	if v := header[len(encMagic)]; v != encVersion {
+		return nil, fmt.Errorf("encrypted backup format version %d is not supported", v)
+	}
+	chunk := binary.BigEndian.Uint32(header[len(encMagic)+1:])
+	if chunk == 0 || chunk > maxEncChunk {
+		return nil, fmt.Errorf("%w: chunk size %d", ErrDecrypt, chunk)
+	}
+
+	return &decryptReader{
+		r:      bufio.NewReaderSize(r, 1<<20),
+		aead:   aesgcm,
+		header: header,
+		nonce:  make([]byte, aesgcm.NonceSize()),
+		sealed: make([]byte, int(chunk)+aesgcm.Overhead()),
+		opened: make([]byte, 0, chunk),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.open()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
 
-	ciphertext := aesgcm.Seal(nil, nonce, plaintext, nil)
+// open reads and opens the next chunk. It returns io.EOF after the final
+// chunk.
+func (d *decryptReader) open() error {
+	if d.opened == nil {
+		return io.EOF
+	}
+	n, err := io.ReadFull(d.r, d.sealed)
+	var final bool
+	switch {
+	case err == nil:
+		// A full chunk is the final one only if nothing follows it.
+		_, perr := d.r.Peek(1)
+		if perr != nil && perr != io.EOF {
+			return perr
+		}
+		final = perr == io.EOF
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		final = true
+	default:
+		return err
+	}
+	if n < d.aead.Overhead() {
+		return fmt.Errorf("%w: truncated after chunk %d", ErrDecrypt, d.n)
+	}
+	if !final && d.n == math.MaxUint32 {
+		return fmt.Errorf("%w: too many chunks", ErrDecrypt)
+	}
 
-	// write nonce + ciphertext to dst
-	f, err := os.Create(dst)
+	nonce := chunkNonce(d.nonce, d.header[encHeaderSize-encPrefixSize:], d.n, final)
+	plain, err := d.aead.Open(d.opened[:0], nonce, d.sealed[:n], d.header)
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d", ErrDecrypt, d.n)
+	}
+	d.plain = plain
+	d.n++
+	if final {
+		d.opened = nil
+	}
+	return nil
+}
+
+// EncryptFile encrypts src into dst using AES-256-GCM with the given key bytes.
+// dst only appears once it is complete; on failure or cancellation nothing is
+// left behind.
+func EncryptFile(ctx context.Context, src, dst string, key []byte) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open src for encrypt: %w", err)
+	}
+	defer in.Close()
+
+	f, err := fsutil.Create(dst, ArtifactPerm)
 	if err != nil {
 		return fmt.Errorf("create dst for encrypt: %w", err)
 	}
-	defer f.Close()
+	defer f.Abort()
 
-	if _, err := f.Write(nonce); err != nil {
-		return fmt.Errorf("write nonce: %w", err)
+	bw := bufio.NewWriterSize(f, 1<<20)
+	ew, err := NewEncryptWriter(bw, key)
+	if err != nil {
+		return err
+	}
+	stage := progress.FromContext(ctx)
+	if _, err := io.Copy(ew, stage.Reader(contextReader{ctx, in})); err != nil {
+		return fmt.Errorf("encrypt: %w", err)
+	}
+	if err := ew.Close(); err != nil {
+		return err
 	}
-	if _, err := f.Write(ciphertext); err != nil {
+	if err := bw.Flush(); err != nil {
 		return fmt.Errorf("write ciphertext: %w", err)
 	}
 
+	if err := f.Commit(); err != nil {
+		return fmt.Errorf("save encrypted file: %w", err)
+	}
+	return nil
+}
+
+// DecryptFile reverses EncryptFile: it writes the plaintext of src to dst.
+// A wrong key or a damaged file fails authentication and leaves nothing
+// behind. Files written by earlier versions, a nonce and one GCM message,
+// are still read.
+func DecryptFile(ctx context.Context, src, dst string, key []byte) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open src for decrypt: %w", err)
+	}
+	defer in.Close()
+
+	br := bufio.NewReaderSize(in, 1<<20)
+	if head, _ := br.Peek(len(encMagic)); !bytes.Equal(head, encMagic) {
+		return decryptLegacy(ctx, in, src, dst, key)
+	}
+
+	dr, err := NewDecryptReader(br, key)
+	if err != nil {
+		return fmt.Errorf("decrypt %s: %w", src, err)
+	}
+
+	f, err := fsutil.Create(dst, ArtifactPerm)
+	if err != nil {
+		return fmt.Errorf("create dst for decrypt: %w", err)
+	}
+	defer f.Abort()
+
+	if _, err := io.Copy(f, contextReader{ctx, dr}); err != nil {
+		return fmt.Errorf("decrypt %s: %w", src, err)
+	}
+	if err := f.Commit(); err != nil {
+		return fmt.Errorf("save decrypted file: %w", err)
+	}
+	return nil
+}
+
+// decryptLegacy decrypts src in the format of earlier versions: a nonce and
+// the whole file as one GCM message, which has to be read into memory.
+func decryptLegacy(ctx context.Context, in *os.File, src, dst string, key []byte) error {
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("read src for decrypt: %w", err)
+	}
+	if info.Size() > maxLegacyInput {
+		return fmt.Errorf("decrypt %s: %w: %d bytes is too large for the single-message format", src, ErrDecrypt, info.Size())
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("read src for decrypt: %w", err)
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return fmt.Errorf("read src for decrypt: %w", err)
+	}
+
+	if len(data) < aesgcm.NonceSize()+aesgcm.Overhead() {
+		return fmt.Errorf("decrypt %s: file too short", src)
+	}
+	nonce, ciphertext := data[:aesgcm.NonceSize()], data[aesgcm.NonceSize():]
+
+	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return fmt.Errorf("decrypt %s: %w: %w", src, ErrDecrypt, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("decrypt cancelled: %w", err)
+	}
+
+	if err := fsutil.WriteFile(dst, plaintext, ArtifactPerm); err != nil {
+		return fmt.Errorf("save decrypted file: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,163 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	testKey  = bytes.Repeat([]byte("k"), 32)
+	otherKey = bytes.Repeat([]byte("o"), 32)
+)
+
+func encrypt(t *testing.T, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, testKey)
+	if err != nil {
+		t.Fatalf("NewEncryptWriter: %v", err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(sealed, key []byte) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(sealed), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, encChunkSize - 1, encChunkSize, encChunkSize + 1, 2*encChunkSize + encChunkSize/2} {
+		plain := bytes.Repeat([]byte("0123456789abcdef"), n/16+1)[:n]
+		sealed := encrypt(t, plain)
+		// A full last chunk is the final one; only empty input seals an
+		// empty chunk.
+		chunks := max(1, (n+encChunkSize-1)/encChunkSize)
+		if want := encHeaderSize + n + chunks*16; len(sealed) != want {
+			t.Errorf("%d bytes: sealed to %d bytes, want %d", n, len(sealed), want)
+		}
+		got, err := decrypt(sealed, testKey)
+		if err != nil {
+			t.Fatalf("%d bytes: decrypt: %v", n, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("%d bytes: round trip changed the data", n)
+		}
+	}
+}
+
+func TestDecryptDamage(t *testing.T) {
+	plain := bytes.Repeat([]byte("x"), 2*encChunkSize+100)
+	sealed := encrypt(t, plain)
+	chunk := encChunkSize + 16
+	first, second := sealed[encHeaderSize:encHeaderSize+chunk], sealed[encHeaderSize+chunk:encHeaderSize+2*chunk]
+
+	flipped := bytes.Clone(sealed)
+	flipped[len(flipped)/2] ^= 1
+	swapped := append(append(append([]byte(nil), sealed[:encHeaderSize]...), second...), first...)
+	swapped = append(swapped, sealed[encHeaderSize+2*chunk:]...)
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		key    []byte
+	}{
+		{"wrong key", sealed, otherKey},
+		{"flipped byte", flipped, testKey},
+		{"cut at a chunk boundary", sealed[:encHeaderSize+2*chunk], testKey},
+		{"cut inside a chunk", sealed[:encHeaderSize+chunk+10], testKey},
+		{"cut inside the header", sealed[:encHeaderSize-1], testKey},
+		{"chunks swapped", swapped, testKey},
+		{"final chunk dropped", sealed[:encHeaderSize+chunk], testKey},
+	}
+	for _, tt := range tests {
+		if _, err := decrypt(tt.sealed, tt.key); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: error = %v, want ErrDecrypt", tt.name, err)
+		}
+	}
+}
+
+func TestEncryptFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src, enc, dst := filepath.Join(dir, "dump.sql"), filepath.Join(dir, "dump.sql.enc"), filepath.Join(dir, "out.sql")
+	plain := bytes.Repeat([]byte("INSERT INTO t VALUES (1);\n"), 100000)
+	if err := os.WriteFile(src, plain, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EncryptFile(ctx, src, enc, testKey); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+	if err := DecryptFile(ctx, enc, dst, testKey); err != nil {
+		t.Fatalf("DecryptFile: %v", err)
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, plain) {
+		t.Error("decrypted file differs from the original")
+	}
+
+	bad := filepath.Join(dir, "bad.sql")
+	if err := DecryptFile(ctx, enc, bad, otherKey); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("DecryptFile with the wrong key = %v, want ErrDecrypt", err)
+	}
+	if _, err := os.Stat(bad); err == nil {
+		t.Error("a failed decrypt left its output behind")
+	}
+}
+
+// TestDecryptLegacy reads files in the format of earlier versions: a
+// random nonce and the whole file sealed as one GCM message.
+func TestDecryptLegacy(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	plain := []byte("CREATE TABLE t (id INT);\nINSERT INTO t VALUES (1);\n")
+
+	block, err := aes.NewCipher(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := bytes.Repeat([]byte{7}, aesgcm.NonceSize())
+	legacy := aesgcm.Seal(append([]byte(nil), nonce...), nonce, plain, nil)
+	src := filepath.Join(dir, "old.sql.enc")
+	if err := os.WriteFile(src, legacy, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "old.sql")
+	if err := DecryptFile(ctx, src, dst, testKey); err != nil {
+		t.Fatalf("DecryptFile: %v", err)
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, plain) {
+		t.Errorf("decrypted %q, want %q", got, plain)
+	}
+
+	if err := DecryptFile(ctx, src, filepath.Join(dir, "bad.sql"), otherKey); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("DecryptFile with the wrong key = %v, want ErrDecrypt", err)
+	}
+	short := filepath.Join(dir, "short.enc")
+	if err := os.WriteFile(short, legacy[:10], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecryptFile(ctx, short, filepath.Join(dir, "short.sql"), testKey); err == nil {
+		t.Error("DecryptFile of a truncated legacy file succeeded")
+	}
+}
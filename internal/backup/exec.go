@@ -0,0 +1,51 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/progress"
+	"github.com/bhagashetti/db-backup-cli/internal/throttle"
+)
+
+// TerminateGrace is how long a child process gets to exit after it is asked
+// to stop (SIGTERM) before it is killed.
+var TerminateGrace = 10 * time.Second
+
+// newCommand returns a command bound to ctx. When ctx is cancelled the child
+// receives SIGTERM rather than SIGKILL so it can exit cleanly, and is killed
+// only if it is still running after TerminateGrace.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Cancel = func() error {
+		if runtime.GOOS == "windows" {
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = TerminateGrace
+	return cmd
+}
+
+// contextReader fails reads once ctx is done, so long copies stop promptly.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// dumpWriter wraps the writer a dump stream goes to, limiting it to limit
+// and counting it towards the context's progress stage.
+func dumpWriter(ctx context.Context, w io.Writer, limit *throttle.Limiter) io.Writer {
+	return progress.FromContext(ctx).Writer(throttle.Writer(ctx, w, limit))
+}
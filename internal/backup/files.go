@@ -0,0 +1,633 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+)
+
+// xattrPrefix is the PAX record prefix GNU tar and bsdtar use for extended
+// attributes.
+const xattrPrefix = "SCHILY.xattr."
+
+// FileSet selects the files of a files backup. Paths are archived under
+// their cleaned path with any leading "/" removed, as tar does, so restoring
+// into "/" puts them back in place.
+//
+// Include and Exclude are globs. A glob with a "/" is matched against the
+// path below its root; one without is matched against every name in the
+// path. "**" matches any number of directories. Excluded directories are
+// skipped whole; with Include set, only matching files are archived.
+type FileSet struct {
+	Paths   []string
+	Include []string
+	Exclude []string
+}
+
+// checkGlobs reports the first malformed glob.
+func (s FileSet) checkGlobs() error {
+	for _, g := range append(append([]string{}, s.Include...), s.Exclude...) {
+		if _, err := path.Match(strings.ReplaceAll(g, "**", "*"), ""); err != nil {
+			return fmt.Errorf("%w: invalid glob %q: %w", ErrDumpOptions, g, err)
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether rel, a slash-separated path below a root,
+// matches one of globs.
+func matchAny(globs []string, rel string) bool {
+	parts := strings.Split(rel, "/")
+	for _, g := range globs {
+		if !strings.Contains(g, "/") {
+			for _, p := range parts {
+				if ok, _ := path.Match(g, p); ok {
+					return true
+				}
+			}
+			continue
+		}
+		if matchGlob(strings.Split(strings.Trim(g, "/"), "/"), parts) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches path segments against glob segments, where a "**"
+// segment matches zero or more path segments.
+func matchGlob(glob, parts []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchGlob(glob[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], parts[0]); !ok {
+			return false
+		}
+		glob, parts = glob[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// archiveName is the name path gets inside the archive.
+func archiveName(p string) string {
+	name := filepath.ToSlash(filepath.Clean(p))
+	name = strings.TrimLeft(name, "/")
+	if vol := filepath.VolumeName(p); vol != "" {
+		name = strings.TrimLeft(strings.TrimPrefix(name, filepath.ToSlash(vol)), "/")
+	}
+	return name
+}
+
+// FilesBackup archives opts.Files into the tar file opts.Output, keeping
+// permissions, ownership, modification times, symlinks, hard links and,
+// on Linux, extended attributes. Sockets and device files are skipped.
+// With opts.Compression or opts.EncryptKey the tar is compressed and
+// encrypted as it is written.
+func FilesBackup(ctx context.Context, opts BackupOptions) error {
+	if opts.Format != "" && opts.Format != FormatSQL {
+		return fmt.Errorf("%w: format %q for files (backups are tar files)", ErrDumpOptions, opts.Format)
+	}
+	if len(opts.Files.Paths) == 0 {
+		return fmt.Errorf("%w: no paths to back up", ErrDumpOptions)
+	}
+	if err := opts.Files.checkGlobs(); err != nil {
+		return err
+	}
+
+	out, err := fsutil.Create(opts.Output, ArtifactPerm)
+	if err != nil {
+		return fmt.Errorf("could not create output file: %w", err)
+	}
+	defer out.Abort()
+	outInfo, err := out.Stat()
+	if err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriterSize(out, 1<<20)
+	sw, err := newStageWriter(buf, opts.Compression, opts.EncryptKey)
+	if err != nil {
+		return err
+	}
+	defer sw.Close()
+	a := &archiver{
+		ctx:     ctx,
+		tw:      tar.NewWriter(dumpWriter(ctx, sw, opts.DumpLimit)),
+		set:     opts.Files,
+		self:    outInfo,
+		links:   make(map[fileID]string),
+		skipped: make(map[string]int),
+	}
+	for _, root := range opts.Files.Paths {
+		console.Println("Archiving", root)
+		if err := a.addTree(root); err != nil {
+			return err
+		}
+	}
+	if err := a.tw.Close(); err != nil {
+		return fmt.Errorf("close tar: %w", err)
+	}
+	if err := sw.Close(); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("write archive: %w", err)
+	}
+
+	console.Printf("Archived %d files, %d directories, %d links (%s)\n", a.files, a.dirs, a.symlinks+a.hardlinks, formatBytes(a.bytes))
+	for kind, n := range a.skipped {
+		console.Printf("Skipped %d %s\n", n, kind)
+	}
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("save archive: %w", err)
+	}
+	return nil
+}
+
+// stageWriter compresses and encrypts what is written to it, as
+// CompressFile and EncryptFile would, before it reaches the underlying
+// writer.
+type stageWriter struct {
+	io.Writer
+	closers []io.Closer // in the order data passes through them
+}
+
+// newStageWriter returns a stageWriter into w. A nil compression or key
+// skips that stage.
+func newStageWriter(w io.Writer, compression *CompressOptions, key []byte) (*stageWriter, error) {
+	s := &stageWriter{Writer: w}
+	if key != nil {
+		ew, err := NewEncryptWriter(s.Writer, key)
+		if err != nil {
+			return nil, err
+		}
+		s.Writer = ew
+		s.closers = append(s.closers, ew)
+	}
+	if compression != nil {
+		c, err := LookupCodec(*compression)
+		if err != nil {
+			return nil, err
+		}
+		cw, err := c.writer(s.Writer, *compression)
+		if err != nil {
+			return nil, fmt.Errorf("start %s writer: %w", c.Name, err)
+		}
+		s.Writer = cw
+		s.closers = append([]io.Closer{cw}, s.closers...)
+	}
+	return s, nil
+}
+
+// Close flushes the compressor, then writes the final encrypted chunk. It
+// does nothing after the first call.
+func (s *stageWriter) Close() error {
+	closers := s.closers
+	s.closers = nil
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			return fmt.Errorf("close archive stream: %w", err)
+		}
+	}
+	return nil
+}
+
+// archiver writes one files backup.
+type archiver struct {
+	ctx   context.Context
+	tw    *tar.Writer
+	set   FileSet
+	self  fs.FileInfo       // the archive being written, never archived
+	links map[fileID]string // first archived name of each multiply linked file
+
+	files, dirs, symlinks, hardlinks int
+	bytes                            int64
+	skipped                          map[string]int
+}
+
+func (a *archiver) addTree(root string) error {
+	root = filepath.Clean(root)
+	if _, err := os.Lstat(root); err != nil {
+		return fmt.Errorf("%w: %w", ErrDumpOptions, err)
+	}
+
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk %s: %w", p, err)
+		}
+		if err := a.ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if rel != "." && matchAny(a.set.Exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && len(a.set.Include) > 0 && !matchAny(a.set.Include, rel) {
+			return nil
+		}
+		return a.add(p)
+	})
+}
+
+// add writes one file, directory or link to the archive.
+func (a *archiver) add(p string) error {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(info, a.self) {
+		return nil
+	}
+
+	var link string
+	switch mode := info.Mode(); {
+	case mode.IsRegular(), mode.IsDir():
+	case mode&fs.ModeSymlink != 0:
+		if link, err = os.Readlink(p); err != nil {
+			return err
+		}
+	default:
+		a.skipped[fileKind(mode)]++
+		return nil
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("tar %s: %w", p, err)
+	}
+	hdr.Name = archiveName(p)
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.Format = tar.FormatPAX
+
+	// Extended attributes of symlinks themselves are not kept.
+	if link == "" {
+		if xattrs, err := readXattrs(p); err != nil {
+			console.Println("Warning: could not read extended attributes of", p+":", err)
+		} else if len(xattrs) > 0 {
+			hdr.PAXRecords = make(map[string]string, len(xattrs))
+			for k, v := range xattrs {
+				hdr.PAXRecords[xattrPrefix+k] = v
+			}
+		}
+	}
+
+	// Later names of a hard-linked file point at the first.
+	if info.Mode().IsRegular() {
+		if id, ok := linkedFileID(info); ok {
+			if first, seen := a.links[id]; seen {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				hdr.Size = 0
+				a.hardlinks++
+				return a.tw.WriteHeader(hdr)
+			}
+			a.links[id] = hdr.Name
+		}
+	}
+
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("tar %s: %w", p, err)
+	}
+	switch {
+	case info.IsDir():
+		a.dirs++
+		return nil
+	case link != "":
+		a.symlinks++
+		return nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := io.CopyN(a.tw, contextReader{a.ctx, f}, hdr.Size)
+	if err != nil {
+		return fmt.Errorf("tar %s: %w (did it shrink while being read?)", p, err)
+	}
+	a.files++
+	a.bytes += n
+	return nil
+}
+
+// fileKind names the kind of a file that is not archived.
+func fileKind(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeSocket != 0:
+		return "sockets"
+	case mode&fs.ModeNamedPipe != 0:
+		return "named pipes"
+	case mode&fs.ModeDevice != 0:
+		return "device files"
+	}
+	return "special files"
+}
+
+// FilesRestore extracts the tar archive opts.Input, optionally compressed, into
+// opts.Target. No entry may land outside the target: absolute names and ".."
+// are rejected, and nothing is written through a symlink, whether it came
+// from the archive or was already there. Existing files are replaced.
+// Ownership is restored when running as root.
+func FilesRestore(ctx context.Context, opts RestoreOptions) error {
+	if opts.Target == "" {
+		return fmt.Errorf("%w: restoring files needs a target directory", ErrDumpOptions)
+	}
+	target, err := filepath.Abs(opts.Target)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		return fmt.Errorf("create target: %w", err)
+	}
+
+	in, err := os.Open(opts.Input)
+	if err != nil {
+		return fmt.Errorf("could not open input file: %w", err)
+	}
+	defer in.Close()
+
+	r, err := NewReader(in)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", opts.Input, err)
+	}
+	defer r.Close()
+
+	x := &extractor{ctx: ctx, root: target, chown: os.Geteuid() == 0}
+	if err := x.run(tar.NewReader(r)); err != nil {
+		return err
+	}
+
+	console.Printf("Extracted %d files, %d directories, %d links into %s\n", x.files, len(x.dirs), x.links, target)
+	if x.xattrErrors > 0 {
+		console.Printf("Warning: %d extended attributes could not be set\n", x.xattrErrors)
+	}
+	if !x.chown {
+		console.Println("Not running as root: files are owned by the current user")
+	}
+	return nil
+}
+
+// extractor unpacks one archive below root.
+type extractor struct {
+	ctx   context.Context
+	root  string
+	chown bool
+
+	dirs        []*tar.Header // metadata applied last, deepest first
+	files       int
+	links       int
+	xattrErrors int
+}
+
+func (x *extractor) run(tr *tar.Reader) error {
+	for {
+		if err := x.ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read archive: %w", err)
+		}
+		if err := x.extract(hdr, tr); err != nil {
+			return fmt.Errorf("extract %s: %w", hdr.Name, err)
+		}
+	}
+
+	// Directory times and modes go last: creating their entries would
+	// change the times, and a read-only mode would block them.
+	sort.SliceStable(x.dirs, func(i, j int) bool {
+		return strings.Count(x.dirs[i].Name, "/") > strings.Count(x.dirs[j].Name, "/")
+	})
+	for _, hdr := range x.dirs {
+		p, err := x.path(hdr.Name)
+		if err != nil {
+			return err
+		}
+		// A later entry may have replaced the directory, say with a
+		// symlink out of root, so check again before changing p.
+		if err := x.checkParents(p); err != nil {
+			return fmt.Errorf("extract %s: %w", hdr.Name, err)
+		}
+		if info, err := os.Lstat(p); err != nil || !info.IsDir() {
+			console.Printf("Warning: %s was replaced by a later entry; its mode and times are not restored\n", hdr.Name)
+			continue
+		}
+		if err := x.setMeta(p, hdr); err != nil {
+			return fmt.Errorf("extract %s: %w", hdr.Name, err)
+		}
+	}
+	return nil
+}
+
+// path returns where name goes below root, refusing absolute names and
+// names that use ".." to leave it.
+func (x *extractor) path(name string) (string, error) {
+	local := filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if !filepath.IsLocal(local) || strings.Contains("/"+filepath.ToSlash(local)+"/", "/../") {
+		return "", fmt.Errorf("entry %q is not a plain relative path", name)
+	}
+	return filepath.Join(x.root, local), nil
+}
+
+// checkParents makes the directories above p, refusing to go through a
+// symlink or anything else that is not a directory.
+func (x *extractor) checkParents(p string) error {
+	rel, err := filepath.Rel(x.root, filepath.Dir(p))
+	if err != nil || rel == "." {
+		return err
+	}
+	dir := x.root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if err := os.Mkdir(dir, 0o755); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case info.Mode()&fs.ModeSymlink != 0:
+			return fmt.Errorf("%s is a symlink; refusing to extract through it", dir)
+		case !info.IsDir():
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+	return nil
+}
+
+// removeExisting removes whatever is at p, unless it is a directory and keepDir is
+// set. It never follows a symlink.
+func removeExisting(p string, keepDir bool) error {
+	info, err := os.Lstat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if keepDir {
+			return nil
+		}
+		return os.RemoveAll(p)
+	}
+	return os.Remove(p)
+}
+
+func (x *extractor) extract(hdr *tar.Header, r io.Reader) error {
+	p, err := x.path(hdr.Name)
+	if err != nil {
+		return err
+	}
+	if err := x.checkParents(p); err != nil {
+		return err
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := removeExisting(p, true); err != nil {
+			return err
+		}
+		if err := os.Mkdir(p, 0o700); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		x.dirs = append(x.dirs, hdr)
+		return nil
+
+	case tar.TypeReg:
+		if err := removeExisting(p, false); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, contextReader{x.ctx, r})
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		x.files++
+		return x.setMeta(p, hdr)
+
+	case tar.TypeSymlink:
+		if err := removeExisting(p, false); err != nil {
+			return err
+		}
+		if err := os.Symlink(hdr.Linkname, p); err != nil {
+			return err
+		}
+		x.links++
+		return x.setMeta(p, hdr)
+
+	case tar.TypeLink:
+		src, err := x.path(hdr.Linkname)
+		if err != nil {
+			return fmt.Errorf("hard link: %w", err)
+		}
+		if err := x.checkParents(src); err != nil {
+			return err
+		}
+		info, err := os.Lstat(src)
+		if err != nil {
+			return fmt.Errorf("hard link: %w", err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("hard link to %s, which is not a regular file", hdr.Linkname)
+		}
+		if err := removeExisting(p, false); err != nil {
+			return err
+		}
+		if err := os.Link(src, p); err != nil {
+			return err
+		}
+		x.links++
+		return nil
+	}
+
+	console.Printf("Skipping %s: unsupported entry type %c\n", hdr.Name, hdr.Typeflag)
+	return nil
+}
+
+// setMeta applies ownership, mode, extended attributes and times.
+func (x *extractor) setMeta(p string, hdr *tar.Header) error {
+	symlink := hdr.Typeflag == tar.TypeSymlink
+	if x.chown {
+		if err := os.Lchown(p, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	if symlink {
+		return nil // lchmod, lutimes and symlink xattrs are not portable
+	}
+	for k, v := range hdr.PAXRecords {
+		if name, ok := strings.CutPrefix(k, xattrPrefix); ok {
+			if err := writeXattr(p, name, v); err != nil {
+				x.xattrErrors++
+			}
+		}
+	}
+	// Mode after chown, which clears setuid and setgid.
+	if err := os.Chmod(p, fileMode(hdr.Mode)); err != nil {
+		return err
+	}
+	mtime := hdr.ModTime
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = mtime
+	}
+	if mtime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(p, atime, mtime)
+}
+
+// fileMode converts a tar mode, including setuid, setgid and sticky bits.
+func fileMode(mode int64) fs.FileMode {
+	m := fs.FileMode(mode).Perm()
+	if mode&0o4000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
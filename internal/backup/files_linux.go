@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// fileID identifies a file across its hard links.
+type fileID struct {
+	dev, ino uint64
+}
+
+// linkedFileID returns the identity of a file with more than one link.
+func linkedFileID(info fs.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: st.Ino}, true
+}
+
+// readXattrs returns the extended attributes of the file at path. A file
+// system without xattr support has none.
+func readXattrs(path string) (map[string]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = syscall.Listxattr(path, buf); err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string]string)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		n, err := syscall.Getxattr(path, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, n)
+		if n, err = syscall.Getxattr(path, string(name), value); err != nil {
+			return nil, err
+		}
+		xattrs[string(name)] = string(value[:n])
+	}
+	return xattrs, nil
+}
+
+// writeXattr sets one extended attribute on the file at path.
+func writeXattr(path, name, value string) error {
+	return syscall.Setxattr(path, name, []byte(value), 0)
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package backup
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// fileID identifies a file across its hard links.
+type fileID struct{}
+
+// linkedFileID reports no hard links where they cannot be detected portably;
+// each name is then archived as a separate file.
+func linkedFileID(fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+// readXattrs returns no extended attributes outside Linux.
+func readXattrs(string) (map[string]string, error) {
+	return nil, nil
+}
+
+// writeXattr cannot set extended attributes outside Linux.
+func writeXattr(string, string, string) error {
+	return errNoXattrs
+}
+
+var errNoXattrs = errors.New("extended attributes are only supported on Linux")
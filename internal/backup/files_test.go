@@ -0,0 +1,268 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tarEntry is one entry of a test archive.
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	linkname string
+	mode     int64
+}
+
+func dirEntry(name string, mode int64) tarEntry {
+	return tarEntry{name: name, typeflag: tar.TypeDir, mode: mode}
+}
+func fileEntry(name, body string) tarEntry {
+	return tarEntry{name: name, typeflag: tar.TypeReg, body: body, mode: 0o644}
+}
+func symlinkEntry(name, target string) tarEntry {
+	return tarEntry{name: name, typeflag: tar.TypeSymlink, linkname: target, mode: 0o777}
+}
+
+// archiveMtime is the modification time of every test entry.
+var archiveMtime = time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+
+func buildTar(t *testing.T, entries []tarEntry) *tar.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     e.mode,
+			Size:     int64(len(e.body)),
+			ModTime:  archiveMtime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("write header %s: %v", e.name, err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tar.NewReader(&buf)
+}
+
+func TestExtractorTraversal(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries func(outside string) []tarEntry
+		prepare func(t *testing.T, root, outside string)
+		wantErr string
+	}{
+		{
+			name:    "dot-dot name",
+			entries: func(string) []tarEntry { return []tarEntry{fileEntry("../evil", "x")} },
+			wantErr: "not a plain relative path",
+		},
+		{
+			name:    "dot-dot inside a name",
+			entries: func(string) []tarEntry { return []tarEntry{fileEntry("a/../../evil", "x")} },
+			wantErr: "not a plain relative path",
+		},
+		{
+			name: "absolute name",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{fileEntry(filepath.ToSlash(filepath.Join(outside, "evil")), "x")}
+			},
+			wantErr: "not a plain relative path",
+		},
+		{
+			name: "symlink from the archive as a parent",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{symlinkEntry("link", outside), fileEntry("link/evil", "x")}
+			},
+			wantErr: "symlink",
+		},
+		{
+			name:    "existing symlink as a parent",
+			entries: func(string) []tarEntry { return []tarEntry{fileEntry("pre/evil", "x")} },
+			prepare: func(t *testing.T, root, outside string) {
+				if err := os.Symlink(outside, filepath.Join(root, "pre")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "symlink",
+		},
+		{
+			name: "hard link out of root",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{{name: "hard", typeflag: tar.TypeLink, linkname: "../outside/secret"}}
+			},
+			wantErr: "not a plain relative path",
+		},
+		{
+			// The directory's metadata is applied after every entry, by
+			// which time "a" points out of root.
+			name: "symlink replaces a directory",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{dirEntry("a/", 0o700), symlinkEntry("a", outside)}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			root := filepath.Join(base, "root")
+			outside := filepath.Join(base, "outside")
+			for _, dir := range []string{root, outside} {
+				if err := os.Mkdir(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("s"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			before, err := os.Stat(outside)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.prepare != nil {
+				tt.prepare(t, root, outside)
+			}
+
+			x := &extractor{ctx: context.Background(), root: root}
+			err = x.run(buildTar(t, tt.entries(outside)))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("run: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("run error = %v, want one containing %q", err, tt.wantErr)
+			}
+
+			// Nothing outside root changed.
+			entries, err := os.ReadDir(outside)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != "secret" {
+				t.Errorf("outside holds %v, want only secret", entries)
+			}
+			after, err := os.Stat(outside)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after.Mode() != before.Mode() || !after.ModTime().Equal(before.ModTime()) {
+				t.Errorf("outside changed from %v %v to %v %v", before.Mode(), before.ModTime(), after.Mode(), after.ModTime())
+			}
+			if _, err := os.Stat(filepath.Join(base, "evil")); err == nil {
+				t.Error("an entry was written next to root")
+			}
+		})
+	}
+}
+
+func TestExtractorMetadata(t *testing.T) {
+	root := t.TempDir()
+	x := &extractor{ctx: context.Background(), root: root}
+	err := x.run(buildTar(t, []tarEntry{
+		dirEntry("ro/", 0o555),
+		fileEntry("ro/file", "data"),
+		dirEntry("ro/sub/", 0o750),
+		symlinkEntry("ro/link", "file"),
+		{name: "ro/hard", typeflag: tar.TypeLink, linkname: "ro/file"},
+	}))
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(root, "ro"), 0o755) })
+
+	for _, tt := range []struct {
+		name string
+		mode fs.FileMode
+	}{
+		{"ro", fs.ModeDir | 0o555},
+		{"ro/sub", fs.ModeDir | 0o750},
+		{"ro/file", 0o644},
+	} {
+		info, err := os.Lstat(filepath.Join(root, tt.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != tt.mode {
+			t.Errorf("%s mode = %v, want %v", tt.name, info.Mode(), tt.mode)
+		}
+		// Directory times are set after their entries are created.
+		if !info.ModTime().Equal(archiveMtime) {
+			t.Errorf("%s mtime = %v, want %v", tt.name, info.ModTime(), archiveMtime)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(root, "ro/link")); err != nil || target != "file" {
+		t.Errorf("ro/link = %q, %v, want file", target, err)
+	}
+	a, _ := os.Stat(filepath.Join(root, "ro/file"))
+	b, _ := os.Stat(filepath.Join(root, "ro/hard"))
+	if a == nil || b == nil || !os.SameFile(a, b) {
+		t.Error("ro/hard is not a hard link to ro/file")
+	}
+	if x.files != 1 || x.links != 2 || len(x.dirs) != 2 {
+		t.Errorf("counted %d files, %d links, %d dirs, want 1, 2, 2", x.files, x.links, len(x.dirs))
+	}
+}
+
+func TestFilesRoundTrip(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "data")
+	for _, dir := range []string{"sub", "cache"} {
+		if err := os.MkdirAll(filepath.Join(src, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{"a.txt": "alpha", "sub/b.txt": "beta", "cache/skip.tmp": "tmp"}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(body), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "data.tar")
+	err := FilesBackup(context.Background(), BackupOptions{
+		DBType: "files",
+		Output: out,
+		Files:  FileSet{Paths: []string{src}, Exclude: []string{"*.tmp"}},
+	})
+	if err != nil {
+		t.Fatalf("FilesBackup: %v", err)
+	}
+
+	target := t.TempDir()
+	if err := FilesRestore(context.Background(), RestoreOptions{DBType: "files", Input: out, Target: target}); err != nil {
+		t.Fatalf("FilesRestore: %v", err)
+	}
+	restored := filepath.Join(target, archiveName(src))
+	for name, body := range files {
+		got, err := os.ReadFile(filepath.Join(restored, name))
+		if strings.HasSuffix(name, ".tmp") {
+			if err == nil {
+				t.Errorf("%s was excluded but restored", name)
+			}
+			continue
+		}
+		if err != nil || string(got) != body {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, body)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(restored, "link")); err != nil || link != "a.txt" {
+		t.Errorf("link = %q, %v, want a.txt", link, err)
+	}
+}
@@ -0,0 +1,260 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+)
+
+// SQL Server backup formats. FormatSQL and "" also mean a full backup.
+const (
+	FormatFull = "full" // BACKUP DATABASE ... WITH COPY_ONLY
+	FormatLog  = "log"  // BACKUP LOG ... WITH COPY_ONLY
+)
+
+// SQL Server backup types, as reported by RESTORE HEADERONLY.
+const (
+	mssqlTypeDatabase = "1"
+	mssqlTypeLog      = "2"
+)
+
+// sqlcmdArgs returns the sqlcmd arguments for a connection. -b makes sqlcmd
+// exit non-zero when a statement fails; the rest give bare, |-separated
+// result rows. The password goes in SQLCMDPASSWORD.
+func sqlcmdArgs(host string, port int, user string) []string {
+	return []string{"-S", fmt.Sprintf("%s,%d", host, port), "-U", user, "-b", "-h", "-1", "-W", "-s", "|"}
+}
+
+// sqlcmdEnv returns the environment for sqlcmd.
+func sqlcmdEnv(password string) []string {
+	env := os.Environ()
+	if password != "" {
+		env = append(env, "SQLCMDPASSWORD="+password)
+	}
+	return env
+}
+
+// runSQLCmd runs a T-SQL batch with sqlcmd. Its output goes to w as well as
+// being returned, so progress messages can be shown while result sets are
+// parsed.
+func runSQLCmd(ctx context.Context, host string, port int, user, password, query string, w io.Writer) (string, error) {
+	args := append(sqlcmdArgs(host, port, user), "-Q", "SET NOCOUNT ON; "+query)
+	var out bytes.Buffer
+	cmd := newCommand(ctx, "sqlcmd", args...)
+	cmd.Env = sqlcmdEnv(password)
+	if err := runClient(ctx, cmd, io.MultiWriter(w, &out), "sqlcmd"); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// mssqlIdent quotes a SQL Server identifier.
+func mssqlIdent(s string) string {
+	return "[" + strings.ReplaceAll(s, "]", "]]") + "]"
+}
+
+// mssqlString quotes a SQL Server Unicode string literal.
+func mssqlString(s string) string {
+	return "N'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// serverPath returns the path SQL Server uses for the local file path: the
+// same absolute path, or the file's name under serverDir when the server sees
+// the directory elsewhere (a container volume or a share).
+func serverPath(path, serverDir string) (string, error) {
+	if serverDir == "" {
+		return filepath.Abs(path)
+	}
+	sep := "/"
+	if strings.Contains(serverDir, `\`) {
+		sep = `\`
+	}
+	return strings.TrimRight(serverDir, `/\`) + sep + filepath.Base(path), nil
+}
+
+// MSSQLBackup has SQL Server write a copy-only full or log backup of
+// opts.DBName to opts.Output. Copy-only backups leave the server's own
+// backup chain and log truncation untouched.
+//
+// SQL Server writes the file itself, so opts.Output must be on a path the
+// server can write: the same host, or a shared directory given as
+// opts.ServerDir from the server's side.
+func MSSQLBackup(ctx context.Context, opts BackupOptions) error {
+	var kind string
+	switch opts.Format {
+	case "", FormatSQL, FormatFull:
+		kind = "DATABASE"
+	case FormatLog:
+		kind = "LOG"
+	default:
+		return fmt.Errorf("%w: format %q for mssql (want %s or %s)", ErrDumpOptions, opts.Format, FormatFull, FormatLog)
+	}
+
+	// The server creates the file, so it cannot go through fsutil.Create;
+	// it is written under a temporary name and renamed once complete.
+	tmp := filepath.Join(filepath.Dir(opts.Output), fmt.Sprintf(".%s.%d.tmp", filepath.Base(opts.Output), time.Now().UnixNano()))
+	target, err := serverPath(tmp, opts.ServerDir)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	query := fmt.Sprintf("BACKUP %s %s TO DISK = %s WITH COPY_ONLY, CHECKSUM, INIT, STATS = 10",
+		kind, mssqlIdent(opts.DBName), mssqlString(target))
+	console.Println("Running command:", "sqlcmd", query)
+	if _, err := runSQLCmd(ctx, opts.Host, opts.Port, opts.User, opts.Password, query, console.Out()); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(tmp); err != nil {
+		return fmt.Errorf("SQL Server wrote the backup to %s, which is not visible here as %s (set serverDir): %w", target, tmp, err)
+	}
+	if err := os.Rename(tmp, opts.Output); err != nil {
+		return fmt.Errorf("save backup: %w", err)
+	}
+	if err := os.Chmod(opts.Output, ArtifactPerm); err != nil {
+		console.Println("Warning: could not restrict permissions of", opts.Output+":", err)
+	}
+	return nil
+}
+
+// MSSQLRestore restores a full or log backup made by MSSQLBackup. A full
+// backup replaces opts.DBName; its files are moved as given by opts.Move
+// (logical name to path) and, for the rest, into opts.DataDir if set. A log
+// backup is applied to a database left restoring by an earlier restore with
+// opts.NoRecovery, stopping at opts.ToTime if set.
+func MSSQLRestore(ctx context.Context, opts RestoreOptions) error {
+	source, err := serverPath(opts.Input, opts.ServerDir)
+	if err != nil {
+		return err
+	}
+
+	header, err := mssqlRows(ctx, opts, "RESTORE HEADERONLY FROM DISK = "+mssqlString(source))
+	if err != nil {
+		return fmt.Errorf("read backup header: %w", err)
+	}
+	if len(header) == 0 || len(header[0]) < 3 {
+		return fmt.Errorf("read backup header: no backup set in %s", source)
+	}
+
+	recovery := "RECOVERY"
+	if opts.NoRecovery {
+		recovery = "NORECOVERY"
+	}
+
+	var query string
+	switch backupType := header[0][2]; backupType {
+	case mssqlTypeDatabase:
+		if !opts.ToTime.IsZero() {
+			return fmt.Errorf("%w: a stop time applies to log backups; restore the full backup with no-recovery first", ErrPITR)
+		}
+		moves, err := mssqlMoves(ctx, opts, source)
+		if err != nil {
+			return err
+		}
+		query = fmt.Sprintf("RESTORE DATABASE %s FROM DISK = %s WITH %sREPLACE, %s, STATS = 10",
+			mssqlIdent(opts.DBName), mssqlString(source), moves, recovery)
+
+	case mssqlTypeLog:
+		if len(opts.Move) > 0 || opts.DataDir != "" {
+			return fmt.Errorf("%w: file moves apply to full backups, not log backups", ErrDumpOptions)
+		}
+		stopAt := ""
+		if !opts.ToTime.IsZero() {
+			// STOPAT is in the server's local time.
+			query = fmt.Sprintf("DECLARE @stopat nvarchar(30) = CONVERT(nvarchar(30), CONVERT(datetime2(3), SWITCHOFFSET(CONVERT(datetimeoffset, %s), DATENAME(TzOffset, SYSDATETIMEOFFSET()))), 126); ",
+				mssqlString(opts.ToTime.Format("2006-01-02T15:04:05.000-07:00")))
+			stopAt = "STOPAT = @stopat, "
+		}
+		query += fmt.Sprintf("RESTORE LOG %s FROM DISK = %s WITH %s%s, STATS = 10",
+			mssqlIdent(opts.DBName), mssqlString(source), stopAt, recovery)
+
+	default:
+		return fmt.Errorf("backup type %s in %s is not supported (want full or log)", backupType, source)
+	}
+
+	console.Println("Running command:", "sqlcmd", query)
+	if _, err := runSQLCmd(ctx, opts.Host, opts.Port, opts.User, opts.Password, query, console.Out()); err != nil {
+		return err
+	}
+	if opts.NoRecovery {
+		console.Println("Database", opts.DBName, "is left restoring; apply log backups, restoring the last without no-recovery.")
+	}
+	return nil
+}
+
+// mssqlMoves builds the MOVE clauses of a full restore. Files named in
+// opts.Move go where it says; with opts.DataDir the others move into it,
+// renamed after the target database so a copy can sit next to the original.
+func mssqlMoves(ctx context.Context, opts RestoreOptions, source string) (string, error) {
+	if len(opts.Move) == 0 && opts.DataDir == "" {
+		return "", nil
+	}
+
+	files, err := mssqlRows(ctx, opts, "RESTORE FILELISTONLY FROM DISK = "+mssqlString(source))
+	if err != nil {
+		return "", fmt.Errorf("list backup files: %w", err)
+	}
+
+	known := make(map[string]bool)
+	var clauses []string
+	for _, f := range files {
+		if len(f) < 2 {
+			continue
+		}
+		logical, physical := f[0], f[1]
+		known[logical] = true
+
+		dest, ok := opts.Move[logical]
+		if !ok {
+			if opts.DataDir == "" {
+				continue
+			}
+			name := physical[strings.LastIndexAny(physical, `/\`)+1:]
+			dir := opts.DataDir
+			sep := "/"
+			if strings.Contains(dir, `\`) {
+				sep = `\`
+			}
+			dest = strings.TrimRight(dir, `/\`) + sep + opts.DBName + "_" + logical + filepath.Ext(name)
+		}
+		clauses = append(clauses, fmt.Sprintf("MOVE %s TO %s, ", mssqlString(logical), mssqlString(dest)))
+	}
+
+	var unknown []string
+	for logical := range opts.Move {
+		if !known[logical] {
+			unknown = append(unknown, logical)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return "", fmt.Errorf("%w: backup has no file with logical name %s", ErrDumpOptions, strings.Join(unknown, ", "))
+	}
+	return strings.Join(clauses, ""), nil
+}
+
+// mssqlRows runs a query and splits its result rows into fields.
+func mssqlRows(ctx context.Context, opts RestoreOptions, query string) ([][]string, error) {
+	out, err := runSQLCmd(ctx, opts.Host, opts.Port, opts.User, opts.Password, query, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rows = append(rows, strings.Split(line, "|"))
+	}
+	return rows, nil
+}
@@ -1,62 +1,203 @@
 package backup
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
 )
 
-// MySQLBackup performs a backup using mysqldump.
-func MySQLBackup(opts BackupOptions) error {
+// ErrConnection reports that the database client could not connect or
+// authenticate, as opposed to failing part-way through a dump or restore.
+var ErrConnection = errors.New("database connection failed")
+
+// connectionErrorMarkers are substrings of MySQL, PostgreSQL and sqlcmd errors
+// that mean the server was never reached or rejected the login.
+var connectionErrorMarkers = []string{
+	"when trying to connect",
+	"Can't connect to",
+	"Unknown MySQL server host",
+	"Access denied for user",
+	"Lost connection to",
+	"could not connect to server",
+	"connection to server",
+	"could not translate host name",
+	"password authentication failed",
+	"no pg_hba.conf entry",
+	"fe_sendauth: no password supplied",
+	"Login failed for user",
+	"Login timeout expired",
+	"Unable to complete login process",
+	"TCP Provider:",
+}
+
+// classifyClientError wraps err with ErrConnection if stderr shows a
+// connection or authentication failure.
+func classifyClientError(err error, stderr string) error {
+	for _, marker := range connectionErrorMarkers {
+		if strings.Contains(stderr, marker) {
+			return fmt.Errorf("%w: %w", ErrConnection, err)
+		}
+	}
+	return err
+}
+
+// connArgs returns the mysql/mysqldump client arguments for a connection.
+func connArgs(host string, port int, user, password string) []string {
 	args := []string{
-		"-h", opts.Host,
-		"-P", fmt.Sprint(opts.Port),
-		"-u", opts.User,
+		"-h", host,
+		"-P", fmt.Sprint(port),
+		"-u", user,
 	}
 
-	if opts.Password != "" {
-		args = append(args, "-p"+opts.Password)
+	if password != "" {
+		args = append(args, "-p"+password)
 	}
 
-	args = append(args, opts.DBName)
+	return args
+}
+
+// mysqlQuery runs a single statement with the mysql client and returns its
+// result rows, one tab-separated line per row without a header.
+func mysqlQuery(ctx context.Context, opts BackupOptions, db, query string) ([]string, error) {
+	if opts.Engine == EngineNative {
+		return nativeQuery(ctx, opts, db, query)
+	}
 
-	cmd := exec.Command("mysqldump", args...)
+	args := connArgs(opts.Host, opts.Port, opts.User, opts.Password)
+	args = append(args, "-N", "-B", "-e", query)
+	if db != "" {
+		args = append(args, db)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := newCommand(ctx, "mysql", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := runCommand(ctx, cmd); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		return nil, fmt.Errorf("mysql query %q failed: %w: %s", query, classifyClientError(err, msg), msg)
+	}
+
+	var rows []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			rows = append(rows, line)
+		}
+	}
+	return rows, nil
+}
 
-	fmt.Println("Running command:", "mysqldump", args)
+// MySQLListDatabases returns every database on the server visible to the user.
+func MySQLListDatabases(ctx context.Context, opts BackupOptions) ([]string, error) {
+	return mysqlQuery(ctx, opts, "", "SHOW DATABASES")
+}
 
-	outfile, err := os.Create(opts.Output)
+// MySQLBackup performs a backup using mysqldump. With a table filter the dump
+// is taken in several mysqldump invocations written to the same file. The
+// native engine dumps over database/sql instead, as does the directory format.
+// With opts.Dump.RecordPosition the dump's binlog position is saved next to
+// it for point-in-time recovery.
+func MySQLBackup(ctx context.Context, opts BackupOptions) error {
+	if err := checkEngine(opts.Engine); err != nil {
+		return err
+	}
+	switch opts.Format {
+	case "", FormatSQL:
+	case FormatDir:
+		return mysqlDirBackup(ctx, opts)
+	default:
+		return fmt.Errorf("%w: format %q (want %s or %s)", ErrDumpOptions, opts.Format, FormatSQL, FormatDir)
+	}
+
+	started := time.Now()
+	var err error
+	if opts.Engine == EngineNative {
+		err = mysqlNativeBackup(ctx, opts)
+	} else {
+		err = mysqlClientBackup(ctx, opts)
+	}
+	if err != nil || !opts.Dump.RecordPosition {
+		return err
+	}
+	return savePosition(opts, started)
+}
+
+// mysqlClientBackup is MySQLBackup for the client engine.
+func mysqlClientBackup(ctx context.Context, opts BackupOptions) error {
+	steps, err := dumpSteps(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if len(steps) > 1 {
+		console.Printf("Note: table filters split the dump into %d mysqldump passes, each with its own snapshot; use engine native for one snapshot\n", len(steps))
+	}
+
+	outfile, err := fsutil.Create(opts.Output, ArtifactPerm)
 	if err != nil {
 		return fmt.Errorf("could not create output file: %w", err)
 	}
-	defer outfile.Close()
+	defer outfile.Abort()
+
+	for _, step := range steps {
+		args := connArgs(opts.Host, opts.Port, opts.User, opts.Password)
+		args = append(args, step...)
 
-	cmd.Stdout = outfile
-	cmd.Stderr = os.Stderr
+		cmd := newCommand(ctx, "mysqldump", args...)
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("mysqldump failed: %w", err)
+		console.Println("Running command:", "mysqldump", args)
+
+		var stderr bytes.Buffer
+		cmd.Stdout = dumpWriter(ctx, outfile, opts.DumpLimit)
+		cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+		if err := runCommand(ctx, cmd); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("mysqldump interrupted: %w", ctx.Err())
+			}
+			return fmt.Errorf("mysqldump failed: %w", classifyClientError(err, stderr.String()))
+		}
+	}
+
+	if err := outfile.Commit(); err != nil {
+		return fmt.Errorf("save dump: %w", err)
 	}
 
 	return nil
 }
 
-// MySQLRestore restores a backup using mysql.
-func MySQLRestore(opts RestoreOptions) error {
-	args := []string{
-		"-h", opts.Host,
-		"-P", fmt.Sprint(opts.Port),
-		"-u", opts.User,
+// MySQLRestore restores a backup using mysql, or statement by statement over
+// database/sql with the native engine. Directory-format backups, or a tar of
+// one, are loaded in parallel. With a target time or GTID, archived binlogs
+// are replayed on top of the backup.
+func MySQLRestore(ctx context.Context, opts RestoreOptions) error {
+	if err := checkEngine(opts.Engine); err != nil {
+		return err
 	}
-
-	if opts.Password != "" {
-		args = append(args, "-p"+opts.Password)
+	if opts.pointInTime() {
+		return mysqlPITRRestore(ctx, opts)
+	}
+	if isDirBackup(opts.Input) {
+		return mysqlDirRestore(ctx, opts)
+	}
+	if opts.Engine == EngineNative {
+		return mysqlNativeRestore(ctx, opts)
 	}
 
+	args := connArgs(opts.Host, opts.Port, opts.User, opts.Password)
 	args = append(args, opts.DBName)
 
-	cmd := exec.Command("mysql", args...)
+	cmd := newCommand(ctx, "mysql", args...)
 
-	fmt.Println("Running command:", "mysql", args)
+	console.Println("Running command:", "mysql", args)
 
 	infile, err := os.Open(opts.Input)
 	if err != nil {
@@ -64,12 +205,16 @@ func MySQLRestore(opts RestoreOptions) error {
 	}
 	defer infile.Close()
 
+	var stderr bytes.Buffer
 	cmd.Stdin = infile
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("mysql restore failed: %w", err)
+	cmd.Stdout = console.Out()
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	if err := runCommand(ctx, cmd); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("mysql restore interrupted: %w", ctx.Err())
+		}
+		return fmt.Errorf("mysql restore failed: %w", classifyClientError(err, stderr.String()))
 	}
 
 	return nil
@@ -0,0 +1,721 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+	"github.com/bhagashetti/db-backup-cli/internal/throttle"
+)
+
+// Engines select how MySQL databases are dumped and restored.
+const (
+	EngineClient = "client" // mysqldump and mysql binaries (the default)
+	EngineNative = "native" // pure Go over database/sql, no client binaries needed
+)
+
+// insertBatchBytes caps the size of one multi-row INSERT in a native dump,
+// well below the default max_allowed_packet of 64MB.
+const insertBatchBytes = 1 << 20
+
+// checkEngine validates an Engine setting.
+func checkEngine(engine string) error {
+	switch engine {
+	case "", EngineClient, EngineNative:
+		return nil
+	}
+	return fmt.Errorf("%w: engine %q (want %s or %s)", ErrDumpOptions, engine, EngineClient, EngineNative)
+}
+
+// openMySQL connects to a MySQL server with the Go driver and checks that the
+// login works. db may be empty.
+func openMySQL(ctx context.Context, host string, port int, user, password, db string) (*sql.DB, error) {
+	cfg := mysql.NewConfig()
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	cfg.User = user
+	cfg.Passwd = password
+	cfg.DBName = db
+	cfg.MaxAllowedPacket = 0 // use the server's max_allowed_packet
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("mysql connection settings: %w", err)
+	}
+
+	sqlDB := sql.OpenDB(connector)
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("connect to %s: %w", cfg.Addr, classifyDriverError(err))
+	}
+	return sqlDB, nil
+}
+
+// classifyDriverError wraps err with ErrConnection if the Go driver could not
+// reach the server, lost the connection, or had the login rejected.
+func classifyDriverError(err error) error {
+	var myErr *mysql.MySQLError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &myErr) && (myErr.Number == 1044 || myErr.Number == 1045):
+	case errors.As(err, &netErr), errors.Is(err, mysql.ErrInvalidConn), errors.Is(err, driver.ErrBadConn):
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrConnection, err)
+}
+
+// nativeQuery is mysqlQuery for the native engine.
+func nativeQuery(ctx context.Context, opts BackupOptions, db, query string) ([]string, error) {
+	sqlDB, err := openMySQL(ctx, opts.Host, opts.Port, opts.User, opts.Password, db)
+	if err != nil {
+		return nil, err
+	}
+	defer sqlDB.Close()
+
+	rows, err := sqlDB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query %q failed: %w", query, classifyDriverError(err))
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	values := make([]sql.NullString, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = v.String
+		}
+		out = append(out, strings.Join(fields, "\t"))
+	}
+	return out, rows.Err()
+}
+
+// mysqlNativeBackup is MySQLBackup for the native engine.
+func mysqlNativeBackup(ctx context.Context, opts BackupOptions) error {
+	if err := checkNativeDump(opts.Dump); err != nil {
+		return err
+	}
+
+	console.Println("Dumping with native engine:", opts.DBName)
+
+	sqlDB, err := openMySQL(ctx, opts.Host, opts.Port, opts.User, opts.Password, opts.DBName)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	outfile, err := fsutil.Create(opts.Output, ArtifactPerm)
+	if err != nil {
+		return fmt.Errorf("could not create output file: %w", err)
+	}
+	defer outfile.Abort()
+
+	if err := WriteMySQLDump(ctx, sqlDB, opts.DBName, dumpWriter(ctx, outfile, opts.DumpLimit), opts.Tables, opts.Dump); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("native dump interrupted: %w", ctx.Err())
+		}
+		return fmt.Errorf("native dump failed: %w", classifyDriverError(err))
+	}
+
+	if err := outfile.Commit(); err != nil {
+		return fmt.Errorf("save dump: %w", err)
+	}
+	return nil
+}
+
+// checkNativeDump rejects dump options only the client engine understands.
+func checkNativeDump(d DumpOptions) error {
+	if len(d.ExtraArgs) > 0 {
+		return fmt.Errorf("%w: extraArgs are mysqldump flags and need the client engine", ErrDumpOptions)
+	}
+	if d.SetGTIDPurged != "" && !strings.EqualFold(d.SetGTIDPurged, "OFF") {
+		return fmt.Errorf("%w: the native engine does not record GTID_PURGED (setGtidPurged must be OFF)", ErrDumpOptions)
+	}
+	if d.RecordPosition && !d.SingleTransaction {
+		return fmt.Errorf("%w: recording the binlog position with the native engine needs singleTransaction", ErrDumpOptions)
+	}
+	return nil
+}
+
+// WriteMySQLDump writes a mysqldump-compatible SQL dump of schema to w: table
+// structure, data as batched multi-row INSERTs, triggers, views, routines
+// and events, according to tables and opts. It needs only a *sql.DB, so any
+// MySQL-compatible server or fixture can be dumped.
+func WriteMySQLDump(ctx context.Context, db *sql.DB, schema string, w io.Writer, tables TableFilter, opts DumpOptions) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	d := &nativeDumper{
+		conn:   conn,
+		w:      bufio.NewWriterSize(w, insertBatchBytes),
+		schema: schema,
+		opts:   opts,
+	}
+	if err := d.dump(ctx, tables); err != nil {
+		return err
+	}
+	return d.w.Flush()
+}
+
+// nativeDumper dumps one schema over a single connection, so every read
+// shares one transaction snapshot.
+type nativeDumper struct {
+	conn   *sql.Conn
+	w      *bufio.Writer
+	schema string
+	opts   DumpOptions
+	limit  *throttle.Limiter // directory format: rate of the chunk files
+}
+
+func (d *nativeDumper) dump(ctx context.Context, filter TableFilter) error {
+	for _, stmt := range []string{"SET SESSION time_zone = '+00:00'", "SET SESSION sql_quote_show_create = 1"} {
+		if _, err := d.conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	if d.opts.SingleTransaction {
+		if _, err := d.conn.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+			return fmt.Errorf("set isolation level: %w", err)
+		}
+		if d.opts.RecordPosition {
+			// Hold writes while the snapshot starts, so the binlog position
+			// read next is exactly where the snapshot sits.
+			if _, err := d.conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+				return fmt.Errorf("lock for binlog position: %w", err)
+			}
+			defer d.conn.ExecContext(context.WithoutCancel(ctx), "UNLOCK TABLES")
+		}
+		if _, err := d.conn.ExecContext(ctx, "START TRANSACTION /*!40100 WITH CONSISTENT SNAPSHOT */"); err != nil {
+			return fmt.Errorf("start snapshot: %w", err)
+		}
+		defer d.conn.ExecContext(context.WithoutCancel(ctx), "ROLLBACK")
+	}
+
+	var pos BinlogPosition
+	if d.opts.RecordPosition {
+		pos = currentBinlogPosition(ctx, d.conn)
+		if _, err := d.conn.ExecContext(ctx, "UNLOCK TABLES"); err != nil {
+			return fmt.Errorf("unlock tables: %w", err)
+		}
+		if pos.File == "" {
+			return fmt.Errorf("%w: binary logging is disabled, so there is no position to record", ErrDumpOptions)
+		}
+	}
+
+	var version string
+	if err := d.conn.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version); err != nil {
+		return fmt.Errorf("read server version: %w", err)
+	}
+
+	rows, err := d.queryStrings(ctx, "SHOW FULL TABLES FROM "+quoteIdent(d.schema))
+	if err != nil {
+		return fmt.Errorf("list tables: %w", err)
+	}
+	var names []string
+	isView := make(map[string]bool)
+	for _, r := range rows {
+		names = append(names, r[0])
+		isView[r[0]] = len(r) > 1 && r[1] == "VIEW"
+	}
+
+	plan, err := planTables(d.schema, names, filter)
+	if err != nil {
+		return err
+	}
+	schemaOnly := make(map[string]bool)
+	for _, t := range plan.schemaOnly {
+		schemaOnly[t] = true
+	}
+	selected := append(append(append([]string(nil), plan.full...), plan.schemaOnly...), plan.filtered...)
+	sort.Strings(selected)
+
+	d.header(version, pos)
+
+	var views []string
+	for _, t := range selected {
+		if isView[t] {
+			views = append(views, t)
+			continue
+		}
+		if err := d.table(ctx, t, !schemaOnly[t], plan.where[t]); err != nil {
+			return fmt.Errorf("table %s: %w", t, err)
+		}
+	}
+
+	if err := d.views(ctx, views); err != nil {
+		return err
+	}
+	if d.opts.Routines {
+		if err := d.routines(ctx); err != nil {
+			return err
+		}
+	}
+	if d.opts.Events {
+		if err := d.events(ctx); err != nil {
+			return err
+		}
+	}
+
+	d.footer()
+	return nil
+}
+
+// header writes the dump preamble. A recorded binlog position is written the
+// way mysqldump --source-data=2 --set-gtid-purged=COMMENTED writes it, so
+// readDumpPosition handles both.
+func (d *nativeDumper) header(version string, pos BinlogPosition) {
+	fmt.Fprintf(d.w, "-- db-backup-cli native MySQL dump\n--\n-- Database: %s\n-- Server version: %s\n\n", d.schema, version)
+	if pos.File != "" {
+		fmt.Fprintf(d.w, "--\n-- Position to start replication or point-in-time recovery from\n--\n\n-- CHANGE REPLICATION SOURCE TO SOURCE_LOG_FILE=%s, SOURCE_LOG_POS=%d;\n\n",
+			quoteString(pos.File), pos.Pos)
+	}
+	if pos.GTIDExecuted != "" {
+		fmt.Fprintf(d.w, "--\n-- GTID state at the beginning of the backup\n--\n\n/* SET @@GLOBAL.GTID_PURGED='+%s'; */\n\n", pos.GTIDExecuted)
+	}
+	d.w.WriteString(`/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;
+/*!40101 SET NAMES utf8mb4 */;
+/*!40103 SET @OLD_TIME_ZONE=@@TIME_ZONE */;
+/*!40103 SET TIME_ZONE='+00:00' */;
+/*!40014 SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0 */;
+/*!40014 SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0 */;
+/*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
+/*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
+`)
+}
+
+func (d *nativeDumper) footer() {
+	d.w.WriteString(`
+/*!40101 SET SQL_MODE=@OLD_SQL_MODE */;
+/*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */;
+/*!40014 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */;
+/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
+/*!40101 SET CHARACTER_SET_CLIENT=@OLD_CHARACTER_SET_CLIENT */;
+/*!40111 SET SQL_NOTES=@OLD_SQL_NOTES */;
+`)
+	fmt.Fprintf(d.w, "\n-- Dump completed on %s\n", time.Now().UTC().Format("2006-01-02 15:04:05"))
+}
+
+// table writes the structure of t and, if withData, its rows matching where
+// (all rows if where is empty), followed by its triggers.
+func (d *nativeDumper) table(ctx context.Context, t string, withData bool, where string) error {
+	create, err := d.showCreate(ctx, "SHOW CREATE TABLE "+quoteIdent(t), "Create Table")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(d.w, "\n--\n-- Table structure for table %s\n--\n\n", quoteIdent(t))
+	fmt.Fprintf(d.w, "DROP TABLE IF EXISTS %s;\n%s;\n", quoteIdent(t), create)
+
+	if withData {
+		n, err := d.tableData(ctx, t, where)
+		if err != nil {
+			return err
+		}
+		console.Printf("  dumped %s: %d rows\n", t, n)
+	}
+
+	if d.opts.Triggers {
+		return d.triggers(ctx, t)
+	}
+	return nil
+}
+
+// column is a dumpable column of a table.
+type column struct {
+	name     string
+	dataType string
+	primary  bool // part of the primary key
+}
+
+func (d *nativeDumper) columns(ctx context.Context, t string) ([]column, error) {
+	rows, err := d.queryStrings(ctx, fmt.Sprintf(
+		"SELECT COLUMN_NAME, DATA_TYPE, EXTRA, COLUMN_KEY FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = %s AND TABLE_NAME = %s ORDER BY ORDINAL_POSITION",
+		quoteString(d.schema), quoteString(t)))
+	if err != nil {
+		return nil, err
+	}
+
+	var cols []column
+	for _, r := range rows {
+		// Generated columns are computed on restore and cannot be inserted.
+		extra := strings.ToUpper(r[2])
+		if strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED") ||
+			strings.Contains(extra, "PERSISTENT GENERATED") {
+			continue
+		}
+		cols = append(cols, column{name: r[0], dataType: strings.ToLower(r[1]), primary: r[3] == "PRI"})
+	}
+	return cols, nil
+}
+
+// tableData writes the rows of t as multi-row INSERTs and returns how many
+// rows it wrote.
+func (d *nativeDumper) tableData(ctx context.Context, t, where string) (int64, error) {
+	cols, err := d.columns(ctx, t)
+	if err != nil {
+		return 0, fmt.Errorf("read columns: %w", err)
+	}
+	if len(cols) == 0 {
+		return 0, nil
+	}
+
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = quoteIdent(c.name)
+	}
+	list := strings.Join(names, ",")
+
+	query := "SELECT " + list + " FROM " + quoteIdent(t)
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := d.conn.QueryContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("select rows: %w", err)
+	}
+	defer rows.Close()
+
+	values := make([]sql.RawBytes, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	fmt.Fprintf(d.w, "\n--\n-- Dumping data for table %s\n--\n\n", quoteIdent(t))
+	fmt.Fprintf(d.w, "/*!40000 ALTER TABLE %s DISABLE KEYS */;\n", quoteIdent(t))
+
+	prefix := "INSERT INTO " + quoteIdent(t) + " (" + list + ") VALUES "
+	var stmt strings.Builder
+	var n int64
+	flush := func() {
+		if stmt.Len() > 0 {
+			d.w.WriteString(stmt.String())
+			d.w.WriteString(";\n")
+			stmt.Reset()
+		}
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		if stmt.Len() == 0 {
+			stmt.WriteString(prefix)
+		} else {
+			stmt.WriteByte(',')
+		}
+		stmt.WriteByte('(')
+		for i, v := range values {
+			if i > 0 {
+				stmt.WriteByte(',')
+			}
+			writeLiteral(&stmt, cols[i].dataType, v, d.opts.HexBlob)
+		}
+		stmt.WriteByte(')')
+		n++
+
+		if stmt.Len() >= insertBatchBytes {
+			flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	flush()
+
+	fmt.Fprintf(d.w, "/*!40000 ALTER TABLE %s ENABLE KEYS */;\n", quoteIdent(t))
+	return n, nil
+}
+
+func (d *nativeDumper) triggers(ctx context.Context, t string) error {
+	rows, err := d.queryStrings(ctx, fmt.Sprintf(
+		"SELECT TRIGGER_NAME FROM information_schema.TRIGGERS WHERE EVENT_OBJECT_SCHEMA = %s AND EVENT_OBJECT_TABLE = %s ORDER BY ACTION_ORDER",
+		quoteString(d.schema), quoteString(t)))
+	if err != nil {
+		return fmt.Errorf("list triggers: %w", err)
+	}
+	for _, r := range rows {
+		create, mode, err := d.showCreateWithMode(ctx, "SHOW CREATE TRIGGER "+quoteIdent(r[0]), "SQL Original Statement")
+		if err != nil {
+			return fmt.Errorf("trigger %s: %w", r[0], err)
+		}
+		d.compound("DROP TRIGGER IF EXISTS "+quoteIdent(r[0]), create, mode)
+	}
+	return nil
+}
+
+// views writes view definitions, each after any view it selects from.
+func (d *nativeDumper) views(ctx context.Context, views []string) error {
+	create := make(map[string]string, len(views))
+	for _, v := range views {
+		stmt, err := d.showCreate(ctx, "SHOW CREATE VIEW "+quoteIdent(v), "Create View")
+		if err != nil {
+			return fmt.Errorf("view %s: %w", v, err)
+		}
+		create[v] = stmt
+	}
+
+	done := make(map[string]bool, len(views))
+	var visit func(v string, depth int)
+	visit = func(v string, depth int) {
+		if done[v] || depth > len(views) {
+			return
+		}
+		for _, other := range views {
+			if other != v && strings.Contains(create[v], quoteIdent(other)) {
+				visit(other, depth+1)
+			}
+		}
+		if done[v] {
+			return
+		}
+		done[v] = true
+		fmt.Fprintf(d.w, "\n--\n-- View structure for view %s\n--\n\n", quoteIdent(v))
+		fmt.Fprintf(d.w, "DROP VIEW IF EXISTS %s;\n%s;\n", quoteIdent(v), create[v])
+	}
+	for _, v := range views {
+		visit(v, 0)
+	}
+	return nil
+}
+
+func (d *nativeDumper) routines(ctx context.Context) error {
+	rows, err := d.queryStrings(ctx, "SELECT ROUTINE_TYPE, ROUTINE_NAME FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = "+
+		quoteString(d.schema)+" ORDER BY ROUTINE_TYPE, ROUTINE_NAME")
+	if err != nil {
+		return fmt.Errorf("list routines: %w", err)
+	}
+	for _, r := range rows {
+		kind, name := r[0], r[1] // PROCEDURE or FUNCTION
+		column := "Create Procedure"
+		if kind == "FUNCTION" {
+			column = "Create Function"
+		}
+		create, mode, err := d.showCreateWithMode(ctx, "SHOW CREATE "+kind+" "+quoteIdent(name), column)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", strings.ToLower(kind), name, err)
+		}
+		if create == "" {
+			return fmt.Errorf("%s %s: definition not visible (missing privileges?)", strings.ToLower(kind), name)
+		}
+		d.compound("DROP "+kind+" IF EXISTS "+quoteIdent(name), create, mode)
+	}
+	return nil
+}
+
+func (d *nativeDumper) events(ctx context.Context) error {
+	rows, err := d.queryStrings(ctx, "SELECT EVENT_NAME FROM information_schema.EVENTS WHERE EVENT_SCHEMA = "+
+		quoteString(d.schema)+" ORDER BY EVENT_NAME")
+	if err != nil {
+		return fmt.Errorf("list events: %w", err)
+	}
+	for _, r := range rows {
+		create, mode, err := d.showCreateWithMode(ctx, "SHOW CREATE EVENT "+quoteIdent(r[0]), "Create Event")
+		if err != nil {
+			return fmt.Errorf("event %s: %w", r[0], err)
+		}
+		d.compound("DROP EVENT IF EXISTS "+quoteIdent(r[0]), create, mode)
+	}
+	return nil
+}
+
+// compound writes a trigger, routine or event body, which may contain
+// semicolons, between DELIMITER ;; lines, under the sql_mode it was created
+// with.
+func (d *nativeDumper) compound(drop, create, sqlMode string) {
+	fmt.Fprintf(d.w, "\n%s;\n", drop)
+	d.w.WriteString("/*!50003 SET @saved_sql_mode = @@sql_mode */;\n")
+	fmt.Fprintf(d.w, "/*!50003 SET sql_mode = %s */;\n", quoteString(sqlMode))
+	fmt.Fprintf(d.w, "DELIMITER ;;\n%s ;;\nDELIMITER ;\n", create)
+	d.w.WriteString("/*!50003 SET sql_mode = @saved_sql_mode */;\n")
+}
+
+// showCreate runs a SHOW CREATE statement and returns the named column.
+func (d *nativeDumper) showCreate(ctx context.Context, query, column string) (string, error) {
+	create, _, err := d.showCreateWithMode(ctx, query, column)
+	return create, err
+}
+
+// showCreateWithMode runs a SHOW CREATE statement and returns the named
+// column and the sql_mode column, if any.
+func (d *nativeDumper) showCreateWithMode(ctx context.Context, query, column string) (string, string, error) {
+	rows, err := d.conn.QueryContext(ctx, query)
+	if err != nil {
+		return "", "", err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", "", err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", "", err
+		}
+		return "", "", fmt.Errorf("%s returned no rows", query)
+	}
+
+	values := make([]sql.NullString, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return "", "", err
+	}
+
+	var create, mode string
+	found := false
+	for i, c := range cols {
+		switch {
+		case strings.EqualFold(c, column):
+			create, found = values[i].String, true
+		case strings.EqualFold(c, "sql_mode"):
+			mode = values[i].String
+		}
+	}
+	if !found {
+		return "", "", fmt.Errorf("%s has no %q column", query, column)
+	}
+	return create, mode, nil
+}
+
+// queryStrings runs a query without arguments and returns every row.
+func (d *nativeDumper) queryStrings(ctx context.Context, query string) ([][]string, error) {
+	rows, err := d.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var out [][]string
+	values := make([]sql.NullString, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = v.String
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// writeLiteral writes v, as read over the text protocol, as a SQL literal for
+// a column of the given data type.
+func writeLiteral(b *strings.Builder, dataType string, v sql.RawBytes, hexBlob bool) {
+	if v == nil {
+		b.WriteString("NULL")
+		return
+	}
+
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint",
+		"decimal", "numeric", "float", "double", "real", "year":
+		b.Write(v)
+		return
+	case "bit":
+		writeHex(b, v)
+		return
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob",
+		"geometry", "point", "linestring", "polygon", "multipoint",
+		"multilinestring", "multipolygon", "geometrycollection", "geomcollection":
+		if hexBlob {
+			writeHex(b, v)
+			return
+		}
+	}
+
+	b.WriteByte('\'')
+	escapeString(b, v)
+	b.WriteByte('\'')
+}
+
+func writeHex(b *strings.Builder, v []byte) {
+	if len(v) == 0 {
+		b.WriteString("''")
+		return
+	}
+	const digits = "0123456789ABCDEF"
+	b.WriteString("0x")
+	for _, c := range v {
+		b.WriteByte(digits[c>>4])
+		b.WriteByte(digits[c&0x0f])
+	}
+}
+
+// escapeString escapes v like mysql_real_escape_string.
+func escapeString(b *strings.Builder, v []byte) {
+	for _, c := range v {
+		switch c {
+		case 0:
+			b.WriteString(`\0`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '"':
+			b.WriteString(`\"`)
+		case 0x1a:
+			b.WriteString(`\Z`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	escapeString(&b, []byte(s))
+	b.WriteByte('\'')
+	return b.String()
+}
@@ -0,0 +1,647 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+)
+
+// fakeServer is an in-memory stand-in for a MySQL server, reached through
+// database/sql. It answers the queries WriteMySQLDump makes from its
+// schema, and records what is executed against it, loading the tables of
+// CREATE TABLE and INSERT statements so a restored dump can be compared
+// with the original.
+type fakeServer struct {
+	mu       sync.Mutex
+	tables   map[string]*fakeTable
+	views    map[string]string // name -> CREATE VIEW
+	triggers map[string][]fakeObject
+	routines []fakeObject // kind is PROCEDURE or FUNCTION
+	events   []fakeObject
+	where    map[string]func(row []any) bool // WHERE clause -> rows it matches
+
+	execs  []string // statements executed, in order
+	failOn string   // Exec fails for a statement containing this
+}
+
+type fakeTable struct {
+	create string
+	cols   []fakeColumn
+	rows   [][]any // nil for NULL, otherwise string
+}
+
+type fakeColumn struct {
+	name, dataType, extra, key string
+}
+
+type fakeObject struct {
+	kind, name, create, sqlMode string
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{
+		tables:   map[string]*fakeTable{},
+		views:    map[string]string{},
+		triggers: map[string][]fakeObject{},
+		where:    map[string]func([]any) bool{},
+	}
+}
+
+// db returns a *sql.DB connected to s.
+func (s *fakeServer) db(t *testing.T) *sql.DB {
+	db := sql.OpenDB(fakeConnector{s})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type fakeConnector struct{ s *fakeServer }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{c.s}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ s *fakeServer }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not supported") }
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), c.s.exec(query)
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	return c.s.query(query)
+}
+
+var (
+	createTableRe = regexp.MustCompile("^CREATE TABLE `([^`]+)`")
+	dropTableRe   = regexp.MustCompile("^DROP TABLE IF EXISTS `([^`]+)`$")
+	insertRe      = regexp.MustCompile("(?s)^INSERT INTO `([^`]+)` \\(([^)]*)\\) VALUES (.*)$")
+)
+
+func (s *fakeServer) exec(stmt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failOn != "" && strings.Contains(stmt, s.failOn) {
+		return fmt.Errorf("fake error for %q", s.failOn)
+	}
+	s.execs = append(s.execs, stmt)
+
+	if m := createTableRe.FindStringSubmatch(stmt); m != nil {
+		s.tables[m[1]] = &fakeTable{create: stmt}
+	} else if m := dropTableRe.FindStringSubmatch(stmt); m != nil {
+		delete(s.tables, m[1])
+	} else if m := insertRe.FindStringSubmatch(stmt); m != nil {
+		t := s.tables[m[1]]
+		if t == nil {
+			return fmt.Errorf("table %s does not exist", m[1])
+		}
+		if t.cols == nil {
+			for _, name := range strings.Split(m[2], ",") {
+				t.cols = append(t.cols, fakeColumn{name: strings.Trim(name, "`")})
+			}
+		}
+		rows, err := parseValues(m[3])
+		if err != nil {
+			return fmt.Errorf("parse INSERT into %s: %w", m[1], err)
+		}
+		t.rows = append(t.rows, rows...)
+	}
+	return nil
+}
+
+var (
+	columnsRe  = regexp.MustCompile(`information_schema\.COLUMNS .* TABLE_NAME = '([^']+)'`)
+	triggersRe = regexp.MustCompile(`information_schema\.TRIGGERS .* EVENT_OBJECT_TABLE = '([^']+)'`)
+	selectRe   = regexp.MustCompile("^SELECT (.+) FROM `([^`]+)`(?: WHERE (.+))?$")
+	showRe     = regexp.MustCompile("^SHOW CREATE (TABLE|VIEW|TRIGGER|PROCEDURE|FUNCTION|EVENT) `([^`]+)`$")
+)
+
+func (s *fakeServer) query(q string) (driver.Rows, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case q == "SELECT VERSION()":
+		return fakeRows([]string{"VERSION()"}, []any{"8.0.36"}), nil
+	case strings.HasPrefix(q, "SHOW FULL TABLES FROM "):
+		var rows [][]any
+		for name := range s.tables {
+			rows = append(rows, []any{name, "BASE TABLE"})
+		}
+		for name := range s.views {
+			rows = append(rows, []any{name, "VIEW"})
+		}
+		return fakeRows([]string{"Tables_in_db", "Table_type"}, rows...), nil
+	case columnsRe.MatchString(q):
+		t := s.tables[columnsRe.FindStringSubmatch(q)[1]]
+		var rows [][]any
+		for _, c := range t.cols {
+			rows = append(rows, []any{c.name, c.dataType, c.extra, c.key})
+		}
+		return fakeRows([]string{"COLUMN_NAME", "DATA_TYPE", "EXTRA", "COLUMN_KEY"}, rows...), nil
+	case triggersRe.MatchString(q):
+		var rows [][]any
+		for _, tr := range s.triggers[triggersRe.FindStringSubmatch(q)[1]] {
+			rows = append(rows, []any{tr.name})
+		}
+		return fakeRows([]string{"TRIGGER_NAME"}, rows...), nil
+	case strings.Contains(q, "information_schema.ROUTINES"):
+		var rows [][]any
+		for _, r := range s.routines {
+			rows = append(rows, []any{r.kind, r.name})
+		}
+		return fakeRows([]string{"ROUTINE_TYPE", "ROUTINE_NAME"}, rows...), nil
+	case strings.Contains(q, "information_schema.EVENTS"):
+		var rows [][]any
+		for _, e := range s.events {
+			rows = append(rows, []any{e.name})
+		}
+		return fakeRows([]string{"EVENT_NAME"}, rows...), nil
+	case showRe.MatchString(q):
+		m := showRe.FindStringSubmatch(q)
+		return s.showCreate(m[1], m[2])
+	case selectRe.MatchString(q):
+		m := selectRe.FindStringSubmatch(q)
+		return s.selectRows(m[2], m[3])
+	}
+	return nil, fmt.Errorf("fake server cannot answer %q", q)
+}
+
+func (s *fakeServer) showCreate(kind, name string) (driver.Rows, error) {
+	switch kind {
+	case "TABLE":
+		if t, ok := s.tables[name]; ok {
+			return fakeRows([]string{"Table", "Create Table"}, []any{name, t.create}), nil
+		}
+	case "VIEW":
+		if v, ok := s.views[name]; ok {
+			return fakeRows([]string{"View", "Create View"}, []any{name, v}), nil
+		}
+	case "TRIGGER":
+		for _, trs := range s.triggers {
+			for _, tr := range trs {
+				if tr.name == name {
+					return fakeRows([]string{"Trigger", "sql_mode", "SQL Original Statement"}, []any{name, tr.sqlMode, tr.create}), nil
+				}
+			}
+		}
+	case "PROCEDURE", "FUNCTION":
+		column := "Create Procedure"
+		if kind == "FUNCTION" {
+			column = "Create Function"
+		}
+		for _, r := range s.routines {
+			if r.kind == kind && r.name == name {
+				return fakeRows([]string{"Procedure", "sql_mode", column}, []any{name, r.sqlMode, r.create}), nil
+			}
+		}
+	case "EVENT":
+		for _, e := range s.events {
+			if e.name == name {
+				return fakeRows([]string{"Event", "sql_mode", "time_zone", "Create Event"}, []any{name, e.sqlMode, "SYSTEM", e.create}), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s %s does not exist", kind, name)
+}
+
+func (s *fakeServer) selectRows(name, where string) (driver.Rows, error) {
+	t, ok := s.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("table %s does not exist", name)
+	}
+	var names []string
+	var keep []int
+	for i, c := range t.cols {
+		if !strings.Contains(c.extra, "GENERATED") {
+			names = append(names, c.name)
+			keep = append(keep, i)
+		}
+	}
+	var rows [][]any
+	for _, r := range t.rows {
+		if where != "" && !s.where[where](r) {
+			continue
+		}
+		row := make([]any, len(keep))
+		for j, i := range keep {
+			row[j] = r[i]
+		}
+		rows = append(rows, row)
+	}
+	return fakeRows(names, rows...), nil
+}
+
+// fakeResult is a result set served over the text protocol: every value is
+// nil or its text as []byte.
+type fakeResult struct {
+	cols []string
+	rows [][]any
+}
+
+func fakeRows(cols []string, rows ...[]any) *fakeResult {
+	return &fakeResult{cols: cols, rows: rows}
+}
+
+func (r *fakeResult) Columns() []string { return r.cols }
+func (r *fakeResult) Close() error      { return nil }
+
+func (r *fakeResult) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	for i, v := range r.rows[0] {
+		if v == nil {
+			dest[i] = nil
+		} else {
+			dest[i] = []byte(v.(string))
+		}
+	}
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// parseValues parses the "(...),(...)" rows of an INSERT as written by
+// writeLiteral.
+func parseValues(s string) ([][]any, error) {
+	var rows [][]any
+	for {
+		if !strings.HasPrefix(s, "(") {
+			return nil, fmt.Errorf("want ( at %.20q", s)
+		}
+		s = s[1:]
+		var row []any
+		for {
+			v, rest, err := parseValue(s)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, v)
+			if rest == "" {
+				return nil, errors.New("unterminated row")
+			}
+			sep := rest[0]
+			s = rest[1:]
+			if sep == ')' {
+				break
+			}
+			if sep != ',' {
+				return nil, fmt.Errorf("want , or ) at %.20q", rest)
+			}
+		}
+		rows = append(rows, row)
+		if s == "" {
+			return rows, nil
+		}
+		if s[0] != ',' {
+			return nil, fmt.Errorf("want , between rows at %.20q", s)
+		}
+		s = s[1:]
+	}
+}
+
+// parseValue parses the literal at the start of s: NULL, a number, a quoted
+// string or a 0x hex string. It returns the value and the rest of s.
+func parseValue(s string) (any, string, error) {
+	if strings.HasPrefix(s, "NULL") {
+		return nil, s[4:], nil
+	}
+	if strings.HasPrefix(s, "'") {
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			c := s[i]
+			switch {
+			case c == '\'':
+				return b.String(), s[i+1:], nil
+			case c == '\\' && i+1 < len(s):
+				i++
+				c = s[i]
+				switch c {
+				case '0':
+					c = 0
+				case 'n':
+					c = '\n'
+				case 'r':
+					c = '\r'
+				case 'Z':
+					c = 0x1a
+				}
+			}
+			b.WriteByte(c)
+		}
+		return nil, "", errors.New("unterminated string")
+	}
+	end := strings.IndexAny(s, ",)")
+	if end <= 0 {
+		return nil, "", fmt.Errorf("bad value at %.20q", s)
+	}
+	if strings.HasPrefix(s, "0x") {
+		data, err := hex.DecodeString(s[2:end])
+		return string(data), s[end:], err
+	}
+	return s[:end], s[end:], nil
+}
+
+// newShopServer returns a fake server with a schema that exercises every
+// part of a dump.
+func newShopServer() *fakeServer {
+	s := newFakeServer()
+
+	s.tables["users"] = &fakeTable{
+		create: "CREATE TABLE `users` (\n  `id` int NOT NULL,\n  `name` varchar(100),\n  `bio` text,\n  `avatar` blob,\n  `name_len` int GENERATED ALWAYS AS (char_length(`name`)) VIRTUAL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB",
+		cols: []fakeColumn{
+			{"id", "int", "", "PRI"},
+			{"name", "varchar", "", ""},
+			{"bio", "text", "", ""},
+			{"avatar", "blob", "", ""},
+			{"name_len", "int", "VIRTUAL GENERATED", ""},
+		},
+		rows: [][]any{
+			{"1", "O'Brien", "line one\nline two; with \"quotes\" and a \\ backslash", "\x00\x01\xff'\x1a", "7"},
+			{"2", "Zoë", "-- not a comment; /* nor this */ # nor this", "", "3"},
+			{"3", nil, "DELIMITER ;;\ttab\r", nil, nil},
+		},
+	}
+
+	// Rows of about 700 bytes, so the table needs several INSERTs.
+	orders := &fakeTable{
+		create: "CREATE TABLE `orders` (\n  `id` bigint NOT NULL,\n  `note` varchar(1000),\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB",
+		cols:   []fakeColumn{{"id", "bigint", "", "PRI"}, {"note", "varchar", "", ""}},
+	}
+	for i := 1; i <= 4000; i++ {
+		orders.rows = append(orders.rows, []any{fmt.Sprint(i), fmt.Sprintf("order %d; %s", i, strings.Repeat("x", 700))})
+	}
+	s.tables["orders"] = orders
+
+	s.tables["sessions"] = &fakeTable{
+		create: "CREATE TABLE `sessions` (\n  `id` int NOT NULL\n) ENGINE=InnoDB",
+		cols:   []fakeColumn{{"id", "int", "", ""}},
+		rows:   [][]any{{"1"}, {"2"}},
+	}
+	s.tables["audit"] = &fakeTable{
+		create: "CREATE TABLE `audit` (\n  `id` int NOT NULL\n) ENGINE=InnoDB",
+		cols:   []fakeColumn{{"id", "int", "", ""}},
+		rows:   [][]any{{"1"}, {"2"}, {"3"}, {"4"}},
+	}
+	s.where["id % 2 = 0"] = func(row []any) bool { return row[0] == "2" || row[0] == "4" }
+
+	// a_summary selects from z_base, so it must come after it.
+	s.views["z_base"] = "CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`%` SQL SECURITY DEFINER VIEW `z_base` AS select `users`.`id` AS `id` from `users`"
+	s.views["a_summary"] = "CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`%` SQL SECURITY DEFINER VIEW `a_summary` AS select count(0) AS `n` from `z_base`"
+
+	s.triggers["users"] = []fakeObject{{
+		name:    "users_bi",
+		create:  "CREATE DEFINER=`root`@`%` TRIGGER `users_bi` BEFORE INSERT ON `users` FOR EACH ROW BEGIN\n  SET NEW.name = TRIM(NEW.name);\n  SET NEW.bio = 'x;y';\nEND",
+		sqlMode: "STRICT_TRANS_TABLES",
+	}}
+	s.routines = []fakeObject{
+		{
+			kind:    "FUNCTION",
+			name:    "order_total",
+			create:  "CREATE DEFINER=`root`@`%` FUNCTION `order_total`(o bigint) RETURNS int\n    DETERMINISTIC\nBEGIN\n  DECLARE t int; -- running total; reset below\n  SET t = 0;\n  RETURN t;\nEND",
+			sqlMode: "",
+		},
+		{
+			kind:    "PROCEDURE",
+			name:    "purge",
+			create:  "CREATE DEFINER=`root`@`%` PROCEDURE `purge`()\nBEGIN\n  DELETE FROM sessions WHERE id < 0; /* ; */\n  SELECT 'done;';\nEND",
+			sqlMode: "ONLY_FULL_GROUP_BY",
+		},
+	}
+	s.events = []fakeObject{{
+		name:    "nightly",
+		create:  "CREATE DEFINER=`root`@`%` EVENT `nightly` ON SCHEDULE EVERY 1 DAY DO BEGIN CALL purge(); END",
+		sqlMode: "",
+	}}
+	return s
+}
+
+func TestMain(m *testing.M) {
+	console.SetOut(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestWriteMySQLDumpRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newShopServer()
+
+	var dump bytes.Buffer
+	filter := TableFilter{
+		SchemaOnly: []string{"sessions"},
+		Where:      map[string]string{"audit": "id % 2 = 0"},
+	}
+	if err := WriteMySQLDump(ctx, src.db(t), "shop", &dump, filter, DefaultDumpOptions()); err != nil {
+		t.Fatalf("WriteMySQLDump: %v", err)
+	}
+
+	if !contains(src.execs, "START TRANSACTION /*!40100 WITH CONSISTENT SNAPSHOT */") || !contains(src.execs, "ROLLBACK") {
+		t.Errorf("dump did not read within one transaction snapshot; executed %q", src.execs)
+	}
+
+	dst := newFakeServer()
+	if err := ExecSQLScript(ctx, dst.db(t), bytes.NewReader(dump.Bytes()), nil); err != nil {
+		t.Fatalf("ExecSQLScript: %v", err)
+	}
+
+	t.Run("rows", func(t *testing.T) {
+		for _, tc := range []struct {
+			table string
+			want  [][]any
+		}{
+			{"users", dropColumn(src.tables["users"].rows, 4)},
+			{"orders", src.tables["orders"].rows},
+			{"audit", [][]any{{"2"}, {"4"}}},
+			{"sessions", nil},
+		} {
+			got, ok := dst.tables[tc.table]
+			if !ok {
+				t.Errorf("table %s was not restored", tc.table)
+				continue
+			}
+			if !reflect.DeepEqual(got.rows, tc.want) {
+				t.Errorf("table %s: restored %d rows, want %d; first differing: %v", tc.table, len(got.rows), len(tc.want), firstDiff(got.rows, tc.want))
+			}
+			if got.create != src.tables[tc.table].create {
+				t.Errorf("table %s: restored as %q, want %q", tc.table, got.create, src.tables[tc.table].create)
+			}
+		}
+	})
+
+	t.Run("batching", func(t *testing.T) {
+		var inserts int
+		for _, stmt := range dst.execs {
+			if !strings.HasPrefix(stmt, "INSERT INTO `orders`") {
+				continue
+			}
+			inserts++
+			// A batch is closed by the first row past insertBatchBytes.
+			if len(stmt) > insertBatchBytes+1024 {
+				t.Errorf("INSERT of %d bytes exceeds the batch size %d", len(stmt), insertBatchBytes)
+			}
+		}
+		if inserts < 2 {
+			t.Errorf("orders was written as %d INSERTs, want several batches", inserts)
+		}
+	})
+
+	t.Run("objects", func(t *testing.T) {
+		var want []string
+		for _, v := range []string{"z_base", "a_summary"} {
+			want = append(want, src.views[v])
+		}
+		want = append(want, src.triggers["users"][0].create)
+		for _, r := range src.routines {
+			want = append(want, r.create)
+		}
+		want = append(want, src.events[0].create)
+		for _, create := range want {
+			if !contains(dst.execs, create) {
+				t.Errorf("not executed as one statement:\n%s", create)
+			}
+		}
+		if index(dst.execs, src.views["z_base"]) > index(dst.execs, src.views["a_summary"]) {
+			t.Error("view a_summary was created before z_base, which it selects from")
+		}
+		if !contains(dst.execs, "/*!50003 SET sql_mode = 'ONLY_FULL_GROUP_BY' */") {
+			t.Error("procedure was not created under its own sql_mode")
+		}
+	})
+}
+
+func TestWriteMySQLDumpOptions(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		opts    func(*DumpOptions)
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "defaults",
+			opts: func(*DumpOptions) {},
+			want: []string{"TRIGGER `users_bi`", "FUNCTION `order_total`", "EVENT `nightly`", "0x0001FF271A"},
+		},
+		{
+			name:    "no routines, triggers or events",
+			opts:    func(d *DumpOptions) { d.Routines, d.Triggers, d.Events = false, false, false },
+			notWant: []string{"TRIGGER", "FUNCTION", "PROCEDURE", "EVENT"},
+		},
+		{
+			name:    "no hex blobs",
+			opts:    func(d *DumpOptions) { d.HexBlob = false },
+			want:    []string{`'\0` + "\x01\xff" + `\'\Z'`},
+			notWant: []string{"0x0001FF271A"},
+		},
+		{
+			name:    "no single transaction",
+			opts:    func(d *DumpOptions) { d.SingleTransaction = false },
+			notWant: []string{"START TRANSACTION"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			src := newShopServer()
+			opts := DefaultDumpOptions()
+			tc.opts(&opts)
+
+			var dump bytes.Buffer
+			if err := WriteMySQLDump(ctx, src.db(t), "shop", &dump, TableFilter{}, opts); err != nil {
+				t.Fatalf("WriteMySQLDump: %v", err)
+			}
+			out := dump.String() + strings.Join(src.execs, "\n")
+			for _, s := range tc.want {
+				if !strings.Contains(out, s) {
+					t.Errorf("dump lacks %q", s)
+				}
+			}
+			for _, s := range tc.notWant {
+				if strings.Contains(out, s) {
+					t.Errorf("dump contains %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteMySQLDumpUnknownTable(t *testing.T) {
+	src := newShopServer()
+	err := WriteMySQLDump(context.Background(), src.db(t), "shop", io.Discard, TableFilter{Exclude: []string{"nope"}}, DefaultDumpOptions())
+	if !errors.Is(err, ErrTableFilter) {
+		t.Fatalf("got %v, want ErrTableFilter", err)
+	}
+}
+
+func TestWriteLiteral(t *testing.T) {
+	tests := []struct {
+		dataType string
+		value    sql.RawBytes
+		hexBlob  bool
+		want     string
+	}{
+		{"int", sql.RawBytes("42"), true, "42"},
+		{"decimal", sql.RawBytes("-1.50"), true, "-1.50"},
+		{"varchar", nil, true, "NULL"},
+		{"varchar", sql.RawBytes(""), true, "''"},
+		{"varchar", sql.RawBytes("it's \"x\"\n\\"), true, `'it\'s \"x\"\n\\'`},
+		{"text", sql.RawBytes("a\x00b\x1a\r"), true, `'a\0b\Z\r'`},
+		{"blob", sql.RawBytes("\x00\xff"), true, "0x00FF"},
+		{"blob", sql.RawBytes("\x00\xff"), false, "'\\0\xff'"},
+		{"blob", sql.RawBytes(""), true, "''"},
+		{"bit", sql.RawBytes("\x05"), false, "0x05"},
+		{"datetime", sql.RawBytes("2024-01-02 03:04:05"), true, "'2024-01-02 03:04:05'"},
+	}
+	for _, tc := range tests {
+		var b strings.Builder
+		writeLiteral(&b, tc.dataType, tc.value, tc.hexBlob)
+		if b.String() != tc.want {
+			t.Errorf("writeLiteral(%s, %q, hexBlob=%v) = %s, want %s", tc.dataType, tc.value, tc.hexBlob, b.String(), tc.want)
+		}
+	}
+}
+
+func contains(stmts []string, s string) bool { return index(stmts, s) >= 0 }
+
+func index(stmts []string, s string) int {
+	for i, stmt := range stmts {
+		if stmt == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// dropColumn returns rows without column i.
+func dropColumn(rows [][]any, i int) [][]any {
+	var out [][]any
+	for _, r := range rows {
+		out = append(out, append(append([]any(nil), r[:i]...), r[i+1:]...))
+	}
+	return out
+}
+
+func firstDiff(got, want [][]any) string {
+	for i := range min(len(got), len(want)) {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			return fmt.Sprintf("row %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+	return "none"
+}
@@ -0,0 +1,261 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+)
+
+// ErrPITR reports a point-in-time restore that the backups and archived
+// binlogs at hand cannot satisfy, found before anything is restored.
+var ErrPITR = errors.New("point-in-time restore not possible")
+
+// pointInTime reports whether opts asks for a point-in-time restore.
+func (opts RestoreOptions) pointInTime() bool {
+	return !opts.ToTime.IsZero() || opts.ToGTID != ""
+}
+
+// mysqlPITRRestore restores the newest full backup taken before the target,
+// then replays the archived binlogs from its recorded position up to the
+// target. opts.Input may be a backup or a directory of backups.
+func mysqlPITRRestore(ctx context.Context, opts RestoreOptions) error {
+	if opts.BinlogDir == "" {
+		return fmt.Errorf("%w: a binlog archive directory is required", ErrPITR)
+	}
+	if !opts.ToTime.IsZero() && opts.ToGTID != "" {
+		return fmt.Errorf("%w: give either a target time or a target GTID, not both", ErrPITR)
+	}
+
+	var target gtidSet
+	if opts.ToGTID != "" {
+		var err error
+		if target, err = parseGTIDSet(opts.ToGTID); err != nil {
+			return fmt.Errorf("%w: %w", ErrPITR, err)
+		}
+	}
+
+	base, pos, err := findBaseBackup(opts.Input, opts.ToTime, target)
+	if err != nil {
+		return err
+	}
+	files, err := binlogsFrom(opts.BinlogDir, pos.File)
+	if err != nil {
+		return err
+	}
+
+	console.Printf("Point-in-time restore: base backup %s (finished %s, binlog %s:%d), then %d binlog(s)\n",
+		base, pos.Finished.Format(time.RFC3339), pos.File, pos.Pos, len(files))
+
+	full := opts
+	full.Input = base
+	full.ToTime, full.ToGTID = time.Time{}, ""
+	if err := MySQLRestore(ctx, full); err != nil {
+		return err
+	}
+
+	return replayBinlogs(ctx, opts, pos, files, target)
+}
+
+// findBaseBackup picks the backup to start from: the one that finished last
+// before toTime, or whose GTIDs do not go past target. Backups without a
+// recorded binlog position are skipped.
+func findBaseBackup(in string, toTime time.Time, target gtidSet) (string, BinlogPosition, error) {
+	candidates := []string{in}
+	if info, err := os.Stat(in); err == nil && info.IsDir() && !isDirBackup(in) {
+		entries, err := os.ReadDir(in)
+		if err != nil {
+			return "", BinlogPosition{}, fmt.Errorf("read backups: %w", err)
+		}
+		candidates = candidates[:0]
+		for _, e := range entries {
+			if !strings.HasSuffix(e.Name(), positionSuffix) {
+				candidates = append(candidates, filepath.Join(in, e.Name()))
+			}
+		}
+	}
+
+	var best string
+	var bestPos BinlogPosition
+	for _, c := range candidates {
+		pos, ok := backupPosition(c)
+		if !ok {
+			continue
+		}
+		if target != nil {
+			if pos.GTIDExecuted == "" {
+				continue
+			}
+			executed, err := parseGTIDSet(pos.GTIDExecuted)
+			if err != nil || !executed.notPast(target) {
+				continue
+			}
+		} else if pos.Finished.After(toTime) {
+			continue
+		}
+		if best == "" || pos.Finished.After(bestPos.Finished) {
+			best, bestPos = c, pos
+		}
+	}
+
+	if best == "" {
+		return "", BinlogPosition{}, fmt.Errorf("%w: no backup in %s with a recorded binlog position was taken before the target", ErrPITR, in)
+	}
+	return best, bestPos, nil
+}
+
+// binlogsFrom returns the archived binlogs from first onwards, checking that
+// none are missing in between.
+func binlogsFrom(dir, first string) ([]string, error) {
+	files, err := archivedBinlogs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPITR, err)
+	}
+
+	i := sort.SearchStrings(files, first)
+	if i == len(files) || files[i] != first {
+		return nil, fmt.Errorf("%w: binlog %s is not in the archive %s", ErrPITR, first, dir)
+	}
+	files = files[i:]
+
+	for j := 1; j < len(files); j++ {
+		if binlogSeq(files[j]) != binlogSeq(files[j-1])+1 {
+			return nil, fmt.Errorf("%w: binlog archive %s is missing files between %s and %s", ErrPITR, dir, files[j-1], files[j])
+		}
+	}
+
+	paths := make([]string, len(files))
+	for j, f := range files {
+		paths[j] = filepath.Join(dir, f)
+	}
+	return paths, nil
+}
+
+// replayBinlogs pipes mysqlbinlog into mysql, starting at pos and stopping at
+// the target. Only statements for the backed-up database are replayed,
+// renamed if it is restored under another name.
+func replayBinlogs(ctx context.Context, opts RestoreOptions, pos BinlogPosition, files []string, target gtidSet) error {
+	args := []string{fmt.Sprintf("--start-position=%d", pos.Pos)}
+	if target != nil {
+		args = append(args, "--include-gtids="+target.String())
+	} else {
+		// Replayed transactions get new GTIDs, so a server that already
+		// executed the originals does not skip them.
+		args = append(args, "--skip-gtids", "--stop-datetime="+opts.ToTime.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if pos.Database != "" && pos.Database != opts.DBName {
+		args = append(args, "--rewrite-db="+pos.Database+"->"+opts.DBName)
+	}
+	args = append(args, "--database="+opts.DBName)
+	args = append(args, files...)
+
+	console.Println("Replaying binlogs:", "mysqlbinlog", args)
+
+	binlog := newCommand(ctx, "mysqlbinlog", args...)
+	binlog.Env = append(os.Environ(), "TZ=UTC") // --stop-datetime is in local time
+	var binlogErr bytes.Buffer
+	binlog.Stderr = io.MultiWriter(os.Stderr, &binlogErr)
+	stream, err := binlog.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	clientArgs := append(connArgs(opts.Host, opts.Port, opts.User, opts.Password), opts.DBName)
+	client := newCommand(ctx, "mysql", clientArgs...)
+	var clientErr bytes.Buffer
+	client.Stdin = stream
+	client.Stdout = console.Out()
+	client.Stderr = io.MultiWriter(os.Stderr, &clientErr)
+
+	if err := startCommand(ctx, binlog); err != nil {
+		return fmt.Errorf("start mysqlbinlog: %w", err)
+	}
+	if err := startCommand(ctx, client); err != nil {
+		binlog.Process.Kill()
+		binlog.Wait()
+		return fmt.Errorf("start mysql: %w", err)
+	}
+	// mysql holds the read end now; without our copy, mysqlbinlog gets
+	// EPIPE instead of blocking if mysql exits early.
+	stream.Close()
+
+	clientWait := client.Wait()
+	binlogWait := binlog.Wait()
+
+	switch {
+	case ctx.Err() != nil:
+		return fmt.Errorf("binlog replay interrupted: %w", ctx.Err())
+	case clientWait != nil:
+		return fmt.Errorf("binlog replay failed: %w", classifyClientError(clientWait, clientErr.String()))
+	case binlogWait != nil:
+		return fmt.Errorf("mysqlbinlog failed: %w: %s", binlogWait, strings.TrimSpace(binlogErr.String()))
+	}
+
+	console.Println("Binlogs replayed up to the target.")
+	return nil
+}
+
+// gtidSet maps each source UUID to the highest transaction number in a GTID
+// set. Gaps are ignored: a target means "everything up to and including".
+type gtidSet map[string]int64
+
+// parseGTIDSet parses "uuid:1-5:7,uuid2:3" or a single "uuid:42".
+func parseGTIDSet(s string) (gtidSet, error) {
+	set := make(gtidSet)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) < 2 || fields[0] == "" {
+			return nil, fmt.Errorf("bad GTID set %q", s)
+		}
+		uuid := strings.ToLower(fields[0])
+		for _, interval := range fields[1:] {
+			_, end, found := strings.Cut(interval, "-")
+			if !found {
+				end = interval
+			}
+			n, err := strconv.ParseInt(end, 10, 64)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("bad GTID set %q", s)
+			}
+			set[uuid] = max(set[uuid], n)
+		}
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("empty GTID set %q", s)
+	}
+	return set, nil
+}
+
+// notPast reports whether s has no transaction beyond target for any of the
+// target's sources.
+func (s gtidSet) notPast(target gtidSet) bool {
+	for uuid, n := range target {
+		if s[uuid] > n {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the set as "uuid:1-N,...", sorted by UUID.
+func (s gtidSet) String() string {
+	parts := make([]string, 0, len(s))
+	for uuid, n := range s {
+		parts = append(parts, fmt.Sprintf("%s:1-%d", uuid, n))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
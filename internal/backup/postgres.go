@@ -0,0 +1,325 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+)
+
+// FormatBaseBackup is a physical PostgreSQL backup of the whole cluster made
+// with pg_basebackup: a directory holding base.tar.gz and pg_wal.tar.gz.
+const FormatBaseBackup = "basebackup"
+
+// baseBackupFile marks a directory as a pg_basebackup backup.
+const baseBackupFile = "base.tar.gz"
+
+// IsDirFormat reports whether format produces a directory instead of a file.
+func IsDirFormat(format string) bool {
+	return format == FormatDir || format == FormatBaseBackup
+}
+
+// pgEnv returns the environment for a PostgreSQL client. The password goes
+// in PGPASSWORD rather than on the command line.
+func pgEnv(password string) []string {
+	env := os.Environ()
+	if password != "" {
+		env = append(env, "PGPASSWORD="+password)
+	}
+	return env
+}
+
+// pgConnArgs returns the connection arguments shared by pg_dump, psql and
+// pg_basebackup. -w fails instead of prompting for a missing password.
+func pgConnArgs(host string, port int, user string) []string {
+	return []string{"-h", host, "-p", fmt.Sprint(port), "-U", user, "-w"}
+}
+
+// PostgresBackup dumps opts.DBName with pg_dump, or with FormatBaseBackup
+// takes a physical backup of the whole cluster with pg_basebackup.
+func PostgresBackup(ctx context.Context, opts BackupOptions) error {
+	switch opts.Format {
+	case "", FormatSQL:
+		return pgDump(ctx, opts)
+	case FormatBaseBackup:
+		return pgBaseBackup(ctx, opts)
+	default:
+		return fmt.Errorf("%w: format %q for postgres (want %s or %s)", ErrDumpOptions, opts.Format, FormatSQL, FormatBaseBackup)
+	}
+}
+
+func pgDump(ctx context.Context, opts BackupOptions) error {
+	outfile, err := fsutil.Create(opts.Output, ArtifactPerm)
+	if err != nil {
+		return fmt.Errorf("could not create output file: %w", err)
+	}
+	defer outfile.Abort()
+
+	args := append(pgConnArgs(opts.Host, opts.Port, opts.User), "-d", opts.DBName)
+	console.Println("Running command:", "pg_dump", args)
+
+	cmd := newCommand(ctx, "pg_dump", args...)
+	cmd.Env = pgEnv(opts.Password)
+	if err := runClient(ctx, cmd, dumpWriter(ctx, outfile, opts.DumpLimit), "pg_dump"); err != nil {
+		return err
+	}
+
+	if err := outfile.Commit(); err != nil {
+		return fmt.Errorf("save dump: %w", err)
+	}
+	return nil
+}
+
+// pgBaseBackup writes a compressed tar-format base backup, including the WAL
+// needed to make it consistent, into the directory opts.Output.
+func pgBaseBackup(ctx context.Context, opts BackupOptions) error {
+	dir, err := fsutil.CreateDir(opts.Output, 0700)
+	if err != nil {
+		return err
+	}
+	defer dir.Abort()
+
+	args := append(pgConnArgs(opts.Host, opts.Port, opts.User),
+		"-D", dir.Path, "-Ft", "-z", "-X", "stream", "-c", "fast", "-l", "db-backup-cli "+time.Now().UTC().Format(time.RFC3339))
+	// pg_basebackup reads from the server itself; it takes a fixed rate,
+	// so the one in force at the start applies to the whole run.
+	if rate := opts.DumpLimit.Rate(time.Now()); rate > 0 {
+		args = append(args, "--max-rate", fmt.Sprintf("%dk", min(max(rate/1024, 32), 1024*1024)))
+	}
+	console.Println("Running command:", "pg_basebackup", args)
+
+	cmd := newCommand(ctx, "pg_basebackup", args...)
+	cmd.Env = pgEnv(opts.Password)
+	if err := runClient(ctx, cmd, console.Out(), "pg_basebackup"); err != nil {
+		return err
+	}
+
+	if err := dir.Commit(); err != nil {
+		return fmt.Errorf("save base backup: %w", err)
+	}
+	return nil
+}
+
+// runClient runs a database client with stdout going to w, classifying its
+// failure from what it printed on stderr.
+func runClient(ctx context.Context, cmd *exec.Cmd, w io.Writer, name string) error {
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	if err := runCommand(ctx, cmd); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s interrupted: %w", name, ctx.Err())
+		}
+		return fmt.Errorf("%s failed: %w", name, classifyClientError(err, stderr.String()))
+	}
+	return nil
+}
+
+// PostgresRestore loads a pg_dump file with psql. A pg_basebackup backup is
+// instead unpacked into opts.DataDir, ready for Postgres to start on; with
+// opts.ToTime or opts.WALConfig it is set up to recover from the WAL archive.
+func PostgresRestore(ctx context.Context, opts RestoreOptions) error {
+	if _, err := os.Stat(filepath.Join(opts.Input, baseBackupFile)); err == nil {
+		return prepareDataDir(ctx, opts)
+	}
+	if !opts.ToTime.IsZero() {
+		return fmt.Errorf("%w: a postgres point-in-time restore needs a base backup (format %s)", ErrPITR, FormatBaseBackup)
+	}
+
+	infile, err := os.Open(opts.Input)
+	if err != nil {
+		return fmt.Errorf("could not open input file: %w", err)
+	}
+	defer infile.Close()
+
+	args := append(pgConnArgs(opts.Host, opts.Port, opts.User), "-v", "ON_ERROR_STOP=1", "-q", "-d", opts.DBName)
+	console.Println("Running command:", "psql", args)
+
+	cmd := newCommand(ctx, "psql", args...)
+	cmd.Env = pgEnv(opts.Password)
+	cmd.Stdin = infile
+	return runClient(ctx, cmd, console.Out(), "psql restore")
+}
+
+// prepareDataDir unpacks a base backup into opts.DataDir, which must be empty
+// or absent. With a WAL archive config it also writes recovery.signal and the
+// recovery settings to postgresql.auto.conf, so that starting Postgres on the
+// directory replays archived WAL up to opts.ToTime, or to the end of the
+// archive, and then promotes.
+func prepareDataDir(ctx context.Context, opts RestoreOptions) error {
+	if opts.DataDir == "" {
+		return fmt.Errorf("%w: restoring a base backup needs a data directory", ErrPITR)
+	}
+	if !opts.ToTime.IsZero() && opts.WALConfig == "" {
+		return fmt.Errorf("%w: a target time needs a WAL archive config for restore_command", ErrPITR)
+	}
+
+	entries, err := os.ReadDir(opts.Input)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tar.gz") && e.Name() != baseBackupFile && e.Name() != "pg_wal.tar.gz" {
+			return fmt.Errorf("base backup has tablespace archive %s; tablespaces are not supported", e.Name())
+		}
+	}
+
+	if existing, err := os.ReadDir(opts.DataDir); err == nil && len(existing) > 0 {
+		return fmt.Errorf("data directory %s is not empty", opts.DataDir)
+	}
+	if err := os.MkdirAll(opts.DataDir, 0700); err != nil {
+		return fmt.Errorf("create data directory: %w", err)
+	}
+	if err := os.Chmod(opts.DataDir, 0700); err != nil {
+		return err
+	}
+
+	console.Println("Unpacking base backup into", opts.DataDir)
+	if err := extractTarGz(ctx, filepath.Join(opts.Input, baseBackupFile), opts.DataDir); err != nil {
+		return err
+	}
+	walTar := filepath.Join(opts.Input, "pg_wal.tar.gz")
+	if _, err := os.Stat(walTar); err == nil {
+		walDir := filepath.Join(opts.DataDir, "pg_wal")
+		if err := os.MkdirAll(walDir, 0700); err != nil {
+			return err
+		}
+		if err := extractTarGz(ctx, walTar, walDir); err != nil {
+			return err
+		}
+	}
+
+	if opts.WALConfig != "" {
+		if err := writeRecoveryConfig(opts); err != nil {
+			return err
+		}
+	}
+
+	console.Println("Data directory is ready. Start PostgreSQL on it to finish the restore, e.g.:")
+	console.Printf("  pg_ctl -D %s start\n", opts.DataDir)
+	return nil
+}
+
+// writeRecoveryConfig makes the data directory recover from the WAL archive
+// through this program's archive-wal fetch command.
+func writeRecoveryConfig(opts RestoreOptions) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate db-backup-cli for restore_command: %w", err)
+	}
+	walConfig, err := filepath.Abs(opts.WALConfig)
+	if err != nil {
+		return err
+	}
+
+	restoreCommand := fmt.Sprintf("%s archive-wal fetch -config %s %%f %%p", shellQuote(exe), shellQuote(walConfig))
+	settings := []string{
+		"",
+		"# Added by db-backup-cli restore",
+		"restore_command = " + pgQuote(restoreCommand),
+	}
+	if !opts.ToTime.IsZero() {
+		settings = append(settings,
+			"recovery_target_time = "+pgQuote(opts.ToTime.Format("2006-01-02 15:04:05.999999-07:00")),
+			"recovery_target_action = 'promote'",
+		)
+		console.Println("Recovery target time:", opts.ToTime.Format(time.RFC3339))
+	}
+
+	conf, err := os.OpenFile(filepath.Join(opts.DataDir, "postgresql.auto.conf"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = conf.WriteString(strings.Join(settings, "\n") + "\n")
+	if cerr := conf.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write recovery settings: %w", err)
+	}
+
+	return fsutil.WriteFile(filepath.Join(opts.DataDir, "recovery.signal"), nil, 0600)
+}
+
+// pgQuote quotes s as a postgresql.conf string value.
+func pgQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// shellQuote quotes s for sh if it contains anything but safe characters.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789/._-+:@") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// extractTarGz unpacks directories and regular files from a gzipped tar into
+// dst. Entries may not leave dst; links and special files are rejected.
+func extractTarGz(ctx context.Context, src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", src, err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", src, err)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s: entry %q is outside the archive", src, hdr.Name)
+		}
+		target := filepath.Join(dst, name)
+		mode := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, contextReader{ctx, tr})
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return fmt.Errorf("unpack %s: %w", hdr.Name, err)
+			}
+		default:
+			return fmt.Errorf("%s: unsupported entry %q (type %c)", src, hdr.Name, hdr.Typeflag)
+		}
+	}
+}
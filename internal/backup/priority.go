@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+)
+
+// I/O scheduling classes for Priority.IOClass, as in ionice.
+const (
+	IOClassBestEffort = "best-effort"
+	IOClassIdle       = "idle"
+)
+
+// Priority lowers the CPU and I/O priority of child processes such as
+// mysqldump, so a backup competes less with the database it reads from.
+// The zero value leaves priorities alone.
+type Priority struct {
+	Nice    int    // 1-19, higher is nicer; 0 leaves it unchanged
+	IOClass string // IOClassBestEffort or IOClassIdle; "" leaves it unchanged
+	IOLevel int    // 0-7 within best-effort, higher is lower priority
+}
+
+// ParseIONice parses an ionice setting: "idle", "best-effort" or
+// "best-effort:<0-7>".
+func ParseIONice(s string) (class string, level int, err error) {
+	class, lvl, hasLevel := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	switch class {
+	case "":
+		return "", 0, nil
+	case IOClassIdle:
+		if hasLevel {
+			return "", 0, fmt.Errorf("ionice %q: the idle class has no level", s)
+		}
+		return class, 0, nil
+	case IOClassBestEffort:
+		level = 4
+		if hasLevel {
+			if level, err = strconv.Atoi(lvl); err != nil || level < 0 || level > 7 {
+				return "", 0, fmt.Errorf("ionice %q: level must be 0-7", s)
+			}
+		}
+		return class, level, nil
+	default:
+		return "", 0, fmt.Errorf("ionice %q: want idle, best-effort or best-effort:<0-7>", s)
+	}
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose child processes run with p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// priorityWarning makes a failure to set priorities be reported once.
+var priorityWarning sync.Once
+
+// startCommand starts cmd and applies the context's Priority to it. The
+// child runs at normal priority for the moment in between. Failing to lower
+// it is only a warning.
+func startCommand(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p != (Priority{}) {
+		if err := setPriority(cmd.Process.Pid, p); err != nil {
+			priorityWarning.Do(func() {
+				console.Println("Warning: could not lower child process priority:", err)
+			})
+		}
+	}
+	return nil
+}
+
+// runCommand is cmd.Run with the context's Priority applied.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	if err := startCommand(ctx, cmd); err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
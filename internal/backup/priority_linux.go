@@ -0,0 +1,33 @@
+package backup
+
+import "syscall"
+
+// ioprio_set arguments; see ioprio_set(2).
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+)
+
+// setPriority sets the niceness and I/O class of process pid.
+func setPriority(pid int, p Priority) error {
+	if p.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, p.Nice); err != nil {
+			return err
+		}
+	}
+	var prio uintptr
+	switch p.IOClass {
+	case IOClassBestEffort:
+		prio = ioprioClassBE<<ioprioClassShift | uintptr(p.IOLevel)
+	case IOClassIdle:
+		prio = ioprioClassIdle << ioprioClassShift
+	default:
+		return nil
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), prio); errno != 0 {
+		return errno
+	}
+	return nil
+}
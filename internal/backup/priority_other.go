@@ -0,0 +1,10 @@
+//go:build !linux
+
+package backup
+
+import "errors"
+
+// setPriority is only implemented on Linux.
+func setPriority(int, Priority) error {
+	return errors.New("nice and ionice are only supported on Linux")
+}
@@ -0,0 +1,535 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"strconv"
+)
+
+// RDB opcodes and the value types this reader can split into DUMP payloads.
+// See rdb.h in the Redis sources.
+const (
+	rdbOpSlotInfo     = 0xF4
+	rdbOpFunction2    = 0xF5
+	rdbOpFunctionPre  = 0xF6
+	rdbOpModuleAux    = 0xF7
+	rdbOpIdle         = 0xF8
+	rdbOpFreq         = 0xF9
+	rdbOpAux          = 0xFA
+	rdbOpResizeDB     = 0xFB
+	rdbOpExpireTimeMS = 0xFC
+	rdbOpExpireTime   = 0xFD
+	rdbOpSelectDB     = 0xFE
+	rdbOpEOF          = 0xFF
+
+	rdbTypeString          = 0
+	rdbTypeList            = 1
+	rdbTypeSet             = 2
+	rdbTypeZSet            = 3
+	rdbTypeHash            = 4
+	rdbTypeZSet2           = 5
+	rdbTypeHashZipmap      = 9
+	rdbTypeListZiplist     = 10
+	rdbTypeSetIntset       = 11
+	rdbTypeZSetZiplist     = 12
+	rdbTypeHashZiplist     = 13
+	rdbTypeListQuicklist   = 14
+	rdbTypeStreamListpacks = 15
+	rdbTypeHashListpack    = 16
+	rdbTypeZSetListpack    = 17
+	rdbTypeListQuicklist2  = 18
+	rdbTypeStream2         = 19
+	rdbTypeSetListpack     = 20
+	rdbTypeStream3         = 21
+	rdbTypeHashMetadata    = 24
+	rdbTypeHashListpackEx  = 25
+)
+
+// rdbMaxString guards against allocating absurd sizes for a corrupt file.
+const rdbMaxString = 1 << 32
+
+// redisCRC is the CRC-64/Jones table used by RDB files and DUMP payloads.
+var redisCRC = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// crc64Redis extends the Redis CRC-64 crc with p. Redis uses no initial or
+// final inversion, which crc64.Update applies.
+func crc64Redis(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, redisCRC, p)
+}
+
+// rdbEntry is one key, or one function library, read from an RDB file.
+type rdbEntry struct {
+	DB       int
+	Key      string
+	ExpireMS int64  // absolute Unix milliseconds, 0 for none
+	Payload  []byte // the value as a DUMP payload, ready for RESTORE
+	Function string // set instead of Key: library code for FUNCTION LOAD
+}
+
+// rdbReader decodes an RDB stream, keeping its checksum and, while capture
+// is set, a copy of the raw bytes of the value being read.
+type rdbReader struct {
+	r       *bufio.Reader
+	crc     uint64
+	capture *bytes.Buffer
+}
+
+func (d *rdbReader) read(n uint64) ([]byte, error) {
+	if n > rdbMaxString {
+		return nil, fmt.Errorf("corrupt RDB: length %d", n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("read RDB: %w", err)
+	}
+	d.crc = crc64Redis(d.crc, buf)
+	if d.capture != nil {
+		d.capture.Write(buf)
+	}
+	return buf, nil
+}
+
+func (d *rdbReader) byte() (byte, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// length reads a length. encoded reports a special string encoding, whose
+// kind is then returned as the length.
+func (d *rdbReader) length() (n uint64, encoded bool, err error) {
+	b, err := d.byte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		b2, err := d.byte()
+		return uint64(b&0x3f)<<8 | uint64(b2), false, err
+	case 2:
+		switch b {
+		case 0x80:
+			buf, err := d.read(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(buf)), false, nil
+		case 0x81:
+			buf, err := d.read(8)
+			if err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(buf), false, nil
+		}
+		return 0, false, fmt.Errorf("corrupt RDB: length prefix %#x", b)
+	default:
+		return uint64(b & 0x3f), true, nil
+	}
+}
+
+func (d *rdbReader) plainLength() (uint64, error) {
+	n, encoded, err := d.length()
+	if err == nil && encoded {
+		err = errors.New("corrupt RDB: encoded value where a length was expected")
+	}
+	return n, err
+}
+
+// str reads a string. Unless decode is set, LZF-compressed strings are only
+// skipped and nil is returned.
+func (d *rdbReader) str(decode bool) ([]byte, error) {
+	n, encoded, err := d.length()
+	if err != nil || !encoded {
+		if err != nil {
+			return nil, err
+		}
+		return d.read(n)
+	}
+
+	switch n {
+	case 0, 1, 2:
+		buf, err := d.read(1 << n)
+		if err != nil {
+			return nil, err
+		}
+		var v int64
+		switch n {
+		case 0:
+			v = int64(int8(buf[0]))
+		case 1:
+			v = int64(int16(binary.LittleEndian.Uint16(buf)))
+		case 2:
+			v = int64(int32(binary.LittleEndian.Uint32(buf)))
+		}
+		return strconv.AppendInt(nil, v, 10), nil
+	case 3:
+		clen, err := d.plainLength()
+		if err != nil {
+			return nil, err
+		}
+		ulen, err := d.plainLength()
+		if err != nil {
+			return nil, err
+		}
+		data, err := d.read(clen)
+		if err != nil || !decode {
+			return nil, err
+		}
+		return lzfDecompress(data, ulen)
+	}
+	return nil, fmt.Errorf("corrupt RDB: string encoding %d", n)
+}
+
+// skip reads n strings.
+func (d *rdbReader) skip(n uint64) error {
+	for range n {
+		if _, err := d.str(false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *rdbReader) skipLengths(n int) error {
+	for range n {
+		if _, err := d.plainLength(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipValue reads a value of type t.
+func (d *rdbReader) skipValue(t byte) error {
+	switch t {
+	case rdbTypeString, rdbTypeHashZipmap, rdbTypeListZiplist, rdbTypeSetIntset,
+		rdbTypeZSetZiplist, rdbTypeHashZiplist, rdbTypeHashListpack, rdbTypeZSetListpack, rdbTypeSetListpack:
+		return d.skip(1)
+
+	case rdbTypeList, rdbTypeSet, rdbTypeListQuicklist:
+		n, err := d.plainLength()
+		if err != nil {
+			return err
+		}
+		return d.skip(n)
+
+	case rdbTypeHash:
+		n, err := d.plainLength()
+		if err != nil {
+			return err
+		}
+		return d.skip(2 * n)
+
+	case rdbTypeZSet, rdbTypeZSet2:
+		n, err := d.plainLength()
+		if err != nil {
+			return err
+		}
+		for range n {
+			if err := d.skip(1); err != nil {
+				return err
+			}
+			if t == rdbTypeZSet2 {
+				_, err = d.read(8)
+			} else {
+				err = d.skipDoubleString()
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case rdbTypeListQuicklist2:
+		n, err := d.plainLength()
+		if err != nil {
+			return err
+		}
+		for range n {
+			if err := d.skipLengths(1); err != nil { // container
+				return err
+			}
+			if err := d.skip(1); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case rdbTypeHashMetadata:
+		if _, err := d.read(8); err != nil { // min field expire time
+			return err
+		}
+		n, err := d.plainLength()
+		if err != nil {
+			return err
+		}
+		for range n {
+			if err := d.skipLengths(1); err != nil { // field TTL
+				return err
+			}
+			if err := d.skip(2); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case rdbTypeHashListpackEx:
+		if _, err := d.read(8); err != nil {
+			return err
+		}
+		return d.skip(1)
+
+	case rdbTypeStreamListpacks, rdbTypeStream2, rdbTypeStream3:
+		return d.skipStream(t)
+	}
+	return fmt.Errorf("unsupported RDB value type %d (module types and values newer than this tool cannot be split into keys)", t)
+}
+
+// skipDoubleString reads a score of the original ZSET type: a length byte
+// followed by the score as text, with 253-255 meaning NaN and infinities.
+func (d *rdbReader) skipDoubleString() error {
+	n, err := d.byte()
+	if err != nil || n >= 253 {
+		return err
+	}
+	_, err = d.read(uint64(n))
+	return err
+}
+
+func (d *rdbReader) skipStream(t byte) error {
+	listpacks, err := d.plainLength()
+	if err != nil {
+		return err
+	}
+	if err := d.skip(2 * listpacks); err != nil { // master ID and listpack
+		return err
+	}
+
+	// Length and last ID; version 2 adds first ID, max deleted ID and
+	// entries added.
+	fields := 3
+	if t >= rdbTypeStream2 {
+		fields += 5
+	}
+	if err := d.skipLengths(fields); err != nil {
+		return err
+	}
+
+	groups, err := d.plainLength()
+	if err != nil {
+		return err
+	}
+	for range groups {
+		if err := d.skip(1); err != nil { // name
+			return err
+		}
+		fields := 2 // last ID
+		if t >= rdbTypeStream2 {
+			fields++ // entries read
+		}
+		if err := d.skipLengths(fields); err != nil {
+			return err
+		}
+
+		pending, err := d.plainLength()
+		if err != nil {
+			return err
+		}
+		for range pending {
+			if _, err := d.read(16 + 8); err != nil { // ID and delivery time
+				return err
+			}
+			if err := d.skipLengths(1); err != nil { // delivery count
+				return err
+			}
+		}
+
+		consumers, err := d.plainLength()
+		if err != nil {
+			return err
+		}
+		for range consumers {
+			if err := d.skip(1); err != nil { // name
+				return err
+			}
+			times := 8 // seen time
+			if t >= rdbTypeStream3 {
+				times += 8 // active time
+			}
+			if _, err := d.read(uint64(times)); err != nil {
+				return err
+			}
+			owned, err := d.plainLength()
+			if err != nil {
+				return err
+			}
+			if _, err := d.read(16 * owned); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readRDB reads an RDB file and calls fn for every key and function library
+// in it, checking the file's checksum at the end.
+func readRDB(ctx context.Context, r io.Reader, fn func(rdbEntry) error) error {
+	d := &rdbReader{r: bufio.NewReaderSize(r, 256*1024)}
+
+	header, err := d.read(9)
+	if err != nil {
+		return err
+	}
+	if string(header[:5]) != "REDIS" {
+		return errors.New("not an RDB file")
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return fmt.Errorf("not an RDB file: version %q", header[5:])
+	}
+	footer := binary.LittleEndian.AppendUint16(nil, uint16(version))
+
+	db := 0
+	var expire int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		op, err := d.byte()
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case rdbOpAux:
+			err = d.skip(2)
+		case rdbOpResizeDB:
+			err = d.skipLengths(2)
+		case rdbOpSlotInfo:
+			err = d.skipLengths(3)
+		case rdbOpExpireTimeMS:
+			var buf []byte
+			if buf, err = d.read(8); err == nil {
+				expire = int64(binary.LittleEndian.Uint64(buf))
+			}
+		case rdbOpExpireTime:
+			var buf []byte
+			if buf, err = d.read(4); err == nil {
+				expire = int64(binary.LittleEndian.Uint32(buf)) * 1000
+			}
+		case rdbOpSelectDB:
+			var n uint64
+			n, err = d.plainLength()
+			db = int(n)
+		case rdbOpFreq:
+			_, err = d.byte()
+		case rdbOpIdle:
+			err = d.skipLengths(1)
+		case rdbOpFunction2:
+			var code []byte
+			if code, err = d.str(true); err == nil {
+				err = fn(rdbEntry{DB: db, Function: string(code)})
+			}
+		case rdbOpFunctionPre, rdbOpModuleAux:
+			return fmt.Errorf("unsupported RDB opcode %#x (pre-release functions or module data)", op)
+		case rdbOpEOF:
+			want := d.crc
+			sum, err := d.read(8)
+			if err != nil {
+				if version < 5 {
+					return nil
+				}
+				return err
+			}
+			if got := binary.LittleEndian.Uint64(sum); got != 0 && got != want {
+				return fmt.Errorf("RDB checksum mismatch: file says %016x, content is %016x", got, want)
+			}
+			return nil
+		default:
+			key, err := d.str(true)
+			if err != nil {
+				return err
+			}
+			d.capture = bytes.NewBuffer([]byte{op})
+			err = d.skipValue(op)
+			payload := d.capture.Bytes()
+			d.capture = nil
+			if err != nil {
+				return fmt.Errorf("key %q: %w", key, err)
+			}
+
+			payload = append(payload, footer...)
+			payload = binary.LittleEndian.AppendUint64(payload, crc64Redis(0, payload))
+			if err := fn(rdbEntry{DB: db, Key: string(key), ExpireMS: expire, Payload: payload}); err != nil {
+				return err
+			}
+			expire = 0
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// lzfDecompress expands LZF data, as used for compressed RDB strings, to
+// exactly n bytes.
+func lzfDecompress(in []byte, n uint64) ([]byte, error) {
+	if n > rdbMaxString {
+		return nil, fmt.Errorf("corrupt RDB: LZF length %d", n)
+	}
+	out := make([]byte, 0, n)
+	corrupt := errors.New("corrupt RDB: bad LZF data")
+
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 { // literal run of ctrl+1 bytes
+			run := ctrl + 1
+			if i+run > len(in) {
+				return nil, corrupt
+			}
+			out = append(out, in[i:i+run]...)
+			i += run
+			continue
+		}
+
+		// Back reference.
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, corrupt
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, corrupt
+		}
+		ref := len(out) - ((ctrl&0x1f)<<8 | int(in[i])) - 1
+		i++
+		if ref < 0 {
+			return nil, corrupt
+		}
+		for j := range length + 2 {
+			out = append(out, out[ref+j])
+		}
+	}
+
+	if uint64(len(out)) != n {
+		return nil, corrupt
+	}
+	return out, nil
+}
@@ -0,0 +1,432 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+)
+
+// Ways to take a Redis snapshot.
+const (
+	// SnapshotSync pulls an RDB over the replication protocol, like
+	// redis-cli --rdb. It works against remote servers.
+	SnapshotSync = "sync"
+
+	// SnapshotBGSave runs BGSAVE, waits for LASTSAVE to move, and copies
+	// the server's RDB file. The server's data directory must be readable
+	// from this host.
+	SnapshotBGSave = "bgsave"
+)
+
+// redisPollInterval is how often a BGSAVE is checked for completion.
+const redisPollInterval = time.Second
+
+// redisRestoreBatch is how many RESTORE commands are pipelined at once.
+const redisRestoreBatch = 256
+
+// RedisBackup writes an RDB snapshot of the Redis server to opts.Output.
+// opts.DBName only names the backup: the snapshot holds every database.
+func RedisBackup(ctx context.Context, opts BackupOptions) error {
+	if IsDirFormat(opts.Format) {
+		return fmt.Errorf("%w: format %q for redis (backups are single RDB files)", ErrDumpOptions, opts.Format)
+	}
+
+	conn, err := dialRedis(ctx, opts.Host, opts.Port, opts.User, opts.Password)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	out, err := fsutil.Create(opts.Output, ArtifactPerm)
+	if err != nil {
+		return fmt.Errorf("could not create output file: %w", err)
+	}
+	defer out.Abort()
+
+	switch opts.Snapshot {
+	case "", SnapshotSync:
+		err = redisSync(ctx, conn, dumpWriter(ctx, out, opts.DumpLimit))
+	case SnapshotBGSave:
+		err = redisBGSave(ctx, conn, dumpWriter(ctx, out, opts.DumpLimit))
+	default:
+		return fmt.Errorf("%w: snapshot %q (want %s or %s)", ErrDumpOptions, opts.Snapshot, SnapshotSync, SnapshotBGSave)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("redis snapshot interrupted: %w", ctx.Err())
+		}
+		return err
+	}
+
+	if err := checkRDBHeader(out.Name()); err != nil {
+		return err
+	}
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("save snapshot: %w", err)
+	}
+	return nil
+}
+
+// redisSync asks for a full resynchronisation and saves the RDB the server
+// sends. REPLCONF rdb-only (Redis 7+) makes the server hang up after the RDB
+// instead of streaming commands; older servers are simply disconnected.
+func redisSync(ctx context.Context, conn *redisConn, w io.Writer) error {
+	console.Println("Requesting RDB snapshot over replication (SYNC)")
+	if _, err := conn.do("REPLCONF", "rdb-only", "1"); err != nil {
+		var rerr redisError
+		if !errors.As(err, &rerr) {
+			return err
+		}
+	}
+
+	conn.send("SYNC")
+	if err := conn.flush(); err != nil {
+		return err
+	}
+
+	// The server sends newlines as keepalives while it prepares the RDB.
+	var header string
+	for {
+		line, err := conn.readLine()
+		if err != nil {
+			return fmt.Errorf("SYNC: %w", err)
+		}
+		if line == "" {
+			continue
+		}
+		if line[0] == '-' {
+			return fmt.Errorf("SYNC: %w", redisError(line[1:]))
+		}
+		if line[0] != '$' {
+			return fmt.Errorf("SYNC: unexpected reply %q", line)
+		}
+		header = line[1:]
+		break
+	}
+
+	src := contextReader{ctx, conn.r}
+	if mark, ok := strings.CutPrefix(header, "EOF:"); ok {
+		// Diskless replication: the RDB ends with the 40-byte mark.
+		return copyUntilMark(w, src, []byte(mark))
+	}
+	n, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		return fmt.Errorf("SYNC: bad RDB length %q", header)
+	}
+	if _, err := io.CopyN(w, src, n); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("SYNC: read RDB: %w", err)
+	}
+	return nil
+}
+
+// copyUntilMark copies r to w up to, and not including, mark.
+func copyUntilMark(w io.Writer, r io.Reader, mark []byte) error {
+	chunk := make([]byte, 64*1024)
+	var pending []byte
+	for {
+		n, err := r.Read(chunk)
+		pending = append(pending, chunk[:n]...)
+		if len(pending) >= len(mark) && bytes.Equal(pending[len(pending)-len(mark):], mark) {
+			_, werr := w.Write(pending[:len(pending)-len(mark)])
+			return werr
+		}
+		// Hold back what could be the start of the mark.
+		if keep := len(pending) - len(mark); keep > 0 {
+			if _, werr := w.Write(pending[:keep]); werr != nil {
+				return werr
+			}
+			pending = append(pending[:0], pending[keep:]...)
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("SYNC: read RDB: %w", err)
+		}
+	}
+}
+
+// redisBGSave has the server save its RDB, waits until LASTSAVE shows the new
+// save, then copies the file from the server's data directory.
+func redisBGSave(ctx context.Context, conn *redisConn, w io.Writer) error {
+	dir, err := conn.configGet("dir")
+	if err != nil {
+		return err
+	}
+	name, err := conn.configGet("dbfilename")
+	if err != nil {
+		return err
+	}
+
+	last, err := startBGSave(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(redisPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		now, err := conn.doInt("LASTSAVE")
+		if err != nil {
+			return fmt.Errorf("LASTSAVE: %w", err)
+		}
+		if now > last {
+			break
+		}
+		info, err := conn.info("persistence")
+		if err != nil {
+			return err
+		}
+		if info["rdb_bgsave_in_progress"] == "0" && info["rdb_last_bgsave_status"] == "err" {
+			return errors.New("BGSAVE failed; see the Redis server log")
+		}
+	}
+
+	path := filepath.Join(dir, name)
+	console.Println("Copying", path)
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open server RDB (bgsave needs the server's data directory on this host): %w", err)
+	}
+	defer in.Close()
+	if _, err := io.Copy(w, contextReader{ctx, in}); err != nil {
+		return fmt.Errorf("copy %s: %w", path, err)
+	}
+	return nil
+}
+
+// startBGSave starts a BGSAVE and returns LASTSAVE from just before it. A
+// save or AOF rewrite already running may have forked before the backup was
+// asked for, so it is waited out and BGSAVE tried again.
+func startBGSave(ctx context.Context, conn *redisConn) (int64, error) {
+	for {
+		last, err := conn.doInt("LASTSAVE")
+		if err != nil {
+			return 0, fmt.Errorf("LASTSAVE: %w", err)
+		}
+		// LASTSAVE has one-second resolution, so a save finishing in the
+		// same second as the previous one would go unnoticed.
+		now, err := redisTime(conn)
+		if err != nil {
+			return 0, err
+		}
+		if now.Unix() <= last {
+			time.Sleep(time.Unix(last+1, 0).Sub(now))
+		}
+
+		console.Println("Running BGSAVE")
+		_, err = conn.do("BGSAVE")
+		if err == nil {
+			return last, nil
+		}
+		if !strings.Contains(err.Error(), "in progress") {
+			return 0, fmt.Errorf("BGSAVE: %w", err)
+		}
+
+		console.Println("Waiting for the running save or AOF rewrite:", err)
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(redisPollInterval):
+		}
+	}
+}
+
+// redisTime returns the server's clock, which LASTSAVE is measured by.
+func redisTime(conn *redisConn) (time.Time, error) {
+	reply, err := conn.do("TIME")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("TIME: %w", err)
+	}
+	items, _ := reply.([]any)
+	if len(items) != 2 {
+		return time.Time{}, fmt.Errorf("TIME: unexpected reply %v", reply)
+	}
+	sec, err1 := strconv.ParseInt(fmt.Sprint(items[0]), 10, 64)
+	usec, err2 := strconv.ParseInt(fmt.Sprint(items[1]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, fmt.Errorf("TIME: unexpected reply %v", reply)
+	}
+	return time.Unix(sec, usec*1000), nil
+}
+
+// checkRDBHeader checks that path starts like an RDB file.
+func checkRDBHeader(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(f, header); err != nil || string(header[:5]) != "REDIS" {
+		return fmt.Errorf("%s is not an RDB file", path)
+	}
+	return nil
+}
+
+// RedisRestore restores an RDB snapshot. With opts.DataDir the file is placed
+// in a stopped server's data directory to be loaded at startup; otherwise
+// every key is replayed into the running server with RESTORE ... REPLACE.
+func RedisRestore(ctx context.Context, opts RestoreOptions) error {
+	if err := checkRDBHeader(opts.Input); err != nil {
+		return err
+	}
+	if opts.DataDir != "" {
+		return placeRDB(ctx, opts)
+	}
+	return restoreKeys(ctx, opts)
+}
+
+// placeRDB copies the snapshot to opts.DataDir/dump.rdb, or to opts.DataDir
+// itself if that names an .rdb file. Files it replaces, and AOF files that
+// Redis would load instead, are renamed with a .bak suffix.
+func placeRDB(ctx context.Context, opts RestoreOptions) error {
+	target := opts.DataDir
+	if !strings.HasSuffix(target, ".rdb") {
+		target = filepath.Join(target, "dump.rdb")
+	}
+	dir := filepath.Dir(target)
+
+	// A server running on the directory would overwrite the file when it
+	// next saves or shuts down.
+	if conn, err := dialRedis(ctx, opts.Host, opts.Port, opts.User, opts.Password); err == nil {
+		serverDir, err := conn.configGet("dir")
+		conn.Close()
+		if err == nil && sameDir(serverDir, dir) {
+			return fmt.Errorf("server at %s:%d is running on %s; stop Redis before restoring into its data directory", opts.Host, opts.Port, dir)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("create data directory: %w", err)
+	}
+	for _, name := range []string{filepath.Base(target), "appendonly.aof", "appendonlydir"} {
+		old := filepath.Join(dir, name)
+		if _, err := os.Lstat(old); err != nil {
+			continue
+		}
+		bak := old + ".bak"
+		if err := os.RemoveAll(bak); err != nil {
+			return err
+		}
+		if err := os.Rename(old, bak); err != nil {
+			return fmt.Errorf("move aside %s: %w", old, err)
+		}
+		console.Println("Moved", old, "to", bak)
+	}
+
+	console.Println("Copying snapshot to", target)
+	if err := copyFile(ctx, opts.Input, target); err != nil {
+		return err
+	}
+	console.Println("Start Redis with dir", dir, "and dbfilename", filepath.Base(target), "to load it.")
+	console.Println("Start it with appendonly no; turn AOF on afterwards with CONFIG SET appendonly yes.")
+	return nil
+}
+
+// sameDir reports whether a and b name the same directory.
+func sameDir(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	return err == nil && os.SameFile(ia, ib)
+}
+
+// restoreKeys replays every key in the snapshot with RESTORE, pipelining
+// commands in batches. Keys keep their database number and absolute expiry;
+// keys that have already expired are skipped.
+func restoreKeys(ctx context.Context, opts RestoreOptions) error {
+	in, err := os.Open(opts.Input)
+	if err != nil {
+		return fmt.Errorf("could not open input file: %w", err)
+	}
+	defer in.Close()
+
+	conn, err := dialRedis(ctx, opts.Host, opts.Port, opts.User, opts.Password)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var (
+		batch    []string // key, or function marker, of each pipelined command
+		db       = -1
+		restored int
+		expired  int
+	)
+	flushBatch := func() error {
+		if err := conn.flush(); err != nil {
+			return err
+		}
+		for _, what := range batch {
+			if _, err := conn.receive(); err != nil {
+				var rerr redisError
+				if errors.As(err, &rerr) {
+					return fmt.Errorf("restore %s: %w", what, err)
+				}
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	now := time.Now().UnixMilli()
+	err = readRDB(ctx, bufio.NewReader(in), func(e rdbEntry) error {
+		if e.Function != "" {
+			conn.send("FUNCTION", "LOAD", "REPLACE", e.Function)
+			batch = append(batch, "function library")
+		} else {
+			if e.ExpireMS != 0 && e.ExpireMS <= now {
+				expired++
+				return nil
+			}
+			if e.DB != db {
+				conn.send("SELECT", strconv.Itoa(e.DB))
+				batch = append(batch, fmt.Sprintf("SELECT %d", e.DB))
+				db = e.DB
+			}
+			conn.send("RESTORE", e.Key, strconv.FormatInt(e.ExpireMS, 10), string(e.Payload), "REPLACE", "ABSTTL")
+			batch = append(batch, "key "+strconv.Quote(e.Key))
+			restored++
+		}
+		if len(batch) >= redisRestoreBatch {
+			return flushBatch()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flushBatch()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("redis restore interrupted after %d keys: %w", restored, ctx.Err())
+		}
+		return err
+	}
+
+	console.Printf("Restored %d keys (%d already expired, skipped)\n", restored, expired)
+	return nil
+}
@@ -0,0 +1,420 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a RESP server that answers each command with what handle
+// returns. If hangup is set it closes the connection after the reply.
+type fakeRedis struct {
+	host   string
+	port   int
+	handle func(cmd []string) (reply string, hangup bool)
+
+	mu   sync.Mutex
+	cmds [][]string
+}
+
+func newFakeRedis(t *testing.T, handle func(cmd []string) (string, bool)) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	addr := ln.Addr().(*net.TCPAddr)
+	s := &fakeRedis{host: addr.IP.String(), port: addr.Port, handle: handle}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.cmds = append(s.cmds, cmd)
+		s.mu.Unlock()
+		reply, hangup := s.handle(cmd)
+		if _, err := io.WriteString(conn, reply); err != nil || hangup {
+			return
+		}
+	}
+}
+
+// commands returns the commands received so far, with RESTORE payloads
+// left out.
+func (s *fakeRedis) commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, cmd := range s.cmds {
+		if cmd[0] == "RESTORE" {
+			cmd = []string{cmd[0], cmd[1], cmd[2], "<payload>", cmd[4], cmd[5]}
+		}
+		out = append(out, strings.Join(cmd, " "))
+	}
+	return out
+}
+
+// readCommand reads one command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	cmd := make([]string, n)
+	for i := range cmd {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		cmd[i] = string(buf[:size])
+	}
+	return cmd, nil
+}
+
+func bulk(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+
+func array(items ...string) string {
+	return fmt.Sprintf("*%d\r\n%s", len(items), strings.Join(items, ""))
+}
+
+func TestRedisReceive(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    any
+		wantErr string
+	}{
+		{"simple string", "+OK\r\n", "OK", ""},
+		{"integer", ":1700000000\r\n", int64(1700000000), ""},
+		{"bulk string", "$5\r\nhello\r\n", "hello", ""},
+		{"empty bulk string", "$0\r\n\r\n", "", ""},
+		{"binary bulk string", "$4\r\na\r\nb\r\n", "a\r\nb", ""},
+		{"null bulk string", "$-1\r\n", nil, ""},
+		{"array", "*2\r\n$3\r\ndir\r\n$9\r\n/var/data\r\n", []any{"dir", "/var/data"}, ""},
+		{"nested array", "*2\r\n:1\r\n*1\r\n+x\r\n", []any{int64(1), []any{"x"}}, ""},
+		{"error in an array", "*2\r\n+OK\r\n-BUSYKEY exists\r\n", []any{"OK", redisError("BUSYKEY exists")}, ""},
+		{"null array", "*-1\r\n", nil, ""},
+		{"error reply", "-ERR unknown command 'SYNC'\r\n", nil, "ERR unknown command 'SYNC'"},
+		{"bad bulk length", "$x\r\n", nil, "bad bulk length"},
+		{"negative bulk length", "$-2\r\n", nil, "bad bulk length"},
+		{"bad array length", "*-5\r\n", nil, "bad array length"},
+		{"unknown type", "!oops\r\n", nil, "unexpected reply"},
+		{"empty line", "\r\n", nil, "empty reply"},
+		{"cut in a bulk string", "$10\r\nhello", nil, "EOF"},
+		{"cut in an array", "*3\r\n:1\r\n", nil, "EOF"},
+		{"no reply", "", nil, "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &redisConn{r: bufio.NewReader(strings.NewReader(tt.raw))}
+			got, err := c.receive()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("receive error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("receive: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("receive = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	var rerr redisError
+	c := &redisConn{r: bufio.NewReader(strings.NewReader("-WRONGPASS invalid\r\n"))}
+	if _, err := c.receive(); !errors.As(err, &rerr) {
+		t.Errorf("error reply %v is not a redisError", err)
+	}
+}
+
+// testRDB is a small RDB file: a header, one string key and the end.
+var testRDB = "REDIS0011" + "\x00\x01k\x01v" + "\xff" + strings.Repeat("\x00", 8)
+
+func TestRedisBackupSync(t *testing.T) {
+	mark := strings.Repeat("m", 40)
+	tests := []struct {
+		name     string
+		sync     string // raw reply to SYNC
+		hangup   bool
+		replconf string
+		wantErr  string
+	}{
+		{"length prefixed", "\n\n" + "$" + strconv.Itoa(len(testRDB)) + "\r\n" + testRDB, false, "+OK\r\n", ""},
+		{"diskless", "$EOF:" + mark + "\r\n" + testRDB + mark, true, "+OK\r\n", ""},
+		{"old server without rdb-only", "$" + strconv.Itoa(len(testRDB)) + "\r\n" + testRDB + "*1\r\n$4\r\nPING\r\n", false, "-ERR Unrecognized REPLCONF option\r\n", ""},
+		{"error reply", "-NOPERM this user has no permissions to run the 'sync' command\r\n", false, "+OK\r\n", "NOPERM"},
+		{"unexpected reply", "+FULLRESYNC abc 0\r\n", false, "+OK\r\n", "unexpected reply"},
+		{"bad length", "$lots\r\n", false, "+OK\r\n", "bad RDB length"},
+		{"interrupted", "$1000\r\n" + testRDB, true, "+OK\r\n", "unexpected EOF"},
+		{"interrupted diskless", "$EOF:" + mark + "\r\n" + testRDB, true, "+OK\r\n", "unexpected EOF"},
+		{"not an RDB", "$9\r\nNOTREDIS!", false, "+OK\r\n", "not an RDB file"},
+		{"hangup before the RDB", "", true, "+OK\r\n", "SYNC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeRedis(t, func(cmd []string) (string, bool) {
+				switch cmd[0] {
+				case "AUTH":
+					return "+OK\r\n", false
+				case "REPLCONF":
+					return tt.replconf, false
+				case "SYNC":
+					return tt.sync, tt.hangup
+				}
+				return "-ERR unknown command\r\n", false
+			})
+
+			out := filepath.Join(t.TempDir(), "cache.rdb")
+			opts := BackupOptions{DBType: "redis", Host: s.host, Port: s.port, Password: "secret", Output: out, Snapshot: SnapshotSync}
+			err := RedisBackup(context.Background(), opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RedisBackup error = %v, want one containing %q", err, tt.wantErr)
+				}
+				if _, err := os.Stat(out); err == nil {
+					t.Error("a failed backup left its output behind")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RedisBackup: %v", err)
+			}
+			if got, _ := os.ReadFile(out); string(got) != testRDB {
+				t.Errorf("saved %q, want %q", got, testRDB)
+			}
+			if cmds := s.commands(); !reflect.DeepEqual(cmds, []string{"AUTH secret", "REPLCONF rdb-only 1", "SYNC"}) {
+				t.Errorf("commands = %q", cmds)
+			}
+		})
+	}
+}
+
+func TestRedisBackupBGSave(t *testing.T) {
+	tests := []struct {
+		name    string
+		bgsave  []string // replies to each BGSAVE
+		failed  bool     // the save fails instead of moving LASTSAVE
+		wantErr string
+	}{
+		{"saved", []string{"+Background saving started\r\n"}, false, ""},
+		{"waits for a running save", []string{"-ERR Background save already in progress\r\n", "+Background saving started\r\n"}, false, ""},
+		{"refused", []string{"-MISCONF no disk\r\n"}, false, "MISCONF"},
+		{"save fails", []string{"+Background saving started\r\n"}, true, "BGSAVE failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "dump.rdb"), []byte(testRDB), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			lastSave, saves := int64(1000), 0
+			s := newFakeRedis(t, func(cmd []string) (string, bool) {
+				mu.Lock()
+				defer mu.Unlock()
+				switch strings.Join(cmd, " ") {
+				case "CONFIG GET dir":
+					return array(bulk("dir"), bulk(dir)), false
+				case "CONFIG GET dbfilename":
+					return array(bulk("dbfilename"), bulk("dump.rdb")), false
+				case "TIME":
+					return array(bulk("2000"), bulk("0")), false
+				case "LASTSAVE":
+					return fmt.Sprintf(":%d\r\n", lastSave), false
+				case "INFO persistence":
+					return bulk("# Persistence\r\nrdb_bgsave_in_progress:0\r\nrdb_last_bgsave_status:err\r\n"), false
+				case "BGSAVE":
+					reply := tt.bgsave[saves]
+					saves++
+					if strings.HasPrefix(reply, "+") && !tt.failed {
+						lastSave++
+					}
+					return reply, false
+				}
+				return "-ERR unknown command\r\n", false
+			})
+
+			out := filepath.Join(t.TempDir(), "cache.rdb")
+			opts := BackupOptions{DBType: "redis", Host: s.host, Port: s.port, Output: out, Snapshot: SnapshotBGSave}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err := RedisBackup(ctx, opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RedisBackup error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RedisBackup: %v", err)
+			}
+			if got, _ := os.ReadFile(out); string(got) != testRDB {
+				t.Errorf("copied %q, want %q", got, testRDB)
+			}
+		})
+	}
+}
+
+// rdbString encodes s, shorter than 64 bytes, as an RDB string.
+func rdbString(s string) string { return string([]byte{byte(len(s))}) + s }
+
+// rdbExpire encodes an expiry in Unix milliseconds.
+func rdbExpire(ms uint64) string {
+	return "\xfc" + string(binary.LittleEndian.AppendUint64(nil, ms))
+}
+
+// restoreRDB holds keys in two databases: one without an expiry, one
+// expiring in 2100, one that expired in 1970, and one in database 2.
+func restoreRDB() []byte {
+	var b bytes.Buffer
+	b.WriteString("REDIS0011")
+	b.WriteString("\xfa" + rdbString("redis-ver") + rdbString("7.2.4"))
+	b.WriteString("\xfe\x00")
+	b.WriteString("\x00" + rdbString("plain") + rdbString("1"))
+	b.WriteString(rdbExpire(4102444800000) + "\x00" + rdbString("later") + rdbString("2"))
+	b.WriteString(rdbExpire(1) + "\x00" + rdbString("gone") + rdbString("3"))
+	b.WriteString("\xfe\x02")
+	b.WriteString("\x00" + rdbString("other") + rdbString("4"))
+	b.WriteString("\xff" + strings.Repeat("\x00", 8))
+	return b.Bytes()
+}
+
+func TestRedisRestoreKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		restore  string // reply to RESTORE
+		wantErr  string
+		wantCmds []string
+	}{
+		{
+			name:    "restored",
+			restore: "+OK\r\n",
+			wantCmds: []string{
+				"SELECT 0",
+				"RESTORE plain 0 <payload> REPLACE ABSTTL",
+				"RESTORE later 4102444800000 <payload> REPLACE ABSTTL",
+				"SELECT 2",
+				"RESTORE other 0 <payload> REPLACE ABSTTL",
+			},
+		},
+		{
+			name:    "error reply",
+			restore: "-ERR DUMP payload version or checksum are wrong\r\n",
+			wantErr: `restore key "plain": ERR DUMP payload`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			payloads := map[string][]byte{}
+			s := newFakeRedis(t, func(cmd []string) (string, bool) {
+				switch cmd[0] {
+				case "SELECT":
+					return "+OK\r\n", false
+				case "RESTORE":
+					mu.Lock()
+					payloads[cmd[1]] = []byte(cmd[3])
+					mu.Unlock()
+					return tt.restore, false
+				}
+				return "-ERR unknown command\r\n", false
+			})
+
+			in := filepath.Join(t.TempDir(), "cache.rdb")
+			if err := os.WriteFile(in, restoreRDB(), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			err := RedisRestore(context.Background(), RestoreOptions{DBType: "redis", Host: s.host, Port: s.port, Input: in})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RedisRestore error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RedisRestore: %v", err)
+			}
+			if cmds := s.commands(); !reflect.DeepEqual(cmds, tt.wantCmds) {
+				t.Errorf("commands = %q, want %q", cmds, tt.wantCmds)
+			}
+
+			// A DUMP payload is the type, the value, the RDB version and
+			// a CRC-64 of those.
+			p := payloads["plain"]
+			want := append([]byte("\x00"+rdbString("1")), 11, 0)
+			if len(p) != len(want)+8 || !bytes.Equal(p[:len(want)], want) {
+				t.Fatalf("payload of plain = %q, want %q and a checksum", p, want)
+			}
+			if crc := crc64Redis(0, want); binary.LittleEndian.Uint64(p[len(want):]) != crc {
+				t.Errorf("payload checksum %x, want %016x", p[len(want):], crc)
+			}
+		})
+	}
+}
+
+func TestRedisRestoreRefusesRunningServer(t *testing.T) {
+	dir := t.TempDir()
+	s := newFakeRedis(t, func(cmd []string) (string, bool) {
+		if strings.Join(cmd, " ") == "CONFIG GET dir" {
+			return array(bulk("dir"), bulk(dir)), false
+		}
+		return "-ERR unknown command\r\n", false
+	})
+	in := filepath.Join(t.TempDir(), "cache.rdb")
+	if err := os.WriteFile(in, []byte(testRDB), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := RedisRestore(context.Background(), RestoreOptions{DBType: "redis", Host: s.host, Port: s.port, Input: in, DataDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "stop Redis") {
+		t.Fatalf("RedisRestore error = %v, want a refusal", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dump.rdb")); err == nil {
+		t.Error("the snapshot was placed under a running server")
+	}
+}
@@ -0,0 +1,199 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisDialTimeout bounds connecting and authenticating to Redis.
+const redisDialTimeout = 10 * time.Second
+
+// redisError is an error reply from the Redis server.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// redisConn is a minimal RESP2 client: enough to authenticate, run admin
+// commands, pipeline RESTOREs and read a replication SYNC.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	stop func() bool
+}
+
+// dialRedis connects to host:port and authenticates. Cancelling ctx closes
+// the connection. User "" or "default" authenticates with the password only,
+// which also works on servers older than Redis 6.
+func dialRedis(ctx context.Context, host string, port int, user, password string) (*redisConn, error) {
+	d := net.Dialer{Timeout: redisDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConnection, err)
+	}
+	c := &redisConn{
+		conn: conn,
+		r:    bufio.NewReaderSize(conn, 64*1024),
+		w:    bufio.NewWriterSize(conn, 64*1024),
+	}
+	c.stop = context.AfterFunc(ctx, func() { conn.Close() })
+
+	if password != "" {
+		conn.SetDeadline(time.Now().Add(redisDialTimeout))
+		var err error
+		if user == "" || user == "default" {
+			_, err = c.do("AUTH", password)
+		} else {
+			_, err = c.do("AUTH", user, password)
+		}
+		conn.SetDeadline(time.Time{})
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("%w: AUTH: %w", ErrConnection, err)
+		}
+	}
+	return c, nil
+}
+
+// Close closes the connection.
+func (c *redisConn) Close() error {
+	c.stop()
+	return c.conn.Close()
+}
+
+// send buffers one command; flush writes it.
+func (c *redisConn) send(args ...string) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(c.w, "$%d\r\n", len(a))
+		c.w.WriteString(a)
+		c.w.WriteString("\r\n")
+	}
+}
+
+func (c *redisConn) flush() error {
+	return c.w.Flush()
+}
+
+// do runs one command and returns its reply. An error reply is returned as
+// a redisError.
+func (c *redisConn) do(args ...string) (any, error) {
+	c.send(args...)
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	return c.receive()
+}
+
+// receive reads one reply: a string for simple and bulk strings, int64,
+// []any, or nil for a null bulk string or array.
+func (c *redisConn) receive() (any, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: bad bulk length %q", line)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: bad array length %q", line)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.receive(); err != nil {
+				var rerr redisError
+				if !errors.As(err, &rerr) {
+					return nil, err
+				}
+				items[i] = rerr
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+func (c *redisConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// doInt runs a command that replies with an integer.
+func (c *redisConn) doInt(args ...string) (int64, error) {
+	reply, err := c.do(args...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis %s: unexpected reply %v", args[0], reply)
+	}
+	return n, nil
+}
+
+// configGet returns one setting from CONFIG GET.
+func (c *redisConn) configGet(name string) (string, error) {
+	reply, err := c.do("CONFIG", "GET", name)
+	if err != nil {
+		return "", fmt.Errorf("CONFIG GET %s: %w", name, err)
+	}
+	items, ok := reply.([]any)
+	if !ok || len(items) != 2 {
+		return "", fmt.Errorf("CONFIG GET %s: setting not found", name)
+	}
+	value, _ := items[1].(string)
+	return value, nil
+}
+
+// info returns the fields of one INFO section.
+func (c *redisConn) info(section string) (map[string]string, error) {
+	reply, err := c.do("INFO", section)
+	if err != nil {
+		return nil, fmt.Errorf("INFO %s: %w", section, err)
+	}
+	text, _ := reply.(string)
+	fields := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(line), ":"); ok {
+			fields[k] = v
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,268 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+)
+
+// progressInterval is how often a native restore prints its progress.
+const progressInterval = 5 * time.Second
+
+// scriptState is where a scriptReader is within the text of a statement.
+type scriptState int
+
+const (
+	stateCode scriptState = iota
+	stateQuote
+	stateLineComment
+	stateBlockComment
+)
+
+// scriptReader splits a SQL script into statements the way the mysql client
+// does: on the current delimiter outside quotes and comments, honouring
+// DELIMITER lines between statements.
+type scriptReader struct {
+	r     *bufio.Reader
+	delim string
+
+	line    string // current input line
+	pos     int    // next byte of line
+	lineNo  int
+	bytes   int64 // bytes consumed so far
+	state   scriptState
+	quote   byte
+	escaped bool
+
+	buf       strings.Builder
+	started   bool // buf holds more than whitespace and plain comments
+	startLine int
+}
+
+func newScriptReader(r io.Reader) *scriptReader {
+	return &scriptReader{r: bufio.NewReaderSize(r, 1<<20), delim: ";"}
+}
+
+// next returns the next statement without its delimiter and the line it
+// starts on. It returns io.EOF after the last statement.
+func (s *scriptReader) next() (string, int, error) {
+	for {
+		if s.pos >= len(s.line) {
+			line, err := s.r.ReadString('\n')
+			if line == "" {
+				if err == nil || err == io.EOF {
+					if s.started {
+						return s.take(), s.startLine, nil
+					}
+					return "", 0, io.EOF
+				}
+				return "", 0, err
+			}
+			s.lineNo++
+			s.bytes += int64(len(line))
+			if s.state == stateLineComment {
+				s.state = stateCode
+			}
+			if s.state == stateCode && !s.started {
+				if f := strings.Fields(line); len(f) >= 2 && strings.EqualFold(f[0], "delimiter") {
+					s.delim = f[1]
+					s.buf.Reset()
+					continue
+				}
+			}
+			s.line, s.pos = line, 0
+		}
+
+		rest := s.line[s.pos:]
+		c := rest[0]
+
+		switch s.state {
+		case stateCode:
+			if strings.HasPrefix(rest, s.delim) {
+				s.pos += len(s.delim)
+				if s.started {
+					return s.take(), s.startLine, nil
+				}
+				s.buf.Reset()
+				continue
+			}
+			switch {
+			case c == '\'' || c == '"' || c == '`':
+				s.state, s.quote = stateQuote, c
+				s.begin()
+			case c == '#' || isDashComment(rest):
+				s.state = stateLineComment
+			case strings.HasPrefix(rest, "/*"):
+				s.state = stateBlockComment
+				// /*! ... */ is executed by the server, so it is code.
+				if len(rest) > 2 && (rest[2] == '!' || rest[2] == '+') {
+					s.begin()
+				}
+				s.buf.WriteString("/*")
+				s.pos += 2
+				continue
+			case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+				s.begin()
+			}
+		case stateQuote:
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case c == '\\' && s.quote != '`':
+				s.escaped = true
+			case c == s.quote:
+				s.state = stateCode
+			}
+		case stateBlockComment:
+			if strings.HasPrefix(rest, "*/") {
+				s.state = stateCode
+				s.buf.WriteString("*/")
+				s.pos += 2
+				continue
+			}
+		case stateLineComment:
+		}
+
+		s.buf.WriteByte(c)
+		s.pos++
+	}
+}
+
+// begin marks the statement as containing code.
+func (s *scriptReader) begin() {
+	if !s.started {
+		s.started = true
+		s.startLine = s.lineNo
+	}
+}
+
+// take returns the buffered statement and resets the buffer.
+func (s *scriptReader) take() string {
+	stmt := strings.TrimSpace(s.buf.String())
+	s.buf.Reset()
+	s.started = false
+	return stmt
+}
+
+// isDashComment reports whether rest starts a "-- " comment, which MySQL
+// requires to be followed by whitespace or the end of the line.
+func isDashComment(rest string) bool {
+	return strings.HasPrefix(rest, "--") && (len(rest) == 2 || strings.ContainsRune(" \t\r\n", rune(rest[2])))
+}
+
+// ExecSQLScript executes the statements of a SQL script, such as a dump from
+// WriteMySQLDump or mysqldump, one by one on a single connection. progress,
+// if not nil, is called after each statement with the number executed and
+// the bytes of r consumed.
+func ExecSQLScript(ctx context.Context, db *sql.DB, r io.Reader, progress func(statements int, bytes int64)) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return execScript(ctx, conn, r, progress)
+}
+
+// execScript is ExecSQLScript on a connection the caller has prepared.
+func execScript(ctx context.Context, conn *sql.Conn, r io.Reader, progress func(statements int, bytes int64)) error {
+	sr := newScriptReader(r)
+	for n := 1; ; n++ {
+		stmt, line, err := sr.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read script: %w", err)
+		}
+
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("statement %d at line %d (%s): %w", n, line, preview(stmt), err)
+		}
+		if progress != nil {
+			progress(n, sr.bytes)
+		}
+	}
+}
+
+// preview shortens a statement for error messages.
+func preview(stmt string) string {
+	stmt = strings.Join(strings.Fields(stmt), " ")
+	if len(stmt) > 80 {
+		return stmt[:77] + "..."
+	}
+	return stmt
+}
+
+// mysqlNativeRestore is MySQLRestore for the native engine.
+func mysqlNativeRestore(ctx context.Context, opts RestoreOptions) error {
+	console.Println("Restoring with native engine:", opts.Input)
+
+	infile, err := os.Open(opts.Input)
+	if err != nil {
+		return fmt.Errorf("could not open input file: %w", err)
+	}
+	defer infile.Close()
+
+	var total int64
+	if info, err := infile.Stat(); err == nil {
+		total = info.Size()
+	}
+
+	sqlDB, err := openMySQL(ctx, opts.Host, opts.Port, opts.User, opts.Password, opts.DBName)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	start := time.Now()
+	last := start
+	var done int
+	progress := func(statements int, bytes int64) {
+		done = statements
+		if time.Since(last) < progressInterval {
+			return
+		}
+		last = time.Now()
+		console.Printf("  restored %d statements, %s of %s (%.0f%%)\n",
+			statements, formatBytes(bytes), formatBytes(total), percent(bytes, total))
+	}
+
+	if err := ExecSQLScript(ctx, sqlDB, infile, progress); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("native restore interrupted: %w", ctx.Err())
+		}
+		return fmt.Errorf("native restore failed: %w", classifyDriverError(err))
+	}
+
+	console.Printf("  restored %d statements in %s\n", done, time.Since(start).Round(time.Second))
+	return nil
+}
+
+func percent(n, total int64) float64 {
+	if total <= 0 {
+		return 100
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// formatBytes renders n with a binary unit, e.g. 1.5 GiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,223 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// scriptStatement is a statement returned by scriptReader.next.
+type scriptStatement struct {
+	line int
+	stmt string
+}
+
+func readScript(t *testing.T, script string) []scriptStatement {
+	t.Helper()
+	var got []scriptStatement
+	sr := newScriptReader(strings.NewReader(script))
+	for {
+		stmt, line, err := sr.next()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		got = append(got, scriptStatement{line, stmt})
+	}
+}
+
+func TestScriptReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []scriptStatement
+	}{
+		{
+			name:   "empty",
+			script: "",
+		},
+		{
+			name:   "only comments and whitespace",
+			script: "-- header\n\n# note\n/* block */\n;\n",
+		},
+		{
+			name:   "simple",
+			script: "SELECT 1;\nSELECT 2;\n",
+			want:   []scriptStatement{{1, "SELECT 1"}, {2, "SELECT 2"}},
+		},
+		{
+			name:   "several on one line",
+			script: "SELECT 1; SELECT 2;SELECT 3;",
+			want:   []scriptStatement{{1, "SELECT 1"}, {1, "SELECT 2"}, {1, "SELECT 3"}},
+		},
+		{
+			name:   "statement starts at its first code line",
+			script: "-- comment\n\nINSERT INTO t\nVALUES (1),\n(2);\n",
+			want:   []scriptStatement{{3, "-- comment\n\nINSERT INTO t\nVALUES (1),\n(2)"}},
+		},
+		{
+			name:   "last statement without delimiter",
+			script: "SELECT 1;\nSELECT 2",
+			want:   []scriptStatement{{1, "SELECT 1"}, {2, "SELECT 2"}},
+		},
+		{
+			name:   "delimiter in quotes",
+			script: "INSERT INTO t VALUES ('a;b', \"c;d\");\nSELECT `x;y` FROM t;\n",
+			want: []scriptStatement{
+				{1, "INSERT INTO t VALUES ('a;b', \"c;d\")"},
+				{2, "SELECT `x;y` FROM t"},
+			},
+		},
+		{
+			name:   "escaped quotes",
+			script: `INSERT INTO t VALUES ('it\'s; fine', 'a\\', 'b;c');` + "\nSELECT 2;\n",
+			want: []scriptStatement{
+				{1, `INSERT INTO t VALUES ('it\'s; fine', 'a\\', 'b;c')`},
+				{2, "SELECT 2"},
+			},
+		},
+		{
+			name:   "quote spanning lines",
+			script: "INSERT INTO t VALUES ('one;\ntwo');\nSELECT 2;\n",
+			want:   []scriptStatement{{1, "INSERT INTO t VALUES ('one;\ntwo')"}, {3, "SELECT 2"}},
+		},
+		{
+			name:   "backslash in backticks does not escape",
+			script: "SELECT `a\\`;\nSELECT 2;\n",
+			want:   []scriptStatement{{1, "SELECT `a\\`"}, {2, "SELECT 2"}},
+		},
+		{
+			name:   "dash comment hides delimiter",
+			script: "SELECT 1 -- not here; or here\n;\n",
+			want:   []scriptStatement{{1, "SELECT 1 -- not here; or here"}},
+		},
+		{
+			name:   "hash comment hides delimiter",
+			script: "SELECT 1 # x; y\n, 2;\n",
+			want:   []scriptStatement{{1, "SELECT 1 # x; y\n, 2"}},
+		},
+		{
+			name:   "double dash without space is an operator",
+			script: "SELECT 5--1;\nSELECT 2;\n",
+			want:   []scriptStatement{{1, "SELECT 5--1"}, {2, "SELECT 2"}},
+		},
+		{
+			name:   "block comment hides delimiter",
+			script: "SELECT /* a; b\n c; */ 1;\n",
+			want:   []scriptStatement{{1, "SELECT /* a; b\n c; */ 1"}},
+		},
+		{
+			name:   "executable comment is a statement",
+			script: "/*!40101 SET NAMES utf8mb4 */;\n/* plain */;\nSELECT 1;\n",
+			want:   []scriptStatement{{1, "/*!40101 SET NAMES utf8mb4 */"}, {3, "SELECT 1"}},
+		},
+		{
+			name: "DELIMITER",
+			script: "DELIMITER ;;\n" +
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 'x;;y';\nEND;;\n" +
+				"DELIMITER ;\n" +
+				"SELECT 2;\n",
+			want: []scriptStatement{
+				{2, "CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 'x;;y';\nEND"},
+				{8, "SELECT 2"},
+			},
+		},
+		{
+			name:   "DELIMITER is case-insensitive",
+			script: "delimiter $$\nSELECT 1; SELECT 2$$\ndelimiter ;\nSELECT 3;\n",
+			want:   []scriptStatement{{2, "SELECT 1; SELECT 2"}, {4, "SELECT 3"}},
+		},
+		{
+			name:   "DELIMITER inside a statement is text",
+			script: "SELECT 'a'\nDELIMITER x;\n",
+			want:   []scriptStatement{{1, "SELECT 'a'\nDELIMITER x"}},
+		},
+		{
+			name:   "CRLF line endings",
+			script: "SELECT 1;\r\nSELECT 2;\r\n",
+			want:   []scriptStatement{{1, "SELECT 1"}, {2, "SELECT 2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readScript(t, tt.script)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecSQLScript(t *testing.T) {
+	script := "CREATE TABLE `t` (`id` int);\n" +
+		"INSERT INTO `t` (`id`) VALUES (1),(2);\n" +
+		"\n" +
+		"INSERT INTO `t` (`id`) VALUES (3);\n"
+
+	t.Run("progress", func(t *testing.T) {
+		s := newFakeServer()
+		type call struct {
+			statements int
+			bytes      int64
+		}
+		var calls []call
+		err := ExecSQLScript(context.Background(), s.db(t), strings.NewReader(script), func(n int, b int64) {
+			calls = append(calls, call{n, b})
+		})
+		if err != nil {
+			t.Fatalf("ExecSQLScript: %v", err)
+		}
+		if len(s.execs) != 3 {
+			t.Fatalf("executed %d statements, want 3: %q", len(s.execs), s.execs)
+		}
+		if rows := s.tables["t"].rows; len(rows) != 3 {
+			t.Errorf("t has %d rows, want 3", len(rows))
+		}
+		// The reader consumes whole lines, so progress is reported at line ends.
+		want := []call{
+			{1, int64(len("CREATE TABLE `t` (`id` int);\n"))},
+			{2, int64(len("CREATE TABLE `t` (`id` int);\nINSERT INTO `t` (`id`) VALUES (1),(2);\n"))},
+			{3, int64(len(script))},
+		}
+		if !reflect.DeepEqual(calls, want) {
+			t.Errorf("progress calls = %v, want %v", calls, want)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		s := newFakeServer()
+		s.failOn = "VALUES (3)"
+		err := ExecSQLScript(context.Background(), s.db(t), strings.NewReader(script), nil)
+		if err == nil {
+			t.Fatal("ExecSQLScript succeeded, want an error")
+		}
+		const want = "statement 3 at line 4 (INSERT INTO `t` (`id`) VALUES (3)): "
+		if !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("error = %q, want prefix %q", err, want)
+		}
+		if len(s.execs) != 2 {
+			t.Errorf("executed %d statements before the failure, want 2", len(s.execs))
+		}
+	})
+}
+
+func TestPreview(t *testing.T) {
+	long := "INSERT INTO t VALUES " + strings.Repeat("(1),", 30)
+	tests := []struct {
+		stmt, want string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT\n  1,\t2", "SELECT 1, 2"},
+		{long, long[:77] + "..."},
+	}
+	for _, tt := range tests {
+		if got := preview(tt.stmt); got != tt.want {
+			t.Errorf("preview(%q) = %q, want %q", tt.stmt, got, tt.want)
+		}
+	}
+}
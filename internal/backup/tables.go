@@ -0,0 +1,235 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrTableFilter reports a table filter that does not fit the live schema.
+var ErrTableFilter = errors.New("invalid table filter")
+
+// TableFilter selects which tables of a MySQL database are dumped, and how.
+// Entries are table names or globs; "db.table" limits an entry to one
+// database of a multi-database run.
+type TableFilter struct {
+	Include    []string          // tables to dump; empty means all
+	Exclude    []string          // tables left out entirely
+	SchemaOnly []string          // tables dumped without rows
+	Where      map[string]string // table name -> WHERE clause for its rows
+}
+
+// IsZero reports whether the filter dumps every table in full.
+func (f TableFilter) IsZero() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0 && len(f.SchemaOnly) == 0 && len(f.Where) == 0
+}
+
+// tablePlan is a TableFilter resolved against a database's tables.
+type tablePlan struct {
+	full       []string          // dumped with all rows
+	ignored    []string          // everything not in full, for --ignore-table
+	schemaOnly []string          // dumped with --no-data
+	filtered   []string          // dumped one by one with --where
+	where      map[string]string // clause for each filtered table
+}
+
+// MySQLListTables returns the tables and views of opts.DBName.
+func MySQLListTables(ctx context.Context, opts BackupOptions) ([]string, error) {
+	return mysqlQuery(ctx, opts, opts.DBName, "SHOW TABLES")
+}
+
+// MySQLCheckOptions validates opts.Dump, and opts.Tables against the live
+// schema, without dumping anything, so mistakes are reported before a run
+// starts.
+func MySQLCheckOptions(ctx context.Context, opts BackupOptions) error {
+	if err := checkEngine(opts.Engine); err != nil {
+		return err
+	}
+	if err := opts.Dump.Validate(); err != nil {
+		return err
+	}
+	if opts.Engine == EngineNative {
+		if err := checkNativeDump(opts.Dump); err != nil {
+			return err
+		}
+	}
+	if opts.Tables.IsZero() {
+		return nil
+	}
+	tables, err := MySQLListTables(ctx, opts)
+	if err != nil {
+		return err
+	}
+	_, err = planTables(opts.DBName, tables, opts.Tables)
+	return err
+}
+
+// planTables resolves f for database db. Every problem is reported at once.
+// Literal names must exist; globs may match nothing.
+func planTables(db string, tables []string, f TableFilter) (tablePlan, error) {
+	var problems []string
+	exists := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		exists[t] = true
+	}
+
+	match := func(field string, entries []string) map[string]bool {
+		matched := make(map[string]bool)
+		for _, e := range scopeEntries(db, entries) {
+			if !strings.ContainsAny(e, "*?[") {
+				if !exists[e] {
+					problems = append(problems, fmt.Sprintf("%s: table %s.%s does not exist", field, db, e))
+				}
+				matched[e] = true
+				continue
+			}
+			if _, err := path.Match(e, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: bad pattern %q", field, e))
+				continue
+			}
+			for _, t := range tables {
+				if ok, _ := path.Match(e, t); ok {
+					matched[t] = true
+				}
+			}
+		}
+		return matched
+	}
+
+	included := match("includeTables", f.Include)
+	excluded := match("excludeTables", f.Exclude)
+	schemaOnly := match("schemaOnlyTables", f.SchemaOnly)
+
+	where := make(map[string]string)
+	for key, clause := range f.Where {
+		t := key
+		if i := strings.IndexByte(key, '.'); i >= 0 {
+			if key[:i] != db {
+				continue
+			}
+			t = key[i+1:]
+		}
+		switch {
+		case !exists[t]:
+			problems = append(problems, fmt.Sprintf("where: table %s.%s does not exist", db, t))
+		case strings.TrimSpace(clause) == "":
+			problems = append(problems, fmt.Sprintf("where: empty clause for %s.%s", db, t))
+		default:
+			where[t] = clause
+		}
+	}
+
+	var plan tablePlan
+	for _, t := range tables {
+		selected := (len(f.Include) == 0 || included[t]) && !excluded[t]
+		_, hasWhere := where[t]
+
+		switch {
+		case schemaOnly[t] && hasWhere:
+			problems = append(problems, fmt.Sprintf("table %s.%s is both schema-only and filtered by where", db, t))
+		case (schemaOnly[t] || hasWhere) && !selected:
+			problems = append(problems, fmt.Sprintf("table %s.%s is excluded but also listed in schemaOnlyTables or where", db, t))
+		case !selected:
+			plan.ignored = append(plan.ignored, t)
+		case schemaOnly[t]:
+			plan.schemaOnly = append(plan.schemaOnly, t)
+			plan.ignored = append(plan.ignored, t)
+		case hasWhere:
+			plan.filtered = append(plan.filtered, t)
+			plan.ignored = append(plan.ignored, t)
+		default:
+			plan.full = append(plan.full, t)
+		}
+	}
+	plan.where = where
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return tablePlan{}, fmt.Errorf("%w: %s", ErrTableFilter, strings.Join(problems, "; "))
+	}
+	return plan, nil
+}
+
+// scopeEntries drops "db.table" entries for other databases and strips the
+// database prefix from the rest.
+func scopeEntries(db string, entries []string) []string {
+	var out []string
+	for _, e := range entries {
+		if i := strings.IndexByte(e, '.'); i >= 0 {
+			if e[:i] != db {
+				continue
+			}
+			e = e[i+1:]
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// dumpSteps returns the mysqldump arguments, after the connection arguments,
+// of each invocation needed to dump opts.DBName. Their outputs are
+// concatenated into one dump file.
+func dumpSteps(ctx context.Context, opts BackupOptions) ([][]string, error) {
+	if err := opts.Dump.Validate(); err != nil {
+		return nil, err
+	}
+
+	steps, err := tableSteps(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	gtid, position := gtidPurged(ctx, opts), positionOption(ctx, opts)
+	for i, step := range steps {
+		steps[i] = append(opts.Dump.stepArgs(i == 0, gtid, position), step...)
+	}
+	return steps, nil
+}
+
+// tableSteps splits the dump of opts.DBName into invocations according to
+// opts.Tables, returning the table-selection arguments of each. Every
+// invocation takes its own snapshot, so with more than one the dump is not
+// consistent to a single point in time; the native engine dumps filtered
+// tables within one snapshot.
+func tableSteps(ctx context.Context, opts BackupOptions) ([][]string, error) {
+	db := opts.DBName
+	if opts.Tables.IsZero() {
+		return [][]string{{db}}, nil
+	}
+
+	tables, err := MySQLListTables(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planTables(db, tables, opts.Tables)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps [][]string
+	if len(plan.full) > 0 {
+		if len(opts.Tables.Include) == 0 {
+			var step []string
+			for _, t := range plan.ignored {
+				step = append(step, "--ignore-table="+db+"."+t)
+			}
+			steps = append(steps, append(step, db))
+		} else {
+			steps = append(steps, append([]string{db}, plan.full...))
+		}
+	}
+	if len(plan.schemaOnly) > 0 {
+		steps = append(steps, append([]string{"--no-data", db}, plan.schemaOnly...))
+	}
+	for _, t := range plan.filtered {
+		steps = append(steps, []string{"--where=" + plan.where[t], db, t})
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("%w: no tables of %s selected", ErrTableFilter, db)
+	}
+	return steps, nil
+}
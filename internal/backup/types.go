@@ -1,5 +1,16 @@
 package backup
 
+import (
+	"os"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/throttle"
+)
+
+// ArtifactPerm is the mode of finished backup files. Dumps contain all of a
+// database's data, so they are readable by the owner only.
+const ArtifactPerm os.FileMode = 0600
+
 // BackupOptions holds everything needed to perform a backup.
 type BackupOptions struct {
 	DBType   string
@@ -9,6 +20,32 @@ type BackupOptions struct {
 	Password string
 	DBName   string
 	Output   string
+	Engine   string // EngineClient (default) or EngineNative
+	Tables   TableFilter
+	Dump     DumpOptions
+
+	Format    string // FormatSQL (default), FormatDir, FormatBaseBackup for postgres, or FormatFull/FormatLog for mssql
+	Threads   int    // FormatDir connections, default DefaultThreads
+	ChunkRows int64  // FormatDir rows per chunk of large tables, default DefaultChunkRows
+
+	Snapshot string // redis: SnapshotSync (default) or SnapshotBGSave
+
+	// ServerDir is Output's directory as SQL Server sees it, when that
+	// differs from this host's path (a container volume or a share).
+	ServerDir string
+
+	Files FileSet // db-type files: what to archive
+
+	// Compression and EncryptKey, if set, are applied by FilesBackup as the
+	// archive is written, so Output is the finished artifact and no plain
+	// tar reaches the disk. Other backups leave them to CompressFile and
+	// EncryptFile.
+	Compression *CompressOptions
+	EncryptKey  []byte
+
+	// DumpLimit limits the rate the dump stream is read at, and so the load
+	// on the server. SQL Server writes its backups itself and is not limited.
+	DumpLimit *throttle.Limiter
 }
 
 // RestoreOptions holds everything needed to perform a restore.
@@ -20,4 +57,27 @@ type RestoreOptions struct {
 	Password string
 	DBName   string
 	Input    string
+	Engine   string // EngineClient (default) or EngineNative
+	Threads  int    // connections for a directory-format backup, default DefaultThreads
+
+	// Point-in-time recovery: restore the newest backup in Input taken
+	// before the target, then replay binlogs from BinlogDir up to it.
+	ToTime    time.Time
+	ToGTID    string // GTID set; "uuid:N" means up to and including transaction N
+	BinlogDir string
+
+	// PostgreSQL base backups are unpacked into DataDir, and Redis snapshots
+	// placed there. WALConfig is the archive-wal config the restored
+	// PostgreSQL server fetches WAL with.
+	DataDir   string
+	WALConfig string
+
+	// SQL Server: ServerDir is Input's directory as the server sees it.
+	// Move maps logical file names to new paths. NoRecovery leaves the
+	// database restoring so log backups can be applied after it.
+	ServerDir  string
+	Move       map[string]string
+	NoRecovery bool
+
+	Target string // db-type files: directory to extract into
 }
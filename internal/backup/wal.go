@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+)
+
+// ErrWALNotFound reports that a requested WAL file is not in the archive,
+// which is how recovery learns it has reached the end of the archive.
+var ErrWALNotFound = errors.New("WAL file not in archive")
+
+// WALArchiveOptions says where and how WAL files are archived. Exactly one of
+// Dir and Upload/Download is used; Dir wins if set.
+type WALArchiveOptions struct {
+	Dir        string // local archive directory
+	Compress   bool   // gzip each file (.gz)
+	EncryptKey []byte // if set, AES-256-GCM encrypt each file (.enc)
+
+	// Upload and Download move one archived file to and from remote
+	// storage under key. Download returns an error wrapping ErrWALNotFound
+	// for a missing key.
+	Upload   func(ctx context.Context, key, path string) error
+	Download func(ctx context.Context, key, path string) error
+}
+
+// walKey is the archived name of a WAL file.
+func (opts WALArchiveOptions) walKey(name string) string {
+	if opts.Compress {
+		name += ".gz"
+	}
+	if opts.EncryptKey != nil {
+		name += ".enc"
+	}
+	return name
+}
+
+// checkWALName rejects names that are not plain file names, since they come
+// from the %f of archive_command and restore_command.
+func checkWALName(name string) error {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid WAL file name %q", name)
+	}
+	return nil
+}
+
+// ArchiveWAL stores the WAL file at path under name, compressing and
+// encrypting it first if configured. It is meant to run as Postgres's
+// archive_command with %p and %f; Postgres retries until it succeeds.
+// Archiving the same name again replaces the earlier copy.
+func ArchiveWAL(ctx context.Context, opts WALArchiveOptions, path, name string) error {
+	if err := checkWALName(name); err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "db-backup-cli-wal-*")
+	if err != nil {
+		return fmt.Errorf("create work directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	current := path
+	if opts.Compress {
+		next := filepath.Join(tmp, name+".gz")
+		if err := GzipFile(ctx, current, next); err != nil {
+			return err
+		}
+		current = next
+	}
+	if opts.EncryptKey != nil {
+		next := filepath.Join(tmp, filepath.Base(current)+".enc")
+		if err := EncryptFile(ctx, current, next, opts.EncryptKey); err != nil {
+			return err
+		}
+		current = next
+	}
+
+	key := opts.walKey(name)
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+			return fmt.Errorf("create WAL archive: %w", err)
+		}
+		return copyFile(ctx, current, filepath.Join(opts.Dir, key))
+	}
+	if opts.Upload == nil {
+		return errors.New("no WAL archive destination configured")
+	}
+	return opts.Upload(ctx, key, current)
+}
+
+// RestoreWAL fetches the archived WAL file name into path, decrypting and
+// decompressing it. It is meant to run as Postgres's restore_command with %f
+// and %p. A file missing from the archive returns ErrWALNotFound.
+func RestoreWAL(ctx context.Context, opts WALArchiveOptions, name, path string) error {
+	if err := checkWALName(name); err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "db-backup-cli-wal-*")
+	if err != nil {
+		return fmt.Errorf("create work directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	key := opts.walKey(name)
+	current := filepath.Join(tmp, key)
+	switch {
+	case opts.Dir != "":
+		src := filepath.Join(opts.Dir, key)
+		if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%s: %w", src, ErrWALNotFound)
+		}
+		current = src
+	case opts.Download != nil:
+		if err := opts.Download(ctx, key, current); err != nil {
+			return err
+		}
+	default:
+		return errors.New("no WAL archive source configured")
+	}
+
+	if opts.EncryptKey != nil {
+		next := filepath.Join(tmp, strings.TrimSuffix(key, ".enc"))
+		if err := DecryptFile(ctx, current, next, opts.EncryptKey); err != nil {
+			return err
+		}
+		current = next
+	}
+	if opts.Compress {
+		return GunzipFile(ctx, current, path)
+	}
+	return copyFile(ctx, current, path)
+}
+
+// copyFile copies src to dst atomically.
+func copyFile(ctx context.Context, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := fsutil.Create(dst, ArtifactPerm)
+	if err != nil {
+		return err
+	}
+	defer out.Abort()
+
+	if _, err := io.Copy(out, contextReader{ctx, in}); err != nil {
+		return fmt.Errorf("copy %s: %w", src, err)
+	}
+	return out.Commit()
+}
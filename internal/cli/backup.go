@@ -0,0 +1,662 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/backup"
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/metrics"
+	"github.com/bhagashetti/db-backup-cli/internal/notify"
+	"github.com/bhagashetti/db-backup-cli/internal/progress"
+	"github.com/bhagashetti/db-backup-cli/internal/storage"
+	"github.com/bhagashetti/db-backup-cli/internal/throttle"
+)
+
+// backupJob is a fully resolved backup request, built from either a config
+// file or command-line flags.
+type backupJob struct {
+	opts        backup.BackupOptions
+	compress    bool
+	compression backup.CompressOptions
+	encrypt     bool
+	encryptKey  string
+	uploadS3    bool
+	s3Bucket    string
+	s3Region    string
+	s3Prefix    string
+	metrics     config.MetricsConfig
+	notify      config.NotifyConfig
+	hooks       config.HooksConfig
+	repository  config.RepositoryConfig // if URL is set, backups go into this repository
+	timestamp   string                  // if set, each database is written to <db>-<timestamp>.sql
+	uploadLimit *throttle.Limiter       // shared by all databases of the run; nil is unlimited
+	priority    backup.Priority         // of dump tools
+	progress    progressSettings
+	tracker     *stageTracker // per database, set by runDatabaseJob
+}
+
+// backupResult describes where a successful backup ended up.
+type backupResult struct {
+	finalPath string // final local artifact, empty if stored in a repository
+	location  string // s3:// URI if uploaded, repository snapshot, otherwise finalPath
+	size      int64  // stream size of a repository snapshot
+}
+
+func handleBackup(ctx context.Context, o *runOptions, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+
+	configPath := fs.String("config", "", "Path to JSON config file")
+
+	dbType := fs.String("db-type", "mysql", "Database type (mysql, postgres, redis, mssql, files)")
+	host := fs.String("host", "localhost", "Database host")
+	port := fs.Int("port", 3306, "Database port")
+	user := fs.String("user", "root", "Database user")
+	password := fs.String("password", "", "Database password")
+	dbName := fs.String("db", "", "Database name, comma-separated list, glob pattern, or all")
+	excludeDB := fs.String("exclude-db", "", "Comma-separated databases or globs to skip when expanding -db")
+	parallel := fs.Int("parallel", defaultParallelism, "Number of databases to back up at once")
+	output := fs.String("out", "backup.sql", "Output backup file")
+	engine := fs.String("engine", backup.EngineClient, "MySQL engine: client (mysqldump) or native (pure Go)")
+	format := fs.String("format", backup.FormatSQL, "Backup format: sql (one file), dir (MySQL, parallel, one file per table chunk), basebackup (PostgreSQL, physical), or full/log (SQL Server)")
+	threads := fs.Int("threads", backup.DefaultThreads, "Connections dumping tables at once with -format=dir")
+	chunkRows := fs.Int64("chunk-rows", backup.DefaultChunkRows, "Split tables larger than this into chunks with -format=dir")
+	snapshot := fs.String("snapshot", backup.SnapshotSync, "Redis snapshot: sync (pull an RDB over replication) or bgsave (BGSAVE, then copy the server's RDB file)")
+	serverDir := fs.String("server-dir", "", "SQL Server: the output directory as the server sees it, if it differs from this host")
+	paths := fs.String("paths", "", "Files: comma-separated directories to archive")
+	includeFiles := fs.String("include-files", "", "Files: comma-separated globs of files to archive (default all)")
+	excludeFiles := fs.String("exclude-files", "", "Files: comma-separated globs of files and directories to skip")
+	recordPosition := fs.Bool("record-position", false, "Record the dump's binlog position for point-in-time restores")
+	compressFlag := fs.Bool("compress", false, "Compress the backup (gzip unless -compression is given)")
+	compression := fs.String("compression", "", "Compression algorithm: gzip, pgzip (parallel gzip), zstd, xz or lz4; implies -compress")
+	compressionLevel := fs.Int("compression-level", 0, "Compression level (gzip/pgzip/xz/lz4 1-9, zstd 1-22; default the algorithm's)")
+	compressThreads := fs.Int("compress-threads", 0, "Compression threads for pgzip, zstd and lz4 (default all CPUs)")
+	zstdLong := fs.Bool("zstd-long", false, "zstd long-distance matching over a 128 MiB window")
+	encryptFlag := fs.Bool("encrypt", false, "Encrypt backup using AES-256-GCM")
+	encryptKeyFlag := fs.String("encrypt-key", "", "Encryption key (32 chars)")
+	metricsTextfile := fs.String("metrics-textfile", "", "Write run metrics to this node_exporter textfile (.prom)")
+	pushgateway := fs.String("pushgateway", "", "Push run metrics to this Prometheus Pushgateway URL")
+	repoURL := fs.String("repo", "", "Store the backup deduplicated in this repository: local directory or s3://bucket/prefix")
+	repoRegion := fs.String("repo-region", "", "S3 region of the repository (default from the AWS environment)")
+	uploadRate := fs.String("upload-rate", "", "Limit S3 uploads and repository writes to this many bytes/s, e.g. 20MB or 512KiB")
+	dumpRate := fs.String("dump-rate", "", "Limit reading the dump stream to this many bytes/s")
+	progressMode := fs.String("progress", progress.ModeAuto, "Progress output on stderr: auto, tty (live line), lines (periodic lines) or off")
+	progressInterval := fs.Duration("progress-interval", progress.DefaultInterval, "Time between progress lines with -progress=lines")
+	historyFile := fs.String("history-file", "", "Where past runs are kept for ETAs (default in the user cache directory)")
+	nice := fs.Int("nice", 0, "Run dump tools at this niceness (0-19)")
+	ionice := fs.String("ionice", "", "Run dump tools in this I/O class: idle or best-effort[:0-7]")
+	fs.DurationVar(&o.grace, "grace", o.grace, "On SIGINT/SIGTERM, how long to wait for the run to stop before exiting")
+
+	if err := parseFlags(fs, args, o); err != nil {
+		return err
+	}
+
+	var job backupJob
+	var exclude []string
+	parallelism := *parallel
+
+	// If a config file is provided, load values from it.
+	if *configPath != "" {
+		logs.Info("Loading backup config from file: %s", *configPath)
+		cfg, err := config.LoadBackup(*configPath)
+		if err != nil {
+			console.Println("Failed to load config:", err)
+			logs.Error("Failed to load backup config: %v", err)
+			return newError(KindConfig, err)
+		}
+
+		job = backupJob{
+			opts: backup.BackupOptions{
+				DBType:   cfg.DBType,
+				Host:     cfg.Host,
+				Port:     cfg.Port,
+				User:     cfg.User,
+				Password: cfg.Password,
+				DBName:   cfg.DBName,
+				Output:   cfg.Output,
+				Engine:   cfg.Engine,
+				Tables: backup.TableFilter{
+					Include:    cfg.IncludeTables,
+					Exclude:    cfg.ExcludeTables,
+					SchemaOnly: cfg.SchemaOnlyTables,
+					Where:      cfg.Where,
+				},
+				Dump:      dumpOptions(cfg.MySQLDump, cfg.ExtraArgs),
+				Format:    cfg.Format,
+				Threads:   cfg.Threads,
+				ChunkRows: cfg.ChunkRows,
+				Snapshot:  cfg.Snapshot,
+				ServerDir: cfg.ServerDir,
+				Files: backup.FileSet{
+					Paths:   cfg.Paths,
+					Include: cfg.IncludeFiles,
+					Exclude: cfg.ExcludeFiles,
+				},
+			},
+			compress: cfg.Compress || cfg.Compression.Algorithm != "",
+			compression: backup.CompressOptions{
+				Algorithm: cfg.Compression.Algorithm,
+				Level:     cfg.Compression.Level,
+				Threads:   cfg.Compression.Threads,
+				Long:      cfg.Compression.Long,
+			},
+			encrypt:    cfg.Encrypt,
+			encryptKey: cfg.EncryptKey,
+			uploadS3:   cfg.UploadS3,
+			s3Bucket:   cfg.S3Bucket,
+			s3Region:   cfg.S3Region,
+			s3Prefix:   cfg.S3Prefix,
+			metrics:    cfg.Metrics,
+			notify:     cfg.Notifications,
+			hooks:      cfg.Hooks,
+			repository: cfg.Repository,
+		}
+
+		job.opts.Dump.RecordPosition = cfg.RecordBinlogPosition
+
+		// If useTimestamp is true, each database's output includes date-time.
+		if cfg.UseTimestamp {
+			job.timestamp = time.Now().Format("20060102-150405")
+		}
+		exclude = cfg.ExcludeDatabases
+		parallelism = cfg.Parallelism
+
+		if _, err := backup.LookupCodec(job.compression); err != nil {
+			console.Println("Invalid compression:", err)
+			logs.Error("Invalid compression in backup config: %v", err)
+			return newError(KindConfig, err)
+		}
+
+		job.uploadLimit, job.opts.DumpLimit, job.priority, err = throttleSettings(cfg.Throttle)
+		if err != nil {
+			console.Println("Invalid throttle settings:", err)
+			logs.Error("Invalid throttle settings in backup config: %v", err)
+			return newError(KindConfig, err)
+		}
+
+		if job.progress, err = parseProgress(cfg.Progress); err != nil {
+			console.Println("Invalid progress settings:", err)
+			logs.Error("Invalid progress settings in backup config: %v", err)
+			return newError(KindConfig, err)
+		}
+	} else {
+		// No config file: use CLI flags.
+		if *dbName == "" {
+			console.Println("Error: -db is required")
+			fs.Usage()
+			logs.Error("Backup failed: missing -db flag")
+			return newError(KindUsage, errors.New("-db is required"))
+		}
+
+		job = backupJob{
+			opts: backup.BackupOptions{
+				DBType:    *dbType,
+				Host:      *host,
+				Port:      *port,
+				User:      *user,
+				Password:  *password,
+				DBName:    *dbName,
+				Output:    *output,
+				Engine:    *engine,
+				Dump:      backup.DefaultDumpOptions(),
+				Format:    *format,
+				Threads:   *threads,
+				ChunkRows: *chunkRows,
+				Snapshot:  *snapshot,
+				ServerDir: *serverDir,
+				Files: backup.FileSet{
+					Paths:   splitList(*paths),
+					Include: splitList(*includeFiles),
+					Exclude: splitList(*excludeFiles),
+				},
+			},
+			compress: *compressFlag || *compression != "",
+			compression: backup.CompressOptions{
+				Algorithm: *compression,
+				Level:     *compressionLevel,
+				Threads:   *compressThreads,
+				Long:      *zstdLong,
+			},
+			encrypt:    *encryptFlag,
+			encryptKey: *encryptKeyFlag,
+			metrics: config.MetricsConfig{
+				Textfile:       *metricsTextfile,
+				PushgatewayURL: *pushgateway,
+			},
+			repository: config.RepositoryConfig{URL: *repoURL, S3Region: *repoRegion},
+		}
+		job.opts.Dump.RecordPosition = *recordPosition
+		if *excludeDB != "" {
+			exclude = strings.Split(*excludeDB, ",")
+		}
+
+		if _, err := backup.LookupCodec(job.compression); err != nil {
+			console.Println("Invalid compression:", err)
+			logs.Error("Invalid compression flags: %v", err)
+			return newError(KindUsage, err)
+		}
+
+		var err error
+		job.uploadLimit, job.opts.DumpLimit, job.priority, err = throttleSettings(config.ThrottleConfig{
+			UploadRate: *uploadRate,
+			DumpRate:   *dumpRate,
+			Nice:       *nice,
+			IONice:     *ionice,
+		})
+		if err != nil {
+			console.Println("Invalid throttle flags:", err)
+			logs.Error("Invalid throttle flags: %v", err)
+			return newError(KindUsage, err)
+		}
+
+		job.progress, err = parseProgress(config.ProgressConfig{
+			Mode:        *progressMode,
+			Interval:    progressInterval.String(),
+			HistoryFile: *historyFile,
+		})
+		if err != nil {
+			console.Println("Invalid progress flags:", err)
+			logs.Error("Invalid progress flags: %v", err)
+			return newError(KindUsage, err)
+		}
+	}
+
+	dbs, err := resolveDatabases(ctx, job.opts, job.opts.DBName, exclude)
+	if err != nil {
+		console.Println("Could not resolve databases:", err)
+		logs.Error("Could not resolve databases %q: %v", job.opts.DBName, err)
+		return err
+	}
+
+	notifier, err := notify.New(job.notify)
+	if err != nil {
+		console.Println("Warning: notifications disabled:", err)
+		logs.Error("Notifications disabled, invalid config: %v", err)
+	}
+
+	return runHookedBackup(ctx, job, notifier, dbs, parallelism)
+}
+
+// runDatabaseJob backs up the single database in job, then reports metrics
+// and sends notifications for it.
+func runDatabaseJob(ctx context.Context, job backupJob, notifier *notify.Notifier) (backupResult, error) {
+	start := time.Now()
+	job.tracker = newStageTracker(job)
+	res, err := runBackup(ctx, job)
+	reportDatabaseJob(ctx, job, notifier, start, res, err)
+	return res, err
+}
+
+// failDatabases reports each of dbs as failed with err, for a run that
+// stopped before any of them was backed up.
+func failDatabases(ctx context.Context, job backupJob, notifier *notify.Notifier, dbs []string, err error) {
+	start := time.Now()
+	for _, db := range dbs {
+		dbJob := databaseJob(job, db, len(dbs) > 1)
+		dbJob.tracker = &stageTracker{}
+		reportDatabaseJob(ctx, dbJob, notifier, start, backupResult{}, err)
+	}
+}
+
+// reportDatabaseJob emits the result of a backup of job's database that
+// began at start, and reports metrics and sends notifications for it.
+func reportDatabaseJob(ctx context.Context, job backupJob, notifier *notify.Notifier, start time.Time, res backupResult, err error) {
+	end := time.Now()
+	size := fileSize(res.finalPath)
+	if res.size > 0 {
+		size = res.size
+	}
+	job.tracker.finish(job, start, size, err)
+
+	emit(backupResultJSON{
+		Type:            "backup",
+		Status:          statusOf(err),
+		DBType:          job.opts.DBType,
+		Host:            job.opts.Host,
+		DBName:          job.opts.DBName,
+		Location:        res.location,
+		File:            res.finalPath,
+		SizeBytes:       size,
+		DumpBytes:       job.tracker.dumpBytes,
+		Start:           start,
+		DurationSeconds: end.Sub(start).Seconds(),
+		Stages:          stageResults(job.tracker.timings),
+		failure:         failureOf(err),
+	})
+
+	reportMetrics(job.metrics, metrics.Run{
+		Operation: "backup",
+		DBName:    job.opts.DBName,
+		Start:     start,
+		End:       end,
+		Success:   err == nil,
+		SizeBytes: size,
+	})
+
+	ev := notify.Event{
+		Status:    notify.KindSuccess,
+		DBType:    job.opts.DBType,
+		DBName:    job.opts.DBName,
+		Host:      job.opts.Host,
+		Location:  res.location,
+		SizeBytes: size,
+		Duration:  end.Sub(start),
+		Time:      end,
+	}
+	ev.Hostname, _ = os.Hostname()
+	if err != nil {
+		ev.Status = notify.KindFailure
+		ev.Error = err.Error()
+	}
+	notifier.Notify(ctx, ev)
+}
+
+// runBackup dumps, compresses, encrypts and uploads according to job.
+// Failures are printed and logged before being returned.
+func runBackup(ctx context.Context, job backupJob) (backupResult, error) {
+	opts := job.opts
+	ctx = backup.WithPriority(ctx, job.priority)
+
+	// A files archive is compressed and encrypted as it is written, so no
+	// plain copy of the files reaches the disk and the file stages below
+	// are skipped. A repository does both itself.
+	streamed := opts.DBType == "files" && job.repository.URL == "" && (job.compress || job.encrypt)
+	if streamed {
+		if job.compress {
+			codec, err := backup.LookupCodec(job.compression)
+			if err != nil {
+				return backupResult{}, newError(KindConfig, err)
+			}
+			opts.Compression = &job.compression
+			opts.Output += codec.Ext
+		}
+		if job.encrypt {
+			key, err := encryptionKey(job)
+			if err != nil {
+				return backupResult{}, err
+			}
+			opts.EncryptKey = key
+			opts.Output += ".enc"
+		}
+	}
+
+	console.Println("Starting backup...")
+	console.Printf("  db-type : %s\n", opts.DBType)
+	console.Printf("  host    : %s\n", opts.Host)
+	console.Printf("  port    : %d\n", opts.Port)
+	console.Printf("  user    : %s\n", opts.User)
+	console.Printf("  db      : %s\n", opts.DBName)
+	console.Printf("  out     : %s\n", opts.Output)
+	console.Printf("  compress: %v\n", job.compress)
+	console.Printf("  encrypt : %v\n", job.encrypt)
+
+	logs.Info(
+		"Starting backup: dbType=%s host=%s port=%d user=%s db=%s out=%s compress=%v encrypt=%v",
+		opts.DBType, opts.Host, opts.Port, opts.User, opts.DBName, opts.Output, job.compress, job.encrypt,
+	)
+
+	// 1) Run DB-specific backup
+	dumpCtx, endDump := job.tracker.begin(ctx, "dump", 0)
+	err := runDump(dumpCtx, opts)
+	job.tracker.dumpBytes = endDump()
+	if err != nil {
+		return backupResult{}, err
+	}
+	if job.tracker.dumpBytes == 0 {
+		// pg_basebackup and SQL Server write their files themselves.
+		job.tracker.dumpBytes = fileSize(opts.Output)
+	}
+
+	// Track the current "final" file path as we transform it
+	finalPath := opts.Output
+	location := finalPath
+
+	// A directory backup compresses its files itself. Encryption, upload
+	// and repositories work on single files, so for those it is packed into
+	// a tar first.
+	if backup.IsDirFormat(opts.Format) {
+		if job.compress {
+			console.Println("Skipping compression: directory backups are already compressed")
+			logs.Info("Skipping compression of directory backup %s", finalPath)
+		}
+		if job.encrypt || job.uploadS3 || job.repository.URL != "" {
+			tarPath := finalPath + ".tar"
+			console.Println("Packing backup directory to:", tarPath)
+			logs.Info("Packing backup directory to: %s", tarPath)
+
+			packCtx, endPack := job.tracker.begin(ctx, "pack", fileSize(finalPath))
+			err := backup.TarDir(packCtx, finalPath, tarPath)
+			endPack()
+			if err != nil {
+				console.Println("Packing failed:", err)
+				logs.Error("Packing backup directory failed: %v", err)
+				return backupResult{}, newErrorCtx(ctx, KindDump, err)
+			}
+			if err := os.RemoveAll(finalPath); err != nil {
+				console.Println("Warning: could not remove backup directory:", err)
+				logs.Error("Could not remove backup directory: %v", err)
+			}
+
+			finalPath = tarPath
+			location = finalPath
+		}
+	}
+
+	// A repository compresses, encrypts and stores the stream chunk by
+	// chunk, in place of the file stages below.
+	if job.repository.URL != "" {
+		if job.compress || job.uploadS3 {
+			console.Println("Skipping compression and upload: the repository compresses and stores the backup")
+			logs.Info("Skipping compression and S3 upload of %s: storing in repository", finalPath)
+		}
+		return storeInRepository(ctx, job, finalPath)
+	}
+
+	// 2) Optional compression
+	if job.compress && !backup.IsDirFormat(opts.Format) && !streamed {
+		codec, err := backup.LookupCodec(job.compression)
+		if err != nil {
+			return backupResult{}, newError(KindConfig, err)
+		}
+		compressedPath := finalPath + codec.Ext
+		console.Printf("Compressing backup with %s to: %s\n", codec.Name, compressedPath)
+		logs.Info("Compressing backup with %s to: %s", codec.Name, compressedPath)
+
+		compressCtx, endCompress := job.tracker.begin(ctx, "compress", fileSize(finalPath))
+		err = backup.CompressFile(compressCtx, finalPath, compressedPath, job.compression)
+		endCompress()
+		if err != nil {
+			console.Println("Compression failed:", err)
+			logs.Error("Compression failed: %v", err)
+			keptArtifact("uncompressed", finalPath)
+			return backupResult{}, newErrorCtx(ctx, KindCompress, err)
+		}
+
+		if err := os.Remove(finalPath); err != nil {
+			console.Println("Warning: could not remove original file:", err)
+			logs.Error("Could not remove original backup file: %v", err)
+		} else {
+			logs.Info("Removed original uncompressed backup: %s", finalPath)
+		}
+
+		finalPath = compressedPath
+		location = finalPath
+	}
+
+	// 3) Optional encryption
+	if job.encrypt && !streamed {
+		keyBytes, err := encryptionKey(job)
+		if err != nil {
+			return backupResult{}, err
+		}
+
+		encPath := finalPath + ".enc"
+		console.Println("Encrypting backup to:", encPath)
+		logs.Info("Encrypting backup to: %s", encPath)
+
+		encryptCtx, endEncrypt := job.tracker.begin(ctx, "encrypt", fileSize(finalPath))
+		err = backup.EncryptFile(encryptCtx, finalPath, encPath, keyBytes)
+		endEncrypt()
+		if err != nil {
+			console.Println("Encryption failed:", err)
+			logs.Error("Encryption failed: %v", err)
+			keptArtifact("unencrypted", finalPath)
+			return backupResult{}, newErrorCtx(ctx, KindEncrypt, err)
+		}
+
+		if err := os.Remove(finalPath); err != nil {
+			console.Println("Warning: could not remove unencrypted file:", err)
+			logs.Error("Could not remove unencrypted file: %v", err)
+		} else {
+			logs.Info("Removed unencrypted backup: %s", finalPath)
+		}
+
+		finalPath = encPath
+		location = finalPath
+	}
+	// 4) Optional S3 upload
+	if job.uploadS3 {
+		if job.s3Bucket == "" || job.s3Region == "" {
+			console.Println("S3 upload requested but bucket or region is empty")
+			logs.Error("S3 upload requested but bucket or region is empty")
+			return backupResult{}, newError(KindConfig, errors.New("S3 upload requested but bucket or region is empty"))
+		}
+
+		key := job.s3Prefix + filepath.Base(finalPath)
+		console.Println("Uploading backup to S3:", job.s3Bucket, "key:", key)
+		logs.Info("Uploading backup to S3: bucket=%s key=%s region=%s", job.s3Bucket, key, job.s3Region)
+
+		uploadCtx, endUpload := job.tracker.begin(ctx, "upload", fileSize(finalPath))
+		err := storage.UploadToS3(uploadCtx, job.s3Bucket, job.s3Region, key, finalPath, job.uploadLimit)
+		endUpload()
+		if err != nil {
+			console.Println("S3 upload failed:", err)
+			logs.Error("S3 upload failed: %v", err)
+			return backupResult{}, newErrorCtx(ctx, KindUpload, err)
+		}
+
+		location = "s3://" + job.s3Bucket + "/" + key
+		console.Println("S3 upload completed.")
+		logs.Info("S3 upload completed: bucket=%s key=%s", job.s3Bucket, key)
+	}
+
+	console.Println("Backup completed successfully. Final file:", finalPath)
+	logs.Info("Backup completed successfully. Final file: %s", finalPath)
+	return backupResult{finalPath: finalPath, location: location}, nil
+}
+
+// runDump runs the database-specific dump for opts. Failures are printed
+// and logged before being returned.
+func runDump(ctx context.Context, opts backup.BackupOptions) error {
+	switch opts.DBType {
+	case "mysql":
+		if err := backup.MySQLBackup(ctx, opts); err != nil {
+			console.Println("Backup failed:", err)
+			logs.Error("Backup failed: %v", err)
+			return newErrorCtx(ctx, dumpErrorKind(err), err)
+		}
+	case "postgres":
+		if err := backup.PostgresBackup(ctx, opts); err != nil {
+			console.Println("Backup failed:", err)
+			logs.Error("Backup failed: %v", err)
+			return newErrorCtx(ctx, dumpErrorKind(err), err)
+		}
+	case "redis":
+		if err := backup.RedisBackup(ctx, opts); err != nil {
+			console.Println("Backup failed:", err)
+			logs.Error("Backup failed: %v", err)
+			return newErrorCtx(ctx, dumpErrorKind(err), err)
+		}
+	case "mssql":
+		if err := backup.MSSQLBackup(ctx, opts); err != nil {
+			console.Println("Backup failed:", err)
+			logs.Error("Backup failed: %v", err)
+			return newErrorCtx(ctx, dumpErrorKind(err), err)
+		}
+	case "files":
+		if err := backup.FilesBackup(ctx, opts); err != nil {
+			console.Println("Backup failed:", err)
+			logs.Error("Backup failed: %v", err)
+			return newErrorCtx(ctx, dumpErrorKind(err), err)
+		}
+	default:
+		console.Println("Unsupported db-type for now:", opts.DBType)
+		logs.Error("Unsupported db-type: %s", opts.DBType)
+		return newError(KindConfig, fmt.Errorf("unsupported db-type: %s", opts.DBType))
+	}
+	return nil
+}
+
+// dumpErrorKind separates connection problems, bad table filters and bad dump
+// options from other dump failures.
+func dumpErrorKind(err error) ErrorKind {
+	if errors.Is(err, backup.ErrConnection) {
+		return KindConnection
+	}
+	if errors.Is(err, backup.ErrTableFilter) || errors.Is(err, backup.ErrDumpOptions) {
+		return KindConfig
+	}
+	return KindDump
+}
+
+// dumpOptions applies a config's mysqldump overrides to the defaults.
+func dumpOptions(cfg config.MySQLDumpConfig, extraArgs []string) backup.DumpOptions {
+	d := backup.DefaultDumpOptions()
+	override := func(dst *bool, src *bool) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	override(&d.SingleTransaction, cfg.SingleTransaction)
+	override(&d.Routines, cfg.Routines)
+	override(&d.Triggers, cfg.Triggers)
+	override(&d.Events, cfg.Events)
+	override(&d.HexBlob, cfg.HexBlob)
+	d.SetGTIDPurged = cfg.SetGTIDPurged
+	d.ExtraArgs = extraArgs
+	return d
+}
+
+// encryptionKey returns the key of job, which must be 32 characters.
+// Failures are printed and logged before being returned.
+func encryptionKey(job backupJob) ([]byte, error) {
+	if job.encryptKey == "" {
+		console.Println("Encryption requested but no key provided")
+		logs.Error("Encryption requested but no key provided")
+		return nil, newError(KindConfig, errors.New("encryption requested but no key provided"))
+	}
+	key := []byte(job.encryptKey)
+	if len(key) != 32 {
+		console.Println("Encryption key must be exactly 32 characters")
+		logs.Error("Encryption key invalid length: %d", len(key))
+		return nil, newError(KindConfig, fmt.Errorf("encryption key must be exactly 32 characters, got %d", len(key)))
+	}
+	return key, nil
+}
+
+// keptArtifact reports the complete backup left at path when a later stage
+// fails. The failed stage leaves no partial output of its own, so the backup
+// can be compressed, encrypted or uploaded by hand.
+func keptArtifact(what, path string) {
+	console.Printf("The %s backup is kept at: %s\n", what, path)
+	logs.Info("Kept %s backup after failure: %s", what, path)
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
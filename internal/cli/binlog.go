@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/backup"
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/storage"
+)
+
+// handleArchiveBinlog streams MySQL binlogs into a local archive, and
+// optionally on to S3, until interrupted. Restores use the archive to
+// replay changes made after a full backup.
+func handleArchiveBinlog(ctx context.Context, o *runOptions, args []string) error {
+	fs := flag.NewFlagSet("archive-binlog", flag.ContinueOnError)
+
+	configPath := fs.String("config", "", "Path to JSON binlog archive config file")
+
+	host := fs.String("host", "localhost", "Database host")
+	port := fs.Int("port", 3306, "Database port")
+	user := fs.String("user", "root", "Database user (needs REPLICATION SLAVE and REPLICATION CLIENT)")
+	password := fs.String("password", "", "Database password")
+	dir := fs.String("dir", "", "Local directory to archive binlogs into")
+	serverID := fs.Int("server-id", 0, "server_id to connect as; must differ from every replica")
+	s3Bucket := fs.String("s3-bucket", "", "Also upload completed binlogs to this S3 bucket")
+	s3Region := fs.String("s3-region", "", "S3 region")
+	s3Prefix := fs.String("s3-prefix", "", "S3 key prefix")
+	interval := fs.Duration("upload-interval", backup.DefaultUploadInterval, "How often to upload completed binlogs")
+	fs.DurationVar(&o.grace, "grace", o.grace, "On SIGINT/SIGTERM, how long to wait for the run to stop before exiting")
+
+	if err := parseFlags(fs, args, o); err != nil {
+		return err
+	}
+
+	var (
+		opts                   backup.BinlogArchiveOptions
+		uploadS3               bool
+		bucket, region, prefix string
+	)
+
+	if *configPath != "" {
+		logs.Info("Loading binlog archive config from file: %s", *configPath)
+		cfg, err := config.LoadBinlogArchive(*configPath)
+		if err != nil {
+			console.Println("Failed to load binlog archive config:", err)
+			logs.Error("Failed to load binlog archive config: %v", err)
+			return newError(KindConfig, err)
+		}
+
+		opts = backup.BinlogArchiveOptions{
+			Host:     cfg.Host,
+			Port:     cfg.Port,
+			User:     cfg.User,
+			Password: cfg.Password,
+			Dir:      cfg.Dir,
+			ServerID: cfg.ServerID,
+		}
+		if cfg.UploadInterval != "" {
+			d, err := time.ParseDuration(cfg.UploadInterval)
+			if err != nil {
+				return newError(KindConfig, fmt.Errorf("invalid uploadInterval: %w", err))
+			}
+			opts.UploadInterval = d
+		}
+		uploadS3, bucket, region, prefix = cfg.UploadS3, cfg.S3Bucket, cfg.S3Region, cfg.S3Prefix
+	} else {
+		opts = backup.BinlogArchiveOptions{
+			Host:           *host,
+			Port:           *port,
+			User:           *user,
+			Password:       *password,
+			Dir:            *dir,
+			ServerID:       *serverID,
+			UploadInterval: *interval,
+		}
+		uploadS3, bucket, region, prefix = *s3Bucket != "", *s3Bucket, *s3Region, *s3Prefix
+	}
+
+	if opts.Dir == "" {
+		console.Println("Error: a binlog archive directory is required (-dir)")
+		logs.Error("archive-binlog failed: no archive directory")
+		return newError(KindUsage, errors.New("a binlog archive directory is required"))
+	}
+	if uploadS3 {
+		if bucket == "" || region == "" {
+			console.Println("S3 upload requested but bucket or region is empty")
+			logs.Error("S3 upload requested but bucket or region is empty")
+			return newError(KindConfig, errors.New("S3 upload requested but bucket or region is empty"))
+		}
+		opts.Upload = func(ctx context.Context, path string) error {
+			key := prefix + filepath.Base(path)
+			logs.Info("Uploading binlog to S3: bucket=%s key=%s", bucket, key)
+			return storage.UploadToS3(ctx, bucket, region, key, path, nil)
+		}
+	}
+
+	logs.Info("Archiving binlogs: host=%s port=%d user=%s dir=%s s3=%v", opts.Host, opts.Port, opts.User, opts.Dir, uploadS3)
+
+	err := backup.ArchiveBinlogs(ctx, opts)
+	if ctx.Err() != nil {
+		console.Println("Binlog archiving stopped.")
+		logs.Info("Binlog archiving stopped")
+		return newError(KindInterrupted, ctx.Err())
+	}
+	console.Println("Binlog archiving failed:", err)
+	logs.Error("Binlog archiving failed: %v", err)
+	return newError(dumpErrorKind(err), err)
+}
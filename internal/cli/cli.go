@@ -1,447 +1,258 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/bhagashetti/db-backup-cli/internal/backup"
-	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
 	"github.com/bhagashetti/db-backup-cli/internal/logs"
-	"github.com/bhagashetti/db-backup-cli/internal/storage"
 )
 
 const appVersion = "0.2.0"
 
+// defaultGrace is how long a command may take to stop after SIGINT/SIGTERM
+// before the process exits anyway. Commands expose it as -grace.
+const defaultGrace = 30 * time.Second
+
+// shutdownGrace is the -grace of the running command in nanoseconds, read
+// by the watchdog exitAfterGrace starts on a signal.
+var shutdownGrace atomic.Int64
+
+// grace returns the shutdown grace of the running command.
+func grace() time.Duration {
+	if d := time.Duration(shutdownGrace.Load()); d > 0 {
+		return d
+	}
+	return defaultGrace
+}
+
+// Execute runs the command named in os.Args and exits with a code matching
+// the kind of failure, if any.
 func Execute() {
 	// init logging
 	logFile, err := logs.Init("backup.log")
 	if err != nil {
-		fmt.Println("Failed to initialize logger:", err)
+		console.Println("Failed to initialize logger:", err)
 		os.Exit(1)
 	}
-	defer logFile.Close()
 
-	if len(os.Args) < 2 {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go exitAfterGrace(ctx, done)
+
+	err = Run(ctx, os.Args[1:])
+	close(done) // before stop, which also cancels ctx
+	stop()
+	code := ExitCode(err)
+	if code != 0 {
+		logs.Error("Command failed (exit %d): %v", code, err)
+	}
+
+	logFile.Close()
+	os.Exit(code)
+}
+
+// exitAfterGrace waits for a shutdown signal, then gives the running command
+// shutdownGrace to clean up before forcing the process to exit. It returns
+// without doing anything once done is closed.
+func exitAfterGrace(ctx context.Context, done <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+	case <-done:
+		return
+	}
+	select {
+	case <-done:
+		return
+	default:
+	}
+
+	d := grace()
+	console.Println("Shutdown requested; stopping within", d)
+	logs.Info("Shutdown requested; grace period %s", d)
+
+	time.Sleep(d)
+	console.Println("Grace period expired; exiting")
+	logs.Error("Shutdown grace period of %s expired; exiting", d)
+	os.Exit(KindInterrupted.ExitCode())
+}
+
+// Run executes a single command with its arguments and returns its error
+// instead of exiting, so it can be driven from tests and the scheduler.
+// Cancelling ctx stops the command and any child processes it started.
+//
+// In JSON mode the last line written is an "exit" result for the command.
+func Run(ctx context.Context, args []string) error {
+	o := defaultRunOptions()
+	global := flag.NewFlagSet("db-backup-cli", flag.ContinueOnError)
+	global.Usage = printUsage
+	if err := parseFlags(global, args, o); err != nil {
+		emitExit("", err)
+		reportQuietError(err)
+		return err
+	}
+	args = global.Args()
+
+	if len(args) < 1 {
 		printUsage()
-		os.Exit(1)
+		err := newError(KindUsage, errors.New("no command given"))
+		emitExit("", err)
+		reportQuietError(err)
+		return err
 	}
 
-	command := os.Args[1]
+	command := args[0]
 	logs.Info("Command received: %s", command)
 
+	err := runCommand(ctx, o, command, args[1:])
+	emitExit(command, err)
+	reportQuietError(err)
+	return err
+}
+
+// runCommand dispatches to the handler of command, which binds its copies
+// of the global flags to o.
+func runCommand(ctx context.Context, o *runOptions, command string, args []string) error {
 	switch command {
 	case "backup":
-		handleBackup(os.Args[2:])
+		return handleBackup(ctx, o, args)
 	case "restore":
-		handleRestore(os.Args[2:])
+		return handleRestore(ctx, o, args)
 	case "schedule":
-		handleSchedule(os.Args[2:])
+		return handleSchedule(ctx, o, args)
+	case "archive-binlog":
+		return handleArchiveBinlog(ctx, o, args)
+	case "archive-wal":
+		return handleArchiveWAL(ctx, o, args)
+	case "jobs":
+		return handleJobs(o, args)
+	case "repo":
+		return handleRepo(ctx, o, args)
+	case "compress-bench":
+		return handleCompressBench(ctx, o, args)
+	case "config":
+		return handleConfig(o, args)
 	case "version":
-		fmt.Println("db-backup-cli version", appVersion)
+		if err := parseFlags(flag.NewFlagSet("version", flag.ContinueOnError), args, o); err != nil {
+			return err
+		}
+		console.Println("db-backup-cli version", appVersion)
+		emit(versionResult{Type: "version", Version: appVersion})
 		logs.Info("Version requested: %s", appVersion)
 	case "help":
 		printUsage()
 		logs.Info("Help requested")
 	default:
-		fmt.Println("Unknown command:", command)
+		console.Println("Unknown command:", command)
 		printUsage()
 		logs.Error("Unknown command: %s", command)
-		os.Exit(1)
+		return newError(KindUsage, fmt.Errorf("unknown command %q", command))
 	}
 
+	return nil
 }
 
 func printUsage() {
-	fmt.Println("Usage: db-backup-cli <command> [options]")
-	fmt.Println()
-	fmt.Println("Commands:")
-	fmt.Println("  backup     Run a backup")
-	fmt.Println("  restore    Restore from a backup")
-	fmt.Println("  schedule   Run backups on a fixed interval")
-	fmt.Println("  version    Show application version")
-	fmt.Println("  help       Show this help message")
-	fmt.Println()
-	fmt.Println("Use 'db-backup-cli <command> -h' to see options for a command.")
+	console.Println("Usage: db-backup-cli [-output text|json] [-quiet] <command> [options]")
+	console.Println()
+	console.Println("Commands:")
+	console.Println("  backup           Run a backup")
+	console.Println("  restore          Restore from a backup")
+	console.Println("  schedule         Run backups on an interval, daily, or from a cron jobs file")
+	console.Println("  jobs             Show the next fire times for each job in a jobs file")
+	console.Println("  archive-binlog   Stream MySQL binlogs to a local archive and S3 for point-in-time restores")
+	console.Println("  archive-wal      Archive or fetch one PostgreSQL WAL file (archive_command / restore_command)")
+	console.Println("  repo             List, forget and garbage-collect snapshots in a deduplicating repository")
+	console.Println("  compress-bench   Compare compression ratio and speed on a sample of a backup")
+	console.Println("  config           Validate config files, or print their JSON Schema")
+	console.Println("  version          Show application version")
+	console.Println("  help             Show this help message")
+	console.Println()
+	console.Println("Use 'db-backup-cli <command> -h' to see options for a command.")
+	console.Println()
+	console.Println("With -output json, stdout carries one JSON object per line (results, then")
+	console.Println("a final \"exit\" object) and human text goes to stderr. -quiet drops the")
+	console.Println("human text and progress. Both may also follow the command.")
+	console.Println()
+	console.Println("Exit codes:")
+	console.Println("  0 success, 1 unknown, 2 usage, 3 config, 4 connection, 5 dump,")
+	console.Println("  6 compress, 7 encrypt, 8 upload, 9 restore, 10 pre-backup hook,")
+	console.Println("  130 interrupted by SIGINT/SIGTERM")
 }
 
-func handleBackup(args []string) {
-	fs := flag.NewFlagSet("backup", flag.ExitOnError)
-
-	configPath := fs.String("config", "", "Path to JSON config file")
-
-	dbType := fs.String("db-type", "mysql", "Database type (mysql, postgres, mongo, sqlite)")
-	host := fs.String("host", "localhost", "Database host")
-	port := fs.Int("port", 3306, "Database port")
-	user := fs.String("user", "root", "Database user")
-	password := fs.String("password", "", "Database password")
-	dbName := fs.String("db", "", "Database name")
-	output := fs.String("out", "backup.sql", "Output backup file")
-	compressFlag := fs.Bool("compress", false, "Compress backup using gzip (.gz)")
-	encryptFlag := fs.Bool("encrypt", false, "Encrypt backup using AES-256-GCM")
-	encryptKeyFlag := fs.String("encrypt-key", "", "Encryption key (32 chars)")
-
-	fs.Parse(args)
-
-	var (
-		opts       backup.BackupOptions
-		compress   bool
-		encrypt    bool
-		encryptKey string
-		uploadS3   bool
-		s3Bucket   string
-		s3Region   string
-		s3Prefix   string
-	)
-
-	// If a config file is provided, load values from it.
-	if *configPath != "" {
-		logs.Info("Loading backup config from file: %s", *configPath)
-		cfg, err := config.LoadBackup(*configPath)
-		if err != nil {
-			fmt.Println("Failed to load config:", err)
-			logs.Error("Failed to load backup config: %v", err)
-			os.Exit(1)
-		}
-
-		opts = backup.BackupOptions{
-			DBType:   cfg.DBType,
-			Host:     cfg.Host,
-			Port:     cfg.Port,
-			User:     cfg.User,
-			Password: cfg.Password,
-			DBName:   cfg.DBName,
-			Output:   cfg.Output,
-		}
-		compress = cfg.Compress
-		encrypt = cfg.Encrypt
-		encryptKey = cfg.EncryptKey
-		uploadS3 = cfg.UploadS3
-		s3Bucket = cfg.S3Bucket
-		s3Region = cfg.S3Region
-		s3Prefix = cfg.S3Prefix
-
-		// If useTimestamp is true, change Output to include date-time.
-		if cfg.UseTimestamp {
-			timestamp := time.Now().Format("20060102-150405")
-			opts.Output = fmt.Sprintf("%s-%s.sql", cfg.DBName, timestamp)
-		}
-	} else {
-		// No config file: use CLI flags.
-		if *dbName == "" {
-			fmt.Println("Error: -db is required")
-			fs.Usage()
-			logs.Error("Backup failed: missing -db flag")
-			os.Exit(1)
-		}
-
-		opts = backup.BackupOptions{
-			DBType:   *dbType,
-			Host:     *host,
-			Port:     *port,
-			User:     *user,
-			Password: *password,
-			DBName:   *dbName,
-			Output:   *output,
-		}
-		compress = *compressFlag
-		encrypt = *encryptFlag
-		encryptKey = *encryptKeyFlag
-		uploadS3 = false
-		s3Bucket = ""
-		s3Region = ""
-		s3Prefix = ""
-
-	}
-
-	fmt.Println("Starting backup...")
-	fmt.Printf("  db-type : %s\n", opts.DBType)
-	fmt.Printf("  host    : %s\n", opts.Host)
-	fmt.Printf("  port    : %d\n", opts.Port)
-	fmt.Printf("  user    : %s\n", opts.User)
-	fmt.Printf("  db      : %s\n", opts.DBName)
-	fmt.Printf("  out     : %s\n", opts.Output)
-	fmt.Printf("  compress: %v\n", compress)
-	fmt.Printf("  encrypt : %v\n", encrypt)
-
-	logs.Info(
-		"Starting backup: dbType=%s host=%s port=%d user=%s db=%s out=%s compress=%v encrypt=%v",
-		opts.DBType, opts.Host, opts.Port, opts.User, opts.DBName, opts.Output, compress, encrypt,
-	)
-
-	// 1) Run DB-specific backup
-	switch opts.DBType {
-	case "mysql":
-		if err := backup.MySQLBackup(opts); err != nil {
-			fmt.Println("Backup failed:", err)
-			logs.Error("Backup failed: %v", err)
-			os.Exit(1)
-		}
-	default:
-		fmt.Println("Unsupported db-type for now:", opts.DBType)
-		logs.Error("Unsupported db-type: %s", opts.DBType)
-		os.Exit(1)
-	}
-
-	// Track the current "final" file path as we transform it
-	finalPath := opts.Output
-
-	// 2) Optional compression
-	if compress {
-		gzPath := finalPath + ".gz"
-		fmt.Println("Compressing backup to:", gzPath)
-		logs.Info("Compressing backup to: %s", gzPath)
-
-		if err := backup.GzipFile(finalPath, gzPath); err != nil {
-			fmt.Println("Compression failed:", err)
-			logs.Error("Compression failed: %v", err)
-			os.Exit(1)
-		}
-
-		if err := os.Remove(finalPath); err != nil {
-			fmt.Println("Warning: could not remove original file:", err)
-			logs.Error("Could not remove original backup file: %v", err)
-		} else {
-			logs.Info("Removed original uncompressed backup: %s", finalPath)
-		}
-
-		finalPath = gzPath
-	}
-
-	// 3) Optional encryption
-	if encrypt {
-		if encryptKey == "" {
-			fmt.Println("Encryption requested but no key provided")
-			logs.Error("Encryption requested but no key provided")
-			os.Exit(1)
-		}
-
-		keyBytes := []byte(encryptKey)
-		if len(keyBytes) != 32 {
-			fmt.Println("Encryption key must be exactly 32 characters")
-			logs.Error("Encryption key invalid length: %d", len(keyBytes))
-			os.Exit(1)
-		}
-
-		encPath := finalPath + ".enc"
-		fmt.Println("Encrypting backup to:", encPath)
-		logs.Info("Encrypting backup to: %s", encPath)
-
-		if err := backup.EncryptFile(finalPath, encPath, keyBytes); err != nil {
-			fmt.Println("Encryption failed:", err)
-			logs.Error("Encryption failed: %v", err)
-			os.Exit(1)
-		}
-
-		if err := os.Remove(finalPath); err != nil {
-			fmt.Println("Warning: could not remove unencrypted file:", err)
-			logs.Error("Could not remove unencrypted file: %v", err)
-		} else {
-			logs.Info("Removed unencrypted backup: %s", finalPath)
-		}
-
-		finalPath = encPath
-	}
-	// 4) Optional S3 upload
-	if uploadS3 {
-		if s3Bucket == "" || s3Region == "" {
-			fmt.Println("S3 upload requested but bucket or region is empty")
-			logs.Error("S3 upload requested but bucket or region is empty")
-			os.Exit(1)
-		}
-
-		key := s3Prefix + filepath.Base(finalPath)
-		fmt.Println("Uploading backup to S3:", s3Bucket, "key:", key)
-		logs.Info("Uploading backup to S3: bucket=%s key=%s region=%s", s3Bucket, key, s3Region)
-
-		if err := storage.UploadToS3(s3Bucket, s3Region, key, finalPath); err != nil {
-			fmt.Println("S3 upload failed:", err)
-			logs.Error("S3 upload failed: %v", err)
-			os.Exit(1)
-		}
-
-		fmt.Println("S3 upload completed.")
-		logs.Info("S3 upload completed: bucket=%s key=%s", s3Bucket, key)
-	}
-
-	fmt.Println("Backup completed successfully. Final file:", finalPath)
-	logs.Info("Backup completed successfully. Final file: %s", finalPath)
+// runOptions are the settings every command takes besides its own: the
+// output format and, for commands that run long enough to be interrupted,
+// the shutdown grace. Run parses them into one value and handlers bind
+// their flags to it rather than to package variables, so the backups the
+// scheduler runs side by side cannot disturb each other.
+type runOptions struct {
+	output string // formatText or formatJSON
+	quiet  bool
+	grace  time.Duration
+
+	// nested marks a run started by another command, such as a scheduled
+	// backup, which leaves the process-wide settings to the command that
+	// started it.
+	nested bool
 }
 
-func handleRestore(args []string) {
-	fs := flag.NewFlagSet("restore", flag.ExitOnError)
-
-	configPath := fs.String("config", "", "Path to JSON restore config file")
-
-	dbType := fs.String("db-type", "mysql", "Database type")
-	host := fs.String("host", "localhost", "Database host")
-	port := fs.Int("port", 3306, "Database port")
-	user := fs.String("user", "root", "Database user")
-	password := fs.String("password", "", "Database password")
-	dbName := fs.String("db", "", "Database name")
-	input := fs.String("in", "backup.sql", "Backup file to restore from")
-
-	fs.Parse(args)
-
-	var opts backup.RestoreOptions
-
-	if *configPath != "" {
-		logs.Info("Loading restore config from file: %s", *configPath)
-		cfg, err := config.LoadRestore(*configPath)
-		if err != nil {
-			fmt.Println("Failed to load restore config:", err)
-			logs.Error("Failed to load restore config: %v", err)
-			os.Exit(1)
-		}
-
-		opts = backup.RestoreOptions{
-			DBType:   cfg.DBType,
-			Host:     cfg.Host,
-			Port:     cfg.Port,
-			User:     cfg.User,
-			Password: cfg.Password,
-			DBName:   cfg.DBName,
-			Input:    cfg.Input,
-		}
-	} else {
-		if *dbName == "" {
-			fmt.Println("Error: -db is required")
-			fs.Usage()
-			logs.Error("Restore failed: missing -db flag")
-			os.Exit(1)
-		}
-
-		opts = backup.RestoreOptions{
-			DBType:   *dbType,
-			Host:     *host,
-			Port:     *port,
-			User:     *user,
-			Password: *password,
-			DBName:   *dbName,
-			Input:    *input,
-		}
-	}
-
-	fmt.Println("Starting restore...")
-	fmt.Printf("  db-type: %s\n", opts.DBType)
-	fmt.Printf("  host   : %s\n", opts.Host)
-	fmt.Printf("  port   : %d\n", opts.Port)
-	fmt.Printf("  user   : %s\n", opts.User)
-	fmt.Printf("  db     : %s\n", opts.DBName)
-	fmt.Printf("  in     : %s\n", opts.Input)
-
-	logs.Info(
-		"Starting restore: dbType=%s host=%s port=%d user=%s db=%s in=%s",
-		opts.DBType, opts.Host, opts.Port, opts.User, opts.DBName, opts.Input,
-	)
-
-	switch opts.DBType {
-	case "mysql":
-		if err := backup.MySQLRestore(opts); err != nil {
-			fmt.Println("Restore failed:", err)
-			logs.Error("Restore failed: %v", err)
-			os.Exit(1)
-		}
-		fmt.Println("Restore completed successfully.")
-		logs.Info("Restore completed successfully.")
-	default:
-		fmt.Println("Unsupported db-type for now:", opts.DBType)
-		logs.Error("Unsupported db-type: %s", opts.DBType)
-		os.Exit(1)
-	}
+func defaultRunOptions() *runOptions {
+	return &runOptions{output: formatText, grace: defaultGrace}
 }
 
-func handleSchedule(args []string) {
-	fs := flag.NewFlagSet("schedule", flag.ExitOnError)
-
-	configPath := fs.String("config", "", "Path to JSON backup config file")
-	every := fs.String("every", "", "How often to run the backup (e.g. 1h, 30m, 24h)")
-	daily := fs.String("daily", "", "Run backup once per day at HH:MM (24h format, local time)")
-
-	fs.Parse(args)
+// child returns the options for a run started by the one o belongs to.
+func (o *runOptions) child() *runOptions {
+	c := *o
+	c.nested = true
+	return &c
+}
 
-	if *configPath == "" {
-		fmt.Println("Error: -config is required for schedule")
-		fs.Usage()
-		logs.Error("Schedule failed: missing -config flag")
-		os.Exit(1)
+// apply checks o and, for a top-level run, puts it into effect: output
+// goes where -output and -quiet say, and the shutdown watchdog and child
+// processes get the grace. It is called after parsing, before a command
+// starts any goroutines.
+func (o *runOptions) apply() error {
+	if o.output != formatText && o.output != formatJSON {
+		return fmt.Errorf("-output %q: want text or json", o.output)
 	}
-
-	if *every == "" && *daily == "" {
-		fmt.Println("Error: either -every or -daily must be provided")
-		fs.Usage()
-		logs.Error("Schedule failed: missing -every/-daily")
-		os.Exit(1)
+	if o.nested {
+		return nil
 	}
+	shutdownGrace.Store(int64(o.grace))
+	// Child processes get half of it to exit after SIGTERM so there is
+	// time left to clean up before the process exits.
+	backup.TerminateGrace = o.grace / 2
+	applyOutput(o)
+	return nil
+}
 
-	if *every != "" && *daily != "" {
-		fmt.Println("Error: use either -every OR -daily, not both")
-		fs.Usage()
-		logs.Error("Schedule failed: both -every and -daily provided")
-		os.Exit(1)
+// parseFlags parses args into fs, mapping parse failures to usage errors.
+// -h and -help return flag.ErrHelp, which exits with status 0.
+//
+// Every command also takes -output and -quiet, bound to o and applied once
+// parsed.
+func parseFlags(fs *flag.FlagSet, args []string, o *runOptions) error {
+	if fs.Lookup("output") == nil {
+		addOutputFlags(fs, o)
 	}
-
-	// Interval scheduler: -every=1h
-	if *every != "" {
-		interval, err := time.ParseDuration(*every)
-		if err != nil {
-			fmt.Println("Invalid duration for -every:", err)
-			logs.Error("Invalid duration for -every: %v", err)
-			os.Exit(1)
+	err := fs.Parse(args)
+	if err == nil {
+		if oerr := o.apply(); oerr != nil {
+			console.Println("Invalid output flags:", oerr)
+			return newError(KindUsage, oerr)
 		}
-
-		fmt.Println("Starting interval scheduler...")
-		fmt.Println("  config :", *configPath)
-		fmt.Println("  every  :", interval)
-
-		logs.Info("Starting interval scheduler: config=%s every=%s", *configPath, interval.String())
-
-		for {
-			fmt.Println("Running scheduled backup at", time.Now().Format(time.RFC3339))
-			logs.Info("Running scheduled backup at %s", time.Now().Format(time.RFC3339))
-
-			handleBackup([]string{"-config=" + *configPath})
-
-			fmt.Println("Next backup in:", interval)
-			logs.Info("Next backup in: %s", interval.String())
-
-			time.Sleep(interval)
-		}
-	}
-
-	// Daily scheduler: -daily=HH:MM
-	t, err := time.Parse("15:04", *daily)
-	if err != nil {
-		fmt.Println("Invalid time for -daily (expected HH:MM):", err)
-		logs.Error("Invalid time for -daily: %v", err)
-		os.Exit(1)
 	}
 
-	fmt.Println("Starting daily scheduler...")
-	fmt.Println("  config :", *configPath)
-	fmt.Println("  daily  :", *daily)
-
-	logs.Info("Starting daily scheduler: config=%s daily=%s", *configPath, *daily)
-
-	for {
-		now := time.Now()
-		nextRun := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
-		if !nextRun.After(now) {
-			// if time already passed today, schedule for tomorrow
-			nextRun = nextRun.Add(24 * time.Hour)
-		}
-
-		wait := time.Until(nextRun)
-		fmt.Println("Next backup at:", nextRun.Format(time.RFC3339))
-		logs.Info("Next daily backup at: %s (in %s)", nextRun.Format(time.RFC3339), wait.String())
-
-		time.Sleep(wait)
-
-		fmt.Println("Running daily scheduled backup at", time.Now().Format(time.RFC3339))
-		logs.Info("Running daily scheduled backup at %s", time.Now().Format(time.RFC3339))
-
-		handleBackup([]string{"-config=" + *configPath})
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return err
 	}
+	return newError(KindUsage, err)
 }
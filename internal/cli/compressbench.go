@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bhagashetti/db-backup-cli/internal/backup"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+)
+
+// defaultBenchCandidates are the compressors compared when -compression is
+// not given: each algorithm's default and its fast and strong ends.
+const defaultBenchCandidates = "gzip:1,gzip,gzip:9,pgzip,zstd:1,zstd,zstd:9,zstd:19,xz:1,xz,lz4,lz4:9"
+
+func handleCompressBench(ctx context.Context, o *runOptions, args []string) error {
+	fs := flag.NewFlagSet("compress-bench", flag.ContinueOnError)
+
+	input := fs.String("in", "", "Backup file to sample (a compressed backup is decompressed first)")
+	sampleMB := fs.Int64("sample-mb", 64, "Sample size in MB, taken in slices spread through the file")
+	candidates := fs.String("compression", defaultBenchCandidates, "Comma-separated algorithm[:level] entries to compare")
+	threads := fs.Int("compress-threads", 0, "Compression threads for pgzip, zstd and lz4 (default all CPUs)")
+	long := fs.Bool("zstd-long", false, "Also try each zstd entry with long-distance matching")
+
+	if err := parseFlags(fs, args, o); err != nil {
+		return err
+	}
+
+	if *input == "" {
+		console.Println("Error: -in is required")
+		fs.Usage()
+		logs.Error("Compression benchmark failed: missing -in flag")
+		return newError(KindUsage, errors.New("-in is required"))
+	}
+	if *sampleMB <= 0 {
+		return newError(KindUsage, errors.New("-sample-mb must be positive"))
+	}
+
+	opts, err := parseCompressionList(*candidates, *threads, *long)
+	if err != nil {
+		console.Println("Invalid -compression:", err)
+		logs.Error("Invalid -compression: %v", err)
+		return newError(KindUsage, err)
+	}
+
+	sample, err := backup.ReadSample(ctx, *input, *sampleMB*1e6)
+	if err != nil {
+		console.Println("Could not read sample:", err)
+		logs.Error("Compression benchmark could not read %s: %v", *input, err)
+		return newErrorCtx(ctx, KindConfig, err)
+	}
+	if len(sample) == 0 {
+		return newError(KindConfig, fmt.Errorf("%s is empty", *input))
+	}
+	console.Printf("Benchmarking %d compressors on a %.1f MB sample of %s\n", len(opts), float64(len(sample))/1e6, *input)
+	logs.Info("Compression benchmark of %s, %d bytes sampled", *input, len(sample))
+
+	results, err := backup.BenchCompression(ctx, sample, opts)
+	console.Printf("  %-14s %8s %12s %14s %16s\n", "ALGORITHM", "RATIO", "SIZE MB", "COMPRESS MB/s", "DECOMPRESS MB/s")
+	for _, r := range results {
+		console.Printf("  %-14s %8.2f %12.2f %14.1f %16.1f\n",
+			benchLabel(r.Options), r.Ratio(), float64(r.OutputBytes)/1e6, r.CompressMBps(), r.DecompressMBps())
+		emit(benchResult{
+			Type:           "compress-bench",
+			Algorithm:      benchLabel(r.Options),
+			InputBytes:     r.InputBytes,
+			OutputBytes:    r.OutputBytes,
+			Ratio:          r.Ratio(),
+			CompressMBps:   r.CompressMBps(),
+			DecompressMBps: r.DecompressMBps(),
+		})
+	}
+	if err != nil {
+		console.Println("Benchmark failed:", err)
+		logs.Error("Compression benchmark failed: %v", err)
+		return newErrorCtx(ctx, KindCompress, err)
+	}
+	return nil
+}
+
+// parseCompressionList parses "zstd:19,lz4,gzip:6" into compressor options.
+func parseCompressionList(s string, threads int, long bool) ([]backup.CompressOptions, error) {
+	var list []backup.CompressOptions
+	for _, entry := range splitList(s) {
+		name, level, hasLevel := strings.Cut(entry, ":")
+		opts := backup.CompressOptions{Algorithm: name, Threads: threads}
+		if hasLevel {
+			n, err := strconv.Atoi(level)
+			if err != nil {
+				return nil, fmt.Errorf("bad level in %q", entry)
+			}
+			opts.Level = n
+		}
+		if _, err := backup.LookupCodec(opts); err != nil {
+			return nil, err
+		}
+		list = append(list, opts)
+		if long && strings.EqualFold(name, backup.CompressZstd) {
+			opts.Long = true
+			list = append(list, opts)
+		}
+	}
+	if len(list) == 0 {
+		return nil, errors.New("no compressors given")
+	}
+	return list, nil
+}
+
+// benchLabel names a benchmarked compressor, e.g. "zstd:19+long".
+func benchLabel(opts backup.CompressOptions) string {
+	label := opts.Algorithm
+	if opts.Level != 0 {
+		label += ":" + strconv.Itoa(opts.Level)
+	}
+	if opts.Long {
+		label += "+long"
+	}
+	return label
+}
@@ -0,0 +1,288 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/backup"
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/notify"
+	"github.com/bhagashetti/db-backup-cli/internal/schedule"
+)
+
+// handleConfig runs "config validate", which checks config files without
+// running anything, and "config schema", which prints their JSON Schema.
+func handleConfig(o *runOptions, args []string) error {
+	if len(args) < 1 || (args[0] != "validate" && args[0] != "schema") {
+		console.Println("Usage: db-backup-cli config validate [-type kind] <file>...")
+		console.Println("       db-backup-cli config schema [-type kind]")
+		return newError(KindUsage, errors.New("config needs validate or schema"))
+	}
+	mode := args[0]
+
+	fs := flag.NewFlagSet("config "+mode, flag.ContinueOnError)
+	kind := fs.String("type", "backup", "Kind of config file: "+strings.Join(config.SchemaKinds, ", "))
+
+	if err := parseFlags(fs, args[1:], o); err != nil {
+		return err
+	}
+	if !slices.Contains(config.SchemaKinds, *kind) {
+		err := fmt.Errorf("-type %q: want one of %s", *kind, strings.Join(config.SchemaKinds, ", "))
+		console.Println("Error:", err)
+		return newError(KindUsage, err)
+	}
+
+	if mode == "schema" {
+		schema, err := config.Schema(*kind)
+		if err != nil {
+			return newError(KindUsage, err)
+		}
+		console.Print(string(schema))
+		return nil
+	}
+
+	if fs.NArg() == 0 {
+		console.Println("Error: no config file given")
+		fs.Usage()
+		return newError(KindUsage, errors.New("no config file given"))
+	}
+
+	var total int
+	for _, path := range fs.Args() {
+		total += reportConfigProblems(validateConfigFile(*kind, path))
+	}
+	if total > 0 {
+		logs.Error("Config validation found %d problems", total)
+		return newError(KindConfig, fmt.Errorf("%d problems found", total))
+	}
+	logs.Info("Config validation passed: %s", strings.Join(fs.Args(), ", "))
+	return nil
+}
+
+// fileProblems are the problems of one config file.
+type fileProblems struct {
+	file     string
+	problems config.Problems
+}
+
+// reportConfigProblems prints and emits the problems of each file and
+// returns how many there are.
+func reportConfigProblems(files []fileProblems) int {
+	var total int
+	for _, f := range files {
+		emit(configValidateResult{Type: "config-validate", File: f.file, Valid: len(f.problems) == 0, Problems: len(f.problems)})
+		if len(f.problems) == 0 {
+			console.Printf("%s: OK\n", f.file)
+			continue
+		}
+		console.Printf("%s: %d problem(s)\n", f.file, len(f.problems))
+		for _, p := range f.problems {
+			console.Println("  " + p.String())
+			emit(configProblemResult{Type: "config-problem", File: f.file, Field: p.Field, Message: p.Message})
+		}
+		total += len(f.problems)
+	}
+	return total
+}
+
+// validateConfigFile checks the config file at path of the given kind:
+// unknown fields and invalid settings, then what depends on this host,
+// such as client programs on PATH and a writable output directory. A
+// jobs file is reported with the backup configs its jobs use.
+func validateConfigFile(kind, path string) []fileProblems {
+	logs.Info("Validating %s config: %s", kind, path)
+	var (
+		problems config.Problems
+		err      error
+		more     []fileProblems
+	)
+	switch kind {
+	case "backup":
+		var cfg *config.BackupConfig
+		if cfg, problems, err = config.ReadBackup(path); cfg != nil {
+			problems = append(problems, checkBackupConfig(cfg)...)
+		}
+	case "restore":
+		var cfg *config.RestoreConfig
+		if cfg, problems, err = config.ReadRestore(path); cfg != nil {
+			problems = append(problems, checkRestoreConfig(cfg)...)
+		}
+	case "archive-binlog":
+		var cfg *config.BinlogArchiveConfig
+		if cfg, problems, err = config.ReadBinlogArchive(path); cfg != nil {
+			problems = append(problems, checkTools(backup.BinlogArchiveTools)...)
+		}
+	case "archive-wal":
+		var cfg *config.WALArchiveConfig
+		if cfg, problems, err = config.ReadWALArchive(path); cfg != nil && len(problems) == 0 {
+			if _, werr := walArchiveOptions(*cfg); werr != nil {
+				problems = append(problems, config.Problem{Message: werr.Error()})
+			}
+		}
+	case "jobs":
+		var cfg *config.JobsConfig
+		if cfg, problems, err = config.ReadJobs(path); cfg != nil {
+			problems = append(problems, checkJobsConfig(cfg)...)
+			seen := map[string]bool{}
+			for _, j := range cfg.Jobs {
+				if j.Config != "" && !seen[j.Config] {
+					seen[j.Config] = true
+					more = append(more, validateConfigFile("backup", j.Config)...)
+				}
+			}
+		}
+	}
+	if err != nil {
+		problems = append(problems, config.Problem{Message: err.Error()})
+	}
+	return append([]fileProblems{{file: path, problems: problems}}, more...)
+}
+
+// checkBackupConfig checks what config.BackupConfig.Validate cannot: the
+// settings parsed by other packages and the state of this host.
+func checkBackupConfig(cfg *config.BackupConfig) config.Problems {
+	var ps config.Problems
+	add := func(field string, err error) {
+		ps = append(ps, config.Problem{Field: field, Message: err.Error()})
+	}
+
+	opts := backup.BackupOptions{
+		DBType:   cfg.DBType,
+		Engine:   cfg.Engine,
+		Format:   cfg.Format,
+		Snapshot: cfg.Snapshot,
+		Dump:     dumpOptions(cfg.MySQLDump, cfg.ExtraArgs),
+		Files: backup.FileSet{
+			Paths:   cfg.Paths,
+			Include: cfg.IncludeFiles,
+			Exclude: cfg.ExcludeFiles,
+		},
+	}
+	if err := backup.CheckOptions(opts); err != nil {
+		add("", err)
+	}
+	compression := backup.CompressOptions{
+		Algorithm: cfg.Compression.Algorithm,
+		Level:     cfg.Compression.Level,
+		Threads:   cfg.Compression.Threads,
+		Long:      cfg.Compression.Long,
+	}
+	if _, err := backup.LookupCodec(compression); err != nil {
+		add("compression", err)
+	}
+	if _, _, _, err := throttleSettings(cfg.Throttle); err != nil {
+		add("throttle", err)
+	}
+	if _, err := parseProgress(cfg.Progress); err != nil {
+		add("progress", err)
+	}
+	if _, err := notify.New(cfg.Notifications); err != nil {
+		add("notifications", err)
+	}
+	for _, list := range []struct {
+		field string
+		hooks []config.Hook
+	}{
+		{"hooks.preBackup", cfg.Hooks.PreBackup},
+		{"hooks.postBackup", cfg.Hooks.PostBackup},
+		{"hooks.onFailure", cfg.Hooks.OnFailure},
+	} {
+		for i, h := range list.hooks {
+			if _, err := time.ParseDuration(h.Timeout); h.Timeout != "" && err != nil {
+				add(fmt.Sprintf("%s[%d].timeout", list.field, i), err)
+			}
+		}
+	}
+
+	dir := filepath.Dir(cfg.Output)
+	if cfg.UseTimestamp {
+		// Timestamped backups are written to the working directory.
+		dir = "."
+	}
+	if cfg.Output != "" || cfg.UseTimestamp {
+		if err := checkWritable(dir); err != nil {
+			add("out", fmt.Errorf("output directory is not writable: %w", err))
+		}
+	}
+
+	return append(ps, checkTools(backup.BackupTools(opts))...)
+}
+
+// checkRestoreConfig checks what config.RestoreConfig.Validate cannot.
+func checkRestoreConfig(cfg *config.RestoreConfig) config.Problems {
+	var ps config.Problems
+	if _, err := parseTargetTime(cfg.ToTime); err != nil {
+		ps = append(ps, config.Problem{Field: "toTime", Message: err.Error()})
+	}
+	if cfg.Input != "" && cfg.Repository.URL == "" {
+		if _, err := os.Stat(cfg.Input); err != nil {
+			ps = append(ps, config.Problem{Field: "input", Message: err.Error()})
+		}
+	}
+	return append(ps, checkTools(backup.RestoreTools(backup.RestoreOptions{
+		DBType:    cfg.DBType,
+		Engine:    cfg.Engine,
+		BinlogDir: cfg.BinlogDir,
+		DataDir:   cfg.DataDir,
+	}))...)
+}
+
+// checkJobsConfig checks the schedule of each job, which
+// config.JobsConfig.Validate leaves to the schedule package.
+func checkJobsConfig(cfg *config.JobsConfig) config.Problems {
+	var ps config.Problems
+	for i, j := range cfg.Jobs {
+		field := fmt.Sprintf("jobs[%d]", i)
+		if j.Cron != "" {
+			if _, err := schedule.ParseCron(j.Cron); err != nil {
+				ps = append(ps, config.Problem{Field: field + ".cron", Message: err.Error()})
+			}
+		}
+		if j.Timezone != "" {
+			if _, err := time.LoadLocation(j.Timezone); err != nil {
+				ps = append(ps, config.Problem{Field: field + ".timezone", Message: err.Error()})
+			}
+		}
+		if j.Jitter != "" {
+			if _, err := time.ParseDuration(j.Jitter); err != nil {
+				ps = append(ps, config.Problem{Field: field + ".jitter", Message: err.Error()})
+			}
+		}
+	}
+	if cfg.Lock != nil && cfg.Lock.TTL != "" {
+		if d, err := time.ParseDuration(cfg.Lock.TTL); err != nil || d < 3*time.Second {
+			ps = append(ps, config.Problem{Field: "lock.ttl", Message: fmt.Sprintf("%q: want a duration of at least 3s", cfg.Lock.TTL)})
+		}
+	}
+	return ps
+}
+
+// checkTools reports each program in tools that is not on PATH.
+func checkTools(tools []string) config.Problems {
+	var ps config.Problems
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			ps = append(ps, config.Problem{Message: fmt.Sprintf("client program %s not found in PATH", tool)})
+		}
+	}
+	return ps
+}
+
+// checkWritable creates and removes a file in dir.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".db-backup-cli-validate-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
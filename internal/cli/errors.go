@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+)
+
+// ErrorKind classifies a command failure. Each kind has its own exit code so
+// scripts can react to the class of failure.
+type ErrorKind int
+
+const (
+	KindUnknown     ErrorKind = iota // exit 1
+	KindUsage                        // exit 2: bad command line
+	KindConfig                       // exit 3: config file or settings
+	KindConnection                   // exit 4: could not connect to the database
+	KindDump                         // exit 5: dump tool failed
+	KindCompress                     // exit 6
+	KindEncrypt                      // exit 7
+	KindUpload                       // exit 8
+	KindRestore                      // exit 9
+	KindHook                         // exit 10: aborting pre-backup hook
+	KindInterrupted                  // exit 130: stopped by SIGINT/SIGTERM
+)
+
+var kindNames = map[ErrorKind]string{
+	KindUnknown:     "unknown",
+	KindUsage:       "usage",
+	KindConfig:      "config",
+	KindConnection:  "connection",
+	KindDump:        "dump",
+	KindCompress:    "compress",
+	KindEncrypt:     "encrypt",
+	KindUpload:      "upload",
+	KindRestore:     "restore",
+	KindHook:        "hook",
+	KindInterrupted: "interrupted",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ExitCode returns the process exit code for failures of this kind.
+func (k ErrorKind) ExitCode() int {
+	if k == KindInterrupted {
+		return 130 // conventional 128 + SIGINT
+	}
+	return int(k) + 1
+}
+
+// CommandError is a command failure tagged with its kind.
+type CommandError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *CommandError) Error() string {
+	return e.Kind.String() + ": " + e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+func newError(kind ErrorKind, err error) error {
+	return &CommandError{Kind: kind, Err: err}
+}
+
+// newErrorCtx is newError, except that failures caused by ctx being
+// cancelled are reported as KindInterrupted.
+func newErrorCtx(ctx context.Context, kind ErrorKind, err error) error {
+	if ctx.Err() != nil {
+		kind = KindInterrupted
+	}
+	return newError(kind, err)
+}
+
+// KindOf returns the kind of err, or KindUnknown if it is not a CommandError.
+func KindOf(err error) ErrorKind {
+	var cerr *CommandError
+	if errors.As(err, &cerr) {
+		return cerr.Kind
+	}
+	return KindUnknown
+}
+
+// ExitCode maps err to a process exit code; nil and -h/-help map to 0.
+func ExitCode(err error) int {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return KindOf(err).ExitCode()
+}
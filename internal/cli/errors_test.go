@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	cause := errors.New("boom")
+	tests := []struct {
+		name     string
+		err      error
+		wantKind ErrorKind
+		wantCode int
+	}{
+		{"nil", nil, KindUnknown, 0},
+		{"help", flag.ErrHelp, KindUnknown, 0},
+		{"wrapped help", fmt.Errorf("parse: %w", flag.ErrHelp), KindUnknown, 0},
+		{"plain error", cause, KindUnknown, 1},
+		{"usage", newError(KindUsage, cause), KindUsage, 2},
+		{"config", newError(KindConfig, cause), KindConfig, 3},
+		{"connection", newError(KindConnection, cause), KindConnection, 4},
+		{"dump", newError(KindDump, cause), KindDump, 5},
+		{"compress", newError(KindCompress, cause), KindCompress, 6},
+		{"encrypt", newError(KindEncrypt, cause), KindEncrypt, 7},
+		{"upload", newError(KindUpload, cause), KindUpload, 8},
+		{"restore", newError(KindRestore, cause), KindRestore, 9},
+		{"hook", newError(KindHook, cause), KindHook, 10},
+		{"interrupted", newError(KindInterrupted, cause), KindInterrupted, 130},
+		{"wrapped", fmt.Errorf("job nightly: %w", newError(KindUpload, cause)), KindUpload, 8},
+		{"outermost kind wins", newError(KindRestore, newError(KindConnection, cause)), KindRestore, 9},
+		{"joined", errors.Join(cause, newError(KindDump, cause)), KindDump, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.wantKind {
+				t.Errorf("KindOf = %v, want %v", got, tt.wantKind)
+			}
+			if got := ExitCode(tt.err); got != tt.wantCode {
+				t.Errorf("ExitCode = %d, want %d", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	cause := errors.New("access denied")
+	err := newError(KindConnection, cause)
+	if got, want := err.Error(), "connection: access denied"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("errors.Is does not find the cause")
+	}
+	if got := ErrorKind(99).String(); got != "unknown" {
+		t.Errorf("String() of an unknown kind = %q, want unknown", got)
+	}
+}
+
+func TestNewErrorCtx(t *testing.T) {
+	cause := errors.New("dump failed")
+	if got := KindOf(newErrorCtx(context.Background(), KindDump, cause)); got != KindDump {
+		t.Errorf("live context: kind = %v, want dump", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := KindOf(newErrorCtx(ctx, KindDump, cause)); got != KindInterrupted {
+		t.Errorf("cancelled context: kind = %v, want interrupted", got)
+	}
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bhagashetti/db-backup-cli/internal/backup"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/hooks"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/notify"
+)
+
+// runHookedBackup backs up dbs with runDatabases, wrapped in the job's
+// pre-backup, post-backup and on-failure hooks. Each hook list runs once for
+// the whole run, however many databases it covers. Dump options and table
+// filters of every database are checked first so a typo fails the run
+// before any hook has side effects.
+func runHookedBackup(ctx context.Context, job backupJob, notifier *notify.Notifier, dbs []string, parallelism int) error {
+	policy := job.hooks.PreBackupPolicy
+	if policy != "" && policy != "abort" && policy != "continue" {
+		console.Println("Invalid hooks.preBackupPolicy (want abort or continue):", policy)
+		logs.Error("Invalid hooks.preBackupPolicy: %s", policy)
+		return newError(KindConfig, fmt.Errorf("invalid hooks.preBackupPolicy %q", policy))
+	}
+
+	if job.opts.DBType == "mysql" {
+		for _, db := range dbs {
+			opts := databaseJob(job, db, len(dbs) > 1).opts
+			if err := backup.MySQLCheckOptions(ctx, opts); err != nil {
+				console.Printf("Dump option check failed for %s: %v\n", db, err)
+				logs.Error("Dump option check failed for %s: %v", db, err)
+				err = newErrorCtx(ctx, dumpErrorKind(err), err)
+				failDatabases(ctx, job, notifier, dbs, err)
+				return err
+			}
+		}
+	}
+
+	env := hooks.Env{
+		Status: "running",
+		DBType: job.opts.DBType,
+		Host:   job.opts.Host,
+		Port:   job.opts.Port,
+		DBName: strings.Join(dbs, ","),
+	}
+
+	if len(job.hooks.PreBackup) > 0 {
+		env.Stage = hooks.StagePre
+		console.Println("Running pre-backup hooks...")
+		if err := hooks.Run(ctx, job.hooks.PreBackup, env); err != nil {
+			if policy != "continue" {
+				console.Println("Pre-backup hook failed, aborting backup:", err)
+				logs.Error("Pre-backup hook failed, aborting backup: %v", err)
+				runFailureHooks(ctx, job, env, err)
+				err = newErrorCtx(ctx, KindHook, err)
+				failDatabases(ctx, job, notifier, dbs, err)
+				return err
+			}
+			console.Println("Warning: pre-backup hook failed, continuing:", err)
+			logs.Error("Pre-backup hook failed, continuing: %v", err)
+		}
+	}
+
+	outcomes, err := runDatabases(ctx, job, notifier, dbs, parallelism)
+	if err != nil {
+		runFailureHooks(ctx, job, env, err)
+		return err
+	}
+
+	if len(job.hooks.PostBackup) > 0 {
+		var artifacts, locations []string
+		for _, o := range outcomes {
+			artifacts = append(artifacts, o.file)
+			locations = append(locations, o.location)
+		}
+		env.Stage = hooks.StagePost
+		env.Status = "success"
+		env.Artifact = strings.Join(artifacts, ",")
+		env.Location = strings.Join(locations, ",")
+		console.Println("Running post-backup hooks...")
+		if err := hooks.Run(ctx, job.hooks.PostBackup, env); err != nil {
+			console.Println("Warning: post-backup hook failed:", err)
+			logs.Error("Post-backup hook failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// runFailureHooks runs the on-failure hooks even if ctx was cancelled by a
+// shutdown signal; each hook's own timeout still applies.
+func runFailureHooks(ctx context.Context, job backupJob, env hooks.Env, cause error) {
+	if len(job.hooks.OnFailure) == 0 {
+		return
+	}
+
+	env.Stage = hooks.StageFailure
+	env.Status = "failure"
+	env.Error = cause.Error()
+	console.Println("Running on-failure hooks...")
+	if err := hooks.Run(context.WithoutCancel(ctx), job.hooks.OnFailure, env); err != nil {
+		console.Println("Warning: on-failure hook failed:", err)
+		logs.Error("On-failure hook failed: %v", err)
+	}
+}
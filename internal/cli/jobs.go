@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/schedule"
+)
+
+func handleJobs(o *runOptions, args []string) error {
+	fs := flag.NewFlagSet("jobs", flag.ContinueOnError)
+
+	jobsPath := fs.String("jobs", "", "Path to JSON jobs file")
+	count := fs.Int("n", 3, "Number of upcoming fire times to show per job")
+
+	if err := parseFlags(fs, args, o); err != nil {
+		return err
+	}
+
+	if *jobsPath == "" {
+		console.Println("Error: -jobs is required")
+		fs.Usage()
+		logs.Error("Jobs failed: missing -jobs flag")
+		return newError(KindUsage, errors.New("-jobs is required"))
+	}
+
+	_, jobs, err := loadJobs(*jobsPath, schedule.Defaults{})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, j := range jobs {
+		console.Printf("%s\n", j.Name)
+		console.Printf("  cron    : %s\n", j.Trigger)
+		console.Printf("  timezone: %s\n", j.Location)
+		console.Printf("  config  : %s\n", j.ConfigPath)
+		if j.Jitter > 0 {
+			console.Printf("  jitter  : up to %s\n", j.Jitter)
+		}
+
+		times := j.NextN(now, *count)
+		emit(jobResult{
+			Type:     "job",
+			Name:     j.Name,
+			Trigger:  j.Trigger.String(),
+			Timezone: j.Location.String(),
+			Config:   j.ConfigPath,
+			Next:     times,
+		})
+		if len(times) == 0 {
+			console.Println("  next    : never")
+		}
+		for i, t := range times {
+			label := ""
+			if i == 0 {
+				label = "next    :"
+			}
+			console.Printf("  %-9s %s (in %s)\n", label, t.Format(time.RFC3339), t.Sub(now).Round(time.Second))
+		}
+	}
+
+	logs.Info("Listed %d jobs from %s", len(jobs), *jobsPath)
+	return nil
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/metrics"
+)
+
+// reportMetrics writes the run's metrics to the configured textfile and/or
+// Pushgateway. Metrics failures are reported but never fail the run.
+func reportMetrics(cfg config.MetricsConfig, run metrics.Run) {
+	if cfg.Textfile != "" {
+		if err := metrics.WriteTextfile(cfg.Textfile, run); err != nil {
+			console.Println("Warning: could not write metrics textfile:", err)
+			logs.Error("Could not write metrics textfile %s: %v", cfg.Textfile, err)
+		} else {
+			logs.Info("Wrote metrics textfile: %s", cfg.Textfile)
+		}
+	}
+
+	if cfg.PushgatewayURL != "" {
+		if err := metrics.Push(cfg.PushgatewayURL, cfg.Job, run); err != nil {
+			console.Println("Warning: could not push metrics:", err)
+			logs.Error("Could not push metrics to %s: %v", cfg.PushgatewayURL, err)
+		} else {
+			logs.Info("Pushed metrics to: %s", cfg.PushgatewayURL)
+		}
+	}
+}
+
+// fileSize returns the size of path in bytes, or 0 if it cannot be read. The
+// size of a directory is the total of the files in it.
+func fileSize(path string) int64 {
+	if path == "" {
+		return 0
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if !info.IsDir() {
+		return info.Size()
+	}
+	var total int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
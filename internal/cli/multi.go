@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/backup"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/notify"
+	"github.com/bhagashetti/db-backup-cli/internal/progress"
+)
+
+// defaultParallelism is how many databases a multi-database run backs up at
+// once when neither -parallel nor "parallelism" is set.
+const defaultParallelism = 2
+
+// systemDatabases are skipped when "all" or a glob is expanded. Naming one of
+// them explicitly still backs it up.
+var systemDatabases = []string{"information_schema", "mysql", "performance_schema", "sys"}
+
+// dbPlaceholder in an output or metrics textfile path is replaced by the
+// database name.
+const dbPlaceholder = "{db}"
+
+// databaseOutcome is the result of backing up one database of a run.
+type databaseOutcome struct {
+	db       string
+	file     string
+	location string
+	took     time.Duration
+	err      error
+}
+
+// resolveDatabases expands spec (a comma-separated list of names, glob
+// patterns or "all") into the databases to back up. The server is only
+// queried when spec contains "all" or a pattern.
+func resolveDatabases(ctx context.Context, opts backup.BackupOptions, spec string, exclude []string) ([]string, error) {
+	var names, patterns []string
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "":
+		case s == "all":
+			patterns = append(patterns, "*")
+		case strings.ContainsAny(s, "*?["):
+			if _, err := path.Match(s, ""); err != nil {
+				return nil, newError(KindConfig, fmt.Errorf("invalid database pattern %q: %w", s, err))
+			}
+			patterns = append(patterns, s)
+		default:
+			names = append(names, s)
+		}
+	}
+	for _, s := range exclude {
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, newError(KindConfig, fmt.Errorf("invalid database exclude %q: %w", s, err))
+		}
+	}
+
+	if len(patterns) > 0 {
+		if opts.DBType != "mysql" {
+			return nil, newError(KindConfig, fmt.Errorf("database lists are not supported for db-type %s", opts.DBType))
+		}
+
+		logs.Info("Listing databases on %s:%d", opts.Host, opts.Port)
+		all, err := backup.MySQLListDatabases(ctx, opts)
+		if err != nil {
+			return nil, newErrorCtx(ctx, dumpErrorKind(err), err)
+		}
+		for _, db := range all {
+			if matchAny(systemDatabases, db) {
+				continue
+			}
+			if matchAny(patterns, db) {
+				names = append(names, db)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var dbs []string
+	for _, db := range names {
+		if seen[db] || matchAny(exclude, db) {
+			continue
+		}
+		seen[db] = true
+		dbs = append(dbs, db)
+	}
+	sort.Strings(dbs)
+
+	if len(dbs) == 0 {
+		return nil, newError(KindConfig, fmt.Errorf("no databases match %q", spec))
+	}
+	return dbs, nil
+}
+
+// matchAny reports whether name matches any of the glob patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// perDatabasePath returns p with {db} replaced by db. Without a placeholder,
+// a run over several databases writes db+ext next to p instead.
+func perDatabasePath(p, db, ext string, multi bool) string {
+	switch {
+	case p == "":
+		return ""
+	case strings.Contains(p, dbPlaceholder):
+		return strings.ReplaceAll(p, dbPlaceholder, db)
+	case multi:
+		return filepath.Join(filepath.Dir(p), db+ext)
+	}
+	return p
+}
+
+// databaseJob narrows a job to a single database of the run.
+func databaseJob(job backupJob, db string, multi bool) backupJob {
+	job.opts.DBName = db
+	ext := ".sql"
+	switch {
+	case backup.IsDirFormat(job.opts.Format):
+		ext = ""
+	case job.opts.DBType == "redis":
+		ext = ".rdb"
+	case job.opts.DBType == "mssql" && job.opts.Format == backup.FormatLog:
+		ext = ".trn"
+	case job.opts.DBType == "mssql":
+		ext = ".bak"
+	case job.opts.DBType == "files":
+		ext = ".tar"
+	}
+	if job.timestamp != "" {
+		job.opts.Output = fmt.Sprintf("%s-%s%s", db, job.timestamp, ext)
+	} else {
+		job.opts.Output = perDatabasePath(job.opts.Output, db, ext, multi)
+	}
+	if backup.IsDirFormat(job.opts.Format) {
+		// A directory backup is named like the dump it replaces.
+		job.opts.Output = strings.TrimSuffix(job.opts.Output, ".sql")
+	}
+	job.metrics.Textfile = perDatabasePath(job.metrics.Textfile, db, ".prom", multi)
+	return job
+}
+
+// runDatabases backs up each database with at most parallelism running at
+// once, then prints a summary. A single database returns its own error;
+// otherwise the kind of the first failure is returned for the whole run.
+func runDatabases(ctx context.Context, job backupJob, notifier *notify.Notifier, dbs []string, parallelism int) ([]databaseOutcome, error) {
+	if len(dbs) == 1 {
+		start := time.Now()
+		res, err := runDatabaseJob(ctx, databaseJob(job, dbs[0], false), notifier)
+		return []databaseOutcome{{db: dbs[0], file: res.finalPath, location: res.location, took: time.Since(start), err: err}}, err
+	}
+	if parallelism < 1 {
+		parallelism = defaultParallelism
+	}
+	if parallelism > 1 && job.progress.mode != progress.ModeOff {
+		// Databases backed up side by side cannot share one live line.
+		job.progress.mode = progress.ModeLines
+	}
+
+	console.Printf("Backing up %d databases, %d at a time: %s\n", len(dbs), parallelism, strings.Join(dbs, ", "))
+	logs.Info("Backing up %d databases with parallelism %d: %s", len(dbs), parallelism, strings.Join(dbs, ","))
+
+	outcomes := make([]databaseOutcome, len(dbs))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+
+	for i, db := range dbs {
+		outcomes[i].db = db
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			outcomes[i].err = newError(KindInterrupted, errors.New("not started"))
+			continue
+		}
+
+		wg.Add(1)
+		go func(o *databaseOutcome) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			start := time.Now()
+			res, err := runDatabaseJob(ctx, databaseJob(job, o.db, true), notifier)
+			o.took = time.Since(start)
+			o.file, o.location, o.err = res.finalPath, res.location, err
+		}(&outcomes[i])
+	}
+	wg.Wait()
+
+	return outcomes, summarize(outcomes)
+}
+
+// summarize prints one line per database and returns an error if any failed.
+func summarize(outcomes []databaseOutcome) error {
+	var failed int
+	var first error
+
+	console.Println()
+	console.Println("Backup summary:")
+	for _, o := range outcomes {
+		if o.err != nil {
+			failed++
+			if first == nil {
+				first = o.err
+			}
+			console.Printf("  FAIL  %-30s %8s  %v\n", o.db, o.took.Round(time.Second), o.err)
+			logs.Error("Backup summary: db=%s status=failure took=%s error=%v", o.db, o.took, o.err)
+			continue
+		}
+		console.Printf("  OK    %-30s %8s  %s\n", o.db, o.took.Round(time.Second), o.location)
+		logs.Info("Backup summary: db=%s status=success took=%s out=%s", o.db, o.took, o.location)
+	}
+	console.Printf("%d of %d databases backed up successfully\n", len(outcomes)-failed, len(outcomes))
+
+	if failed == 0 {
+		return nil
+	}
+	return newError(KindOf(first), fmt.Errorf("%d of %d databases failed, first: %w", failed, len(outcomes), first))
+}
@@ -0,0 +1,248 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/progress"
+)
+
+// Output formats for -output.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+var (
+	// outputFormat and quiet are the -output and -quiet of the top-level
+	// command, set by runOptions.apply.
+	outputFormat = formatText
+	quiet        bool
+
+	// results is where JSON results go. Human text is printed through
+	// console, which applyOutput points elsewhere in JSON or quiet mode so
+	// that stdout carries nothing but results.
+	results   io.Writer = os.Stdout
+	resultsMu sync.Mutex
+)
+
+// addOutputFlags adds -output and -quiet to fs, bound to o so that they
+// default to what was given before the command.
+func addOutputFlags(fs *flag.FlagSet, o *runOptions) {
+	fs.StringVar(&o.output, "output", o.output, "Output format: text, or json for one JSON object per line on stdout with human text on stderr")
+	fs.BoolVar(&o.quiet, "quiet", o.quiet, "Print no human text or progress, only JSON results and a final error")
+}
+
+// applyOutput moves human text off stdout when stdout is kept for JSON
+// results, or discards it when quiet.
+func applyOutput(o *runOptions) {
+	outputFormat, quiet = o.output, o.quiet
+	switch {
+	case quiet:
+		console.SetOut(io.Discard)
+	case outputFormat == formatJSON:
+		console.SetOut(os.Stderr)
+	default:
+		console.SetOut(os.Stdout)
+	}
+}
+
+// emit writes v as one line of JSON to stdout in JSON mode, and does
+// nothing otherwise.
+func emit(v any) {
+	if outputFormat != formatJSON {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: could not encode result:", err)
+		return
+	}
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	results.Write(append(data, '\n'))
+}
+
+// The JSON results. Each line is one object whose "type" says which of
+// these it is; fields are only ever added, never renamed or removed.
+
+// exitResult is the last line of every command.
+type exitResult struct {
+	Type      string `json:"type"` // "exit"
+	Command   string `json:"command"`
+	ExitCode  int    `json:"exitCode"`
+	ErrorKind string `json:"errorKind,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// failure is the error part of a result.
+type failure struct {
+	ErrorKind string `json:"errorKind,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func failureOf(err error) failure {
+	if err == nil {
+		return failure{}
+	}
+	return failure{ErrorKind: KindOf(err).String(), Error: err.Error()}
+}
+
+func statusOf(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// backupResultJSON reports the backup of one database.
+type backupResultJSON struct {
+	Type            string        `json:"type"` // "backup"
+	Status          string        `json:"status"`
+	DBType          string        `json:"dbType"`
+	Host            string        `json:"host"`
+	DBName          string        `json:"dbName"`
+	Location        string        `json:"location,omitempty"` // local path, s3:// URI or repository snapshot
+	File            string        `json:"file,omitempty"`     // local artifact, if kept
+	SizeBytes       int64         `json:"sizeBytes"`
+	DumpBytes       int64         `json:"dumpBytes"`
+	Start           time.Time     `json:"start"`
+	DurationSeconds float64       `json:"durationSeconds"`
+	Stages          []stageResult `json:"stages"`
+	failure
+}
+
+type stageResult struct {
+	Stage   string  `json:"stage"`
+	Seconds float64 `json:"seconds"`
+}
+
+func stageResults(t progress.Timings) []stageResult {
+	stages := make([]stageResult, len(t))
+	for i, s := range t {
+		stages[i] = stageResult{s.Stage, s.Duration.Seconds()}
+	}
+	return stages
+}
+
+// restoreResult reports a restore.
+type restoreResult struct {
+	Type            string    `json:"type"` // "restore"
+	Status          string    `json:"status"`
+	DBType          string    `json:"dbType"`
+	Host            string    `json:"host"`
+	DBName          string    `json:"dbName"`
+	Source          string    `json:"source"`             // backup file or repository
+	Snapshot        string    `json:"snapshot,omitempty"` // repository snapshot as requested, e.g. latest
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	failure
+}
+
+// scheduleEvent reports what the scheduler does.
+type scheduleEvent struct {
+	Type      string     `json:"type"`  // "schedule"
+	Event     string     `json:"event"` // see schedule.Event
+	Job       string     `json:"job"`
+	Time      time.Time  `json:"time"`
+	Scheduled *time.Time `json:"scheduled,omitempty"` // the trigger time the event is about
+	Status    string     `json:"status,omitempty"`    // "finish": success, failure or interrupted
+	Skipped   int        `json:"skipped,omitempty"`   // "overlap": triggers skipped
+	Error     string     `json:"error,omitempty"`
+}
+
+// jobResult lists the next fire times of one job of a jobs file.
+type jobResult struct {
+	Type     string      `json:"type"` // "job"
+	Name     string      `json:"name"`
+	Trigger  string      `json:"trigger"`
+	Timezone string      `json:"timezone"`
+	Config   string      `json:"config"`
+	Next     []time.Time `json:"next"`
+}
+
+// snapshotResult is one snapshot of a repository.
+type snapshotResult struct {
+	Type      string    `json:"type"` // "snapshot"
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Host      string    `json:"host"`
+	DBType    string    `json:"dbType"`
+	DBName    string    `json:"dbName"`
+	File      string    `json:"file"`
+	SizeBytes int64     `json:"sizeBytes"`
+	Chunks    int       `json:"chunks"`
+}
+
+// forgetResult reports a snapshot removed from a repository.
+type forgetResult struct {
+	Type string `json:"type"` // "forget"
+	ID   string `json:"id"`
+}
+
+// gcResult reports a repository garbage collection.
+type gcResult struct {
+	Type         string `json:"type"` // "gc"
+	DryRun       bool   `json:"dryRun"`
+	Snapshots    int    `json:"snapshots"`
+	Chunks       int    `json:"chunks"`       // stored before the collection
+	Unreferenced int    `json:"unreferenced"` // deleted, or to be deleted with dryRun
+	Bytes        int64  `json:"bytes"`        // storage the unreferenced chunks take
+}
+
+// benchResult is one compressor of a compress-bench run.
+type benchResult struct {
+	Type           string  `json:"type"`      // "compress-bench"
+	Algorithm      string  `json:"algorithm"` // as given to -compression, e.g. zstd:19
+	InputBytes     int64   `json:"inputBytes"`
+	OutputBytes    int64   `json:"outputBytes"`
+	Ratio          float64 `json:"ratio"`
+	CompressMBps   float64 `json:"compressMBps"`
+	DecompressMBps float64 `json:"decompressMBps"`
+}
+
+// configValidateResult reports the validation of one config file.
+type configValidateResult struct {
+	Type     string `json:"type"` // "config-validate"
+	File     string `json:"file"`
+	Valid    bool   `json:"valid"`
+	Problems int    `json:"problems"`
+}
+
+// configProblemResult is one problem found in a config file.
+type configProblemResult struct {
+	Type    string `json:"type"` // "config-problem"
+	File    string `json:"file"`
+	Field   string `json:"field,omitempty"` // e.g. throttle.profiles[0].from
+	Message string `json:"message"`
+}
+
+// versionResult reports the version.
+type versionResult struct {
+	Type    string `json:"type"` // "version"
+	Version string `json:"version"`
+}
+
+// emitExit writes the final line of a command.
+func emitExit(command string, err error) {
+	res := exitResult{Type: "exit", Command: command, ExitCode: ExitCode(err)}
+	if res.ExitCode != 0 {
+		res.ErrorKind, res.Error = KindOf(err).String(), err.Error()
+	}
+	emit(res)
+}
+
+// reportQuietError prints the error of a quiet text-mode run, which would
+// otherwise end without a word.
+func reportQuietError(err error) {
+	if quiet && outputFormat == formatText && err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+}
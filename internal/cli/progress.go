@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/progress"
+)
+
+// progressSettings is how a run reports progress, resolved from a config
+// file or flags.
+type progressSettings struct {
+	mode        string
+	interval    time.Duration
+	historyPath string
+}
+
+// parseProgress validates cfg.
+func parseProgress(cfg config.ProgressConfig) (progressSettings, error) {
+	s := progressSettings{mode: cfg.Mode, historyPath: cfg.HistoryFile}
+	if !progress.ValidMode(s.mode) {
+		return s, fmt.Errorf("progress mode %q: want auto, tty, lines or off", s.mode)
+	}
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d < time.Second {
+			return s, fmt.Errorf("progress interval %q: want a duration of at least 1s", cfg.Interval)
+		}
+		s.interval = d
+	}
+	if s.historyPath == "" {
+		s.historyPath = progress.DefaultHistoryPath()
+	}
+	return s, nil
+}
+
+// stageTracker reports the progress of the stages of one database's backup
+// and keeps how long each took.
+type stageTracker struct {
+	reporter  *progress.Reporter
+	last      *progress.Run // the previous run of the database, nil if none
+	timings   progress.Timings
+	dumpBytes int64
+}
+
+// newStageTracker starts tracking the backup in job, with ETAs based on the
+// previous run of the same database.
+func newStageTracker(job backupJob) *stageTracker {
+	mode := job.progress.mode
+	if quiet {
+		mode = progress.ModeOff
+	}
+	t := &stageTracker{
+		reporter: progress.NewReporter(os.Stderr, mode, job.progress.interval, job.opts.DBName),
+	}
+	last, err := progress.LastRun(job.progress.historyPath, historyRun(job))
+	if err != nil {
+		logs.Error("Could not read backup history: %v", err)
+	}
+	t.last = last
+	return t
+}
+
+// historyRun identifies job's database in the history.
+func historyRun(job backupJob) progress.Run {
+	return progress.Run{
+		DBType: job.opts.DBType,
+		Host:   job.opts.Host,
+		Port:   job.opts.Port,
+		DBName: job.opts.DBName,
+	}
+}
+
+// begin starts reporting stage name, which processes size bytes (0 if not
+// known in advance). Code running the stage with the returned context counts
+// towards it. end stops reporting, records the stage's time and returns the
+// bytes it processed.
+func (t *stageTracker) begin(ctx context.Context, name string, size int64) (_ context.Context, end func() int64) {
+	s := &progress.Stage{Name: name}
+	est := progress.Estimate{Bytes: size}
+	if t.last != nil {
+		est.Duration = t.last.Stages.Get(name)
+		if name == "dump" && size == 0 {
+			est.Bytes = t.last.DumpBytes
+		}
+	}
+	stop := t.reporter.Track(s, est)
+	start := time.Now()
+	return progress.WithStage(ctx, s), func() int64 {
+		stop()
+		t.timings = append(t.timings, progress.Timing{Stage: name, Duration: time.Since(start)})
+		return s.Done()
+	}
+}
+
+// finish prints and logs the stage timings and, for a successful backup,
+// adds it to the history.
+func (t *stageTracker) finish(job backupJob, start time.Time, size int64, err error) {
+	if len(t.timings) > 0 {
+		console.Println("Stage timings:", t.timings)
+		logs.Info("Stage timings for %s: %s", job.opts.DBName, t.timings)
+	}
+	if err != nil {
+		return
+	}
+	run := historyRun(job)
+	run.Time = start
+	run.DumpBytes = t.dumpBytes
+	run.SizeBytes = size
+	run.Stages = t.timings
+	if err := progress.Record(job.progress.historyPath, run); err != nil {
+		console.Println("Warning: could not update backup history:", err)
+		logs.Error("Could not update backup history %s: %v", job.progress.historyPath, err)
+	}
+}
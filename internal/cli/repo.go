@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/progress"
+	"github.com/bhagashetti/db-backup-cli/internal/repo"
+	"github.com/bhagashetti/db-backup-cli/internal/storage"
+	"github.com/bhagashetti/db-backup-cli/internal/throttle"
+)
+
+// openRepository opens the repository cfg points at. With create it is
+// initialised if it does not exist yet. An empty key opens an unencrypted
+// repository. limit, if not nil, caps the rate of writes to it.
+func openRepository(ctx context.Context, cfg config.RepositoryConfig, key string, create bool, limit *throttle.Limiter) (*repo.Repository, error) {
+	var keyBytes []byte
+	if key != "" {
+		keyBytes = []byte(key)
+		if len(keyBytes) != 32 {
+			return nil, fmt.Errorf("encryption key must be exactly 32 characters, got %d", len(keyBytes))
+		}
+	}
+	backend, err := storage.OpenBackend(ctx, cfg.URL, cfg.S3Region)
+	if err != nil {
+		return nil, err
+	}
+	backend = storage.Throttled(backend, limit)
+	if create {
+		return repo.OpenOrInit(ctx, backend, keyBytes)
+	}
+	return repo.Open(ctx, backend, keyBytes)
+}
+
+// repoErrorKind separates bad keys and missing snapshots, which are
+// settings problems, from storage failures of the given kind.
+func repoErrorKind(err error, kind ErrorKind) ErrorKind {
+	if errors.Is(err, repo.ErrWrongKey) || errors.Is(err, repo.ErrNoRepository) || errors.Is(err, repo.ErrNoSnapshot) {
+		return KindConfig
+	}
+	return kind
+}
+
+// storeInRepository adds the backup at path to job's repository as a new
+// snapshot and removes the local file.
+func storeInRepository(ctx context.Context, job backupJob, path string) (backupResult, error) {
+	key := ""
+	if job.encrypt {
+		if job.encryptKey == "" {
+			console.Println("Encryption requested but no key provided")
+			logs.Error("Encryption requested but no key provided")
+			return backupResult{}, newError(KindConfig, errors.New("encryption requested but no key provided"))
+		}
+		key = job.encryptKey
+	}
+
+	r, err := openRepository(ctx, job.repository, key, true, job.uploadLimit)
+	if err != nil {
+		console.Println("Could not open repository:", err)
+		logs.Error("Could not open repository %s: %v", job.repository.URL, err)
+		return backupResult{}, newErrorCtx(ctx, repoErrorKind(err, KindUpload), err)
+	}
+	defer r.Close()
+
+	in, err := os.Open(path)
+	if err != nil {
+		return backupResult{}, newError(KindUpload, err)
+	}
+	defer in.Close()
+
+	console.Println("Storing backup in repository:", r)
+	logs.Info("Storing backup %s in repository %s", path, r)
+
+	storeCtx, endStore := job.tracker.begin(ctx, "store", fileSize(path))
+	snap, stats, err := r.Backup(storeCtx, progress.FromContext(storeCtx).Reader(in), repo.Snapshot{
+		DBType: job.opts.DBType,
+		DBName: job.opts.DBName,
+		File:   filepath.Base(path),
+	})
+	endStore()
+	if err != nil {
+		console.Println("Repository backup failed:", err)
+		logs.Error("Repository backup failed: %v", err)
+		return backupResult{}, newErrorCtx(ctx, repoErrorKind(err, KindUpload), err)
+	}
+
+	console.Printf("Snapshot %s: %d chunks, %d new (%.1f MB, %.1f MB stored) of %.1f MB\n",
+		snap.ID, stats.Chunks, stats.NewChunks, float64(stats.NewBytes)/1e6, float64(stats.StoredBytes)/1e6, float64(snap.Size)/1e6)
+	logs.Info("Repository snapshot %s: size=%d chunks=%d new=%d newBytes=%d stored=%d",
+		snap.ID, snap.Size, stats.Chunks, stats.NewChunks, stats.NewBytes, stats.StoredBytes)
+
+	in.Close()
+	if err := os.RemoveAll(path); err != nil {
+		console.Println("Warning: could not remove local backup:", err)
+		logs.Error("Could not remove local backup %s: %v", path, err)
+	}
+
+	location := strings.TrimSuffix(r.String(), "/") + "/snapshots/" + snap.ID
+	console.Println("Backup completed successfully. Snapshot:", location)
+	logs.Info("Backup completed successfully. Snapshot: %s", location)
+	return backupResult{location: location, size: snap.Size}, nil
+}
+
+// fetchFromRepository writes the selected snapshot to a hidden file in dir,
+// named after the original artifact, and returns its path.
+func fetchFromRepository(ctx context.Context, cfg config.RepositoryConfig, key, snapshot, dbName, dir string) (string, error) {
+	r, err := openRepository(ctx, cfg, key, false, nil)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	snap, err := r.FindSnapshot(ctx, snapshot, dbName)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf(".restore-%d-%s", time.Now().UnixNano(), snap.File))
+	console.Printf("Reassembling snapshot %s (%s %s, %s, %.1f MB) to: %s\n",
+		snap.ID, snap.DBType, snap.DBName, snap.Time.Local().Format(time.RFC3339), float64(snap.Size)/1e6, path)
+	logs.Info("Reassembling snapshot %s from %s to %s", snap.ID, r, path)
+
+	out, err := fsutil.Create(path, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer out.Abort()
+	if err := r.Restore(ctx, snap, out); err != nil {
+		return "", err
+	}
+	if err := out.Commit(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// handleRepo lists snapshots, forgets them, and collects garbage in a
+// repository.
+func handleRepo(ctx context.Context, o *runOptions, args []string) error {
+	if len(args) < 1 || (args[0] != "snapshots" && args[0] != "forget" && args[0] != "gc") {
+		console.Println("Usage: db-backup-cli repo snapshots [options]")
+		console.Println("       db-backup-cli repo forget [options] <snapshot-id>...")
+		console.Println("       db-backup-cli repo gc [options]")
+		return newError(KindUsage, errors.New("repo needs snapshots, forget or gc"))
+	}
+	mode := args[0]
+
+	fs := flag.NewFlagSet("repo "+mode, flag.ContinueOnError)
+	configPath := fs.String("config", "", "Backup config file to take the repository and encryptKey from")
+	url := fs.String("repo", "", "Repository: local directory or s3://bucket/prefix")
+	region := fs.String("repo-region", "", "S3 region of the repository (default from the AWS environment)")
+	encryptKey := fs.String("encrypt-key", "", "Key of an encrypted repository (32 chars)")
+	dbName := fs.String("db", "", "snapshots: only list snapshots of this database")
+	dryRun := fs.Bool("dry-run", false, "gc: only report what would be deleted")
+
+	if err := parseFlags(fs, args[1:], o); err != nil {
+		return err
+	}
+
+	cfg := config.RepositoryConfig{URL: *url, S3Region: *region}
+	key := *encryptKey
+	if *configPath != "" {
+		loaded, err := config.LoadBackup(*configPath)
+		if err != nil {
+			console.Println("Failed to load config:", err)
+			logs.Error("Failed to load backup config: %v", err)
+			return newError(KindConfig, err)
+		}
+		cfg = loaded.Repository
+		if loaded.Encrypt {
+			key = loaded.EncryptKey
+		}
+	}
+	if cfg.URL == "" {
+		console.Println("Error: -repo is required")
+		fs.Usage()
+		return newError(KindUsage, errors.New("-repo is required"))
+	}
+
+	r, err := openRepository(ctx, cfg, key, false, nil)
+	if err != nil {
+		console.Println("Could not open repository:", err)
+		logs.Error("Could not open repository %s: %v", cfg.URL, err)
+		return newErrorCtx(ctx, repoErrorKind(err, KindUpload), err)
+	}
+	defer r.Close()
+
+	switch mode {
+	case "snapshots":
+		snaps, err := r.Snapshots(ctx)
+		if err != nil {
+			console.Println("Could not list snapshots:", err)
+			logs.Error("Could not list snapshots in %s: %v", r, err)
+			return newErrorCtx(ctx, KindUpload, err)
+		}
+		console.Printf("%-26s %-20s %-8s %-20s %10s %8s  %s\n", "ID", "TIME", "TYPE", "DATABASE", "SIZE MB", "CHUNKS", "FILE")
+		for _, s := range snaps {
+			if *dbName != "" && s.DBName != *dbName {
+				continue
+			}
+			console.Printf("%-26s %-20s %-8s %-20s %10.1f %8d  %s\n",
+				s.ID, s.Time.Local().Format("2006-01-02 15:04:05"), s.DBType, s.DBName, float64(s.Size)/1e6, len(s.Chunks), s.File)
+			emit(snapshotResult{
+				Type:      "snapshot",
+				ID:        s.ID,
+				Time:      s.Time,
+				Host:      s.Host,
+				DBType:    s.DBType,
+				DBName:    s.DBName,
+				File:      s.File,
+				SizeBytes: s.Size,
+				Chunks:    len(s.Chunks),
+			})
+		}
+
+	case "forget":
+		if fs.NArg() == 0 {
+			console.Println("Error: repo forget needs snapshot IDs")
+			return newError(KindUsage, errors.New("repo forget: no snapshot IDs given"))
+		}
+		for _, id := range fs.Args() {
+			if err := r.Forget(ctx, id); err != nil {
+				console.Printf("Could not forget snapshot %s: %v\n", id, err)
+				logs.Error("Could not forget snapshot %s in %s: %v", id, r, err)
+				return newErrorCtx(ctx, repoErrorKind(err, KindUpload), err)
+			}
+			console.Println("Forgot snapshot", id)
+			emit(forgetResult{Type: "forget", ID: id})
+			logs.Info("Forgot snapshot %s in %s", id, r)
+		}
+		console.Println("Run 'db-backup-cli repo gc' to delete chunks no longer used.")
+
+	case "gc":
+		stats, err := r.GC(ctx, *dryRun)
+		if err != nil {
+			console.Println("Garbage collection failed:", err)
+			logs.Error("Garbage collection of %s failed: %v", r, err)
+			return newErrorCtx(ctx, KindUpload, err)
+		}
+		verb := "Deleted"
+		if *dryRun {
+			verb = "Would delete"
+		}
+		console.Printf("%d snapshots use %d of %d chunks. %s %d unreferenced chunks (%.1f MB).\n",
+			stats.Snapshots, stats.Chunks-stats.Unreferenced, stats.Chunks, verb, stats.Unreferenced, float64(stats.Bytes)/1e6)
+		emit(gcResult{
+			Type:         "gc",
+			DryRun:       *dryRun,
+			Snapshots:    stats.Snapshots,
+			Chunks:       stats.Chunks,
+			Unreferenced: stats.Unreferenced,
+			Bytes:        stats.Bytes,
+		})
+		logs.Info("Garbage collection of %s: snapshots=%d chunks=%d unreferenced=%d bytes=%d dryRun=%t",
+			r, stats.Snapshots, stats.Chunks, stats.Unreferenced, stats.Bytes, *dryRun)
+	}
+	return nil
+}
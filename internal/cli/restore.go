@@ -0,0 +1,355 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/backup"
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/metrics"
+)
+
+func handleRestore(ctx context.Context, o *runOptions, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+
+	configPath := fs.String("config", "", "Path to JSON restore config file")
+
+	dbType := fs.String("db-type", "mysql", "Database type")
+	host := fs.String("host", "localhost", "Database host")
+	port := fs.Int("port", 3306, "Database port")
+	user := fs.String("user", "root", "Database user")
+	password := fs.String("password", "", "Database password")
+	dbName := fs.String("db", "", "Database name")
+	input := fs.String("in", "backup.sql", "Backup file to restore from")
+	engine := fs.String("engine", backup.EngineClient, "MySQL engine: client (mysql) or native (pure Go)")
+	threads := fs.Int("threads", backup.DefaultThreads, "Parallel loaders for a directory-format backup")
+	toTime := fs.String("to-time", "", "Point-in-time restore: replay binlogs up to this time (RFC 3339 or \"2006-01-02 15:04:05\" local)")
+	toGTID := fs.String("to-gtid", "", "Point-in-time restore: replay binlogs up to and including this GTID")
+	binlogDir := fs.String("binlog-dir", "", "Binlog archive for a point-in-time restore, written by archive-binlog")
+	dataDir := fs.String("data-dir", "", "PostgreSQL data directory to unpack a base backup into, stopped Redis data directory to place an RDB in, or SQL Server directory to move restored files to")
+	walConfig := fs.String("wal-config", "", "archive-wal config for the restored PostgreSQL server's restore_command")
+	serverDir := fs.String("server-dir", "", "SQL Server: the input directory as the server sees it, if it differs from this host")
+	move := fs.String("move", "", "SQL Server: comma-separated logical=path file moves (WITH MOVE)")
+	noRecovery := fs.Bool("no-recovery", false, "SQL Server: leave the database restoring so log backups can be applied")
+	target := fs.String("target", "", "Files: directory to extract the archive into (\"/\" restores the original paths)")
+	metricsTextfile := fs.String("metrics-textfile", "", "Write run metrics to this node_exporter textfile (.prom)")
+	pushgateway := fs.String("pushgateway", "", "Push run metrics to this Prometheus Pushgateway URL")
+	repoURL := fs.String("repo", "", "Restore from this repository instead of -in: local directory or s3://bucket/prefix")
+	repoRegion := fs.String("repo-region", "", "S3 region of the repository (default from the AWS environment)")
+	snapshot := fs.String("snapshot", "latest", "Repository snapshot ID, or latest for the newest snapshot of -db")
+	encryptKey := fs.String("encrypt-key", "", "Key of an encrypted repository (32 chars)")
+	fs.DurationVar(&o.grace, "grace", o.grace, "On SIGINT/SIGTERM, how long to wait for the run to stop before exiting")
+
+	if err := parseFlags(fs, args, o); err != nil {
+		return err
+	}
+
+	var (
+		opts       backup.RestoreOptions
+		metricsCfg config.MetricsConfig
+		repoCfg    config.RepositoryConfig
+		snapshotID string
+		repoKey    string
+	)
+
+	if *configPath != "" {
+		logs.Info("Loading restore config from file: %s", *configPath)
+		cfg, err := config.LoadRestore(*configPath)
+		if err != nil {
+			console.Println("Failed to load restore config:", err)
+			logs.Error("Failed to load restore config: %v", err)
+			return newError(KindConfig, err)
+		}
+
+		opts = backup.RestoreOptions{
+			DBType:     cfg.DBType,
+			Host:       cfg.Host,
+			Port:       cfg.Port,
+			User:       cfg.User,
+			Password:   cfg.Password,
+			DBName:     cfg.DBName,
+			Input:      cfg.Input,
+			Engine:     cfg.Engine,
+			Threads:    cfg.Threads,
+			ToGTID:     cfg.ToGTID,
+			BinlogDir:  cfg.BinlogDir,
+			DataDir:    cfg.DataDir,
+			WALConfig:  cfg.WALConfig,
+			ServerDir:  cfg.ServerDir,
+			Move:       cfg.Move,
+			NoRecovery: cfg.NoRecovery,
+			Target:     cfg.Target,
+		}
+		if opts.ToTime, err = parseTargetTime(cfg.ToTime); err != nil {
+			console.Println("Invalid toTime:", err)
+			logs.Error("Invalid toTime in restore config: %v", err)
+			return newError(KindConfig, err)
+		}
+		metricsCfg = cfg.Metrics
+		repoCfg, snapshotID, repoKey = cfg.Repository, cfg.Snapshot, cfg.EncryptKey
+	} else {
+		if *dbName == "" && *dataDir == "" && *target == "" {
+			console.Println("Error: -db is required")
+			fs.Usage()
+			logs.Error("Restore failed: missing -db flag")
+			return newError(KindUsage, errors.New("-db is required"))
+		}
+
+		opts = backup.RestoreOptions{
+			DBType:     *dbType,
+			Host:       *host,
+			Port:       *port,
+			User:       *user,
+			Password:   *password,
+			DBName:     *dbName,
+			Input:      *input,
+			Engine:     *engine,
+			Threads:    *threads,
+			ToGTID:     *toGTID,
+			BinlogDir:  *binlogDir,
+			DataDir:    *dataDir,
+			WALConfig:  *walConfig,
+			ServerDir:  *serverDir,
+			NoRecovery: *noRecovery,
+			Target:     *target,
+		}
+		var err error
+		if opts.Move, err = parseMoves(*move); err != nil {
+			console.Println("Invalid -move:", err)
+			logs.Error("Invalid -move: %v", err)
+			return newError(KindUsage, err)
+		}
+		if opts.ToTime, err = parseTargetTime(*toTime); err != nil {
+			console.Println("Invalid -to-time:", err)
+			logs.Error("Invalid -to-time: %v", err)
+			return newError(KindUsage, err)
+		}
+		metricsCfg = config.MetricsConfig{
+			Textfile:       *metricsTextfile,
+			PushgatewayURL: *pushgateway,
+		}
+		repoCfg = config.RepositoryConfig{URL: *repoURL, S3Region: *repoRegion}
+		snapshotID, repoKey = *snapshot, *encryptKey
+	}
+
+	start := time.Now()
+	result := restoreResult{
+		Type:   "restore",
+		DBType: opts.DBType,
+		Host:   opts.Host,
+		DBName: opts.DBName,
+		Source: opts.Input,
+		Start:  start,
+	}
+
+	// A repository snapshot is reassembled next to -in and restored from
+	// there like a file.
+	if repoCfg.URL != "" {
+		result.Source, result.Snapshot = repoCfg.URL, snapshotID
+		path, err := fetchFromRepository(ctx, repoCfg, repoKey, snapshotID, opts.DBName, filepath.Dir(opts.Input))
+		if err != nil {
+			console.Println("Could not restore from repository:", err)
+			logs.Error("Could not restore snapshot %q from %s: %v", snapshotID, repoCfg.URL, err)
+			err = newErrorCtx(ctx, repoErrorKind(err, KindRestore), err)
+			emitRestore(result, err)
+			return err
+		}
+		defer func() {
+			if err := os.Remove(path); err != nil {
+				console.Println("Warning: could not remove reassembled backup:", err)
+				logs.Error("Could not remove reassembled backup %s: %v", path, err)
+			}
+		}()
+		opts.Input = path
+	}
+
+	err := runRestore(ctx, opts)
+	emitRestore(result, err)
+
+	reportMetrics(metricsCfg, metrics.Run{
+		Operation: "restore",
+		DBName:    opts.DBName,
+		Start:     start,
+		End:       time.Now(),
+		Success:   err == nil,
+		SizeBytes: fileSize(opts.Input),
+	})
+
+	return err
+}
+
+// emitRestore completes res with the outcome of the restore and emits it.
+func emitRestore(res restoreResult, err error) {
+	res.Status = statusOf(err)
+	res.DurationSeconds = time.Since(res.Start).Seconds()
+	res.failure = failureOf(err)
+	emit(res)
+}
+
+// runRestore loads opts.Input into the target database. Failures are
+// printed and logged before being returned.
+func runRestore(ctx context.Context, opts backup.RestoreOptions) error {
+	console.Println("Starting restore...")
+	console.Printf("  db-type: %s\n", opts.DBType)
+	console.Printf("  host   : %s\n", opts.Host)
+	console.Printf("  port   : %d\n", opts.Port)
+	console.Printf("  user   : %s\n", opts.User)
+	console.Printf("  db     : %s\n", opts.DBName)
+	console.Printf("  in     : %s\n", opts.Input)
+	if !opts.ToTime.IsZero() {
+		console.Printf("  to-time: %s\n", opts.ToTime.Format(time.RFC3339))
+	}
+	if opts.ToGTID != "" {
+		console.Printf("  to-gtid: %s\n", opts.ToGTID)
+	}
+
+	logs.Info(
+		"Starting restore: dbType=%s host=%s port=%d user=%s db=%s in=%s",
+		opts.DBType, opts.Host, opts.Port, opts.User, opts.DBName, opts.Input,
+	)
+
+	// Compressed backups are recognised by their magic bytes and unpacked
+	// next to themselves first. The files engine decompresses as it reads.
+	if opts.DBType != "files" && isCompressedFile(opts.Input) {
+		plain, err := decompressInput(ctx, opts.Input)
+		if err != nil {
+			console.Println("Decompression failed:", err)
+			logs.Error("Decompressing %s failed: %v", opts.Input, err)
+			return newErrorCtx(ctx, KindCompress, err)
+		}
+		defer func() {
+			if err := os.Remove(plain); err != nil {
+				console.Println("Warning: could not remove decompressed backup:", err)
+				logs.Error("Could not remove decompressed backup %s: %v", plain, err)
+			}
+		}()
+		opts.Input = plain
+	}
+
+	switch opts.DBType {
+	case "mysql":
+		if err := backup.MySQLRestore(ctx, opts); err != nil {
+			console.Println("Restore failed:", err)
+			logs.Error("Restore failed: %v", err)
+			return newErrorCtx(ctx, restoreErrorKind(err), err)
+		}
+		console.Println("Restore completed successfully.")
+		logs.Info("Restore completed successfully.")
+		return nil
+	case "postgres":
+		if err := backup.PostgresRestore(ctx, opts); err != nil {
+			console.Println("Restore failed:", err)
+			logs.Error("Restore failed: %v", err)
+			return newErrorCtx(ctx, restoreErrorKind(err), err)
+		}
+		console.Println("Restore completed successfully.")
+		logs.Info("Restore completed successfully.")
+		return nil
+	case "redis":
+		if err := backup.RedisRestore(ctx, opts); err != nil {
+			console.Println("Restore failed:", err)
+			logs.Error("Restore failed: %v", err)
+			return newErrorCtx(ctx, restoreErrorKind(err), err)
+		}
+		console.Println("Restore completed successfully.")
+		logs.Info("Restore completed successfully.")
+		return nil
+	case "mssql":
+		if err := backup.MSSQLRestore(ctx, opts); err != nil {
+			console.Println("Restore failed:", err)
+			logs.Error("Restore failed: %v", err)
+			return newErrorCtx(ctx, restoreErrorKind(err), err)
+		}
+		console.Println("Restore completed successfully.")
+		logs.Info("Restore completed successfully.")
+		return nil
+	case "files":
+		if err := backup.FilesRestore(ctx, opts); err != nil {
+			console.Println("Restore failed:", err)
+			logs.Error("Restore failed: %v", err)
+			return newErrorCtx(ctx, restoreErrorKind(err), err)
+		}
+		console.Println("Restore completed successfully.")
+		logs.Info("Restore completed successfully.")
+		return nil
+	default:
+		console.Println("Unsupported db-type for now:", opts.DBType)
+		logs.Error("Unsupported db-type: %s", opts.DBType)
+		return newError(KindConfig, fmt.Errorf("unsupported db-type: %s", opts.DBType))
+	}
+}
+
+// isCompressedFile reports whether path is a regular file in a supported
+// compressed format.
+func isCompressedFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && backup.IsCompressed(path)
+}
+
+// decompressInput decompresses a backup into a hidden file in the same
+// directory, so a server reading it from a shared path still finds it, and
+// returns its path. The name keeps the backup's own extension (.sql, .tar,
+// .bak, ...) with the compression suffix dropped.
+func decompressInput(ctx context.Context, path string) (string, error) {
+	name := fmt.Sprintf(".restore-%d-%s", time.Now().UnixNano(), backup.StripCodecExt(filepath.Base(path)))
+	plain := filepath.Join(filepath.Dir(path), name)
+	console.Println("Decompressing backup to:", plain)
+	logs.Info("Decompressing backup %s to %s", path, plain)
+	if err := backup.DecompressFile(ctx, path, plain); err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// restoreErrorKind separates connection problems, bad engine settings and
+// impossible point-in-time targets from other restore failures.
+func restoreErrorKind(err error) ErrorKind {
+	if errors.Is(err, backup.ErrConnection) {
+		return KindConnection
+	}
+	if errors.Is(err, backup.ErrDumpOptions) || errors.Is(err, backup.ErrPITR) {
+		return KindConfig
+	}
+	return KindRestore
+}
+
+// parseTargetTime parses a point-in-time restore target. Times without a zone
+// are local. An empty string is the zero time.
+func parseTargetTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("target time %q: want RFC 3339 or \"2006-01-02 15:04:05\"", s)
+	}
+	return t, nil
+}
+
+// parseMoves parses "logical=path,logical2=path2" into a map. An empty
+// string is no moves.
+func parseMoves(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	moves := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		logical, path, ok := strings.Cut(pair, "=")
+		if !ok || logical == "" || path == "" {
+			return nil, fmt.Errorf("%q: want logical=path", pair)
+		}
+		moves[logical] = path
+	}
+	return moves, nil
+}
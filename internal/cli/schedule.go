@@ -0,0 +1,248 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/lock"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/schedule"
+)
+
+const defaultStateFile = "schedule-state.json"
+
+func handleSchedule(ctx context.Context, o *runOptions, args []string) error {
+	fs := flag.NewFlagSet("schedule", flag.ContinueOnError)
+
+	configPath := fs.String("config", "", "Path to JSON backup config file")
+	every := fs.String("every", "", "How often to run the backup, anchored to local midnight (e.g. 1h, 30m, 24h)")
+	daily := fs.String("daily", "", "Run backup once per day at HH:MM (24h format, local time)")
+	jobsPath := fs.String("jobs", "", "Path to JSON jobs file with many cron-scheduled backups")
+	jitter := fs.Duration("jitter", 0, "Delay each run by a random amount up to this duration (e.g. 10m)")
+	statePath := fs.String("state", defaultStateFile, "File that records each job's last run")
+	catchUp := fs.Bool("catch-up", true, "On startup, run a job once if its last fire time was missed")
+	var lockFlags config.LockConfig
+	fs.StringVar(&lockFlags.Backend, "lock-backend", "", "Run jobs only while holding a lock shared with other scheduler hosts: s3, mysql or postgres (with -config; a jobs file sets \"lock\")")
+	fs.StringVar(&lockFlags.DSN, "lock-dsn", "", "DSN of the database holding a mysql or postgres lock")
+	fs.StringVar(&lockFlags.S3Bucket, "lock-s3-bucket", "", "Bucket of the s3 lock object")
+	fs.StringVar(&lockFlags.S3Region, "lock-s3-region", "", "Region of the s3 lock bucket")
+	fs.StringVar(&lockFlags.Name, "lock-name", "", "Name of the lock (default db-backup-cli-scheduler)")
+	fs.StringVar(&lockFlags.TTL, "lock-ttl", "", "Lease length of the lock, renewed every ttl/3 (default 60s)")
+	fs.DurationVar(&o.grace, "grace", o.grace, "On SIGINT/SIGTERM, how long to wait for in-flight backups to stop before exiting")
+
+	if err := parseFlags(fs, args, o); err != nil {
+		return err
+	}
+
+	defaults := schedule.Defaults{Jitter: *jitter, CatchUp: *catchUp}
+
+	var (
+		jobs    []schedule.Job
+		lockCfg *config.LockConfig
+	)
+	if *jobsPath != "" {
+		if *configPath != "" || *every != "" || *daily != "" {
+			console.Println("Error: -jobs cannot be combined with -config, -every or -daily")
+			fs.Usage()
+			logs.Error("Schedule failed: -jobs combined with -config/-every/-daily")
+			return newError(KindUsage, errors.New("-jobs cannot be combined with -config, -every or -daily"))
+		}
+		if lockFlags != (config.LockConfig{}) {
+			console.Println("Error: -lock-* flags cannot be combined with -jobs; set \"lock\" in the jobs file")
+			fs.Usage()
+			logs.Error("Schedule failed: -lock-* flags combined with -jobs")
+			return newError(KindUsage, errors.New("-lock-* flags cannot be combined with -jobs"))
+		}
+
+		cfg, loaded, err := loadJobs(*jobsPath, defaults)
+		if err != nil {
+			return err
+		}
+		if cfg.StateFile != "" {
+			*statePath = cfg.StateFile
+		}
+		jobs = loaded
+		lockCfg = cfg.Lock
+	} else {
+		job, err := singleJob(fs, *configPath, *every, *daily, defaults)
+		if err != nil {
+			return err
+		}
+		jobs = []schedule.Job{job}
+
+		if lockFlags != (config.LockConfig{}) {
+			if problems := lockFlags.Validate(); len(problems) > 0 {
+				console.Println("Error: invalid -lock-* flags:", problems)
+				fs.Usage()
+				logs.Error("Schedule failed: invalid -lock-* flags: %v", problems)
+				return newError(KindUsage, fmt.Errorf("invalid -lock-* flags: %w", problems))
+			}
+			lockCfg = &lockFlags
+		}
+	}
+
+	state, err := schedule.LoadState(*statePath)
+	if err != nil {
+		console.Println("Failed to load schedule state:", err)
+		logs.Error("Failed to load schedule state: %v", err)
+		return newError(KindConfig, err)
+	}
+
+	console.Println("Starting scheduler...")
+	console.Println("  state  :", *statePath)
+	for _, j := range jobs {
+		console.Printf("  %-20s %-22s %-16s jitter=%-6s catch-up=%-5v %s\n", j.Name, j.Trigger, j.Location, j.Jitter, j.CatchUp, j.ConfigPath)
+	}
+	logs.Info("Starting scheduler: jobs=%d state=%s", len(jobs), *statePath)
+
+	runner := &schedule.Runner{
+		Jobs:  jobs,
+		State: state,
+		Run: func(ctx context.Context, j schedule.Job) error {
+			return runScheduledBackup(ctx, o.child(), j.ConfigPath)
+		},
+		Events: emitScheduleEvent,
+	}
+
+	if lockCfg != nil {
+		elector, err := lock.New(*lockCfg)
+		if err != nil {
+			console.Println("Invalid scheduler lock config:", err)
+			logs.Error("Invalid scheduler lock config: %v", err)
+			return newError(KindConfig, err)
+		}
+		console.Println("  lock   :", lockCfg.Backend)
+		logs.Info("Scheduler lock enabled: backend=%s", lockCfg.Backend)
+
+		elector.Start(ctx)
+		runner.Leader = elector
+	}
+
+	runner.Start(ctx)
+
+	if ctx.Err() == nil {
+		console.Println("No job has a future fire time; stopping scheduler")
+		logs.Error("Scheduler stopped: no job has a future fire time")
+		return newError(KindConfig, errors.New("no job has a future fire time"))
+	}
+
+	console.Println("Scheduler stopped:", context.Cause(ctx))
+	logs.Info("Scheduler stopped: %v", context.Cause(ctx))
+	return newError(KindInterrupted, ctx.Err())
+}
+
+// singleJob builds the one job described by -config with -every or -daily.
+func singleJob(fs *flag.FlagSet, configPath, every, daily string, defaults schedule.Defaults) (schedule.Job, error) {
+	if configPath == "" {
+		console.Println("Error: -config is required for schedule")
+		fs.Usage()
+		logs.Error("Schedule failed: missing -config flag")
+		return schedule.Job{}, newError(KindUsage, errors.New("-config is required for schedule"))
+	}
+
+	if every == "" && daily == "" {
+		console.Println("Error: either -every or -daily must be provided")
+		fs.Usage()
+		logs.Error("Schedule failed: missing -every/-daily")
+		return schedule.Job{}, newError(KindUsage, errors.New("either -every or -daily must be provided"))
+	}
+
+	if every != "" && daily != "" {
+		console.Println("Error: use either -every OR -daily, not both")
+		fs.Usage()
+		logs.Error("Schedule failed: both -every and -daily provided")
+		return schedule.Job{}, newError(KindUsage, errors.New("use either -every or -daily, not both"))
+	}
+
+	var trigger schedule.Trigger
+	if every != "" {
+		// Interval scheduler: -every=1h
+		interval, err := time.ParseDuration(every)
+		if err != nil || interval <= 0 {
+			if err == nil {
+				err = errors.New("must be positive")
+			}
+			console.Println("Invalid duration for -every:", err)
+			logs.Error("Invalid duration for -every: %v", err)
+			return schedule.Job{}, newError(KindUsage, fmt.Errorf("invalid duration for -every: %w", err))
+		}
+		trigger = schedule.Interval{Every: interval}
+	} else {
+		// Daily scheduler: -daily=HH:MM
+		t, err := schedule.Daily(daily)
+		if err != nil {
+			console.Println("Invalid time for -daily (expected HH:MM):", err)
+			logs.Error("Invalid time for -daily: %v", err)
+			return schedule.Job{}, newError(KindUsage, fmt.Errorf("invalid time for -daily: %w", err))
+		}
+		trigger = t
+	}
+
+	return schedule.Job{
+		Name:       configPath,
+		ConfigPath: configPath,
+		Trigger:    trigger,
+		Location:   time.Local,
+		Jitter:     defaults.Jitter,
+		CatchUp:    defaults.CatchUp,
+	}, nil
+}
+
+// runScheduledBackup runs one backup in-process. A failure is logged with its
+// kind and exit code and returned for the schedule state, but never stops the
+// scheduler. Each run gets its own copy of the options, o.
+func runScheduledBackup(ctx context.Context, o *runOptions, configPath string) error {
+	err := handleBackup(ctx, o, []string{"-config=" + configPath})
+	if err == nil {
+		return nil
+	}
+
+	kind := KindOf(err)
+	console.Printf("Scheduled backup failed (%s, exit code %d); scheduler continues\n", kind, kind.ExitCode())
+	logs.Error("Scheduled backup failed: kind=%s exit=%d err=%v", kind, kind.ExitCode(), err)
+	return err
+}
+
+// emitScheduleEvent emits a scheduler event as a JSON result.
+func emitScheduleEvent(e schedule.Event) {
+	ev := scheduleEvent{
+		Type:    "schedule",
+		Event:   e.Type,
+		Job:     e.Job,
+		Time:    e.Time,
+		Status:  e.Status,
+		Skipped: e.Skipped,
+	}
+	if !e.Scheduled.IsZero() {
+		ev.Scheduled = &e.Scheduled
+	}
+	if e.Err != nil {
+		ev.Error = e.Err.Error()
+	}
+	emit(ev)
+}
+
+// loadJobs reads and validates a jobs file.
+func loadJobs(path string, defaults schedule.Defaults) (*config.JobsConfig, []schedule.Job, error) {
+	logs.Info("Loading jobs file: %s", path)
+	cfg, err := config.LoadJobs(path)
+	if err != nil {
+		console.Println("Failed to load jobs file:", err)
+		logs.Error("Failed to load jobs file: %v", err)
+		return nil, nil, newError(KindConfig, err)
+	}
+
+	jobs, err := schedule.NewJobs(cfg, defaults)
+	if err != nil {
+		console.Println("Invalid jobs file:", err)
+		logs.Error("Invalid jobs file: %v", err)
+		return nil, nil, newError(KindConfig, err)
+	}
+
+	return cfg, jobs, nil
+}
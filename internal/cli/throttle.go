@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/bhagashetti/db-backup-cli/internal/backup"
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/throttle"
+)
+
+// throttleSettings turns cfg into rate limiters for uploads and dumps, each
+// nil when unlimited, and the priority for dump tools.
+func throttleSettings(cfg config.ThrottleConfig) (upload, dump *throttle.Limiter, prio backup.Priority, err error) {
+	uploadRate, err := throttle.ParseRate(cfg.UploadRate)
+	if err != nil {
+		return nil, nil, prio, fmt.Errorf("uploadRate: %w", err)
+	}
+	dumpRate, err := throttle.ParseRate(cfg.DumpRate)
+	if err != nil {
+		return nil, nil, prio, fmt.Errorf("dumpRate: %w", err)
+	}
+
+	var uploadWindows, dumpWindows []throttle.Window
+	for i, p := range cfg.Profiles {
+		from, err := throttle.ParseClock(p.From)
+		if err != nil {
+			return nil, nil, prio, fmt.Errorf("profile %d: from: %w", i+1, err)
+		}
+		to, err := throttle.ParseClock(p.To)
+		if err != nil {
+			return nil, nil, prio, fmt.Errorf("profile %d: to: %w", i+1, err)
+		}
+		if from == to {
+			return nil, nil, prio, fmt.Errorf("profile %d: from and to are both %s", i+1, p.From)
+		}
+		// An empty rate keeps the base one, so a profile can change just
+		// one of the two.
+		up, down := uploadRate, dumpRate
+		if p.UploadRate != "" {
+			if up, err = throttle.ParseRate(p.UploadRate); err != nil {
+				return nil, nil, prio, fmt.Errorf("profile %d: uploadRate: %w", i+1, err)
+			}
+		}
+		if p.DumpRate != "" {
+			if down, err = throttle.ParseRate(p.DumpRate); err != nil {
+				return nil, nil, prio, fmt.Errorf("profile %d: dumpRate: %w", i+1, err)
+			}
+		}
+		uploadWindows = append(uploadWindows, throttle.Window{From: from, To: to, Rate: up})
+		dumpWindows = append(dumpWindows, throttle.Window{From: from, To: to, Rate: down})
+	}
+
+	if cfg.Nice < 0 || cfg.Nice > 19 {
+		return nil, nil, prio, fmt.Errorf("nice must be 0-19, got %d", cfg.Nice)
+	}
+	prio.Nice = cfg.Nice
+	if prio.IOClass, prio.IOLevel, err = backup.ParseIONice(cfg.IONice); err != nil {
+		return nil, nil, prio, err
+	}
+
+	return throttle.New(uploadRate, uploadWindows), throttle.New(dumpRate, dumpWindows), prio, nil
+}
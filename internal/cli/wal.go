@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/bhagashetti/db-backup-cli/internal/backup"
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+	"github.com/bhagashetti/db-backup-cli/internal/storage"
+)
+
+// handleArchiveWAL archives or fetches one PostgreSQL WAL file. Postgres
+// runs it as
+//
+//	archive_command = 'db-backup-cli archive-wal push -config wal.json %p %f'
+//	restore_command = 'db-backup-cli archive-wal fetch -config wal.json %f %p'
+//
+// and only treats exit status 0 as success.
+func handleArchiveWAL(ctx context.Context, o *runOptions, args []string) error {
+	if len(args) < 1 || (args[0] != "push" && args[0] != "fetch") {
+		console.Println("Usage: db-backup-cli archive-wal push [options] <path> <name>")
+		console.Println("       db-backup-cli archive-wal fetch [options] <name> <path>")
+		return newError(KindUsage, errors.New("archive-wal needs push or fetch"))
+	}
+	mode := args[0]
+
+	fs := flag.NewFlagSet("archive-wal "+mode, flag.ContinueOnError)
+	configPath := fs.String("config", "", "Path to JSON WAL archive config file")
+	dir := fs.String("dir", "", "Local WAL archive directory")
+	compress := fs.Bool("compress", false, "gzip WAL files in the archive")
+	encryptKey := fs.String("encrypt-key", "", "Encrypt WAL files with this key (32 chars)")
+	s3Bucket := fs.String("s3-bucket", "", "S3 bucket of the WAL archive")
+	s3Region := fs.String("s3-region", "", "S3 region")
+	s3Prefix := fs.String("s3-prefix", "", "S3 key prefix")
+
+	if err := parseFlags(fs, args[1:], o); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		console.Printf("Error: archive-wal %s needs two arguments\n", mode)
+		return newError(KindUsage, fmt.Errorf("archive-wal %s: want 2 arguments, got %d", mode, fs.NArg()))
+	}
+
+	cfg := config.WALArchiveConfig{
+		Dir:        *dir,
+		Compress:   *compress,
+		Encrypt:    *encryptKey != "",
+		EncryptKey: *encryptKey,
+		UploadS3:   *s3Bucket != "",
+		S3Bucket:   *s3Bucket,
+		S3Region:   *s3Region,
+		S3Prefix:   *s3Prefix,
+	}
+	if *configPath != "" {
+		loaded, err := config.LoadWALArchive(*configPath)
+		if err != nil {
+			console.Println("Failed to load WAL archive config:", err)
+			logs.Error("Failed to load WAL archive config: %v", err)
+			return newError(KindConfig, err)
+		}
+		cfg = *loaded
+	}
+
+	opts, err := walArchiveOptions(cfg)
+	if err != nil {
+		console.Println("Invalid WAL archive config:", err)
+		logs.Error("Invalid WAL archive config: %v", err)
+		return newError(KindConfig, err)
+	}
+
+	if mode == "push" {
+		path, name := fs.Arg(0), fs.Arg(1)
+		if err := backup.ArchiveWAL(ctx, opts, path, name); err != nil {
+			console.Printf("Archiving WAL %s failed: %v\n", name, err)
+			logs.Error("Archiving WAL %s failed: %v", name, err)
+			return newErrorCtx(ctx, KindUpload, err)
+		}
+		logs.Info("Archived WAL %s", name)
+		return nil
+	}
+
+	name, path := fs.Arg(0), fs.Arg(1)
+	if err := backup.RestoreWAL(ctx, opts, name, path); err != nil {
+		if errors.Is(err, backup.ErrWALNotFound) {
+			// Normal at the end of the archive; recovery moves on.
+			console.Printf("WAL %s not in archive\n", name)
+			return newError(KindRestore, err)
+		}
+		console.Printf("Fetching WAL %s failed: %v\n", name, err)
+		logs.Error("Fetching WAL %s failed: %v", name, err)
+		return newErrorCtx(ctx, KindRestore, err)
+	}
+	logs.Info("Fetched WAL %s", name)
+	return nil
+}
+
+// walArchiveOptions checks cfg and turns it into options for the backup
+// package, with S3 as the remote storage.
+func walArchiveOptions(cfg config.WALArchiveConfig) (backup.WALArchiveOptions, error) {
+	opts := backup.WALArchiveOptions{Dir: cfg.Dir, Compress: cfg.Compress}
+
+	if cfg.Encrypt {
+		if len(cfg.EncryptKey) != 32 {
+			return opts, fmt.Errorf("encryption key must be exactly 32 characters, got %d", len(cfg.EncryptKey))
+		}
+		opts.EncryptKey = []byte(cfg.EncryptKey)
+	}
+
+	switch {
+	case cfg.Dir != "":
+	case cfg.UploadS3:
+		if cfg.S3Bucket == "" || cfg.S3Region == "" {
+			return opts, errors.New("S3 archive requested but bucket or region is empty")
+		}
+		opts.Upload = func(ctx context.Context, key, path string) error {
+			return storage.UploadToS3(ctx, cfg.S3Bucket, cfg.S3Region, cfg.S3Prefix+key, path, nil)
+		}
+		opts.Download = func(ctx context.Context, key, path string) error {
+			err := storage.DownloadFromS3(ctx, cfg.S3Bucket, cfg.S3Region, cfg.S3Prefix+key, path)
+			if errors.Is(err, storage.ErrNotFound) {
+				return fmt.Errorf("%w: %w", backup.ErrWALNotFound, err)
+			}
+			return err
+		}
+	default:
+		return opts, errors.New("no WAL archive: set dir or uploadS3")
+	}
+	return opts, nil
+}
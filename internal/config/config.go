@@ -1,10 +1,6 @@
 package config
 
-import (
-	"encoding/json"
-	"fmt"
-	"os"
-)
+import "path/filepath"
 
 // BackupConfig represents backup configuration loaded from JSON file.
 type BackupConfig struct {
@@ -15,6 +11,7 @@ type BackupConfig struct {
 	Password     string `json:"password"`
 	DBName       string `json:"dbName"`
 	Output       string `json:"out"`
+	Engine       string `json:"engine"` // client (mysqldump, default) or native
 	Compress     bool   `json:"compress"`
 	UseTimestamp bool   `json:"useTimestamp"`
 	Encrypt      bool   `json:"encrypt"`
@@ -23,6 +20,64 @@ type BackupConfig struct {
 	S3Bucket     string `json:"s3Bucket"`
 	S3Region     string `json:"s3Region"`
 	S3Prefix     string `json:"s3Prefix"`
+
+	// DBName may also be a comma-separated list, glob patterns or "all".
+	ExcludeDatabases []string `json:"excludeDatabases"` // names or globs skipped when expanding DBName
+	Parallelism      int      `json:"parallelism"`      // databases backed up at once, default 2
+
+	// Table filters, validated against the live schema before each run.
+	// Entries are names or globs, optionally qualified as "db.table". With
+	// engine "client", schema-only and where tables are dumped by separate
+	// mysqldump calls, each with its own snapshot, so the dump is not
+	// consistent to one point in time; engine "native" uses one snapshot.
+	IncludeTables    []string          `json:"includeTables"`    // dump only these tables
+	ExcludeTables    []string          `json:"excludeTables"`    // skip these tables
+	SchemaOnlyTables []string          `json:"schemaOnlyTables"` // dump structure without rows
+	Where            map[string]string `json:"where"`            // table -> WHERE clause
+
+	// Format "dir" writes one compressed file per table chunk, dumped by
+	// Threads connections within one snapshot. Default "sql".
+	Format    string `json:"format"`
+	Threads   int    `json:"threads"`   // default 4
+	ChunkRows int64  `json:"chunkRows"` // rows per chunk of large tables, default 1000000
+
+	// RecordBinlogPosition saves each dump's binlog position and GTID set
+	// for point-in-time restores (see the archive-binlog command).
+	RecordBinlogPosition bool `json:"recordBinlogPosition"`
+
+	// Snapshot is how a Redis RDB is taken: "sync" (default) pulls it over
+	// replication, "bgsave" runs BGSAVE and copies the server's file.
+	Snapshot string `json:"snapshot"`
+
+	// ServerDir is the output directory as SQL Server sees it, if that
+	// differs from this host's path. Format "full" (default) or "log".
+	ServerDir string `json:"serverDir"`
+
+	// db-type "files": directories to archive into a tar, filtered by globs
+	// ("*.tmp" matches names anywhere, "cache/**" paths below each root).
+	Paths        []string `json:"paths"`
+	IncludeFiles []string `json:"includeFiles"`
+	ExcludeFiles []string `json:"excludeFiles"`
+
+	// Compression picks the compressor used when Compress is set; setting
+	// an algorithm also turns compression on.
+	Compression CompressionConfig `json:"compression"`
+
+	// Repository stores backups deduplicated in a chunk repository instead
+	// of as files. encryptKey, if set, encrypts the repository.
+	Repository RepositoryConfig `json:"repository"`
+
+	// Throttle limits the load a backup puts on the server and the network.
+	Throttle ThrottleConfig `json:"throttle"`
+
+	Progress ProgressConfig `json:"progress"`
+
+	MySQLDump MySQLDumpConfig `json:"mysqldump"`
+	ExtraArgs []string        `json:"extraArgs"` // extra mysqldump flags, checked against a denylist
+
+	Metrics       MetricsConfig `json:"metrics"`
+	Notifications NotifyConfig  `json:"notifications"`
+	Hooks         HooksConfig   `json:"hooks"`
 }
 
 // RestoreConfig represents restore configuration loaded from JSON file.
@@ -34,34 +89,282 @@ type RestoreConfig struct {
 	Password string `json:"password"`
 	DBName   string `json:"dbName"`
 	Input    string `json:"input"`
+	Engine   string `json:"engine"`  // client (mysql, default) or native
+	Threads  int    `json:"threads"` // loaders for a directory-format backup, default 4
+
+	// Point-in-time recovery: Input may then be a directory of backups.
+	ToTime    string `json:"toTime"`    // RFC 3339, or "2006-01-02 15:04:05" in local time
+	ToGTID    string `json:"toGtid"`    // e.g. "3e11fa47-71ca-11e1-9e33-c80aa9429562:1234"
+	BinlogDir string `json:"binlogDir"` // archive written by archive-binlog
+
+	// PostgreSQL base backups: the data directory to unpack into, and the
+	// archive-wal config its restore_command fetches WAL with. For Redis,
+	// DataDir is a stopped server's directory to place the RDB in.
+	DataDir   string `json:"dataDir"`
+	WALConfig string `json:"walConfig"`
+
+	// SQL Server: the input directory as the server sees it, logical file
+	// name -> new path (WITH MOVE), and whether to leave the database
+	// restoring for further log backups. DataDir moves all other files.
+	ServerDir  string            `json:"serverDir"`
+	Move       map[string]string `json:"move"`
+	NoRecovery bool              `json:"noRecovery"`
+
+	Target string `json:"target"` // db-type "files": directory to extract into
+
+	// Restore from a chunk repository instead of Input: the snapshot ID, or
+	// "latest" (default) for the newest snapshot of DBName.
+	Repository RepositoryConfig `json:"repository"`
+	Snapshot   string           `json:"snapshot"`
+	EncryptKey string           `json:"encryptKey"` // key of an encrypted repository
+
+	Metrics MetricsConfig `json:"metrics"`
 }
 
-// LoadBackup reads and parses a backup config file.
-func LoadBackup(path string) (*BackupConfig, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("read backup config file: %w", err)
-	}
+// BinlogArchiveConfig configures the archive-binlog command.
+type BinlogArchiveConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Dir      string `json:"dir"`      // local archive directory
+	ServerID int    `json:"serverId"` // server_id to connect as; must be unique among replicas
 
-	var cfg BackupConfig
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("parse backup config JSON: %w", err)
-	}
+	UploadS3       bool   `json:"uploadS3"`
+	S3Bucket       string `json:"s3Bucket"`
+	S3Region       string `json:"s3Region"`
+	S3Prefix       string `json:"s3Prefix"`
+	UploadInterval string `json:"uploadInterval"` // default "1m"
+}
+
+// WALArchiveConfig configures the archive-wal command, which Postgres runs
+// as archive_command and restore_command.
+type WALArchiveConfig struct {
+	Dir        string `json:"dir"` // local archive directory; used instead of S3 if set
+	Compress   bool   `json:"compress"`
+	Encrypt    bool   `json:"encrypt"`
+	EncryptKey string `json:"encryptKey"`
+	UploadS3   bool   `json:"uploadS3"`
+	S3Bucket   string `json:"s3Bucket"`
+	S3Region   string `json:"s3Region"`
+	S3Prefix   string `json:"s3Prefix"`
+}
+
+// MySQLDumpConfig overrides mysqldump consistency defaults. Unset booleans
+// default to true.
+type MySQLDumpConfig struct {
+	SingleTransaction *bool  `json:"singleTransaction"`
+	Routines          *bool  `json:"routines"`
+	Triggers          *bool  `json:"triggers"`
+	Events            *bool  `json:"events"`
+	HexBlob           *bool  `json:"hexBlob"`
+	SetGTIDPurged     string `json:"setGtidPurged"` // OFF, ON, AUTO, COMMENTED; default OFF on GTID servers
+}
+
+// CompressionConfig selects and tunes the backup compressor.
+type CompressionConfig struct {
+	Algorithm string `json:"algorithm"` // gzip (default), pgzip, zstd, xz or lz4
+	Level     int    `json:"level"`     // 0 for the algorithm's default
+	Threads   int    `json:"threads"`   // pgzip, zstd and lz4 workers, default all CPUs
+	Long      bool   `json:"long"`      // zstd long-distance matching (128 MiB window)
+}
+
+// RepositoryConfig locates a deduplicating chunk repository.
+type RepositoryConfig struct {
+	URL      string `json:"url"`      // local directory or s3://bucket/prefix
+	S3Region string `json:"s3Region"` // default from the AWS environment
+}
+
+// ThrottleConfig limits dump and upload rates and lowers the priority of
+// dump tools. Rates are bytes per second with an optional unit ("20MB",
+// "512KiB"); empty or "0" means unlimited.
+type ThrottleConfig struct {
+	UploadRate string            `json:"uploadRate"` // S3 upload and repository writes
+	DumpRate   string            `json:"dumpRate"`   // reading the dump stream
+	Nice       int               `json:"nice"`       // 0-19 for dump and restore tools
+	IONice     string            `json:"ionice"`     // "idle" or "best-effort[:0-7]"
+	Profiles   []ThrottleProfile `json:"profiles"`   // first matching profile wins
+}
+
+// ThrottleProfile replaces the rates between two times of day, local time,
+// e.g. to run faster overnight. From after To wraps past midnight. An
+// empty rate keeps the base one; "0" or "unlimited" lifts the limit.
+type ThrottleProfile struct {
+	From       string `json:"from"` // HH:MM
+	To         string `json:"to"`
+	UploadRate string `json:"uploadRate"`
+	DumpRate   string `json:"dumpRate"`
+}
+
+// ProgressConfig controls progress reporting during a backup.
+type ProgressConfig struct {
+	Mode        string `json:"mode"`        // auto (default), tty, lines or off
+	Interval    string `json:"interval"`    // between lines in lines mode, default 30s
+	HistoryFile string `json:"historyFile"` // past runs for ETAs, default in the user cache dir
+}
+
+// MetricsConfig controls Prometheus metrics written at the end of a run.
+type MetricsConfig struct {
+	Textfile       string `json:"textfile"`       // node_exporter textfile-collector .prom path
+	PushgatewayURL string `json:"pushgatewayURL"` // e.g. http://pushgateway:9091
+	Job            string `json:"job"`            // Pushgateway job name, default "db-backup-cli"
+}
 
-	return &cfg, nil
+// NotifyConfig configures notifications sent after each backup run.
+type NotifyConfig struct {
+	StateFile string       `json:"stateFile"` // last status per database, default "notify-state.json"
+	Retries   int          `json:"retries"`   // retries per sink, default 2
+	Timeout   string       `json:"timeout"`   // per-attempt timeout, default "10s"
+	Sinks     []NotifySink `json:"sinks"`
 }
 
-// LoadRestore reads and parses a restore config file.
+// NotifySink is one notification destination.
+type NotifySink struct {
+	Type     string   `json:"type"`     // webhook, slack or email
+	Events   []string `json:"events"`   // failure, success, recovery (default: failure)
+	Template string   `json:"template"` // Go text/template for the message body
+
+	// webhook and slack
+	URL string `json:"url"`
+
+	// email
+	SMTPHost     string   `json:"smtpHost"`
+	SMTPPort     int      `json:"smtpPort"`
+	SMTPUser     string   `json:"smtpUser"`
+	SMTPPassword string   `json:"smtpPassword"`
+	From         string   `json:"from"`
+	To           []string `json:"to"`
+	Subject      string   `json:"subject"`
+}
+
+// HooksConfig configures commands or HTTP calls run around a backup.
+type HooksConfig struct {
+	PreBackup  []Hook `json:"preBackup"`
+	PostBackup []Hook `json:"postBackup"`
+	OnFailure  []Hook `json:"onFailure"`
+
+	// PreBackupPolicy decides what a failing pre-backup hook does:
+	// "abort" (default) fails the run, "continue" logs and carries on.
+	PreBackupPolicy string `json:"preBackupPolicy"`
+}
+
+// Hook is a single shell command or HTTP call.
+type Hook struct {
+	Name    string `json:"name"`
+	Command string `json:"command"` // run with sh -c (cmd /C on Windows)
+	URL     string `json:"url"`
+	Method  string `json:"method"`  // default GET; other methods send the run as JSON
+	Timeout string `json:"timeout"` // default "60s"
+}
+
+// JobsConfig is a scheduler jobs file listing many scheduled backups.
+type JobsConfig struct {
+	StateFile string      `json:"stateFile"` // last-run state per job, default "schedule-state.json"
+	Lock      *LockConfig `json:"lock"`      // only the lock holder runs jobs
+	Jobs      []JobConfig `json:"jobs"`
+}
+
+// JobConfig schedules one backup config.
+type JobConfig struct {
+	Name     string `json:"name"`
+	Cron     string `json:"cron"`     // 5-field cron expression or @hourly, @daily, ...
+	Timezone string `json:"timezone"` // IANA zone, e.g. "Europe/Berlin"; default local time
+	Config   string `json:"config"`   // backup config path, relative to the jobs file
+	Jitter   string `json:"jitter"`   // random delay up to this duration, e.g. "10m"
+	CatchUp  *bool  `json:"catchUp"`  // run once on startup if a fire time was missed
+}
+
+// LockConfig makes only one of several scheduler hosts run the jobs.
+type LockConfig struct {
+	Backend string `json:"backend"` // s3, mysql or postgres
+	Name    string `json:"name"`    // default "db-backup-cli-scheduler"
+	TTL     string `json:"ttl"`     // lease length, renewed every ttl/3; default "60s"
+
+	// s3: a lock object updated with conditional writes
+	S3Bucket string `json:"s3Bucket"`
+	S3Region string `json:"s3Region"`
+	S3Key    string `json:"s3Key"` // default "locks/<name>.json"
+
+	// mysql (GET_LOCK) and postgres (advisory lock)
+	DSN string `json:"dsn"`
+}
+
+// LoadBackup reads and parses a backup config file, failing on unknown
+// fields and invalid settings.
+func LoadBackup(path string) (*BackupConfig, error) {
+	return load(path, "backup config", (*BackupConfig).Validate)
+}
+
+// ReadBackup reads a backup config file, returning its problems instead
+// of failing on them.
+func ReadBackup(path string) (*BackupConfig, Problems, error) {
+	return read(path, "backup config", (*BackupConfig).Validate)
+}
+
+// LoadRestore reads and parses a restore config file, failing on unknown
+// fields and invalid settings.
 func LoadRestore(path string) (*RestoreConfig, error) {
-	data, err := os.ReadFile(path)
+	return load(path, "restore config", (*RestoreConfig).Validate)
+}
+
+// ReadRestore reads a restore config file, returning its problems instead
+// of failing on them.
+func ReadRestore(path string) (*RestoreConfig, Problems, error) {
+	return read(path, "restore config", (*RestoreConfig).Validate)
+}
+
+// LoadBinlogArchive reads and parses an archive-binlog config file, failing
+// on unknown fields and invalid settings.
+func LoadBinlogArchive(path string) (*BinlogArchiveConfig, error) {
+	return load(path, "binlog archive config", (*BinlogArchiveConfig).Validate)
+}
+
+// ReadBinlogArchive reads an archive-binlog config file, returning its
+// problems instead of failing on them.
+func ReadBinlogArchive(path string) (*BinlogArchiveConfig, Problems, error) {
+	return read(path, "binlog archive config", (*BinlogArchiveConfig).Validate)
+}
+
+// LoadWALArchive reads and parses an archive-wal config file, failing on
+// unknown fields and invalid settings.
+func LoadWALArchive(path string) (*WALArchiveConfig, error) {
+	return load(path, "WAL archive config", (*WALArchiveConfig).Validate)
+}
+
+// ReadWALArchive reads an archive-wal config file, returning its problems
+// instead of failing on them.
+func ReadWALArchive(path string) (*WALArchiveConfig, Problems, error) {
+	return read(path, "WAL archive config", (*WALArchiveConfig).Validate)
+}
+
+// LoadJobs reads and parses a scheduler jobs file, failing on unknown
+// fields and invalid settings. Relative backup config paths are resolved
+// against the jobs file's directory.
+func LoadJobs(path string) (*JobsConfig, error) {
+	cfg, err := load(path, "jobs", (*JobsConfig).Validate)
 	if err != nil {
-		return nil, fmt.Errorf("read restore config file: %w", err)
+		return nil, err
 	}
+	cfg.resolvePaths(path)
+	return cfg, nil
+}
 
-	var cfg RestoreConfig
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("parse restore config JSON: %w", err)
+// ReadJobs reads a scheduler jobs file, returning its problems instead of
+// failing on them. Relative backup config paths are resolved as by LoadJobs.
+func ReadJobs(path string) (*JobsConfig, Problems, error) {
+	cfg, problems, err := read(path, "jobs", (*JobsConfig).Validate)
+	if err != nil {
+		return nil, nil, err
 	}
+	cfg.resolvePaths(path)
+	return cfg, problems, nil
+}
 
-	return &cfg, nil
+func (c *JobsConfig) resolvePaths(path string) {
+	dir := filepath.Dir(path)
+	for i := range c.Jobs {
+		if c.Jobs[i].Config != "" && !filepath.IsAbs(c.Jobs[i].Config) {
+			c.Jobs[i].Config = filepath.Join(dir, c.Jobs[i].Config)
+		}
+	}
 }
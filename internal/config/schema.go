@@ -0,0 +1,112 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SchemaKinds are the config files a JSON Schema can be generated for, by
+// the name of the command that reads them.
+var SchemaKinds = []string{"backup", "restore", "jobs", "archive-binlog", "archive-wal"}
+
+var schemaTypes = map[string]reflect.Type{
+	"backup":         reflect.TypeOf(BackupConfig{}),
+	"restore":        reflect.TypeOf(RestoreConfig{}),
+	"jobs":           reflect.TypeOf(JobsConfig{}),
+	"archive-binlog": reflect.TypeOf(BinlogArchiveConfig{}),
+	"archive-wal":    reflect.TypeOf(WALArchiveConfig{}),
+}
+
+// schemaEnums are the values of string settings that take one of a fixed
+// set, by "Type.jsonName". For a list, they apply to its items.
+var schemaEnums = map[string][]string{
+	"BackupConfig.dbType":           DBTypes,
+	"BackupConfig.engine":           {"client", "native"},
+	"BackupConfig.format":           {"sql", "dir", "basebackup", "full", "log"},
+	"BackupConfig.snapshot":         {"sync", "bgsave"},
+	"RestoreConfig.dbType":          DBTypes,
+	"RestoreConfig.engine":          {"client", "native"},
+	"CompressionConfig.algorithm":   {"gzip", "pgzip", "zstd", "xz", "lz4"},
+	"MySQLDumpConfig.setGtidPurged": {"OFF", "ON", "AUTO", "COMMENTED"},
+	"ProgressConfig.mode":           {"auto", "tty", "lines", "off"},
+	"NotifySink.type":               {"webhook", "slack", "email"},
+	"NotifySink.events":             {"failure", "success", "recovery"},
+	"HooksConfig.preBackupPolicy":   {"abort", "continue"},
+	"LockConfig.backend":            {"s3", "mysql", "postgres"},
+}
+
+// schemaRanges bound integer settings, by "Type.jsonName".
+var schemaRanges = map[string][2]int{
+	"BackupConfig.port":        {1, 65535},
+	"RestoreConfig.port":       {1, 65535},
+	"BinlogArchiveConfig.port": {1, 65535},
+	"NotifySink.smtpPort":      {1, 65535},
+	"ThrottleConfig.nice":      {0, 19},
+}
+
+// schemaLengths fix the length of string settings, by "Type.jsonName".
+var schemaLengths = map[string]int{
+	"BackupConfig.encryptKey":     32,
+	"RestoreConfig.encryptKey":    32,
+	"WALArchiveConfig.encryptKey": 32,
+}
+
+// Schema returns a JSON Schema (draft 2020-12) for the config files of
+// kind, one of SchemaKinds. It is generated from the config types, so it
+// always lists the fields the loaders accept; files can point at it with
+// a top-level "$schema" for editor completion and checks.
+func Schema(kind string) ([]byte, error) {
+	t, ok := schemaTypes[kind]
+	if !ok {
+		return nil, fmt.Errorf("no schema for %q (want %s)", kind, strings.Join(SchemaKinds, ", "))
+	}
+	s := schemaOf(t, "")
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = "db-backup-cli " + kind + " config"
+	s["properties"].(map[string]any)[SchemaKey] = map[string]any{"type": "string"}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// schemaOf describes values of t. key is "Type.jsonName" of the field
+// holding them, for the constraint tables.
+func schemaOf(t reflect.Type, key string) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		props := map[string]any{}
+		for _, f := range jsonFields(t) {
+			props[f.name] = schemaOf(f.Type, t.Name()+"."+f.name)
+		}
+		return map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), key)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), "")}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s := map[string]any{"type": "integer"}
+		if r, ok := schemaRanges[key]; ok {
+			s["minimum"], s["maximum"] = r[0], r[1]
+		}
+		return s
+	case reflect.String:
+		s := map[string]any{"type": "string"}
+		if enum, ok := schemaEnums[key]; ok {
+			s["enum"] = enum
+		}
+		if n, ok := schemaLengths[key]; ok {
+			s["minLength"], s["maxLength"] = n, n
+		}
+		return s
+	}
+	return map[string]any{}
+}
@@ -0,0 +1,466 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaKey is the top-level field a config file may use to point editors
+// at its JSON Schema. It is accepted and ignored.
+const SchemaKey = "$schema"
+
+// DBTypes are the database types a backup or restore config may name.
+var DBTypes = []string{"mysql", "postgres", "redis", "mssql", "files"}
+
+// Problem is one thing wrong with a config file. Field is the path of the
+// setting, e.g. "throttle.profiles[0].from", or empty for the whole file.
+type Problem struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Field == "" {
+		return p.Message
+	}
+	return p.Field + ": " + p.Message
+}
+
+// Problems are everything wrong with a config file. As an error it lists
+// them all.
+type Problems []Problem
+
+func (ps Problems) Error() string {
+	if len(ps) == 1 {
+		return ps[0].String()
+	}
+	parts := make([]string, len(ps))
+	for i, p := range ps {
+		parts[i] = p.String()
+	}
+	return fmt.Sprintf("%d problems: %s", len(ps), strings.Join(parts, "; "))
+}
+
+func (ps *Problems) add(field, format string, args ...any) {
+	*ps = append(*ps, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// read reads the config file at path into a new T. Unknown fields,
+// settings of the wrong JSON type and what validate finds are returned as
+// problems; err is only set if the file cannot be read or is not JSON.
+// what names the file in errors, e.g. "backup config".
+func read[T any](path, what string, validate func(*T) Problems) (*T, Problems, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s file: %w", what, err)
+	}
+
+	var cfg T
+	problems, mistyped, err := decodeStrict(data, &cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse %s JSON: %w", what, err)
+	}
+	if !mistyped {
+		// A mistyped setting is left zero, which validate would report
+		// a second time.
+		problems = append(problems, validate(&cfg)...)
+	}
+	return &cfg, problems, nil
+}
+
+// load is read for commands that need a usable config: any problem fails.
+func load[T any](path, what string, validate func(*T) Problems) (*T, error) {
+	cfg, problems, err := read(path, what, validate)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid %s %s: %w", what, path, problems)
+	}
+	return cfg, nil
+}
+
+// decodeStrict unmarshals data into v, then reports every field of data
+// that v has no place for. A setting of the wrong JSON type is reported
+// too, with mistyped set; encoding/json only reports the first. A syntax
+// error is returned as err.
+func decodeStrict(data []byte, v any) (problems Problems, mistyped bool, err error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return nil, false, err
+		}
+		problems.add(typeErr.Field, "want %s, got JSON %s", typeErr.Type, typeErr.Value)
+		mistyped = true
+	}
+
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, false, err
+	}
+	if obj, ok := raw.(map[string]any); ok {
+		delete(obj, SchemaKey)
+	}
+	unknownFields(&problems, raw, reflect.TypeOf(v), "")
+	return problems, mistyped, nil
+}
+
+// unknownFields walks raw alongside t, adding a problem for each object
+// key that matches no field. Keys match field names case-insensitively,
+// as encoding/json does.
+func unknownFields(problems *Problems, raw any, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for _, k := range sortedKeys(obj) {
+			f, ok := lookupField(fields, k)
+			if !ok {
+				msg := "unknown field"
+				if s := suggest(fields, k); s != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", s)
+				}
+				problems.add(joinPath(path, k), "%s", msg)
+				continue
+			}
+			unknownFields(problems, obj[k], f.Type, joinPath(path, f.name))
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := raw.([]any)
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			unknownFields(problems, item, t.Elem(), path+"["+strconv.Itoa(i)+"]")
+		}
+	case reflect.Map:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return
+		}
+		for _, k := range sortedKeys(obj) {
+			unknownFields(problems, obj[k], t.Elem(), joinPath(path, k))
+		}
+	}
+}
+
+func sortedKeys(obj map[string]any) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonField is a struct field under its JSON name.
+type jsonField struct {
+	reflect.StructField
+	name string
+}
+
+// jsonFields returns the fields of struct type t that encoding/json fills.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, jsonField{f, name})
+	}
+	return fields
+}
+
+func lookupField(fields []jsonField, key string) (jsonField, bool) {
+	for _, f := range fields {
+		if f.name == key {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, key) {
+			return f, true
+		}
+	}
+	return jsonField{}, false
+}
+
+// suggest returns the field name closest to a mistyped key, or "" if none
+// is close enough to be a likely typo.
+func suggest(fields []jsonField, key string) string {
+	best, bestDist := "", 3
+	for _, f := range fields {
+		if d := editDistance(strings.ToLower(f.name), strings.ToLower(key)); d < bestDist {
+			best, bestDist = f.name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// Checks shared by the config types. Each adds a problem for field if the
+// check fails.
+
+func checkDBType(ps *Problems, field, dbType string) {
+	if dbType == "" {
+		ps.add(field, "required (one of %s)", strings.Join(DBTypes, ", "))
+		return
+	}
+	for _, t := range DBTypes {
+		if t == dbType {
+			return
+		}
+	}
+	ps.add(field, "%q is not a database type (want one of %s)", dbType, strings.Join(DBTypes, ", "))
+}
+
+// networked reports whether dbType connects to a server by host and port.
+func networked(dbType string) bool {
+	return dbType != "files"
+}
+
+func checkPort(ps *Problems, field string, port int) {
+	if port < 1 || port > 65535 {
+		ps.add(field, "%d is not a port (want 1-65535)", port)
+	}
+}
+
+func checkKey(ps *Problems, field, key string, required bool) {
+	switch {
+	case key == "" && required:
+		ps.add(field, "required when encrypt is true")
+	case key != "" && len(key) != 32:
+		ps.add(field, "must be exactly 32 characters, got %d", len(key))
+	}
+}
+
+// checkS3 requires a bucket and region for uploads, and both together
+// whenever either is set.
+func checkS3(ps *Problems, upload bool, bucket, region string) {
+	if !upload && bucket == "" && region == "" {
+		return
+	}
+	if bucket == "" {
+		ps.add("s3Bucket", "required with s3Region or uploadS3")
+	}
+	if region == "" {
+		ps.add("s3Region", "required with s3Bucket or uploadS3")
+	}
+}
+
+func checkNotNegative(ps *Problems, field string, n int64) {
+	if n < 0 {
+		ps.add(field, "must not be negative, got %d", n)
+	}
+}
+
+// Validate checks the settings of a backup config that can be judged
+// without looking beyond the file.
+func (c *BackupConfig) Validate() Problems {
+	var ps Problems
+	checkDBType(&ps, "dbType", c.DBType)
+	if c.DBName == "" {
+		ps.add("dbName", "required")
+	}
+	if networked(c.DBType) {
+		checkPort(&ps, "port", c.Port)
+	} else if len(c.Paths) == 0 {
+		ps.add("paths", "required for dbType files")
+	}
+	if c.Output == "" && !c.UseTimestamp {
+		ps.add("out", "required unless useTimestamp is true")
+	}
+	checkKey(&ps, "encryptKey", c.EncryptKey, c.Encrypt)
+	checkS3(&ps, c.UploadS3, c.S3Bucket, c.S3Region)
+	checkNotNegative(&ps, "parallelism", int64(c.Parallelism))
+	checkNotNegative(&ps, "threads", int64(c.Threads))
+	checkNotNegative(&ps, "chunkRows", c.ChunkRows)
+	checkNotNegative(&ps, "compression.level", int64(c.Compression.Level))
+	checkNotNegative(&ps, "compression.threads", int64(c.Compression.Threads))
+
+	if c.Throttle.Nice < 0 || c.Throttle.Nice > 19 {
+		ps.add("throttle.nice", "%d is out of range (want 0-19)", c.Throttle.Nice)
+	}
+
+	c.Hooks.validate(&ps)
+	return ps
+}
+
+func (h *HooksConfig) validate(ps *Problems) {
+	for _, list := range []struct {
+		field string
+		hooks []Hook
+	}{
+		{"hooks.preBackup", h.PreBackup},
+		{"hooks.postBackup", h.PostBackup},
+		{"hooks.onFailure", h.OnFailure},
+	} {
+		for i, hook := range list.hooks {
+			if (hook.Command == "") == (hook.URL == "") {
+				ps.add(fmt.Sprintf("%s[%d]", list.field, i), "needs exactly one of command or url")
+			}
+		}
+	}
+	switch h.PreBackupPolicy {
+	case "", "abort", "continue":
+	default:
+		ps.add("hooks.preBackupPolicy", "%q is not a policy (want abort or continue)", h.PreBackupPolicy)
+	}
+}
+
+// Validate checks the settings of a restore config that can be judged
+// without looking beyond the file.
+func (c *RestoreConfig) Validate() Problems {
+	var ps Problems
+	checkDBType(&ps, "dbType", c.DBType)
+	// A base backup or RDB unpacked into DataDir needs no connection; SQL
+	// Server only moves files there.
+	if networked(c.DBType) && (c.DataDir == "" || c.DBType == "mssql") {
+		checkPort(&ps, "port", c.Port)
+	}
+	if c.DBType == "files" {
+		if c.Target == "" {
+			ps.add("target", "required for dbType files")
+		}
+	} else if c.DBName == "" && c.DataDir == "" {
+		ps.add("dbName", "required unless dataDir is set")
+	}
+	if c.Input == "" && c.Repository.URL == "" {
+		ps.add("input", "required unless repository.url is set")
+	}
+	if c.ToTime != "" && c.ToGTID != "" {
+		ps.add("toGtid", "toTime and toGtid are alternatives; set one")
+	}
+	checkKey(&ps, "encryptKey", c.EncryptKey, false)
+	checkNotNegative(&ps, "threads", int64(c.Threads))
+	return ps
+}
+
+// Validate checks the settings of an archive-binlog config.
+func (c *BinlogArchiveConfig) Validate() Problems {
+	var ps Problems
+	checkPort(&ps, "port", c.Port)
+	if c.Dir == "" {
+		ps.add("dir", "required")
+	}
+	if c.ServerID < 0 {
+		ps.add("serverId", "must not be negative, got %d", c.ServerID)
+	}
+	if c.UploadInterval != "" {
+		if d, err := time.ParseDuration(c.UploadInterval); err != nil || d <= 0 {
+			ps.add("uploadInterval", "%q is not a duration, e.g. 1m", c.UploadInterval)
+		}
+	}
+	checkS3(&ps, c.UploadS3, c.S3Bucket, c.S3Region)
+	return ps
+}
+
+// Validate checks the settings of an archive-wal config.
+func (c *WALArchiveConfig) Validate() Problems {
+	var ps Problems
+	if c.Dir == "" && !c.UploadS3 {
+		ps.add("dir", "required unless uploadS3 is true")
+	}
+	checkKey(&ps, "encryptKey", c.EncryptKey, c.Encrypt)
+	checkS3(&ps, c.UploadS3, c.S3Bucket, c.S3Region)
+	return ps
+}
+
+// Validate checks the settings of a jobs file. The backup configs it names
+// are not read.
+func (c *JobsConfig) Validate() Problems {
+	var ps Problems
+	if len(c.Jobs) == 0 {
+		ps.add("jobs", "no jobs")
+	}
+	names := map[string]bool{}
+	for i, j := range c.Jobs {
+		field := fmt.Sprintf("jobs[%d]", i)
+		switch {
+		case j.Name == "":
+			ps.add(field+".name", "required")
+		case names[j.Name]:
+			ps.add(field+".name", "%q is used by another job", j.Name)
+		}
+		names[j.Name] = true
+		if j.Cron == "" {
+			ps.add(field+".cron", "required")
+		}
+		if j.Config == "" {
+			ps.add(field+".config", "required")
+		}
+	}
+	if c.Lock != nil {
+		for _, p := range c.Lock.Validate() {
+			p.Field = "lock." + p.Field
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// Validate checks the settings of a scheduler lock.
+func (l *LockConfig) Validate() Problems {
+	var ps Problems
+	switch l.Backend {
+	case "s3":
+		if l.S3Bucket == "" {
+			ps.add("s3Bucket", "required for the s3 backend")
+		}
+	case "mysql", "postgres":
+		if l.DSN == "" {
+			ps.add("dsn", "required for the %s backend", l.Backend)
+		}
+	default:
+		ps.add("backend", "%q is not a lock backend (want s3, mysql or postgres)", l.Backend)
+	}
+	return ps
+}
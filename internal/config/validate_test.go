@@ -0,0 +1,265 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeStrict(t *testing.T) {
+	tests := []struct {
+		name         string
+		json         string
+		want         []string // Problem.String of each problem
+		wantMistyped bool
+		wantErr      bool
+	}{
+		{
+			name: "clean",
+			json: `{"dbType": "mysql", "port": 3306, "compression": {"level": 3}}`,
+		},
+		{
+			name: "schema key",
+			json: `{"$schema": "./backup.schema.json", "dbType": "mysql"}`,
+		},
+		{
+			name: "keys match case-insensitively",
+			json: `{"DBTYPE": "mysql", "S3bucket": "b"}`,
+		},
+		{
+			name: "unknown field with suggestion",
+			json: `{"dbTyp": "mysql"}`,
+			want: []string{`dbTyp: unknown field (did you mean "dbType"?)`},
+		},
+		{
+			name: "unknown field without suggestion",
+			json: `{"colour": "blue"}`,
+			want: []string{"colour: unknown field"},
+		},
+		{
+			name: "all unknown fields, sorted",
+			json: `{"zz": 1, "aa": 2, "port": 1}`,
+			want: []string{"aa: unknown field", "zz: unknown field"},
+		},
+		{
+			name: "nested struct",
+			json: `{"compression": {"algorithm": "zstd", "levle": 3}}`,
+			want: []string{`compression.levle: unknown field (did you mean "level"?)`},
+		},
+		{
+			name: "slice of structs",
+			json: `{"throttle": {"profiles": [{"from": "22:00"}, {"form": "06:00"}]}}`,
+			want: []string{`throttle.profiles[1].form: unknown field (did you mean "from"?)`},
+		},
+		{
+			name: "map values are not fields",
+			json: `{"where": {"orders": "id > 10", "anything": "1=1"}}`,
+		},
+		{
+			name: "struct in a slice in a struct",
+			json: `{"hooks": {"preBackup": [{"command": "true", "timout": "5s"}]}}`,
+			want: []string{`hooks.preBackup[0].timout: unknown field (did you mean "timeout"?)`},
+		},
+		{
+			name:         "wrong type",
+			json:         `{"port": "3306"}`,
+			want:         []string{"port: want int, got JSON string"},
+			wantMistyped: true,
+		},
+		{
+			name:         "wrong type and unknown field",
+			json:         `{"compress": "yes", "extra": 1}`,
+			want:         []string{"compress: want bool, got JSON string", "extra: unknown field"},
+			wantMistyped: true,
+		},
+		{
+			name:    "syntax error",
+			json:    `{"dbType": "mysql",}`,
+			wantErr: true,
+		},
+		{
+			name:         "not an object",
+			json:         `[1, 2]`,
+			want:         []string{"want config.BackupConfig, got JSON array"},
+			wantMistyped: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg BackupConfig
+			problems, mistyped, err := decodeStrict([]byte(tt.json), &cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, p := range problems {
+				got = append(got, p.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems = %q, want %q", got, tt.want)
+			}
+			if mistyped != tt.wantMistyped {
+				t.Errorf("mistyped = %v, want %v", mistyped, tt.wantMistyped)
+			}
+		})
+	}
+}
+
+// fields returns the Field of each problem.
+func fields(ps Problems) []string {
+	var out []string
+	for _, p := range ps {
+		out = append(out, p.Field)
+	}
+	return out
+}
+
+func TestBackupConfigValidate(t *testing.T) {
+	valid := func() BackupConfig {
+		return BackupConfig{DBType: "mysql", Port: 3306, DBName: "shop", Output: "shop.sql"}
+	}
+	tests := []struct {
+		name   string
+		change func(c *BackupConfig)
+		want   []string
+	}{
+		{"valid", func(c *BackupConfig) {}, nil},
+		{"empty", func(c *BackupConfig) { *c = BackupConfig{} }, []string{"dbType", "dbName", "port", "out"}},
+		{"unknown type", func(c *BackupConfig) { c.DBType = "oracle" }, []string{"dbType"}},
+		{"port range", func(c *BackupConfig) { c.Port = 70000 }, []string{"port"}},
+		{"timestamp instead of out", func(c *BackupConfig) { c.Output, c.UseTimestamp = "", true }, nil},
+		{"files needs paths, not a port", func(c *BackupConfig) { c.DBType, c.Port = "files", 0 }, []string{"paths"}},
+		{"files", func(c *BackupConfig) { c.DBType, c.Port, c.Paths = "files", 0, []string{"/srv"} }, nil},
+		{"encrypt without key", func(c *BackupConfig) { c.Encrypt = true }, []string{"encryptKey"}},
+		{"short key", func(c *BackupConfig) { c.EncryptKey = "short" }, []string{"encryptKey"}},
+		{"key", func(c *BackupConfig) { c.Encrypt, c.EncryptKey = true, strings.Repeat("k", 32) }, nil},
+		{"upload without bucket", func(c *BackupConfig) { c.UploadS3 = true }, []string{"s3Bucket", "s3Region"}},
+		{"bucket without region", func(c *BackupConfig) { c.S3Bucket = "b" }, []string{"s3Region"}},
+		{"negatives", func(c *BackupConfig) {
+			c.Parallelism, c.Threads, c.ChunkRows = -1, -1, -1
+			c.Compression.Level, c.Compression.Threads = -1, -1
+		}, []string{"parallelism", "threads", "chunkRows", "compression.level", "compression.threads"}},
+		{"nice", func(c *BackupConfig) { c.Throttle.Nice = 20 }, []string{"throttle.nice"}},
+		{"hooks", func(c *BackupConfig) {
+			c.Hooks.PreBackup = []Hook{{Command: "true"}, {}}
+			c.Hooks.OnFailure = []Hook{{Command: "true", URL: "http://x"}}
+			c.Hooks.PreBackupPolicy = "ignore"
+		}, []string{"hooks.preBackup[1]", "hooks.onFailure[0]", "hooks.preBackupPolicy"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.change(&c)
+			if got := fields(c.Validate()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems in %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		c    RestoreConfig
+		want []string
+	}{
+		{"valid", RestoreConfig{DBType: "mysql", Port: 3306, DBName: "shop", Input: "shop.sql"}, nil},
+		{"empty", RestoreConfig{}, []string{"dbType", "port", "dbName", "input"}},
+		{"repository instead of input", RestoreConfig{DBType: "mysql", Port: 3306, DBName: "shop", Repository: RepositoryConfig{URL: "/repo"}}, nil},
+		{"data dir needs no connection", RestoreConfig{DBType: "postgres", DataDir: "/var/lib/pg", Input: "base.tar"}, nil},
+		{"mssql data dir still connects", RestoreConfig{DBType: "mssql", DBName: "shop", DataDir: "/data", Input: "x.bak"}, []string{"port"}},
+		{"files needs target", RestoreConfig{DBType: "files", Input: "f.tar"}, []string{"target"}},
+		{"time and gtid", RestoreConfig{DBType: "mysql", Port: 3306, DBName: "shop", Input: "dir", ToTime: "2026-10-19 10:00:00", ToGTID: "x:1"}, []string{"toGtid"}},
+		{"key length", RestoreConfig{DBType: "mysql", Port: 3306, DBName: "shop", Input: "x", EncryptKey: "k"}, []string{"encryptKey"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fields(tt.c.Validate()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems in %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobsConfigValidate(t *testing.T) {
+	job := JobConfig{Name: "orders", Cron: "@daily", Config: "orders.json"}
+	tests := []struct {
+		name string
+		c    JobsConfig
+		want []string
+	}{
+		{"valid", JobsConfig{Jobs: []JobConfig{job}}, nil},
+		{"no jobs", JobsConfig{}, []string{"jobs"}},
+		{"missing settings", JobsConfig{Jobs: []JobConfig{{}}}, []string{"jobs[0].name", "jobs[0].cron", "jobs[0].config"}},
+		{"duplicate name", JobsConfig{Jobs: []JobConfig{job, job}}, []string{"jobs[1].name"}},
+		{"s3 lock", JobsConfig{Jobs: []JobConfig{job}, Lock: &LockConfig{Backend: "s3"}}, []string{"lock.s3Bucket"}},
+		{"mysql lock", JobsConfig{Jobs: []JobConfig{job}, Lock: &LockConfig{Backend: "mysql"}}, []string{"lock.dsn"}},
+		{"unknown lock", JobsConfig{Jobs: []JobConfig{job}, Lock: &LockConfig{Backend: "zookeeper"}}, []string{"lock.backend"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fields(tt.c.Validate()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems in %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBackup(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// A mistyped setting is reported once, not again by Validate.
+	path := write("mistyped.json", `{"dbType": "mysql", "port": "3306", "dbName": "shop", "out": "x.sql"}`)
+	_, problems, err := ReadBackup(path)
+	if err != nil {
+		t.Fatalf("ReadBackup: %v", err)
+	}
+	if got := fields(problems); !reflect.DeepEqual(got, []string{"port"}) {
+		t.Errorf("problems in %q, want [port]", got)
+	}
+
+	path = write("unknown.json", `{"dbType": "mysql", "port": 3306, "dbName": "", "out": "x.sql", "extra": 1}`)
+	if _, problems, _ = ReadBackup(path); !reflect.DeepEqual(fields(problems), []string{"extra", "dbName"}) {
+		t.Errorf("problems in %q, want [extra dbName]", fields(problems))
+	}
+	if _, err := LoadBackup(path); err == nil || !strings.Contains(err.Error(), "2 problems") {
+		t.Errorf("LoadBackup error = %v, want 2 problems", err)
+	}
+
+	if _, _, err := ReadBackup(write("bad.json", `{`)); err == nil {
+		t.Error("ReadBackup of invalid JSON succeeded")
+	}
+	if _, _, err := ReadBackup(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("ReadBackup of a missing file succeeded")
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"port", "port", 0},
+		{"dbtyp", "dbtype", 1},
+		{"form", "from", 2},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
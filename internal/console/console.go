@@ -0,0 +1,35 @@
+// Package console is where the human-readable text of a command goes.
+// Packages print with Println and Printf from here rather than fmt, so the
+// cli can keep stdout for JSON results, or drop the text with -quiet,
+// without touching os.Stdout.
+package console
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// writer boxes an io.Writer so that atomic.Value always holds one type.
+type writer struct{ io.Writer }
+
+var out atomic.Value
+
+func init() { out.Store(writer{os.Stdout}) }
+
+// Out returns where human text goes. Child processes whose output is
+// shown to the user get it as their stdout.
+func Out() io.Writer { return out.Load().(writer).Writer }
+
+// SetOut sends human text to w from now on.
+func SetOut(w io.Writer) { out.Store(writer{w}) }
+
+// Println prints like fmt.Println to Out.
+func Println(a ...any) { fmt.Fprintln(Out(), a...) }
+
+// Printf prints like fmt.Printf to Out.
+func Printf(format string, a ...any) { fmt.Fprintf(Out(), format, a...) }
+
+// Print prints like fmt.Print to Out.
+func Print(a ...any) { fmt.Fprint(Out(), a...) }
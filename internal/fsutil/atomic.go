@@ -0,0 +1,143 @@
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AtomicFile is written under a temporary name in the target directory and
+// only appears at its final path once Commit succeeds, so a crash or failed
+// run never leaves a truncated file that looks complete.
+type AtomicFile struct {
+	*os.File
+	path string
+	perm os.FileMode
+	done bool
+}
+
+// Create opens a temporary file next to path. Call Commit to fsync it and
+// rename it into place, or Abort to discard it; Abort after Commit is a no-op,
+// so it is safe to defer.
+func Create(path string, perm os.FileMode) (*AtomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file for %s: %w", path, err)
+	}
+	return &AtomicFile{File: f, path: path, perm: perm}, nil
+}
+
+// Commit flushes the file to disk and renames it to its final path.
+func (a *AtomicFile) Commit() error {
+	if a.done {
+		return fmt.Errorf("%s already committed or aborted", a.path)
+	}
+
+	if err := a.Sync(); err != nil {
+		a.Abort()
+		return fmt.Errorf("fsync %s: %w", a.Name(), err)
+	}
+	if err := a.Chmod(a.perm); err != nil {
+		a.Abort()
+		return fmt.Errorf("chmod %s: %w", a.Name(), err)
+	}
+	if err := a.Close(); err != nil {
+		a.Abort()
+		return fmt.Errorf("close %s: %w", a.Name(), err)
+	}
+	if err := os.Rename(a.Name(), a.path); err != nil {
+		a.Abort()
+		return fmt.Errorf("rename %s into place: %w", a.path, err)
+	}
+	a.done = true
+
+	syncDir(filepath.Dir(a.path))
+	return nil
+}
+
+// Abort closes and removes the temporary file.
+func (a *AtomicFile) Abort() {
+	if a.done {
+		return
+	}
+	a.done = true
+	a.Close()
+	os.Remove(a.Name())
+}
+
+// WriteFile atomically replaces path with data.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	f, err := Create(path, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return fmt.Errorf("write %s: %w", f.Name(), err)
+	}
+	return f.Commit()
+}
+
+// syncDir makes a rename durable. Errors are ignored: not every platform
+// supports fsync on directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// AtomicDir is a directory built under a temporary name next to its final
+// path and renamed into place by Commit, like AtomicFile.
+type AtomicDir struct {
+	Path string // temporary directory to write into
+	path string
+	done bool
+}
+
+// CreateDir creates a temporary directory next to path. Call Commit to
+// rename it into place, replacing any existing directory, or Abort to remove
+// it; Abort after Commit is a no-op, so it is safe to defer.
+func CreateDir(path string, perm os.FileMode) (*AtomicDir, error) {
+	tmp, err := os.MkdirTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir for %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		os.RemoveAll(tmp)
+		return nil, fmt.Errorf("chmod %s: %w", tmp, err)
+	}
+	return &AtomicDir{Path: tmp, path: path}, nil
+}
+
+// Commit renames the directory to its final path.
+func (a *AtomicDir) Commit() error {
+	if a.done {
+		return fmt.Errorf("%s already committed or aborted", a.path)
+	}
+
+	syncDir(a.Path)
+	if err := os.RemoveAll(a.path); err != nil {
+		a.Abort()
+		return fmt.Errorf("remove previous %s: %w", a.path, err)
+	}
+	if err := os.Rename(a.Path, a.path); err != nil {
+		a.Abort()
+		return fmt.Errorf("rename %s into place: %w", a.path, err)
+	}
+	a.done = true
+
+	syncDir(filepath.Dir(a.path))
+	return nil
+}
+
+// Abort removes the temporary directory and everything in it.
+func (a *AtomicDir) Abort() {
+	if a.done {
+		return
+	}
+	a.done = true
+	os.RemoveAll(a.Path)
+}
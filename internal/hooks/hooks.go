@@ -0,0 +1,162 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+)
+
+const defaultTimeout = 60 * time.Second
+
+// Stages a hook can run in.
+const (
+	StagePre     = "preBackup"
+	StagePost    = "postBackup"
+	StageFailure = "onFailure"
+)
+
+// Env describes the run a hook is executing for. It is exposed to commands as
+// DBBACKUP_* environment variables and to HTTP hooks as a JSON body.
+type Env struct {
+	Stage    string
+	Status   string // "running", "success" or "failure"
+	DBType   string
+	Host     string
+	Port     int
+	DBName   string
+	Artifact string // final local artifact, empty before the dump
+	Location string // s3:// URI if uploaded, otherwise Artifact
+	Error    string
+}
+
+// Vars returns the environment as DBBACKUP_* variables.
+func (e Env) Vars() map[string]string {
+	return map[string]string{
+		"DBBACKUP_STAGE":    e.Stage,
+		"DBBACKUP_STATUS":   e.Status,
+		"DBBACKUP_DB_TYPE":  e.DBType,
+		"DBBACKUP_HOST":     e.Host,
+		"DBBACKUP_PORT":     fmt.Sprint(e.Port),
+		"DBBACKUP_DB_NAME":  e.DBName,
+		"DBBACKUP_ARTIFACT": e.Artifact,
+		"DBBACKUP_LOCATION": e.Location,
+		"DBBACKUP_ERROR":    e.Error,
+	}
+}
+
+// Run executes hooks in order and stops at the first failure. Cancelling ctx
+// stops the running hook.
+func Run(ctx context.Context, hooks []config.Hook, env Env) error {
+	for i, h := range hooks {
+		name := h.Name
+		if name == "" {
+			name = fmt.Sprintf("%s[%d]", env.Stage, i)
+		}
+
+		logs.Info("Running hook %s", name)
+		start := time.Now()
+		if err := runOne(ctx, h, env); err != nil {
+			logs.Error("Hook %s failed after %s: %v", name, time.Since(start), err)
+			return fmt.Errorf("hook %s: %w", name, err)
+		}
+		logs.Info("Hook %s finished in %s", name, time.Since(start))
+	}
+	return nil
+}
+
+func runOne(ctx context.Context, h config.Hook, env Env) error {
+	timeout := defaultTimeout
+	if h.Timeout != "" {
+		d, err := time.ParseDuration(h.Timeout)
+		if err != nil {
+			return fmt.Errorf("parse timeout: %w", err)
+		}
+		timeout = d
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch {
+	case h.Command != "" && h.URL != "":
+		return fmt.Errorf("set either command or url, not both")
+	case h.Command != "":
+		return runCommand(ctx, h.Command, env)
+	case h.URL != "":
+		return callURL(ctx, h, env)
+	default:
+		return fmt.Errorf("hook has neither command nor url")
+	}
+}
+
+func runCommand(ctx context.Context, command string, env Env) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	cmd.Env = os.Environ()
+	for k, v := range env.Vars() {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdout = console.Out()
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("command timed out: %w", ctx.Err())
+		}
+		return fmt.Errorf("command failed: %w", err)
+	}
+	return nil
+}
+
+func callURL(ctx context.Context, h config.Hook, env Env) error {
+	method := strings.ToUpper(h.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if method != http.MethodGet && method != http.MethodHead {
+		data, err := json.Marshal(env.Vars())
+		if err != nil {
+			return fmt.Errorf("encode hook body: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, h.URL, body)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, h.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", method, h.URL, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+)
+
+var testEnv = Env{
+	Stage:    StageFailure,
+	Status:   "failure",
+	DBType:   "postgres",
+	Host:     "db1",
+	Port:     5432,
+	DBName:   "shop",
+	Artifact: "/var/backups/shop.dump.gz",
+	Location: "s3://backups/shop.dump.gz",
+	Error:    "dump: connection refused",
+}
+
+func skipWindows(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("command hooks are tested with sh")
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	skipWindows(t)
+	out := filepath.Join(t.TempDir(), "env")
+	// The hook sees the run as DBBACKUP_* variables on top of the
+	// scheduler's own environment.
+	t.Setenv("HOOK_OUT", out)
+	hook := config.Hook{Command: `env | grep '^DBBACKUP_' | sort > "$HOOK_OUT"`}
+	if err := Run(context.Background(), []config.Hook{hook}, testEnv); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `DBBACKUP_ARTIFACT=/var/backups/shop.dump.gz
+DBBACKUP_DB_NAME=shop
+DBBACKUP_DB_TYPE=postgres
+DBBACKUP_ERROR=dump: connection refused
+DBBACKUP_HOST=db1
+DBBACKUP_LOCATION=s3://backups/shop.dump.gz
+DBBACKUP_PORT=5432
+DBBACKUP_STAGE=onFailure
+DBBACKUP_STATUS=failure
+`
+	if string(data) != want {
+		t.Errorf("hook environment:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestRunStopsAtFirstFailure(t *testing.T) {
+	skipWindows(t)
+	dir := t.TempDir()
+	hooks := []config.Hook{
+		{Command: "touch first", Name: "first"},
+		{Command: "exit 3"},
+		{Command: "touch third"},
+	}
+	for i := range hooks {
+		hooks[i].Command = "cd " + dir + " && " + hooks[i].Command
+	}
+
+	err := Run(context.Background(), hooks, Env{Stage: StagePre})
+	if err == nil || !strings.Contains(err.Error(), "hook preBackup[1]") || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("Run error = %v, want the failing hook and its exit status", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "first")); err != nil {
+		t.Error("the hook before the failure did not run")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "third")); err == nil {
+		t.Error("a hook after the failure ran")
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	skipWindows(t)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		hook    config.Hook
+		wantErr string
+	}{
+		{"timeout", context.Background(), config.Hook{Command: "exec sleep 5", Timeout: "100ms"}, "timed out"},
+		{"bad timeout", context.Background(), config.Hook{Command: "true", Timeout: "soon"}, "parse timeout"},
+		{"command and url", context.Background(), config.Hook{Command: "true", URL: "http://localhost"}, "not both"},
+		{"empty", context.Background(), config.Hook{}, "neither"},
+		{"cancelled run", cancelled, config.Hook{Command: "true"}, "command failed"},
+		{"named", context.Background(), config.Hook{Name: "notify-pager", Command: "false"}, "hook notify-pager:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			err := Run(tt.ctx, []config.Hook{tt.hook}, Env{Stage: StagePost})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Run error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if d := time.Since(start); d > 3*time.Second {
+				t.Errorf("Run took %s", d)
+			}
+		})
+	}
+}
+
+func TestURLHook(t *testing.T) {
+	var (
+		method, contentType string
+		body                []byte
+	)
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, contentType = r.Method, r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		io.WriteString(w, "  maintenance window  \n")
+	}))
+	defer srv.Close()
+
+	// GET is the default and carries no body.
+	if err := Run(context.Background(), []config.Hook{{URL: srv.URL}}, testEnv); err != nil {
+		t.Fatalf("GET hook: %v", err)
+	}
+	if method != http.MethodGet || len(body) != 0 || contentType != "" {
+		t.Errorf("GET hook sent %s with %q (%s)", method, body, contentType)
+	}
+
+	// Other methods send the run as JSON.
+	if err := Run(context.Background(), []config.Hook{{URL: srv.URL, Method: "post"}}, testEnv); err != nil {
+		t.Fatalf("POST hook: %v", err)
+	}
+	if method != http.MethodPost || contentType != "application/json" {
+		t.Errorf("POST hook sent %s (%s)", method, contentType)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("POST body %s: %v", body, err)
+	}
+	for k, v := range testEnv.Vars() {
+		if got[k] != v {
+			t.Errorf("POST body %s = %q, want %q", k, got[k], v)
+		}
+	}
+
+	status = http.StatusServiceUnavailable
+	err := Run(context.Background(), []config.Hook{{URL: srv.URL}}, testEnv)
+	if err == nil || !strings.Contains(err.Error(), "503") || !strings.HasSuffix(err.Error(), ": maintenance window") {
+		t.Errorf("Run error = %v, want the status and trimmed body", err)
+	}
+}
@@ -0,0 +1,207 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+)
+
+const (
+	defaultName = "db-backup-cli-scheduler"
+	defaultTTL  = 60 * time.Second
+)
+
+// ErrHeld reports that another live holder owns the lock.
+var ErrHeld = errors.New("lock held by another holder")
+
+// ErrLost reports that a held lock is known to be gone, so renewing it
+// again cannot help.
+var ErrLost = errors.New("lock lost")
+
+// Backend takes and keeps a single named lock.
+type Backend interface {
+	// Acquire tries once to take the lock, returning ErrHeld if another live
+	// holder owns it.
+	Acquire(ctx context.Context) error
+	// Renew extends the lease. An error wrapping ErrLost means the lock is
+	// gone; after any other error the lock may still be held until the
+	// lease runs out.
+	Renew(ctx context.Context) error
+	// Release gives the lock up so a standby can take over immediately.
+	Release(ctx context.Context) error
+	Close() error
+}
+
+// Elector keeps trying to hold a lock shared by several scheduler hosts and
+// reports whether this process is currently the leader. The leader renews its
+// lease every TTL/3; if it dies, a standby takes over once the lease lapses.
+// A renewal that fails is retried on the next tick, and leadership is given
+// up only when the lease would run out before another attempt.
+type Elector struct {
+	backend Backend
+	name    string
+	ttl     time.Duration
+	renewed time.Time // when the last successful acquire or renewal began
+
+	mu        sync.Mutex
+	leaderCtx context.Context
+	cancel    context.CancelFunc
+}
+
+// New builds an Elector from config.
+func New(cfg config.LockConfig) (*Elector, error) {
+	name := cfg.Name
+	if name == "" {
+		name = defaultName
+	}
+
+	ttl := defaultTTL
+	if cfg.TTL != "" {
+		d, err := time.ParseDuration(cfg.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("parse lock ttl: %w", err)
+		}
+		if d < 3*time.Second {
+			return nil, fmt.Errorf("lock ttl must be at least 3s, got %s", d)
+		}
+		ttl = d
+	}
+
+	holder := holderID()
+
+	var (
+		backend Backend
+		err     error
+	)
+	switch cfg.Backend {
+	case "s3":
+		backend, err = newS3(cfg, name, holder, ttl)
+	case "mysql":
+		backend, err = newMySQL(cfg, name)
+	case "postgres":
+		backend, err = newPostgres(cfg, name)
+	default:
+		return nil, fmt.Errorf("unknown lock backend %q (want s3, mysql or postgres)", cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Elector{backend: backend, name: name, ttl: ttl}, nil
+}
+
+// Leader returns a context that stays valid while this process holds the
+// lock, and whether it holds it now.
+func (e *Elector) Leader() (context.Context, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.leaderCtx == nil || e.leaderCtx.Err() != nil {
+		return nil, false
+	}
+	return e.leaderCtx, true
+}
+
+// Start makes a first attempt to take the lock, then keeps acquiring or
+// renewing it in the background until ctx is cancelled, when the lock is
+// released.
+func (e *Elector) Start(ctx context.Context) {
+	e.tick(ctx)
+
+	go func() {
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				e.stop()
+				return
+			case <-ticker.C:
+				e.tick(ctx)
+			}
+		}
+	}()
+}
+
+func (e *Elector) tick(ctx context.Context) {
+	opCtx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	defer cancel()
+	start := time.Now()
+
+	if _, leader := e.Leader(); leader {
+		err := e.backend.Renew(opCtx)
+		switch {
+		case err == nil:
+			e.renewed = start
+		case errors.Is(err, ErrLost) || time.Now().Add(e.ttl/3).After(e.renewed.Add(e.ttl)):
+			console.Println("Lost scheduler lock", e.name+":", err)
+			logs.Error("Lost scheduler lock %s: %v", e.name, err)
+			e.setLeader(ctx, false)
+		default:
+			logs.Error("Could not renew scheduler lock %s, lease runs until %s: %v",
+				e.name, e.renewed.Add(e.ttl).Format(time.RFC3339), err)
+		}
+		return
+	}
+
+	err := e.backend.Acquire(opCtx)
+	switch {
+	case err == nil:
+		console.Println("Acquired scheduler lock", e.name, "- this host runs the jobs")
+		logs.Info("Acquired scheduler lock %s as %s", e.name, holderID())
+		e.renewed = start
+		e.setLeader(ctx, true)
+	case errors.Is(err, ErrHeld):
+		logs.Info("Scheduler lock %s is held elsewhere; standing by", e.name)
+	default:
+		logs.Error("Could not acquire scheduler lock %s: %v", e.name, err)
+	}
+}
+
+func (e *Elector) setLeader(ctx context.Context, leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cancel != nil {
+		e.cancel()
+		e.leaderCtx, e.cancel = nil, nil
+	}
+	if leader {
+		e.leaderCtx, e.cancel = context.WithCancel(ctx)
+	}
+}
+
+func (e *Elector) stop() {
+	// The leader context ends with the one passed to Start, so ask whether
+	// there is one rather than whether it is still live.
+	e.mu.Lock()
+	leader := e.cancel != nil
+	e.mu.Unlock()
+	e.setLeader(context.Background(), false)
+
+	if leader {
+		ctx, cancel := context.WithTimeout(context.Background(), e.ttl/3)
+		if err := e.backend.Release(ctx); err != nil {
+			logs.Error("Could not release scheduler lock %s: %v", e.name, err)
+		} else {
+			logs.Info("Released scheduler lock %s", e.name)
+		}
+		cancel()
+	}
+
+	e.backend.Close()
+}
+
+func holderID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
@@ -0,0 +1,228 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+)
+
+func TestMain(m *testing.M) {
+	console.SetOut(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeBackend returns the next queued error from each call, or nil once
+// the queue is empty, and counts the calls.
+type fakeBackend struct {
+	mu                                 sync.Mutex
+	acquireErrs, renewErrs             []error
+	acquires, renews, releases, closes int
+}
+
+func (f *fakeBackend) Acquire(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.acquires++
+	return pop(&f.acquireErrs)
+}
+
+func (f *fakeBackend) Renew(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.renews++
+	return pop(&f.renewErrs)
+}
+
+func (f *fakeBackend) Release(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.releases++
+	return nil
+}
+
+func (f *fakeBackend) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closes++
+	return nil
+}
+
+func pop(errs *[]error) error {
+	if len(*errs) == 0 {
+		return nil
+	}
+	err := (*errs)[0]
+	*errs = (*errs)[1:]
+	return err
+}
+
+func TestElectorAcquire(t *testing.T) {
+	tests := []struct {
+		name       string
+		errs       []error
+		wantLeader []bool // after each tick
+	}{
+		{"free", nil, []bool{true}},
+		{"held elsewhere", []error{ErrHeld, ErrHeld}, []bool{false, false, true}},
+		{"backend down", []error{errors.New("connection refused")}, []bool{false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &fakeBackend{acquireErrs: tt.errs}
+			e := &Elector{backend: b, name: "test", ttl: time.Minute}
+			for i, want := range tt.wantLeader {
+				e.tick(context.Background())
+				if _, leader := e.Leader(); leader != want {
+					t.Fatalf("tick %d: leader = %v, want %v", i, leader, want)
+				}
+			}
+			if b.acquires != len(tt.wantLeader) || b.renews != 0 {
+				t.Errorf("%d acquires and %d renewals, want %d and 0", b.acquires, b.renews, len(tt.wantLeader))
+			}
+		})
+	}
+}
+
+func TestElectorRenewFailure(t *testing.T) {
+	const ttl = time.Minute
+	transient := errors.New("timeout")
+	tests := []struct {
+		name       string
+		age        time.Duration // since the last successful renewal
+		err        error
+		wantLeader bool
+	}{
+		{"renewed", ttl / 3, nil, true},
+		{"transient, lease has time left", ttl / 3, transient, true},
+		{"transient, lease runs out before the next tick", ttl * 2 / 3, transient, false},
+		{"transient, lease expired", 2 * ttl, transient, false},
+		{"lost", 0, ErrLost, false},
+		{"lost, wrapped", 0, errors.Join(errors.New("check lock"), ErrLost), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &fakeBackend{}
+			e := &Elector{backend: b, name: "test", ttl: ttl}
+			e.tick(context.Background())
+			leaderCtx, ok := e.Leader()
+			if !ok {
+				t.Fatal("not leader after acquiring")
+			}
+
+			e.renewed = time.Now().Add(-tt.age)
+			b.renewErrs = []error{tt.err}
+			e.tick(context.Background())
+			if _, leader := e.Leader(); leader != tt.wantLeader {
+				t.Fatalf("leader = %v, want %v", leader, tt.wantLeader)
+			}
+			// Jobs run under the leader context, so losing the lock stops them.
+			if cancelled := leaderCtx.Err() != nil; cancelled == tt.wantLeader {
+				t.Errorf("leader context cancelled = %v, want %v", cancelled, !tt.wantLeader)
+			}
+			if b.renews != 1 {
+				t.Errorf("%d renewals, want 1", b.renews)
+			}
+		})
+	}
+}
+
+func TestElectorRetriesRenewal(t *testing.T) {
+	b := &fakeBackend{}
+	e := &Elector{backend: b, name: "test", ttl: time.Minute}
+	e.tick(context.Background())
+	leaderCtx, _ := e.Leader()
+
+	// One failed renewal is retried on the next tick, and a success
+	// restarts the lease.
+	b.renewErrs = []error{errors.New("timeout"), nil}
+	e.tick(context.Background())
+	before := e.renewed
+	e.tick(context.Background())
+	if _, leader := e.Leader(); !leader || leaderCtx.Err() != nil {
+		t.Fatal("lost leadership over one failed renewal")
+	}
+	if !e.renewed.After(before) {
+		t.Error("a successful renewal did not restart the lease")
+	}
+}
+
+func TestElectorRelease(t *testing.T) {
+	tests := []struct {
+		name         string
+		acquireErrs  []error
+		wantReleases int
+	}{
+		{"leader", nil, 1},
+		{"standby", []error{ErrHeld}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &fakeBackend{acquireErrs: tt.acquireErrs}
+			e := &Elector{backend: b, name: "test", ttl: time.Hour}
+			ctx, cancel := context.WithCancel(context.Background())
+			e.Start(ctx)
+			leaderCtx, _ := e.Leader()
+			cancel()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				b.mu.Lock()
+				closes, releases := b.closes, b.releases
+				b.mu.Unlock()
+				if closes > 0 {
+					if releases != tt.wantReleases {
+						t.Errorf("%d releases, want %d", releases, tt.wantReleases)
+					}
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("backend not closed after the context was cancelled")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if _, leader := e.Leader(); leader {
+				t.Error("still leader after stopping")
+			}
+			if leaderCtx != nil && leaderCtx.Err() == nil {
+				t.Error("leader context not cancelled after stopping")
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.LockConfig
+		wantTTL time.Duration
+		wantErr bool
+	}{
+		{"default ttl", config.LockConfig{Backend: "mysql", DSN: "u:p@tcp(db:3306)/"}, defaultTTL, false},
+		{"ttl", config.LockConfig{Backend: "postgres", DSN: "postgres://db/x", TTL: "30s"}, 30 * time.Second, false},
+		{"short ttl", config.LockConfig{Backend: "mysql", DSN: "u:p@tcp(db:3306)/", TTL: "1s"}, 0, true},
+		{"bad ttl", config.LockConfig{Backend: "mysql", DSN: "u:p@tcp(db:3306)/", TTL: "soon"}, 0, true},
+		{"unknown backend", config.LockConfig{Backend: "zookeeper"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer e.backend.Close()
+			if e.ttl != tt.wantTTL || e.name != defaultName {
+				t.Errorf("ttl %s, name %q, want %s, %q", e.ttl, e.name, tt.wantTTL, defaultName)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+)
+
+// s3Lock is a lease stored as a JSON object and updated only with
+// conditional writes: If-None-Match to create it, If-Match on the last seen
+// ETag to renew it or take over an expired lease. Hosts' clocks must agree to
+// well within the TTL.
+type s3Lock struct {
+	client *s3.Client
+	bucket string
+	key    string
+	holder string
+	ttl    time.Duration
+	etag   *string
+}
+
+type lease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func newS3(cfg config.LockConfig, name, holder string, ttl time.Duration) (*s3Lock, error) {
+	if cfg.S3Bucket == "" || cfg.S3Region == "" {
+		return nil, fmt.Errorf("s3 lock requires s3Bucket and s3Region")
+	}
+
+	key := cfg.S3Key
+	if key == "" {
+		key = "locks/" + name + ".json"
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(cfg.S3Region))
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+
+	return &s3Lock{
+		client: s3.NewFromConfig(awsCfg),
+		bucket: cfg.S3Bucket,
+		key:    key,
+		holder: holder,
+		ttl:    ttl,
+	}, nil
+}
+
+func (l *s3Lock) Acquire(ctx context.Context) error {
+	out, err := l.client.GetObject(ctx, &s3.GetObjectInput{Bucket: &l.bucket, Key: &l.key})
+	if isStatus(err, http.StatusNotFound) {
+		return l.put(ctx, nil, aws.String("*"), time.Now().Add(l.ttl))
+	}
+	if err != nil {
+		return fmt.Errorf("read lock object: %w", err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return fmt.Errorf("read lock object: %w", err)
+	}
+
+	var current lease
+	if err := json.Unmarshal(data, &current); err != nil {
+		return fmt.Errorf("parse lock object: %w", err)
+	}
+	if current.Holder != l.holder && time.Now().Before(current.ExpiresAt) {
+		return ErrHeld
+	}
+
+	// Expired (or ours from before): take over, but only if nobody else
+	// wrote the object since we read it.
+	return l.put(ctx, out.ETag, nil, time.Now().Add(l.ttl))
+}
+
+// Renew fails with ErrLost if another holder has written the object since
+// our last write; other failures leave the lease to run out.
+func (l *s3Lock) Renew(ctx context.Context) error {
+	if l.etag == nil {
+		return fmt.Errorf("%w: not held", ErrLost)
+	}
+	err := l.put(ctx, l.etag, nil, time.Now().Add(l.ttl))
+	if errors.Is(err, ErrHeld) {
+		return fmt.Errorf("%w: taken over by another holder", ErrLost)
+	}
+	return err
+}
+
+// Release expires the lease instead of deleting it, so the write can still be
+// made conditional on our ETag.
+func (l *s3Lock) Release(ctx context.Context) error {
+	if l.etag == nil {
+		return nil
+	}
+	err := l.put(ctx, l.etag, nil, time.Now())
+	l.etag = nil
+	return err
+}
+
+func (l *s3Lock) Close() error {
+	return nil
+}
+
+func (l *s3Lock) put(ctx context.Context, ifMatch, ifNoneMatch *string, expires time.Time) error {
+	body, err := json.Marshal(lease{Holder: l.holder, ExpiresAt: expires})
+	if err != nil {
+		return fmt.Errorf("encode lock object: %w", err)
+	}
+
+	out, err := l.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &l.bucket,
+		Key:         &l.key,
+		Body:        strings.NewReader(string(body)),
+		ContentType: aws.String("application/json"),
+		IfMatch:     ifMatch,
+		IfNoneMatch: ifNoneMatch,
+	})
+	if isStatus(err, http.StatusPreconditionFailed) || isStatus(err, http.StatusConflict) {
+		l.etag = nil
+		return ErrHeld
+	}
+	if err != nil {
+		return fmt.Errorf("write lock object: %w", err)
+	}
+
+	l.etag = out.ETag
+	return nil
+}
+
+// isStatus reports whether err is an S3 response with the given HTTP status.
+func isStatus(err error, status int) bool {
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode() == status
+	}
+	var apiErr smithy.APIError
+	if status == http.StatusNotFound && errors.As(err, &apiErr) {
+		return apiErr.ErrorCode() == "NoSuchKey"
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+)
+
+// sqlLock holds a session-scoped lock on one dedicated connection. The server
+// releases it as soon as that session ends, so a dead holder is replaced
+// without waiting for a lease to expire.
+type sqlLock struct {
+	db   *sql.DB
+	conn *sql.Conn
+
+	acquireQuery string
+	checkQuery   string
+	releaseQuery string
+	arg          any
+}
+
+// newMySQL uses GET_LOCK(), which is held until RELEASE_LOCK() or the
+// session ends.
+func newMySQL(cfg config.LockConfig, name string) (*sqlLock, error) {
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("mysql lock requires dsn")
+	}
+	if len(name) > 64 {
+		return nil, fmt.Errorf("mysql lock name must be at most 64 characters")
+	}
+
+	db, err := sql.Open("mysql", cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("open mysql lock connection: %w", err)
+	}
+	db.SetMaxIdleConns(0)
+
+	return &sqlLock{
+		db:           db,
+		acquireQuery: "SELECT COALESCE(GET_LOCK(?, 0), 0)",
+		checkQuery:   "SELECT COALESCE(IS_USED_LOCK(?) = CONNECTION_ID(), 0)",
+		releaseQuery: "SELECT RELEASE_LOCK(?)",
+		arg:          name,
+	}, nil
+}
+
+// newPostgres uses a session-level advisory lock keyed by a hash of name.
+func newPostgres(cfg config.LockConfig, name string) (*sqlLock, error) {
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("postgres lock requires dsn")
+	}
+
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres lock connection: %w", err)
+	}
+	db.SetMaxIdleConns(0)
+
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	key := int64(h.Sum64())
+
+	return &sqlLock{
+		db:           db,
+		acquireQuery: "SELECT pg_try_advisory_lock($1)",
+		checkQuery: "SELECT EXISTS (SELECT 1 FROM pg_locks WHERE locktype = 'advisory' AND granted " +
+			"AND pid = pg_backend_pid() AND objsubid = 1 AND ((classid::bigint << 32) | objid::bigint) = $1)",
+		releaseQuery: "SELECT pg_advisory_unlock($1)",
+		arg:          key,
+	}, nil
+}
+
+func (l *sqlLock) Acquire(ctx context.Context) error {
+	if l.conn == nil {
+		conn, err := l.db.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("connect for lock: %w", err)
+		}
+		l.conn = conn
+	}
+
+	var ok bool
+	if err := l.conn.QueryRowContext(ctx, l.acquireQuery, l.arg).Scan(&ok); err != nil {
+		l.dropConn()
+		return fmt.Errorf("acquire lock: %w", err)
+	}
+	if !ok {
+		return ErrHeld
+	}
+	return nil
+}
+
+// Renew checks that the session still holds the lock. There is no lease to
+// outlive the session, so every failure is ErrLost: a session that cannot
+// be queried is dropped, which releases the lock.
+func (l *sqlLock) Renew(ctx context.Context) error {
+	if l.conn == nil {
+		return fmt.Errorf("%w: lock connection closed", ErrLost)
+	}
+
+	var held bool
+	if err := l.conn.QueryRowContext(ctx, l.checkQuery, l.arg).Scan(&held); err != nil {
+		l.dropConn()
+		return fmt.Errorf("%w: check lock: %w", ErrLost, err)
+	}
+	if !held {
+		return fmt.Errorf("%w: no longer held by this session", ErrLost)
+	}
+	return nil
+}
+
+func (l *sqlLock) Release(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+	_, err := l.conn.ExecContext(ctx, l.releaseQuery, l.arg)
+	l.dropConn()
+	if err != nil {
+		return fmt.Errorf("release lock: %w", err)
+	}
+	return nil
+}
+
+func (l *sqlLock) Close() error {
+	l.dropConn()
+	return l.db.Close()
+}
+
+// dropConn discards the session. With no idle connections kept, closing it
+// ends the session and the server releases any lock it held.
+func (l *sqlLock) dropConn() {
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Metric names shared by one-shot runs and the long-running scheduler.
+const (
+	LastRunTimestamp     = "dbbackup_last_run_timestamp_seconds"
+	LastSuccessTimestamp = "dbbackup_last_success_timestamp_seconds"
+	LastRunSuccess       = "dbbackup_last_run_success"
+	LastRunDuration      = "dbbackup_last_run_duration_seconds"
+	LastArtifactSize     = "dbbackup_last_artifact_size_bytes"
+)
+
+var help = map[string]string{
+	LastRunTimestamp:     "Unix time the last run finished.",
+	LastSuccessTimestamp: "Unix time the last successful run finished.",
+	LastRunSuccess:       "Whether the last run succeeded (1) or failed (0).",
+	LastRunDuration:      "Duration of the last run in seconds.",
+	LastArtifactSize:     "Size in bytes of the final artifact of the last run.",
+}
+
+// Run describes the outcome of a single backup or restore.
+type Run struct {
+	Operation string // "backup" or "restore"
+	DBName    string
+	Start     time.Time
+	End       time.Time
+	Success   bool
+	SizeBytes int64
+}
+
+// Labels returns the label set identifying this run's series.
+func (r Run) Labels() string {
+	return fmt.Sprintf(`{operation=%q,db=%q}`, r.Operation, r.DBName)
+}
+
+// Render returns the run in Prometheus text exposition format.
+// lastSuccess is emitted as LastSuccessTimestamp when the run itself failed;
+// pass the zero time to omit it.
+func (r Run) Render(lastSuccess time.Time) []byte {
+	if r.Success {
+		lastSuccess = r.End
+	}
+
+	var buf bytes.Buffer
+	labels := r.Labels()
+
+	writeGauge(&buf, LastRunTimestamp, labels, float64(r.End.Unix()))
+	writeGauge(&buf, LastRunSuccess, labels, boolToFloat(r.Success))
+	writeGauge(&buf, LastRunDuration, labels, r.End.Sub(r.Start).Seconds())
+	if r.Success {
+		writeGauge(&buf, LastArtifactSize, labels, float64(r.SizeBytes))
+	}
+	if !lastSuccess.IsZero() {
+		writeGauge(&buf, LastSuccessTimestamp, labels, float64(lastSuccess.Unix()))
+	}
+
+	return buf.Bytes()
+}
+
+func writeGauge(buf *bytes.Buffer, name, labels string, value float64) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help[name])
+	fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+	fmt.Fprintf(buf, "%s%s %s\n", name, labels, formatValue(value))
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	start = time.Unix(1792400000, 0)
+	end   = start.Add(90*time.Second + 500*time.Millisecond)
+)
+
+func TestRender(t *testing.T) {
+	ok := Run{Operation: "backup", DBName: "shop", Start: start, End: end, Success: true, SizeBytes: 1 << 20}
+	want := `# HELP dbbackup_last_run_timestamp_seconds Unix time the last run finished.
+# TYPE dbbackup_last_run_timestamp_seconds gauge
+dbbackup_last_run_timestamp_seconds{operation="backup",db="shop"} 1792400090
+# HELP dbbackup_last_run_success Whether the last run succeeded (1) or failed (0).
+# TYPE dbbackup_last_run_success gauge
+dbbackup_last_run_success{operation="backup",db="shop"} 1
+# HELP dbbackup_last_run_duration_seconds Duration of the last run in seconds.
+# TYPE dbbackup_last_run_duration_seconds gauge
+dbbackup_last_run_duration_seconds{operation="backup",db="shop"} 90.5
+# HELP dbbackup_last_artifact_size_bytes Size in bytes of the final artifact of the last run.
+# TYPE dbbackup_last_artifact_size_bytes gauge
+dbbackup_last_artifact_size_bytes{operation="backup",db="shop"} 1048576
+# HELP dbbackup_last_success_timestamp_seconds Unix time the last successful run finished.
+# TYPE dbbackup_last_success_timestamp_seconds gauge
+dbbackup_last_success_timestamp_seconds{operation="backup",db="shop"} 1792400090
+`
+	// A successful run is its own last success, whatever is passed.
+	if got := string(ok.Render(start.Add(-time.Hour))); got != want {
+		t.Errorf("Render of a success:\n%s\nwant:\n%s", got, want)
+	}
+
+	failed := Run{Operation: "restore", DBName: `we"ird`, Start: start, End: end}
+	got := string(failed.Render(time.Time{}))
+	for _, line := range []string{
+		`dbbackup_last_run_success{operation="restore",db="we\"ird"} 0`,
+		`dbbackup_last_run_duration_seconds{operation="restore",db="we\"ird"} 90.5`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("Render of a failure lacks %q:\n%s", line, got)
+		}
+	}
+	for _, name := range []string{LastArtifactSize, LastSuccessTimestamp} {
+		if strings.Contains(got, name) {
+			t.Errorf("Render of a failure with no earlier success has %s:\n%s", name, got)
+		}
+	}
+
+	got = string(failed.Render(start.Add(-time.Hour)))
+	if line := `dbbackup_last_success_timestamp_seconds{operation="restore",db="we\"ird"} 1792396400`; !strings.Contains(got, line+"\n") {
+		t.Errorf("Render of a failure lacks the earlier success %q:\n%s", line, got)
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dbbackup.prom")
+	success := LastSuccessTimestamp + `{operation="backup",db="shop"} `
+
+	// A failure with no earlier file has no last success.
+	failed := Run{Operation: "backup", DBName: "shop", Start: start, End: end}
+	if err := WriteTextfile(path, failed); err != nil {
+		t.Fatalf("WriteTextfile: %v", err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), success) {
+		t.Errorf("first failure wrote a last success:\n%s", data)
+	}
+
+	ok := Run{Operation: "backup", DBName: "shop", Start: start, End: end, Success: true, SizeBytes: 42}
+	if err := WriteTextfile(path, ok); err != nil {
+		t.Fatalf("WriteTextfile: %v", err)
+	}
+
+	// A later failure keeps the success time, so alerts on backup age
+	// keep working, but drops the size.
+	failed.Start, failed.End = end.Add(time.Hour), end.Add(time.Hour+time.Second)
+	if err := WriteTextfile(path, failed); err != nil {
+		t.Fatalf("WriteTextfile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	if !strings.Contains(text, success+"1792400090\n") {
+		t.Errorf("failure did not carry over the last success:\n%s", text)
+	}
+	if !strings.Contains(text, LastRunSuccess+`{operation="backup",db="shop"} 0`+"\n") {
+		t.Errorf("failure not recorded:\n%s", text)
+	}
+	if strings.Contains(text, LastArtifactSize) {
+		t.Errorf("failure wrote an artifact size:\n%s", text)
+	}
+
+	// Only the same series counts as an earlier success.
+	other := Run{Operation: "backup", DBName: "billing", Start: start, End: end}
+	if err := WriteTextfile(path, other); err != nil {
+		t.Fatalf("WriteTextfile: %v", err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), LastSuccessTimestamp+"{") {
+		t.Errorf("another database's success was carried over:\n%s", data)
+	}
+
+	if err := WriteTextfile(filepath.Join(t.TempDir(), "missing", "x.prom"), ok); err == nil {
+		t.Error("WriteTextfile into a missing directory succeeded")
+	}
+}
+
+func TestPush(t *testing.T) {
+	var method, path, contentType, body string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, contentType, body = r.Method, r.URL.EscapedPath(), r.Header.Get("Content-Type"), string(data)
+		w.WriteHeader(status)
+		io.WriteString(w, "bad metric\n")
+	}))
+	defer srv.Close()
+
+	run := Run{Operation: "backup", DBName: "shop/eu", Start: start, End: end, Success: true, SizeBytes: 7}
+	if err := Push(srv.URL+"/", "", run); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	// POST rather than PUT keeps the last success pushed by earlier runs.
+	if method != http.MethodPost {
+		t.Errorf("method = %s, want POST", method)
+	}
+	if want := "/metrics/job/db-backup-cli/operation/backup/db/shop%2Feu"; path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+	if !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("content type = %q, want text/plain", contentType)
+	}
+	if body != string(run.Render(time.Time{})) {
+		t.Errorf("body = %q, want the rendered run", body)
+	}
+
+	status = http.StatusBadRequest
+	err := Push(srv.URL, "nightly", run)
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "bad metric") {
+		t.Errorf("Push error = %v, want the status and body", err)
+	}
+	if !strings.HasPrefix(path, "/metrics/job/nightly/") {
+		t.Errorf("path = %s, want the nightly job", path)
+	}
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const pushTimeout = 10 * time.Second
+
+// Push sends the run to a Prometheus Pushgateway under the given job name.
+// It uses POST so that a failed run does not wipe the last-success sample
+// pushed by an earlier successful run.
+func Push(gatewayURL, job string, r Run) error {
+	if job == "" {
+		job = "db-backup-cli"
+	}
+
+	endpoint := strings.TrimRight(gatewayURL, "/") +
+		"/metrics/job/" + url.PathEscape(job) +
+		"/operation/" + url.PathEscape(r.Operation) +
+		"/db/" + url.PathEscape(r.DBName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(r.Render(time.Time{})))
+	if err != nil {
+		return fmt.Errorf("build pushgateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("push to pushgateway: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
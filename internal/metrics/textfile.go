@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+)
+
+// WriteTextfile atomically writes the run to a node_exporter textfile-collector
+// .prom file. On failure the previous last-success timestamp is carried over
+// from the existing file so alerts on backup age keep working.
+func WriteTextfile(path string, r Run) error {
+	var lastSuccess time.Time
+	if !r.Success {
+		lastSuccess = previousSuccess(path, r)
+	}
+
+	if err := fsutil.WriteFile(path, r.Render(lastSuccess), 0644); err != nil {
+		return fmt.Errorf("write metrics textfile: %w", err)
+	}
+
+	return nil
+}
+
+// previousSuccess reads the last-success sample for r's series from an
+// existing textfile. It returns the zero time if none is found.
+func previousSuccess(path string, r Run) time.Time {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+
+	prefix := LastSuccessTimestamp + r.Labels() + " "
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimPrefix(line, prefix), 64)
+		if err != nil {
+			return time.Time{}
+		}
+		return time.Unix(int64(v), 0)
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// Event kinds a sink can subscribe to.
+const (
+	KindFailure  = "failure"  // a run failed
+	KindSuccess  = "success"  // a run succeeded (summary)
+	KindRecovery = "recovery" // first success after one or more failures
+)
+
+// Event describes the outcome of a backup run.
+type Event struct {
+	Kind      string        `json:"kind"`
+	Status    string        `json:"status"` // "success" or "failure"
+	DBType    string        `json:"dbType"`
+	DBName    string        `json:"dbName"`
+	Host      string        `json:"host"`
+	Hostname  string        `json:"hostname"` // machine running the backup
+	Location  string        `json:"location"` // final local path or s3:// URI
+	SizeBytes int64         `json:"sizeBytes"`
+	Duration  time.Duration `json:"-"`
+	Error     string        `json:"error,omitempty"`
+	Time      time.Time     `json:"time"`
+}
+
+// Size returns the artifact size in human-readable form.
+func (e Event) Size() string {
+	return formatBytes(e.SizeBytes)
+}
+
+// Took returns the run duration rounded for display.
+func (e Event) Took() string {
+	return e.Duration.Round(time.Millisecond).String()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+)
+
+const (
+	defaultStateFile = "notify-state.json"
+	defaultRetries   = 2
+	defaultTimeout   = 10 * time.Second
+
+	// Limits that bound how long Notify can hold up a run: at most
+	// (maxRetries+1) attempts of maxTimeout each, plus backoff of 1s, 2s,
+	// 4s, then maxBackoff between them, about six and a half minutes.
+	maxRetries = 5
+	maxTimeout = time.Minute
+	maxBackoff = 10 * time.Second
+)
+
+// sink delivers a rendered event to one destination.
+type sink interface {
+	name() string
+	send(ctx context.Context, ev Event) error
+}
+
+type subscribedSink struct {
+	sink
+	events map[string]bool
+}
+
+// Notifier fans events out to the configured sinks.
+type Notifier struct {
+	sinks     []subscribedSink
+	stateFile string
+	retries   int
+	timeout   time.Duration
+}
+
+// New builds a Notifier from config. It returns nil if no sinks are configured.
+func New(cfg config.NotifyConfig) (*Notifier, error) {
+	if len(cfg.Sinks) == 0 {
+		return nil, nil
+	}
+
+	n := &Notifier{
+		stateFile: cfg.StateFile,
+		retries:   cfg.Retries,
+		timeout:   defaultTimeout,
+	}
+	if n.stateFile == "" {
+		n.stateFile = defaultStateFile
+	}
+	if n.retries <= 0 {
+		n.retries = defaultRetries
+	}
+	if n.retries > maxRetries {
+		return nil, fmt.Errorf("notifications retries %d: at most %d", n.retries, maxRetries)
+	}
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("parse notifications timeout: %w", err)
+		}
+		if d <= 0 || d > maxTimeout {
+			return nil, fmt.Errorf("notifications timeout %s: want more than 0 and at most %s", d, maxTimeout)
+		}
+		n.timeout = d
+	}
+
+	for i, sc := range cfg.Sinks {
+		s, err := newSink(sc)
+		if err != nil {
+			return nil, fmt.Errorf("notification sink %d: %w", i, err)
+		}
+
+		events := map[string]bool{}
+		for _, e := range sc.Events {
+			switch e {
+			case KindFailure, KindSuccess, KindRecovery:
+				events[e] = true
+			default:
+				return nil, fmt.Errorf("notification sink %d: unknown event %q", i, e)
+			}
+		}
+		if len(events) == 0 {
+			events[KindFailure] = true
+		}
+
+		n.sinks = append(n.sinks, subscribedSink{sink: s, events: events})
+	}
+
+	return n, nil
+}
+
+func newSink(sc config.NotifySink) (sink, error) {
+	switch sc.Type {
+	case "webhook":
+		return newWebhook(sc)
+	case "slack":
+		return newSlack(sc)
+	case "email":
+		return newEmail(sc)
+	default:
+		return nil, fmt.Errorf("unknown type %q (want webhook, slack or email)", sc.Type)
+	}
+}
+
+// Notify classifies ev against the last recorded status for its database and
+// delivers it to every subscribed sink. Delivery runs concurrently with
+// retries; failures are logged and never returned, and the call returns once
+// every sink has finished or given up, which the limits above bound.
+//
+// Once ctx is cancelled, e.g. by SIGINT, no further retries are made, so an
+// interrupted run is held up by at most one attempt per sink.
+func (n *Notifier) Notify(ctx context.Context, ev Event) {
+	if n == nil {
+		return
+	}
+
+	kinds := []string{ev.Status}
+	previous := n.swapState(ev.DBName, ev.Status)
+	if ev.Status == KindSuccess && previous == KindFailure {
+		kinds = append(kinds, KindRecovery)
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range n.sinks {
+		kind := ""
+		for _, k := range kinds {
+			if s.events[k] {
+				kind = k
+			}
+		}
+		if kind == "" {
+			continue
+		}
+
+		e := ev
+		e.Kind = kind
+		wg.Add(1)
+		go func(s sink) {
+			defer wg.Done()
+			n.deliver(ctx, s, e)
+		}(s.sink)
+	}
+	wg.Wait()
+}
+
+func (n *Notifier) deliver(ctx context.Context, s sink, ev Event) {
+	backoff := time.Second
+	var err error
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			t := time.NewTimer(backoff)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				logs.Error("Notification via %s abandoned after %d attempts: %v", s.name(), attempt, ctx.Err())
+				console.Println("Warning: notification via", s.name(), "failed:", err)
+				return
+			}
+			backoff = min(backoff*2, maxBackoff)
+		}
+
+		// The first attempt outlives a cancelled ctx so that an
+		// interrupted run is still reported; its timeout bounds it.
+		parent := ctx
+		if attempt == 0 {
+			parent = context.WithoutCancel(ctx)
+		}
+		actx, cancel := context.WithTimeout(parent, n.timeout)
+		err = s.send(actx, ev)
+		cancel()
+		if err == nil {
+			logs.Info("Notification sent: sink=%s kind=%s db=%s", s.name(), ev.Kind, ev.DBName)
+			return
+		}
+		logs.Error("Notification attempt %d via %s failed: %v", attempt+1, s.name(), err)
+	}
+
+	console.Println("Warning: notification via", s.name(), "failed:", err)
+}
+
+// stateMu serializes state file updates from concurrently scheduled jobs.
+var stateMu sync.Mutex
+
+// swapState records status for db and returns the previously recorded one.
+// State problems are logged and treated as "no previous status".
+func (n *Notifier) swapState(db, status string) string {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	state := map[string]string{}
+	if data, err := os.ReadFile(n.stateFile); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			logs.Error("Could not parse notification state %s: %v", n.stateFile, err)
+			state = map[string]string{}
+		}
+	}
+
+	previous := state[db]
+	state[db] = status
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = fsutil.WriteFile(n.stateFile, data, 0644)
+	}
+	if err != nil {
+		logs.Error("Could not save notification state %s: %v", n.stateFile, err)
+	}
+
+	return previous
+}
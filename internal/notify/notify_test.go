@@ -0,0 +1,406 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+)
+
+func testEvent(status string) Event {
+	ev := Event{
+		Status:    status,
+		DBType:    "mysql",
+		DBName:    "shop",
+		Host:      "db1",
+		Hostname:  "backup-host",
+		Location:  "s3://backups/shop.sql.gz",
+		SizeBytes: 3 << 20,
+		Duration:  83*time.Second + 456789*time.Microsecond,
+		Time:      time.Date(2026, 10, 19, 2, 0, 0, 0, time.UTC),
+	}
+	if status == KindFailure {
+		ev.Kind, ev.Error, ev.SizeBytes, ev.Location = KindFailure, "dump: access denied", 0, ""
+	}
+	return ev
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{3 << 20, "3.0 MiB"},
+		{5 << 40, "5.0 TiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// capture is an HTTP endpoint that records the last request body.
+func capture(t *testing.T, status int) (url string, body func() []byte) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		last []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		last = data
+		mu.Unlock()
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("content type %q, want application/json", r.Header.Get("Content-Type"))
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, "no such channel")
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, func() []byte {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func TestSlackMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		ev       Event
+		want     string
+	}{
+		{
+			name: "success",
+			ev:   testEvent(KindSuccess),
+			want: "Backup of shop on db1 succeeded in 1m23.457s (3.0 MiB): s3://backups/shop.sql.gz",
+		},
+		{
+			name: "failure",
+			ev:   testEvent(KindFailure),
+			want: "Backup of shop on db1 FAILED after 1m23.457s: dump: access denied",
+		},
+		{
+			name:     "custom template",
+			template: "{{.Kind}} {{.DBType}}/{{.DBName}} from {{.Hostname}}",
+			ev:       testEvent(KindFailure),
+			want:     "failure mysql/shop from backup-host",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, body := capture(t, http.StatusOK)
+			s, err := newSlack(config.NotifySink{Type: "slack", URL: url, Template: tt.template})
+			if err != nil {
+				t.Fatalf("newSlack: %v", err)
+			}
+			if err := s.send(context.Background(), tt.ev); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			var got map[string]string
+			if err := json.Unmarshal(body(), &got); err != nil {
+				t.Fatalf("payload %s: %v", body(), err)
+			}
+			if len(got) != 1 || got["text"] != tt.want {
+				t.Errorf("payload = %v, want text %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookPayload(t *testing.T) {
+	url, body := capture(t, http.StatusOK)
+	w, err := newWebhook(config.NotifySink{Type: "webhook", URL: url})
+	if err != nil {
+		t.Fatalf("newWebhook: %v", err)
+	}
+	ev := testEvent(KindSuccess)
+	ev.Kind = KindRecovery
+	if err := w.send(context.Background(), ev); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(body(), &got); err != nil {
+		t.Fatalf("payload %s: %v", body(), err)
+	}
+	want := map[string]any{
+		"kind":            "recovery",
+		"status":          "success",
+		"dbType":          "mysql",
+		"dbName":          "shop",
+		"host":            "db1",
+		"hostname":        "backup-host",
+		"location":        "s3://backups/shop.sql.gz",
+		"sizeBytes":       float64(3 << 20),
+		"time":            "2026-10-19T02:00:00Z",
+		"durationSeconds": 83.456789,
+		"message":         "Backup of shop on db1 succeeded in 1m23.457s (3.0 MiB): s3://backups/shop.sql.gz",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if _, ok := got["error"]; ok {
+		t.Error("a success has an error field")
+	}
+
+	failing, _ := capture(t, http.StatusNotFound)
+	w.url = failing
+	if err := w.send(context.Background(), ev); err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "no such channel") {
+		t.Errorf("send error = %v, want the status and body", err)
+	}
+}
+
+// fakeSMTP accepts one message and returns its data.
+func fakeSMTP(t *testing.T) (host string, port int, data <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	out := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO":
+				reply("250-fake\r\n250 8BITMIME")
+			case "MAIL", "RCPT":
+				reply("250 OK")
+			case "DATA":
+				reply("354 go ahead")
+				var msg strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					msg.WriteString(line)
+				}
+				out <- msg.String()
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, out
+}
+
+func TestEmailMessage(t *testing.T) {
+	host, port, data := fakeSMTP(t)
+	e, err := newEmail(config.NotifySink{
+		Type:     "email",
+		SMTPHost: host,
+		SMTPPort: port,
+		From:     "backups@example.com",
+		To:       []string{"ops@example.com", "dba@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("newEmail: %v", err)
+	}
+
+	// A database name must not be able to add headers.
+	ev := testEvent(KindFailure)
+	ev.DBName = "shöp\r\nBcc: evil@example.com"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.send(ctx, ev); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	msg := <-data
+	head, body, _ := strings.Cut(msg, "\r\n\r\n")
+	headers := map[string]string{}
+	for _, line := range strings.Split(head, "\r\n") {
+		k, v, _ := strings.Cut(line, ": ")
+		headers[k] = v
+	}
+	if _, ok := headers["Bcc"]; ok {
+		t.Errorf("the subject added a header:\n%s", head)
+	}
+	if got, want := headers["To"], "ops@example.com, dba@example.com"; got != want {
+		t.Errorf("To = %q, want %q", got, want)
+	}
+	if got, want := headers["Subject"], "=?utf-8?q?[db-backup-cli]_failure:_sh=C3=B6p_Bcc:_evil@example.com_on_db1?="; got != want {
+		t.Errorf("Subject = %q, want %q", got, want)
+	}
+	if got := headers["Content-Type"]; got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if !strings.Contains(body, "FAILED after 1m23.457s: dump: access denied") {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestHeaderValue(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"[db-backup-cli] success: shop on db1", "[db-backup-cli] success: shop on db1"},
+		{"a\r\nBcc: x", "a Bcc: x"},
+		{"a\n\nb", "a b"},
+		{"Sicherung München", "=?utf-8?q?Sicherung_M=C3=BCnchen?="},
+	}
+	for _, tt := range tests {
+		if got := headerValue(tt.in); got != tt.want {
+			t.Errorf("headerValue(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// recorder is a sink that records the kinds it is sent and fails the
+// first failures attempts.
+type recorder struct {
+	mu       sync.Mutex
+	kinds    []string
+	failures int
+}
+
+func (r *recorder) name() string { return "recorder" }
+
+func (r *recorder) send(ctx context.Context, ev Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("unavailable")
+	}
+	r.kinds = append(r.kinds, ev.Kind)
+	return nil
+}
+
+func TestNotifyKinds(t *testing.T) {
+	failures, all := &recorder{}, &recorder{}
+	n := &Notifier{
+		sinks: []subscribedSink{
+			{failures, map[string]bool{KindFailure: true}},
+			{all, map[string]bool{KindFailure: true, KindSuccess: true, KindRecovery: true}},
+		},
+		stateFile: filepath.Join(t.TempDir(), "state.json"),
+		timeout:   time.Second,
+	}
+	for _, status := range []string{KindSuccess, KindFailure, KindFailure, KindSuccess, KindSuccess} {
+		n.Notify(context.Background(), testEvent(status))
+	}
+	if got, want := strings.Join(failures.kinds, " "), "failure failure"; got != want {
+		t.Errorf("failure sink got %q, want %q", got, want)
+	}
+	// Recovery takes the place of success for sinks that want it.
+	if got, want := strings.Join(all.kinds, " "), "success failure failure recovery success"; got != want {
+		t.Errorf("all-events sink got %q, want %q", got, want)
+	}
+}
+
+func TestNotifyRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		retries  int
+		cancel   bool
+		want     int // deliveries
+	}{
+		{"first attempt", 0, 1, false, 1},
+		{"retried", 1, 1, false, 1},
+		{"gives up", 2, 1, false, 0},
+		{"cancelled run still gets one attempt", 0, 1, true, 1},
+		{"cancelled run is not retried", 1, 1, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{failures: tt.failures}
+			n := &Notifier{
+				sinks:     []subscribedSink{{r, map[string]bool{KindFailure: true}}},
+				stateFile: filepath.Join(t.TempDir(), "state.json"),
+				retries:   tt.retries,
+				timeout:   time.Second,
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			}
+			defer cancel()
+			n.Notify(ctx, testEvent(KindFailure))
+			if len(r.kinds) != tt.want {
+				t.Errorf("%d deliveries, want %d", len(r.kinds), tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	webhook := config.NotifySink{Type: "webhook", URL: "http://localhost/hook"}
+	tests := []struct {
+		name    string
+		cfg     config.NotifyConfig
+		wantErr string
+	}{
+		{"no sinks", config.NotifyConfig{}, ""},
+		{"webhook", config.NotifyConfig{Sinks: []config.NotifySink{webhook}}, ""},
+		{"unknown type", config.NotifyConfig{Sinks: []config.NotifySink{{Type: "pager"}}}, "unknown type"},
+		{"webhook without url", config.NotifyConfig{Sinks: []config.NotifySink{{Type: "webhook"}}}, "url is required"},
+		{"email without recipients", config.NotifyConfig{Sinks: []config.NotifySink{{Type: "email", SMTPHost: "mx", From: "a@b"}}}, "requires"},
+		{"bad template", config.NotifyConfig{Sinks: []config.NotifySink{{Type: "slack", URL: "http://x", Template: "{{.Nope"}}}, "template"},
+		{"unknown event", config.NotifyConfig{Sinks: []config.NotifySink{{Type: "webhook", URL: "http://x", Events: []string{"always"}}}}, "unknown event"},
+		{"too many retries", config.NotifyConfig{Retries: maxRetries + 1, Sinks: []config.NotifySink{webhook}}, "retries"},
+		{"bad timeout", config.NotifyConfig{Timeout: "forever", Sinks: []config.NotifySink{webhook}}, "timeout"},
+		{"long timeout", config.NotifyConfig{Timeout: "2m", Sinks: []config.NotifySink{webhook}}, "timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := New(tt.cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("New: %v", err)
+				}
+				if (n == nil) != (len(tt.cfg.Sinks) == 0) {
+					t.Errorf("New = %v for %d sinks", n, len(tt.cfg.Sinks))
+				}
+				if n != nil && (n.retries != defaultRetries || n.timeout != defaultTimeout || !n.sinks[0].events[KindFailure]) {
+					t.Errorf("defaults not applied: %+v", n)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("New error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+)
+
+const defaultMessage = `{{if eq .Status "success"}}Backup of {{.DBName}} on {{.Host}} succeeded in {{.Took}} ({{.Size}}): {{.Location}}` +
+	`{{else}}Backup of {{.DBName}} on {{.Host}} FAILED after {{.Took}}: {{.Error}}{{end}}`
+
+const defaultSubject = `[db-backup-cli] {{.Kind}}: {{.DBName}} on {{.Host}}`
+
+func parseTemplate(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+func render(t *template.Template, ev Event) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, ev); err != nil {
+		return "", fmt.Errorf("render %s template: %w", t.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// webhook POSTs the event as JSON with a rendered "message" field.
+type webhook struct {
+	url     string
+	message *template.Template
+}
+
+func newWebhook(sc config.NotifySink) (*webhook, error) {
+	if sc.URL == "" {
+		return nil, fmt.Errorf("webhook url is required")
+	}
+	t, err := parseTemplate("webhook", sc.Template, defaultMessage)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook{url: sc.URL, message: t}, nil
+}
+
+func (w *webhook) name() string { return "webhook" }
+
+func (w *webhook) send(ctx context.Context, ev Event) error {
+	msg, err := render(w.message, ev)
+	if err != nil {
+		return err
+	}
+
+	payload := struct {
+		Event
+		DurationSeconds float64 `json:"durationSeconds"`
+		Message         string  `json:"message"`
+	}{ev, ev.Duration.Seconds(), msg}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode webhook payload: %w", err)
+	}
+	return postJSON(ctx, w.url, body)
+}
+
+// slack posts to a Slack-compatible incoming webhook ({"text": ...}).
+type slack struct {
+	url     string
+	message *template.Template
+}
+
+func newSlack(sc config.NotifySink) (*slack, error) {
+	if sc.URL == "" {
+		return nil, fmt.Errorf("slack url is required")
+	}
+	t, err := parseTemplate("slack", sc.Template, defaultMessage)
+	if err != nil {
+		return nil, err
+	}
+	return &slack{url: sc.URL, message: t}, nil
+}
+
+func (s *slack) name() string { return "slack" }
+
+func (s *slack) send(ctx context.Context, ev Event) error {
+	msg, err := render(s.message, ev)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{"text": msg})
+	if err != nil {
+		return fmt.Errorf("encode slack payload: %w", err)
+	}
+	return postJSON(ctx, s.url, body)
+}
+
+func postJSON(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("post: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// email sends a plain-text message over SMTP, upgrading with STARTTLS when
+// the server offers it.
+type email struct {
+	host     string
+	port     int
+	user     string
+	password string
+	from     string
+	to       []string
+	subject  *template.Template
+	message  *template.Template
+}
+
+func newEmail(sc config.NotifySink) (*email, error) {
+	if sc.SMTPHost == "" || sc.From == "" || len(sc.To) == 0 {
+		return nil, fmt.Errorf("email requires smtpHost, from and to")
+	}
+	subject, err := parseTemplate("subject", sc.Subject, defaultSubject)
+	if err != nil {
+		return nil, err
+	}
+	message, err := parseTemplate("email", sc.Template, defaultMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	port := sc.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+
+	return &email{
+		host:     sc.SMTPHost,
+		port:     port,
+		user:     sc.SMTPUser,
+		password: sc.SMTPPassword,
+		from:     sc.From,
+		to:       sc.To,
+		subject:  subject,
+		message:  message,
+	}, nil
+}
+
+func (e *email) name() string { return "email" }
+
+func (e *email) send(ctx context.Context, ev Event) error {
+	subject, err := render(e.subject, ev)
+	if err != nil {
+		return err
+	}
+	body, err := render(e.message, ev)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", headerValue(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(body)
+	msg.WriteString("\r\n")
+
+	addr := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("dial smtp: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if e.user != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.user, e.password, e.host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := c.Mail(e.from); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	for _, rcpt := range e.to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp rcpt %s: %w", rcpt, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return fmt.Errorf("smtp write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp close data: %w", err)
+	}
+
+	return c.Quit()
+}
+
+// headerValue makes a rendered template safe as a header value: line
+// breaks, which would start new headers, become spaces, and non-ASCII
+// text is RFC 2047 encoded.
+func headerValue(s string) string {
+	s = strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == '\r' || r == '\n' }), " ")
+	return mime.QEncoding.Encode("utf-8", s)
+}
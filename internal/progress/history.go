@@ -0,0 +1,109 @@
+package progress
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+)
+
+// runsPerDatabase is how many runs the history keeps for each database.
+const runsPerDatabase = 20
+
+// Run is a successful backup recorded in the history.
+type Run struct {
+	Time      time.Time `json:"time"`
+	DBType    string    `json:"dbType"`
+	Host      string    `json:"host"`
+	Port      int       `json:"port"`
+	DBName    string    `json:"dbName"`
+	DumpBytes int64     `json:"dumpBytes"` // size of the dump before compression
+	SizeBytes int64     `json:"sizeBytes"` // size of the final artifact
+	Stages    Timings   `json:"stages"`
+}
+
+func (r Run) sameDatabase(o Run) bool {
+	return r.DBType == o.DBType && r.Host == o.Host && r.Port == o.Port && r.DBName == o.DBName
+}
+
+// DefaultHistoryPath is where the history is kept unless configured: the
+// user's cache directory, since losing it only loses the ETAs.
+func DefaultHistoryPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "db-backup-cli", "history.json")
+}
+
+// historyMu serialises updates from databases backed up in parallel.
+// Separate processes may still race; the last to write wins.
+var historyMu sync.Mutex
+
+func loadHistory(path string) ([]Run, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var runs []Run
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, fmt.Errorf("parse history %s: %w", path, err)
+	}
+	return runs, nil
+}
+
+// LastRun returns the latest run of the database described by like, or nil
+// if there is none.
+func LastRun(path string, like Run) (*Run, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	runs, err := loadHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].sameDatabase(like) {
+			return &runs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Record adds run to the history, dropping the oldest runs of its database
+// beyond runsPerDatabase.
+func Record(path string, run Run) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	runs, err := loadHistory(path)
+	if err != nil {
+		return err
+	}
+	runs = append(runs, run)
+
+	var count int
+	for i := len(runs) - 1; i >= 0; i-- {
+		if !runs[i].sameDatabase(run) {
+			continue
+		}
+		if count++; count > runsPerDatabase {
+			runs = append(runs[:i], runs[i+1:]...)
+		}
+	}
+
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return fsutil.WriteFile(path, append(data, '\n'), 0600)
+}
@@ -0,0 +1,336 @@
+// Package progress reports how far the stages of a backup have got: bytes
+// processed, throughput and an ETA, either as a live line on a terminal or
+// as periodic lines for logs and cron mail. It also keeps the stage timings
+// and a history of past runs that the ETAs are based on.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Modes of a Reporter.
+const (
+	ModeAuto  = "auto"  // ModeTTY if the output is a terminal, else ModeLines
+	ModeTTY   = "tty"   // one line, redrawn in place
+	ModeLines = "lines" // a line every interval
+	ModeOff   = "off"
+)
+
+const (
+	ttyInterval = 500 * time.Millisecond
+	// DefaultInterval is how often ModeLines prints.
+	DefaultInterval = 30 * time.Second
+)
+
+// Stage counts the bytes one stage of a backup has processed. A nil *Stage
+// counts nothing.
+type Stage struct {
+	Name   string
+	done   atomic.Int64 // bytes of the stream processed so far
+	output atomic.Int64 // bytes written, where that differs, e.g. compressed
+}
+
+// Done returns the bytes processed so far.
+func (s *Stage) Done() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.done.Load()
+}
+
+// Output returns the bytes written by a stage counted with OutputWriter.
+func (s *Stage) Output() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.output.Load()
+}
+
+type counter struct {
+	n *atomic.Int64
+	r io.Reader
+	w io.Writer
+}
+
+func (c counter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func (c counter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// Reader counts what is read from r as processed. With a nil stage it
+// returns r.
+func (s *Stage) Reader(r io.Reader) io.Reader {
+	if s == nil {
+		return r
+	}
+	return counter{n: &s.done, r: r}
+}
+
+type readSeeker struct {
+	n   *atomic.Int64
+	rs  io.ReadSeeker
+	pos int64
+}
+
+func (r *readSeeker) Read(p []byte) (int, error) {
+	n, err := r.rs.Read(p)
+	r.pos += int64(n)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+func (r *readSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.rs.Seek(offset, whence)
+	if err == nil {
+		r.n.Add(pos - r.pos)
+		r.pos = pos
+	}
+	return pos, err
+}
+
+// ReadSeeker counts the position in rs as processed, so a request body
+// that is rewound for a retry is not counted twice. With a nil stage it
+// returns rs.
+func (s *Stage) ReadSeeker(rs io.ReadSeeker) io.ReadSeeker {
+	if s == nil {
+		return rs
+	}
+	return &readSeeker{n: &s.done, rs: rs}
+}
+
+// Writer counts what is written to w as processed. With a nil stage it
+// returns w.
+func (s *Stage) Writer(w io.Writer) io.Writer {
+	if s == nil {
+		return w
+	}
+	return counter{n: &s.done, w: w}
+}
+
+// OutputWriter counts what is written to w as output. With a nil stage it
+// returns w.
+func (s *Stage) OutputWriter(w io.Writer) io.Writer {
+	if s == nil {
+		return w
+	}
+	return counter{n: &s.output, w: w}
+}
+
+type stageKey struct{}
+
+// WithStage returns a context that code deep in a stage can find s in.
+func WithStage(ctx context.Context, s *Stage) context.Context {
+	return context.WithValue(ctx, stageKey{}, s)
+}
+
+// FromContext returns the stage of ctx, or nil.
+func FromContext(ctx context.Context) *Stage {
+	s, _ := ctx.Value(stageKey{}).(*Stage)
+	return s
+}
+
+// Reporter prints the progress of stages to w.
+type Reporter struct {
+	w        io.Writer
+	mode     string
+	interval time.Duration
+	label    string // prefix of every line, e.g. the database
+	mu       sync.Mutex
+}
+
+// NewReporter returns a reporter writing to w in mode, resolving ModeAuto
+// by whether w is a terminal. interval applies to ModeLines; 0 means
+// DefaultInterval.
+func NewReporter(w io.Writer, mode string, interval time.Duration, label string) *Reporter {
+	if mode == "" || mode == ModeAuto {
+		mode = ModeLines
+		if IsTerminal(w) {
+			mode = ModeTTY
+		}
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Reporter{w: w, mode: mode, interval: interval, label: label}
+}
+
+// IsTerminal reports whether w is a character device such as a terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ValidMode reports whether mode is one of the Mode constants.
+func ValidMode(mode string) bool {
+	switch mode {
+	case "", ModeAuto, ModeTTY, ModeLines, ModeOff:
+		return true
+	}
+	return false
+}
+
+// Estimate is what a stage is expected to take, from earlier runs or known
+// sizes. Zero fields are unknown.
+type Estimate struct {
+	Bytes    int64         // size of the stream
+	Duration time.Duration // how long the stage took last time
+}
+
+// Track reports s until the returned function is called, which clears a
+// terminal line. A nil reporter or ModeOff reports nothing.
+func (r *Reporter) Track(s *Stage, est Estimate) (stop func()) {
+	if r == nil || r.mode == ModeOff {
+		return func() {}
+	}
+	start := time.Now()
+	interval := r.interval
+	if r.mode == ModeTTY {
+		interval = ttyInterval
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				r.print(Line(s, est, time.Since(start)))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+		if r.mode == ModeTTY {
+			r.mu.Lock()
+			fmt.Fprint(r.w, "\r\033[K")
+			r.mu.Unlock()
+		}
+	}
+}
+
+func (r *Reporter) print(line string) {
+	if r.label != "" {
+		line = "[" + r.label + "] " + line
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode == ModeTTY {
+		fmt.Fprint(r.w, "\r\033[K"+line)
+		return
+	}
+	fmt.Fprintln(r.w, line)
+}
+
+// Line describes the state of s after elapsed, such as
+// "compress: 45% of 1.2 GB -> 120 MB (4.5x), 80.0 MB/s, ETA 20s".
+func Line(s *Stage, est Estimate, elapsed time.Duration) string {
+	var b strings.Builder
+	b.WriteString(s.Name + ": ")
+	done := s.Done()
+	secs := elapsed.Seconds()
+
+	var eta time.Duration
+	switch {
+	case done == 0:
+		fmt.Fprintf(&b, "%s elapsed", elapsed.Round(time.Second))
+		if est.Duration > elapsed {
+			eta = est.Duration - elapsed
+		}
+	case est.Bytes > done:
+		fmt.Fprintf(&b, "%d%% of %s", done*100/est.Bytes, FormatBytes(est.Bytes))
+		if secs > 0 {
+			eta = time.Duration(float64(est.Bytes-done) / (float64(done) / secs) * float64(time.Second))
+		}
+	case est.Bytes > 0:
+		fmt.Fprintf(&b, "%s, past the expected %s", FormatBytes(done), FormatBytes(est.Bytes))
+	default:
+		b.WriteString(FormatBytes(done))
+	}
+
+	if out := s.Output(); out > 0 && done > 0 {
+		fmt.Fprintf(&b, " -> %s (%.1fx)", FormatBytes(out), float64(done)/float64(out))
+	}
+	if done > 0 && secs > 0 {
+		fmt.Fprintf(&b, ", %s/s", FormatBytes(int64(float64(done)/secs)))
+	}
+	if eta > 0 {
+		fmt.Fprintf(&b, ", ETA %s", eta.Round(time.Second))
+	}
+	return b.String()
+}
+
+// FormatBytes formats n in decimal units, e.g. "1.2 GB".
+func FormatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// Timing is how long one stage took.
+type Timing struct {
+	Stage    string        `json:"stage"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Timings are the stages of a run in the order they ran.
+type Timings []Timing
+
+// Get returns how long stage took, or 0 if it did not run.
+func (t Timings) Get(stage string) time.Duration {
+	for _, s := range t {
+		if s.Stage == stage {
+			return s.Duration
+		}
+	}
+	return 0
+}
+
+// Total returns the time of all stages.
+func (t Timings) Total() time.Duration {
+	var total time.Duration
+	for _, s := range t {
+		total += s.Duration
+	}
+	return total
+}
+
+// String formats the timings as "dump 1m2s, compress 20s (total 1m22s)".
+func (t Timings) String() string {
+	parts := make([]string, len(t))
+	for i, s := range t {
+		parts[i] = s.Stage + " " + s.Duration.Round(time.Millisecond).String()
+	}
+	return fmt.Sprintf("%s (total %s)", strings.Join(parts, ", "), t.Total().Round(time.Millisecond))
+}
@@ -0,0 +1,127 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Chunk size defaults. Dumps change a few rows at a time, so chunks are kept
+// around 1 MiB: small enough that an edit rewrites little, large enough that
+// a big dump is not millions of objects.
+const (
+	DefaultMinChunk = 256 << 10
+	DefaultAvgChunk = 1 << 20
+	DefaultMaxChunk = 4 << 20
+)
+
+// ChunkerParams fixes how a repository splits streams. They are chosen when
+// the repository is created and never change, or chunks would stop matching.
+type ChunkerParams struct {
+	Min  int    `json:"min"`
+	Avg  int    `json:"avg"` // a power of two
+	Max  int    `json:"max"`
+	Seed uint64 `json:"seed"` // seeds the gear table, so boundaries differ per repository
+}
+
+func (p ChunkerParams) validate() error {
+	if p.Avg <= 0 || p.Avg&(p.Avg-1) != 0 {
+		return fmt.Errorf("average chunk size %d is not a power of two", p.Avg)
+	}
+	if p.Min <= 0 || p.Min >= p.Avg || p.Max <= p.Avg {
+		return fmt.Errorf("chunk sizes must satisfy 0 < min < avg < max, got %d, %d, %d", p.Min, p.Avg, p.Max)
+	}
+	return nil
+}
+
+// chunker splits a stream with FastCDC: a rolling gear hash over the bytes
+// decides where chunks end, so an insert or delete only changes the chunks
+// around it and the rest of the stream still deduplicates. Normalised
+// chunking uses a stricter mask before the average size and a looser one
+// after it, which keeps sizes close to the average.
+type chunker struct {
+	r     io.Reader
+	p     ChunkerParams
+	gear  [256]uint64
+	maskS uint64
+	maskL uint64
+	buf   []byte
+	start int
+	end   int
+	eof   bool
+}
+
+func newChunker(r io.Reader, p ChunkerParams) *chunker {
+	c := &chunker{r: r, p: p, buf: make([]byte, 2*p.Max)}
+
+	// splitmix64 fills the gear table from the seed.
+	x := p.Seed
+	for i := range c.gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		c.gear[i] = z ^ (z >> 31)
+	}
+
+	// The gear hash shifts left, so its high bits cover the most input.
+	n := bits.TrailingZeros(uint(p.Avg))
+	c.maskS = ^uint64(0) << (64 - (n + 2))
+	c.maskL = ^uint64(0) << (64 - (n - 2))
+	return c
+}
+
+// next returns the next chunk, valid until the following call, or io.EOF
+// after the last one.
+func (c *chunker) next() ([]byte, error) {
+	// Keep at least Max bytes buffered unless the stream has ended.
+	if c.end-c.start < c.p.Max && !c.eof {
+		copy(c.buf, c.buf[c.start:c.end])
+		c.end -= c.start
+		c.start = 0
+		for c.end < len(c.buf) && !c.eof {
+			n, err := c.r.Read(c.buf[c.end:])
+			c.end += n
+			if errors.Is(err, io.EOF) {
+				c.eof = true
+			} else if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+
+	n := c.cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// cut returns the length of the chunk at the start of data.
+func (c *chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.p.Min {
+		return n
+	}
+	n = min(n, c.p.Max)
+	normal := min(n, c.p.Avg)
+
+	var fp uint64
+	i := c.p.Min
+	for ; i < normal; i++ {
+		fp = fp<<1 + c.gear[data[i]]
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = fp<<1 + c.gear[data[i]]
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
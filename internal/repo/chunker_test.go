@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"testing"
+	"testing/iotest"
+)
+
+// testParams are small chunk sizes, so short inputs make many chunks.
+var testParams = ChunkerParams{Min: 64, Avg: 256, Max: 1024, Seed: 1}
+
+func randomBytes(seed uint64, n int) []byte {
+	r := rand.New(rand.NewPCG(seed, seed))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(r.Uint32())
+	}
+	return b
+}
+
+// chunks splits r with p and returns copies of the chunks.
+func chunks(t *testing.T, r io.Reader, p ChunkerParams) [][]byte {
+	t.Helper()
+	var out [][]byte
+	c := newChunker(r, p)
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		out = append(out, append([]byte(nil), chunk...))
+	}
+}
+
+func TestChunkerParamsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       ChunkerParams
+		wantErr bool
+	}{
+		{"defaults", ChunkerParams{Min: DefaultMinChunk, Avg: DefaultAvgChunk, Max: DefaultMaxChunk}, false},
+		{"small", testParams, false},
+		{"zero", ChunkerParams{}, true},
+		{"avg not a power of two", ChunkerParams{Min: 64, Avg: 300, Max: 1024}, true},
+		{"min zero", ChunkerParams{Min: 0, Avg: 256, Max: 1024}, true},
+		{"min not below avg", ChunkerParams{Min: 256, Avg: 256, Max: 1024}, true},
+		{"max not above avg", ChunkerParams{Min: 64, Avg: 256, Max: 256}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.p.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestChunker(t *testing.T) {
+	p := testParams
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"one byte", []byte{1}},
+		{"min", randomBytes(1, p.Min)},
+		{"min plus one", randomBytes(2, p.Min+1)},
+		{"max", randomBytes(3, p.Max)},
+		{"random", randomBytes(4, 100*p.Max)},
+		{"zeros", make([]byte, 10*p.Max+5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunks(t, bytes.NewReader(tt.data), p)
+			if joined := bytes.Join(got, nil); !bytes.Equal(joined, tt.data) {
+				t.Fatalf("chunks join to %d bytes, want the %d input bytes", len(joined), len(tt.data))
+			}
+			for i, c := range got {
+				if len(c) > p.Max {
+					t.Errorf("chunk %d is %d bytes, over the maximum %d", i, len(c), p.Max)
+				}
+				if i < len(got)-1 && len(c) <= p.Min {
+					t.Errorf("chunk %d of %d is %d bytes, not over the minimum %d", i, len(got), len(c), p.Min)
+				}
+			}
+
+			// Boundaries depend on the content, not on how it is read.
+			again := chunks(t, iotest.HalfReader(bytes.NewReader(tt.data)), p)
+			if len(again) != len(got) {
+				t.Fatalf("short reads gave %d chunks, want %d", len(again), len(got))
+			}
+			for i := range got {
+				if !bytes.Equal(again[i], got[i]) {
+					t.Fatalf("short reads changed chunk %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkerAverage(t *testing.T) {
+	p := testParams
+	data := randomBytes(5, 1000*p.Avg)
+	n := len(chunks(t, bytes.NewReader(data), p))
+	// Normalised chunking keeps the mean near Avg, well inside these bounds.
+	if mean := len(data) / n; mean < p.Avg/2 || mean > 2*p.Avg {
+		t.Errorf("mean chunk size %d, want near %d", mean, p.Avg)
+	}
+}
+
+func TestChunkerSeed(t *testing.T) {
+	data := randomBytes(6, 50*testParams.Max)
+	other := testParams
+	other.Seed = 2
+	a := chunks(t, bytes.NewReader(data), testParams)
+	b := chunks(t, bytes.NewReader(data), other)
+	if len(a) == len(b) && bytes.Equal(a[0], b[0]) && bytes.Equal(a[1], b[1]) {
+		t.Error("a different seed gave the same boundaries")
+	}
+}
+
+func TestChunkerEditLocality(t *testing.T) {
+	data := randomBytes(7, 200*testParams.Max)
+	edited := append(append(append([]byte(nil), data[:len(data)/2]...), "inserted row"...), data[len(data)/2:]...)
+
+	before := map[string]bool{}
+	for _, c := range chunks(t, bytes.NewReader(data), testParams) {
+		before[string(c)] = true
+	}
+	after := chunks(t, bytes.NewReader(edited), testParams)
+	changed := 0
+	for _, c := range after {
+		if !before[string(c)] {
+			changed++
+		}
+	}
+	// An insert only changes the chunk it lands in, and maybe the next.
+	if changed == 0 || changed > 3 {
+		t.Errorf("%d of %d chunks changed after one insert, want 1-3", changed, len(after))
+	}
+}
+
+func TestChunkerReadError(t *testing.T) {
+	boom := errors.New("boom")
+	r := io.MultiReader(bytes.NewReader(randomBytes(8, 100)), iotest.ErrReader(boom))
+	c := newChunker(r, testParams)
+	if _, err := c.next(); !errors.Is(err, boom) {
+		t.Errorf("next error = %v, want %v", err, boom)
+	}
+}
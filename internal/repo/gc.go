@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GCStats describes what a garbage collection found.
+type GCStats struct {
+	Snapshots    int
+	Chunks       int   // chunks stored before the collection
+	Unreferenced int   // chunks no snapshot uses
+	Bytes        int64 // storage taken by the unreferenced chunks
+}
+
+// GC deletes chunks that no snapshot references, or with dryRun only
+// counts them. It refuses to run while a backup is in progress, since a
+// running backup may rely on chunks its snapshot does not list yet.
+func (r *Repository) GC(ctx context.Context, dryRun bool) (GCStats, error) {
+	var stats GCStats
+
+	release, err := r.acquire(ctx, opGC, newSnapshotID(time.Now()))
+	if err != nil {
+		return stats, err
+	}
+	defer release()
+
+	// Any unreadable index stops the collection: deleting its chunks
+	// would lose the backup for good.
+	snaps, err := r.Snapshots(ctx)
+	if err != nil {
+		return stats, err
+	}
+	stats.Snapshots = len(snaps)
+	used := make(map[string]bool)
+	for _, s := range snaps {
+		for _, id := range s.Chunks {
+			used[id] = true
+		}
+	}
+
+	chunks, err := r.backend.List(ctx, chunkPrefix)
+	if err != nil {
+		return stats, fmt.Errorf("list chunks: %w", err)
+	}
+	stats.Chunks = len(chunks)
+	for _, c := range chunks {
+		id := c.Key[strings.LastIndex(c.Key, "/")+1:]
+		if used[id] {
+			continue
+		}
+		stats.Unreferenced++
+		stats.Bytes += c.Size
+		if dryRun {
+			continue
+		}
+		if err := r.backend.Delete(ctx, c.Key); err != nil {
+			return stats, fmt.Errorf("delete chunk %s: %w", id, err)
+		}
+	}
+	return stats, nil
+}
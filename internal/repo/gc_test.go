@@ -0,0 +1,188 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/storage"
+)
+
+func TestMain(m *testing.M) {
+	console.SetOut(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestRepo creates a repository in a temporary directory that splits
+// streams into small chunks.
+func newTestRepo(t *testing.T, key []byte) (*Repository, *storage.LocalBackend) {
+	t.Helper()
+	backend := &storage.LocalBackend{Dir: t.TempDir()}
+	r, err := Init(context.Background(), backend, key)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(r.Close)
+	r.cfg.Chunker = testParams
+	return r, backend
+}
+
+func backup(t *testing.T, r *Repository, data []byte) Snapshot {
+	t.Helper()
+	snap, _, err := r.Backup(context.Background(), bytes.NewReader(data), Snapshot{DBName: "shop"})
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	return snap
+}
+
+func countChunks(t *testing.T, b storage.Backend) int {
+	t.Helper()
+	objs, err := b.List(context.Background(), chunkPrefix)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return len(objs)
+}
+
+func TestGC(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		key  []byte
+	}{
+		{"plain", nil},
+		{"encrypted", bytes.Repeat([]byte("k"), 32)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r, backend := newTestRepo(t, tt.key)
+
+			// Two backups that share their first half.
+			shared := randomBytes(10, 50*testParams.Max)
+			first := append(append([]byte(nil), shared...), randomBytes(11, 50*testParams.Max)...)
+			second := append(append([]byte(nil), shared...), randomBytes(12, 50*testParams.Max)...)
+			old := backup(t, r, first)
+			keep := backup(t, r, second)
+			total := countChunks(t, backend)
+
+			stats, err := r.GC(ctx, false)
+			if err != nil {
+				t.Fatalf("GC: %v", err)
+			}
+			if stats.Unreferenced != 0 || stats.Chunks != total || stats.Snapshots != 2 {
+				t.Fatalf("GC with every chunk in use = %+v, want nothing unreferenced of %d", stats, total)
+			}
+
+			if err := r.Forget(ctx, old.ID); err != nil {
+				t.Fatalf("Forget: %v", err)
+			}
+			onlyOld := map[string]bool{}
+			for _, id := range old.Chunks {
+				onlyOld[id] = true
+			}
+			for _, id := range keep.Chunks {
+				delete(onlyOld, id)
+			}
+			if len(onlyOld) == 0 {
+				t.Fatal("the first backup has no chunks of its own")
+			}
+
+			dry, err := r.GC(ctx, true)
+			if err != nil {
+				t.Fatalf("GC dry run: %v", err)
+			}
+			if dry.Unreferenced != len(onlyOld) || dry.Bytes <= 0 || dry.Snapshots != 1 {
+				t.Errorf("dry run = %+v, want %d unreferenced chunks", dry, len(onlyOld))
+			}
+			if n := countChunks(t, backend); n != total {
+				t.Errorf("dry run left %d chunks, want all %d", n, total)
+			}
+
+			stats, err = r.GC(ctx, false)
+			if err != nil {
+				t.Fatalf("GC: %v", err)
+			}
+			if stats != dry {
+				t.Errorf("GC = %+v, want what the dry run found, %+v", stats, dry)
+			}
+			if n := countChunks(t, backend); n != total-len(onlyOld) {
+				t.Errorf("%d chunks left, want %d", n, total-len(onlyOld))
+			}
+
+			var got bytes.Buffer
+			if err := r.Restore(ctx, &keep, &got); err != nil {
+				t.Fatalf("Restore after GC: %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), second) {
+				t.Error("the kept snapshot restored different data")
+			}
+			if locks, _ := backend.List(ctx, lockPrefix); len(locks) != 0 {
+				t.Errorf("locks left behind: %v", locks)
+			}
+		})
+	}
+}
+
+func TestGCLocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		lock    string
+		age     time.Duration
+		wantErr error
+	}{
+		{"running backup", "backup-20261019T100000Z-00000000", 0, ErrLocked},
+		{"running gc", "gc-20261019T100000Z-00000000", 0, ErrLocked},
+		{"stale backup", "backup-20261019T100000Z-00000000", 2 * staleLockAge, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r, backend := newTestRepo(t, nil)
+			backup(t, r, randomBytes(13, 10*testParams.Max))
+
+			if err := backend.Put(ctx, lockPrefix+tt.lock, []byte("{}")); err != nil {
+				t.Fatal(err)
+			}
+			if tt.age > 0 {
+				modified := time.Now().Add(-tt.age)
+				path := filepath.Join(backend.Dir, "locks", tt.lock)
+				if err := os.Chtimes(path, modified, modified); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := r.GC(ctx, false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GC error = %v, want %v", err, tt.wantErr)
+			}
+			// The collection's own lock is removed either way.
+			locks, _ := backend.List(ctx, lockPrefix)
+			if len(locks) != 1 {
+				t.Errorf("locks after GC = %v, want only %s", locks, tt.lock)
+			}
+		})
+	}
+}
+
+func TestGCUnreadableSnapshot(t *testing.T) {
+	ctx := context.Background()
+	r, backend := newTestRepo(t, nil)
+	backup(t, r, randomBytes(14, 10*testParams.Max))
+	total := countChunks(t, backend)
+
+	if err := backend.Put(ctx, snapshotPrefix+"damaged", []byte("not a sealed index")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GC(ctx, false); err == nil {
+		t.Fatal("GC succeeded with an unreadable snapshot index")
+	}
+	if n := countChunks(t, backend); n != total {
+		t.Errorf("GC deleted chunks despite the unreadable index: %d left of %d", n, total)
+	}
+}
@@ -0,0 +1,361 @@
+// Package repo implements a deduplicating backup repository. Backup streams
+// are split into content-defined chunks, which are compressed, optionally
+// encrypted, and stored once under their hash; a snapshot is just the list
+// of chunks that make up one backup.
+//
+// Layout below the storage root:
+//
+//	config              repository settings, plain JSON
+//	chunks/ab/abcd...   chunks, named by ID
+//	snapshots/<id>      snapshot indexes, sealed like chunks
+//	locks/<name>        markers of running backups and garbage collections
+package repo
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/storage"
+)
+
+const (
+	configKey      = "config"
+	chunkPrefix    = "chunks/"
+	snapshotPrefix = "snapshots/"
+	lockPrefix     = "locks/"
+
+	repoVersion = 1
+
+	// keyCheckText is sealed into the config of an encrypted repository, so
+	// a wrong key is reported as such rather than as damaged chunks.
+	keyCheckText = "db-backup-cli repository"
+
+	// maxObjectSize bounds what a sealed object may decompress to.
+	maxObjectSize = 1 << 30
+)
+
+var (
+	// ErrNoRepository is returned by Open when location holds no repository.
+	ErrNoRepository = errors.New("no repository")
+	// ErrWrongKey is returned when the key does not match the repository.
+	ErrWrongKey = errors.New("wrong encryption key for repository")
+	// ErrLocked is returned when a backup and a garbage collection would
+	// run at the same time.
+	ErrLocked = errors.New("repository is locked")
+)
+
+type repoConfig struct {
+	Version   int           `json:"version"`
+	Created   time.Time     `json:"created"`
+	Encrypted bool          `json:"encrypted"`
+	KeyCheck  []byte        `json:"keyCheck,omitempty"`
+	Chunker   ChunkerParams `json:"chunker"`
+}
+
+// Repository is an open repository.
+type Repository struct {
+	backend storage.Backend
+	cfg     repoConfig
+	aead    cipher.AEAD // nil if the repository is not encrypted
+	idKey   []byte      // chunk IDs are HMACs under this key when encrypted
+	enc     *zstd.Encoder
+	dec     *zstd.Decoder
+}
+
+// Init creates a repository at backend. With a key, chunks and indexes are
+// encrypted with AES-256-GCM and chunk IDs are keyed hashes, so the storage
+// learns nothing about the content; without one they are only compressed.
+func Init(ctx context.Context, backend storage.Backend, key []byte) (*Repository, error) {
+	if _, err := backend.Get(ctx, configKey); err == nil {
+		return nil, fmt.Errorf("%s already holds a repository", backend)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	var seed [8]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return nil, err
+	}
+	cfg := repoConfig{
+		Version:   repoVersion,
+		Created:   time.Now().UTC(),
+		Encrypted: key != nil,
+		Chunker: ChunkerParams{
+			Min:  DefaultMinChunk,
+			Avg:  DefaultAvgChunk,
+			Max:  DefaultMaxChunk,
+			Seed: binary.LittleEndian.Uint64(seed[:]),
+		},
+	}
+	r, err := newRepository(backend, cfg, key)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		if r.cfg.KeyCheck, err = r.seal([]byte(keyCheckText), configKey); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(r.cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := backend.Put(ctx, configKey, append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("write repository config: %w", err)
+	}
+	return r, nil
+}
+
+// Open opens the repository at backend. key must be given exactly when the
+// repository is encrypted.
+func Open(ctx context.Context, backend storage.Backend, key []byte) (*Repository, error) {
+	data, err := backend.Get(ctx, configKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w at %s", ErrNoRepository, backend)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read repository config: %w", err)
+	}
+
+	var cfg repoConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse repository config: %w", err)
+	}
+	if cfg.Version != repoVersion {
+		return nil, fmt.Errorf("repository version %d is not supported", cfg.Version)
+	}
+	if err := cfg.Chunker.validate(); err != nil {
+		return nil, fmt.Errorf("repository config: %w", err)
+	}
+	switch {
+	case cfg.Encrypted && key == nil:
+		return nil, fmt.Errorf("%w: the repository is encrypted and needs its key", ErrWrongKey)
+	case !cfg.Encrypted && key != nil:
+		return nil, fmt.Errorf("%w: the repository is not encrypted, but a key was given", ErrWrongKey)
+	}
+
+	r, err := newRepository(backend, cfg, key)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Encrypted {
+		if text, err := r.open(cfg.KeyCheck, configKey); err != nil || string(text) != keyCheckText {
+			return nil, ErrWrongKey
+		}
+	}
+	return r, nil
+}
+
+// OpenOrInit opens the repository at backend, creating it first if needed.
+func OpenOrInit(ctx context.Context, backend storage.Backend, key []byte) (*Repository, error) {
+	r, err := Open(ctx, backend, key)
+	if errors.Is(err, ErrNoRepository) {
+		return Init(ctx, backend, key)
+	}
+	return r, err
+}
+
+func newRepository(backend storage.Backend, cfg repoConfig, key []byte) (*Repository, error) {
+	r := &Repository{backend: backend, cfg: cfg}
+
+	if key != nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key must be 32 bytes for AES-256")
+		}
+		// Separate keys for encryption and chunk IDs, derived from the one
+		// the user gives.
+		encKey, err := hkdf.Key(sha256.New, key, nil, "db-backup-cli repository encryption", 32)
+		if err != nil {
+			return nil, err
+		}
+		if r.idKey, err = hkdf.Key(sha256.New, key, nil, "db-backup-cli repository chunk id", 32); err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(encKey)
+		if err != nil {
+			return nil, err
+		}
+		if r.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if r.enc, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault)); err != nil {
+		return nil, err
+	}
+	if r.dec, err = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxObjectSize)); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Close releases the compressor.
+func (r *Repository) Close() {
+	r.enc.Close()
+	r.dec.Close()
+}
+
+// String returns the repository's location.
+func (r *Repository) String() string {
+	return r.backend.String()
+}
+
+// Encrypted reports whether the repository is encrypted.
+func (r *Repository) Encrypted() bool {
+	return r.cfg.Encrypted
+}
+
+// chunkID names a chunk by its content.
+func (r *Repository) chunkID(data []byte) string {
+	var h hash.Hash
+	if r.idKey != nil {
+		h = hmac.New(sha256.New, r.idKey)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func chunkKey(id string) string {
+	return chunkPrefix + id[:2] + "/" + id
+}
+
+// seal compresses data and, in an encrypted repository, encrypts it bound to
+// the object's key, so an object moved to another key fails to open.
+func (r *Repository) seal(data []byte, key string) ([]byte, error) {
+	compressed := r.enc.EncodeAll(data, nil)
+	if r.aead == nil {
+		return compressed, nil
+	}
+	nonce := make([]byte, r.aead.NonceSize(), r.aead.NonceSize()+len(compressed)+r.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return r.aead.Seal(nonce, nonce, compressed, []byte(key)), nil
+}
+
+// open reverses seal.
+func (r *Repository) open(obj []byte, key string) ([]byte, error) {
+	if r.aead != nil {
+		if len(obj) < r.aead.NonceSize() {
+			return nil, fmt.Errorf("%s: object too short", key)
+		}
+		var err error
+		obj, err = r.aead.Open(nil, obj[:r.aead.NonceSize()], obj[r.aead.NonceSize():], []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("%s: damaged or wrong key: %w", key, err)
+		}
+	}
+	data, err := r.dec.DecodeAll(obj, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: decompress: %w", key, err)
+	}
+	return data, nil
+}
+
+// getChunk fetches a chunk and checks it against its ID.
+func (r *Repository) getChunk(ctx context.Context, id string) ([]byte, error) {
+	obj, err := r.backend.Get(ctx, chunkKey(id))
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.open(obj, chunkKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if r.chunkID(data) != id {
+		return nil, fmt.Errorf("chunk %s: content does not match its ID", id)
+	}
+	return data, nil
+}
+
+// lock is the marker a backup or garbage collection leaves while running.
+type lock struct {
+	Operation string    `json:"operation"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	Time      time.Time `json:"time"`
+}
+
+// Lock operations; a lock is named "<operation>-<id>".
+const (
+	opBackup = "backup"
+	opGC     = "gc"
+)
+
+// staleLockAge is when a lock is assumed to be left over from a crash.
+const staleLockAge = 24 * time.Hour
+
+// acquire writes a lock for op, then checks for locks that conflict with
+// it: any backup blocks a garbage collection and a garbage collection blocks
+// backups. Writing before checking means two racing operations cannot both
+// miss each other. The returned function removes the lock.
+func (r *Repository) acquire(ctx context.Context, op, id string) (func(), error) {
+	name := op + "-" + id
+	host, _ := os.Hostname()
+	data, err := json.Marshal(lock{Operation: op, Host: host, PID: os.Getpid(), Time: time.Now().UTC()})
+	if err != nil {
+		return nil, err
+	}
+	key := lockPrefix + name
+	if err := r.backend.Put(ctx, key, data); err != nil {
+		return nil, fmt.Errorf("write lock: %w", err)
+	}
+	release := func() {
+		// Also on cancellation: the lock must not outlive the run.
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := r.backend.Delete(ctx, key); err != nil {
+			console.Println("Warning: could not remove repository lock", key+":", err)
+		}
+	}
+
+	locks, err := r.backend.List(ctx, lockPrefix)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("list locks: %w", err)
+	}
+	for _, l := range locks {
+		other := strings.TrimPrefix(l.Key, lockPrefix)
+		if other == name {
+			continue
+		}
+		if op != opGC && !strings.HasPrefix(other, opGC+"-") {
+			continue // backups may run side by side
+		}
+		if time.Since(l.Modified) > staleLockAge {
+			console.Printf("Warning: ignoring stale repository lock %s from %s\n", other, l.Modified.Format(time.RFC3339))
+			continue
+		}
+		release()
+		return nil, fmt.Errorf("%w: %s is running (lock %s since %s)", ErrLocked, lockOperation(other), l.Key, l.Modified.Format(time.RFC3339))
+	}
+	return release, nil
+}
+
+func lockOperation(name string) string {
+	if strings.HasPrefix(name, opGC+"-") {
+		return "a garbage collection"
+	}
+	return "a backup"
+}
@@ -0,0 +1,299 @@
+package repo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/storage"
+)
+
+const (
+	// uploadWorkers is how many chunks are sealed and stored at once.
+	uploadWorkers = 8
+	// fetchAhead is how many chunks a restore fetches ahead of writing.
+	fetchAhead = 8
+)
+
+// Latest selects the newest snapshot in FindSnapshot.
+const Latest = "latest"
+
+// ErrNoSnapshot is returned when no snapshot matches.
+var ErrNoSnapshot = errors.New("no such snapshot")
+
+// Snapshot is the index of one backup: the chunks its stream is made of, in
+// order, and what it is a backup of.
+type Snapshot struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Host   string    `json:"host"` // machine the backup ran on
+	DBType string    `json:"dbType"`
+	DBName string    `json:"dbName"`
+	File   string    `json:"file"` // name of the backup artifact, e.g. shop.sql
+	Size   int64     `json:"size"`
+	Chunks []string  `json:"chunks"`
+}
+
+// BackupStats describes what a backup added to the repository.
+type BackupStats struct {
+	Chunks      int   // chunks in the snapshot
+	NewChunks   int   // chunks not already stored
+	NewBytes    int64 // uncompressed size of the new chunks
+	StoredBytes int64 // what the new chunks take up in storage
+}
+
+func newSnapshotID(t time.Time) string {
+	var b [4]byte
+	rand.Read(b[:])
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b[:])
+}
+
+// Backup stores the stream in as a new snapshot described by meta, which
+// gets its ID, time, size and chunk list filled in. Only chunks the
+// repository does not already hold are uploaded.
+func (r *Repository) Backup(ctx context.Context, in io.Reader, meta Snapshot) (Snapshot, BackupStats, error) {
+	snap := meta
+	snap.Time = time.Now().UTC()
+	snap.ID = newSnapshotID(snap.Time)
+	if snap.Host == "" {
+		snap.Host, _ = os.Hostname()
+	}
+	var stats BackupStats
+
+	release, err := r.acquire(ctx, opBackup, snap.ID)
+	if err != nil {
+		return snap, stats, err
+	}
+	defer release()
+
+	existing, err := r.backend.List(ctx, chunkPrefix)
+	if err != nil {
+		return snap, stats, fmt.Errorf("list chunks: %w", err)
+	}
+	known := make(map[string]bool, len(existing))
+	for _, o := range existing {
+		known[o.Key[strings.LastIndex(o.Key, "/")+1:]] = true
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type upload struct {
+		id   string
+		data []byte
+	}
+	work := make(chan upload, uploadWorkers)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for range uploadWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range work {
+				obj, err := r.seal(u.data, chunkKey(u.id))
+				if err == nil {
+					err = r.backend.Put(ctx, chunkKey(u.id), obj)
+				}
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("store chunk %s: %w", u.id, err)
+					cancel()
+				}
+				stats.StoredBytes += int64(len(obj))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	c := newChunker(in, r.cfg.Chunker)
+	var readErr error
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		id := r.chunkID(chunk)
+		snap.Chunks = append(snap.Chunks, id)
+		snap.Size += int64(len(chunk))
+		if known[id] {
+			continue
+		}
+		known[id] = true
+		stats.NewChunks++
+		stats.NewBytes += int64(len(chunk))
+		select {
+		case work <- upload{id, append([]byte(nil), chunk...)}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(work)
+	wg.Wait()
+	stats.Chunks = len(snap.Chunks)
+
+	switch {
+	case firstErr != nil:
+		return snap, stats, firstErr
+	case readErr != nil:
+		return snap, stats, fmt.Errorf("read backup: %w", readErr)
+	case ctx.Err() != nil:
+		return snap, stats, ctx.Err()
+	}
+
+	if err := r.saveSnapshot(ctx, snap); err != nil {
+		return snap, stats, err
+	}
+	return snap, stats, nil
+}
+
+func (r *Repository) saveSnapshot(ctx context.Context, snap Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	key := snapshotPrefix + snap.ID
+	obj, err := r.seal(data, key)
+	if err != nil {
+		return err
+	}
+	if err := r.backend.Put(ctx, key, obj); err != nil {
+		return fmt.Errorf("write snapshot index: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot reads the snapshot with the given ID.
+func (r *Repository) LoadSnapshot(ctx context.Context, id string) (*Snapshot, error) {
+	key := snapshotPrefix + id
+	obj, err := r.backend.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNoSnapshot, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.open(obj, key)
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("parse snapshot %s: %w", id, err)
+	}
+	return &snap, nil
+}
+
+// Snapshots returns all snapshots, oldest first.
+func (r *Repository) Snapshots(ctx context.Context) ([]*Snapshot, error) {
+	objects, err := r.backend.List(ctx, snapshotPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots: %w", err)
+	}
+	var snaps []*Snapshot
+	for _, o := range objects {
+		snap, err := r.LoadSnapshot(ctx, strings.TrimPrefix(o.Key, snapshotPrefix))
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Time.Before(snaps[j].Time) })
+	return snaps, nil
+}
+
+// FindSnapshot returns the snapshot with the given ID, or with Latest the
+// newest one, of dbName if it is set.
+func (r *Repository) FindSnapshot(ctx context.Context, id, dbName string) (*Snapshot, error) {
+	if id != "" && id != Latest {
+		return r.LoadSnapshot(ctx, id)
+	}
+	snaps, err := r.Snapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if dbName == "" || snaps[i].DBName == dbName {
+			return snaps[i], nil
+		}
+	}
+	if dbName != "" {
+		return nil, fmt.Errorf("%w: no snapshot of %s", ErrNoSnapshot, dbName)
+	}
+	return nil, fmt.Errorf("%w: the repository is empty", ErrNoSnapshot)
+}
+
+// Restore writes the stream of snap to w, checking every chunk against its
+// ID and the total against the recorded size.
+func (r *Repository) Restore(ctx context.Context, snap *Snapshot, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	// Chunks are fetched in parallel but written in order: each fetch gets
+	// its own channel, queued in stream order.
+	pending := make(chan chan result, fetchAhead)
+	go func() {
+		defer close(pending)
+		for _, id := range snap.Chunks {
+			ch := make(chan result, 1)
+			select {
+			case pending <- ch:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				data, err := r.getChunk(ctx, id)
+				ch <- result{data, err}
+			}()
+		}
+	}()
+
+	var written int64
+	for ch := range pending {
+		res := <-ch
+		if res.err != nil {
+			return res.err
+		}
+		if _, err := w.Write(res.data); err != nil {
+			return err
+		}
+		written += int64(len(res.data))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if written != snap.Size {
+		return fmt.Errorf("snapshot %s: restored %d bytes, expected %d", snap.ID, written, snap.Size)
+	}
+	return nil
+}
+
+// Forget deletes a snapshot's index. Its chunks stay until a garbage
+// collection finds them unreferenced.
+func (r *Repository) Forget(ctx context.Context, id string) error {
+	if _, err := r.LoadSnapshot(ctx, id); err != nil {
+		return err
+	}
+	return r.backend.Delete(ctx, snapshotPrefix+id)
+}
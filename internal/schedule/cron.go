@@ -0,0 +1,223 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed standard 5-field cron expression:
+// minute hour day-of-month month day-of-week.
+type Cron struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// Per cron(8), when both day fields are restricted a day matches if
+	// either field matches.
+	domStar bool
+	dowStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day-of-month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day-of-week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a 5-field cron expression or one of the @yearly,
+// @annually, @monthly, @weekly, @daily, @midnight and @hourly macros.
+func ParseCron(expr string) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "@") {
+		m, ok := macros[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cron macro %q", spec)
+		}
+		spec = m
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, got %d", expr, len(parts))
+	}
+
+	c := &Cron{expr: expr}
+	var err error
+	if c.minute, err = parseField(parts[0], minuteField); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseField(parts[1], hourField); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseField(parts[2], domField); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseField(parts[3], monthField); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseField(parts[4], dowField); err != nil {
+		return nil, err
+	}
+
+	// 7 is an alias for Sunday.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	c.domStar = parts[2] == "*" || parts[2] == "?"
+	c.dowStar = parts[4] == "*" || parts[4] == "?"
+
+	return c, nil
+}
+
+// String returns the expression as written.
+func (c *Cron) String() string {
+	return c.expr
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		b, err := parseRange(part, f)
+		if err != nil {
+			return 0, fmt.Errorf("cron %s field %q: %w", f.name, s, err)
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+func parseRange(s string, f field) (uint64, error) {
+	rangePart, step := s, 1
+	if i := strings.Index(s, "/"); i >= 0 {
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid step %q", s[i+1:])
+		}
+		rangePart, step = s[:i], n
+	}
+
+	lo, hi := f.min, f.max
+	switch {
+	case rangePart == "*" || rangePart == "?":
+	case strings.Contains(rangePart, "-"):
+		bounds := strings.SplitN(rangePart, "-", 2)
+		var err error
+		if lo, err = parseValue(bounds[0], f); err != nil {
+			return 0, err
+		}
+		if hi, err = parseValue(bounds[1], f); err != nil {
+			return 0, err
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("range %q is backwards", rangePart)
+		}
+	default:
+		v, err := parseValue(rangePart, f)
+		if err != nil {
+			return 0, err
+		}
+		lo = v
+		if step == 1 {
+			hi = v
+		}
+	}
+
+	var bits uint64
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first activation strictly after t, in t's location.
+// Times that do not exist on the day clocks go forward are skipped. It
+// returns the zero time if the expression never matches within five years
+// (e.g. "0 0 30 2 *").
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	start := t
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	if !t.After(start) {
+		// In the repeated hour after clocks go back, the wall time
+		// resolves to its first occurrence.
+		t = start.Truncate(time.Minute).Add(time.Minute)
+	}
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+		default:
+			return t
+		}
+		// A wall time in a DST gap, such as 02:00 on the day clocks jump
+		// to 03:00, can resolve to before t. Step through the gap a
+		// minute at a time instead of going back.
+		if !next.After(t) {
+			next = t.Truncate(time.Minute).Add(time.Minute)
+		}
+		t = next
+	}
+
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	domOK := c.dom&(1<<uint(t.Day())) != 0
+	dowOK := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
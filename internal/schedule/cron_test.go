@@ -0,0 +1,111 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // DST cases need America/New_York wherever the tests run
+)
+
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	return loc
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"0 2 * * *", false},
+		{"*/15 9-17 * * mon-fri", false},
+		{"0 0 1,15 jan,JUL ?", false},
+		{"5/10 * * * 7", false},
+		{"@daily", false},
+		{"@HOURLY", false},
+		{"  @weekly  ", false},
+		{"@fortnightly", true},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"*/0 * * * *", true},
+		{"*/x * * * *", true},
+		{"10-5 * * * *", true},
+		{"a * * * *", true},
+		{"1,,2 * * * *", true},
+	}
+	for _, tt := range tests {
+		_, err := ParseCron(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	ny := newYork(t)
+	utc := func(y int, m time.Month, d, hh, mm, ss int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, 0, time.UTC)
+	}
+	// 2026-03-08 is the spring change in New York (02:00 EST -> 03:00 EDT)
+	// and 2026-11-01 the autumn one (02:00 EDT -> 01:00 EST).
+	springNY := func(hh, mm int) time.Time { return time.Date(2026, 3, 8, hh, mm, 0, 0, ny) }
+	firstHalf := time.Date(2026, 11, 1, 1, 40, 0, 0, ny) // 01:40 EDT
+	secondHalf := firstHalf.Add(time.Hour)               // 01:40 EST
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", utc(2026, 10, 19, 10, 0, 30), utc(2026, 10, 19, 10, 1, 0)},
+		{"strictly after", "0 2 * * *", utc(2026, 10, 19, 2, 0, 0), utc(2026, 10, 20, 2, 0, 0)},
+		{"later today", "0 2 * * *", utc(2026, 10, 19, 1, 59, 59), utc(2026, 10, 19, 2, 0, 0)},
+		{"step", "*/15 * * * *", utc(2026, 10, 19, 10, 16, 0), utc(2026, 10, 19, 10, 30, 0)},
+		{"range and list", "0 9-17/4 * * *", utc(2026, 10, 19, 13, 0, 0), utc(2026, 10, 19, 17, 0, 0)},
+		{"month rollover", "0 0 1 * *", utc(2026, 10, 19, 0, 0, 0), utc(2026, 11, 1, 0, 0, 0)},
+		{"year rollover", "@yearly", utc(2026, 10, 19, 0, 0, 0), utc(2027, 1, 1, 0, 0, 0)},
+		{"named month", "0 0 1 feb *", utc(2026, 10, 19, 0, 0, 0), utc(2027, 2, 1, 0, 0, 0)},
+		// 2026-10-19 is a Monday.
+		{"weekday", "0 8 * * fri", utc(2026, 10, 19, 0, 0, 0), utc(2026, 10, 23, 8, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", utc(2026, 10, 19, 0, 0, 0), utc(2026, 10, 25, 0, 0, 0)},
+		{"weekly", "@weekly", utc(2026, 10, 19, 0, 0, 0), utc(2026, 10, 25, 0, 0, 0)},
+		// With both day fields restricted, either one matching is enough.
+		{"dom or dow", "0 0 25 * mon", utc(2026, 10, 19, 12, 0, 0), utc(2026, 10, 25, 0, 0, 0)},
+		{"dow or dom", "0 0 31 * tue", utc(2026, 10, 19, 12, 0, 0), utc(2026, 10, 20, 0, 0, 0)},
+		{"leap day", "0 0 29 2 *", utc(2026, 10, 19, 0, 0, 0), utc(2028, 2, 29, 0, 0, 0)},
+		{"never", "0 0 30 2 *", utc(2026, 10, 19, 0, 0, 0), time.Time{}},
+		{"keeps location", "30 2 * * *", time.Date(2026, 6, 1, 0, 0, 0, 0, ny), time.Date(2026, 6, 1, 2, 30, 0, 0, ny)},
+		{"gap is skipped", "30 2 * * *", springNY(1, 50), time.Date(2026, 3, 9, 2, 30, 0, 0, ny)},
+		{"after the gap", "0 3 * * *", springNY(1, 50), springNY(3, 0)},
+		{"step across the gap", "*/15 * * * *", springNY(1, 50), springNY(3, 0)},
+		{"repeated hour, first", "*/15 * * * *", firstHalf, firstHalf.Add(5 * time.Minute)},
+		{"repeated hour, second", "*/15 * * * *", secondHalf, secondHalf.Add(5 * time.Minute)},
+		{"repeated hour fires once", "30 1 * * *", firstHalf, time.Date(2026, 11, 2, 1, 30, 0, 0, ny)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+			}
+			got := c.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+			if !got.IsZero() && got.Location() != tt.from.Location() {
+				t.Errorf("Next returned location %v, want %v", got.Location(), tt.from.Location())
+			}
+		})
+	}
+}
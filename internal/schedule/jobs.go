@@ -0,0 +1,109 @@
+package schedule
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+)
+
+// Job is a named backup config with a trigger evaluated in a fixed time zone.
+type Job struct {
+	Name       string
+	ConfigPath string
+	Trigger    Trigger
+	Location   *time.Location
+	Jitter     time.Duration // random delay in [0, Jitter) added to each fire time
+	CatchUp    bool          // run once on startup if a fire time was missed
+}
+
+// Defaults apply to jobs that do not set the corresponding field.
+type Defaults struct {
+	Jitter  time.Duration
+	CatchUp bool
+}
+
+// Next returns the job's first fire time strictly after t, before jitter.
+func (j Job) Next(t time.Time) time.Time {
+	return j.Trigger.Next(t.In(j.Location))
+}
+
+// NextN returns the job's next n fire times after t.
+func (j Job) NextN(t time.Time, n int) []time.Time {
+	var times []time.Time
+	for i := 0; i < n; i++ {
+		t = j.Next(t)
+		if t.IsZero() {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+// delay returns a random jitter for one run.
+func (j Job) delay() time.Duration {
+	if j.Jitter <= 0 {
+		return 0
+	}
+	return rand.N(j.Jitter)
+}
+
+// NewJobs validates a jobs file and parses each job's schedule and time zone.
+func NewJobs(cfg *config.JobsConfig, defaults Defaults) ([]Job, error) {
+	if len(cfg.Jobs) == 0 {
+		return nil, fmt.Errorf("jobs file has no jobs")
+	}
+
+	seen := map[string]bool{}
+	jobs := make([]Job, 0, len(cfg.Jobs))
+	for i, jc := range cfg.Jobs {
+		if jc.Name == "" {
+			return nil, fmt.Errorf("job %d: name is required", i)
+		}
+		if seen[jc.Name] {
+			return nil, fmt.Errorf("job %q: duplicate name", jc.Name)
+		}
+		seen[jc.Name] = true
+
+		if jc.Config == "" {
+			return nil, fmt.Errorf("job %q: config is required", jc.Name)
+		}
+
+		cron, err := ParseCron(jc.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("job %q: %w", jc.Name, err)
+		}
+
+		loc := time.Local
+		if jc.Timezone != "" {
+			if loc, err = time.LoadLocation(jc.Timezone); err != nil {
+				return nil, fmt.Errorf("job %q: load timezone: %w", jc.Name, err)
+			}
+		}
+
+		jitter := defaults.Jitter
+		if jc.Jitter != "" {
+			if jitter, err = time.ParseDuration(jc.Jitter); err != nil {
+				return nil, fmt.Errorf("job %q: parse jitter: %w", jc.Name, err)
+			}
+		}
+
+		catchUp := defaults.CatchUp
+		if jc.CatchUp != nil {
+			catchUp = *jc.CatchUp
+		}
+
+		jobs = append(jobs, Job{
+			Name:       jc.Name,
+			ConfigPath: jc.Config,
+			Trigger:    cron,
+			Location:   loc,
+			Jitter:     jitter,
+			CatchUp:    catchUp,
+		})
+	}
+
+	return jobs, nil
+}
@@ -0,0 +1,64 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/config"
+)
+
+func TestJobDelay(t *testing.T) {
+	for _, jitter := range []time.Duration{0, -time.Minute} {
+		if d := (Job{Jitter: jitter}).delay(); d != 0 {
+			t.Errorf("delay with jitter %s = %s, want 0", jitter, d)
+		}
+	}
+
+	j := Job{Jitter: 10 * time.Minute}
+	seen := map[time.Duration]bool{}
+	for range 1000 {
+		d := j.delay()
+		if d < 0 || d >= j.Jitter {
+			t.Fatalf("delay = %s, want in [0, %s)", d, j.Jitter)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 900 {
+		t.Errorf("%d distinct delays in 1000 draws, want them spread out", len(seen))
+	}
+}
+
+func TestNewJobs(t *testing.T) {
+	no := false
+	cfg := &config.JobsConfig{Jobs: []config.JobConfig{
+		{Name: "orders", Cron: "30 2 * * *", Config: "orders.json"},
+		{Name: "billing", Cron: "@hourly", Config: "billing.json", Timezone: "Asia/Kolkata", Jitter: "90s", CatchUp: &no},
+	}}
+	jobs, err := NewJobs(cfg, Defaults{Jitter: 10 * time.Minute, CatchUp: true})
+	if err != nil {
+		t.Fatalf("NewJobs: %v", err)
+	}
+	if got := jobs[0]; got.Jitter != 10*time.Minute || !got.CatchUp || got.Location != time.Local {
+		t.Errorf("orders = jitter %s, catch-up %v, %s; want the defaults", got.Jitter, got.CatchUp, got.Location)
+	}
+	if got := jobs[1]; got.Jitter != 90*time.Second || got.CatchUp || got.Location.String() != "Asia/Kolkata" {
+		t.Errorf("billing = jitter %s, catch-up %v, %s; want its own settings", got.Jitter, got.CatchUp, got.Location)
+	}
+
+	// Fire times are in the job's zone; jitter is added by the runner.
+	from := time.Date(2026, 10, 19, 10, 10, 0, 0, time.UTC) // 15:40 in Kolkata
+	if got, want := jobs[1].Next(from), time.Date(2026, 10, 19, 10, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("billing Next = %v, want %v", got, want)
+	}
+
+	for _, bad := range []config.JobConfig{
+		{Name: "x", Cron: "@daily", Config: "x.json", Jitter: "soon"},
+		{Name: "x", Cron: "@daily", Config: "x.json", Timezone: "Mars/Olympus"},
+		{Name: "x", Cron: "61 * * * *", Config: "x.json"},
+		{Name: "x", Cron: "@daily"},
+	} {
+		if _, err := NewJobs(&config.JobsConfig{Jobs: []config.JobConfig{bad}}, Defaults{}); err == nil {
+			t.Errorf("NewJobs(%+v) succeeded, want an error", bad)
+		}
+	}
+}
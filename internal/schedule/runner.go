@@ -0,0 +1,213 @@
+package schedule
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/logs"
+)
+
+// maxSkippedCount bounds how far ahead skipped fire times are counted.
+const maxSkippedCount = 1000
+
+// Runner drives a set of jobs. Each job runs in its own loop, so a slow run
+// delays that job's next trigger instead of overlapping it, and never holds
+// up other jobs.
+type Runner struct {
+	Jobs  []Job
+	State *State
+	Run   func(context.Context, Job) error
+
+	// Leader, if set, limits runs to the host currently holding a shared
+	// lock; other hosts skip their triggers.
+	Leader Leadership
+
+	// Events, if set, is called for everything the runner does, from the
+	// jobs' goroutines.
+	Events func(Event)
+}
+
+// Event types.
+const (
+	EventNext    = "next"     // the next fire time was computed
+	EventCatchUp = "catch-up" // a missed or unfinished run is run now
+	EventStart   = "start"
+	EventFinish  = "finish"
+	EventStandby = "standby" // skipped: another host holds the lock
+	EventOverlap = "overlap" // triggers passed while the job was running
+	EventDone    = "done"    // the job has no future fire time
+)
+
+// Event is something the runner did with a job.
+type Event struct {
+	Type      string
+	Job       string
+	Time      time.Time
+	Scheduled time.Time // the trigger the event is about, zero if none
+	Status    string    // EventFinish: success, failure or interrupted
+	Skipped   int       // EventOverlap: how many triggers
+	Err       error     // EventFinish: the run's error
+}
+
+func (r *Runner) event(e Event) {
+	if r.Events == nil {
+		return
+	}
+	e.Time = time.Now()
+	r.Events(e)
+}
+
+// Leadership reports whether this process may run jobs right now. The
+// returned context is cancelled if leadership is lost.
+type Leadership interface {
+	Leader() (context.Context, bool)
+}
+
+// Start runs every job until ctx is cancelled, then waits for in-flight runs
+// (which see the same cancelled ctx) to return.
+func (r *Runner) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, j := range r.Jobs {
+		wg.Add(1)
+		go func(j Job) {
+			defer wg.Done()
+			r.loop(ctx, j)
+		}(j)
+	}
+	wg.Wait()
+}
+
+func (r *Runner) loop(ctx context.Context, j Job) {
+	if j.CatchUp {
+		r.catchUp(ctx, j)
+	}
+
+	for ctx.Err() == nil {
+		next := j.Next(time.Now())
+		if next.IsZero() {
+			console.Println("Job", j.Name, "has no future fire time; stopping it")
+			r.event(Event{Type: EventDone, Job: j.Name})
+			logs.Error("Job %s has no future fire time; stopping it", j.Name)
+			return
+		}
+
+		fire := next.Add(j.delay())
+		console.Println("Next backup for", j.Name, "at:", fire.Format(time.RFC3339))
+		r.event(Event{Type: EventNext, Job: j.Name, Scheduled: fire})
+		logs.Info("Next backup for %s at: %s (trigger %s, in %s)", j.Name, fire.Format(time.RFC3339), next.Format(time.RFC3339), time.Until(fire).String())
+
+		timer := time.NewTimer(time.Until(fire))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		r.execute(ctx, j, next)
+
+		if skipped := countFires(j, next, time.Now()); skipped > 0 {
+			console.Printf("Job %s: skipped %d trigger(s) while the previous run was in progress\n", j.Name, skipped)
+			r.event(Event{Type: EventOverlap, Job: j.Name, Skipped: skipped})
+			logs.Error("Job %s: skipped %d trigger(s) while the previous run was in progress", j.Name, skipped)
+		}
+	}
+}
+
+// catchUp runs j once if its state shows a fire time was missed while the
+// scheduler was not running, or its last run never finished because the
+// scheduler was stopped or crashed.
+func (r *Runner) catchUp(ctx context.Context, j Job) {
+	st, ok := r.State.Get(j.Name)
+	if !ok || st.LastScheduled.IsZero() {
+		return
+	}
+
+	if st.LastStatus == "running" || st.LastStatus == "interrupted" {
+		console.Println("Job", j.Name, "did not finish its run at", st.LastScheduled.Format(time.RFC3339), "- running it again now")
+		r.event(Event{Type: EventCatchUp, Job: j.Name, Scheduled: st.LastScheduled})
+		logs.Info("Job %s last run (%s) is %s; running it again", j.Name, st.LastScheduled.Format(time.RFC3339), st.LastStatus)
+		r.execute(ctx, j, st.LastScheduled)
+		return
+	}
+
+	missed := j.Next(st.LastScheduled)
+	if missed.IsZero() || !missed.Before(time.Now()) {
+		return
+	}
+
+	console.Println("Job", j.Name, "missed its run at", missed.Format(time.RFC3339), "- catching up now")
+	r.event(Event{Type: EventCatchUp, Job: j.Name, Scheduled: missed})
+	logs.Info("Job %s missed its run at %s (last scheduled %s); catching up", j.Name, missed.Format(time.RFC3339), st.LastScheduled.Format(time.RFC3339))
+
+	// Record the most recent missed trigger so a crash during catch-up does
+	// not replay the same window again.
+	latest := missed
+	for t := j.Next(missed); !t.IsZero() && t.Before(time.Now()); t = j.Next(t) {
+		latest = t
+	}
+	r.execute(ctx, j, latest)
+}
+
+func (r *Runner) execute(ctx context.Context, j Job, scheduled time.Time) {
+	if r.Leader != nil {
+		leaderCtx, ok := r.Leader.Leader()
+		if !ok {
+			console.Println("Skipping job", j.Name, "- another host holds the scheduler lock")
+			r.event(Event{Type: EventStandby, Job: j.Name, Scheduled: scheduled})
+			logs.Info("Skipping job %s at %s: standby, lock held elsewhere", j.Name, scheduled.Format(time.RFC3339))
+
+			js, _ := r.State.Get(j.Name)
+			js.LastScheduled = scheduled
+			js.LastStatus = "standby"
+			js.LastError = ""
+			r.save(j, js)
+			return
+		}
+		ctx = leaderCtx
+	}
+
+	js := JobState{
+		LastScheduled: scheduled,
+		LastStart:     time.Now(),
+		LastStatus:    "running",
+	}
+	r.save(j, js)
+
+	console.Println("Running job", j.Name, "at", js.LastStart.Format(time.RFC3339))
+	r.event(Event{Type: EventStart, Job: j.Name, Scheduled: scheduled})
+	logs.Info("Running job %s at %s (trigger %s)", j.Name, js.LastStart.Format(time.RFC3339), scheduled.Format(time.RFC3339))
+
+	err := r.Run(ctx, j)
+
+	js.LastEnd = time.Now()
+	js.LastStatus = "success"
+	switch {
+	case err != nil && ctx.Err() != nil:
+		js.LastStatus = "interrupted"
+		js.LastError = err.Error()
+	case err != nil:
+		js.LastStatus = "failure"
+		js.LastError = err.Error()
+	}
+	r.save(j, js)
+	r.event(Event{Type: EventFinish, Job: j.Name, Scheduled: scheduled, Status: js.LastStatus, Err: err})
+}
+
+func (r *Runner) save(j Job, js JobState) {
+	if err := r.State.Put(j.Name, js); err != nil {
+		console.Println("Warning: could not save schedule state:", err)
+		logs.Error("Could not save schedule state for %s: %v", j.Name, err)
+	}
+}
+
+// countFires counts fire times of j strictly after from and before until.
+func countFires(j Job, from, until time.Time) int {
+	n := 0
+	for t := j.Next(from); !t.IsZero() && t.Before(until) && n < maxSkippedCount; t = j.Next(t) {
+		n++
+	}
+	return n
+}
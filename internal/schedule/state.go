@@ -0,0 +1,72 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+)
+
+// JobState is what the scheduler remembers about a job across restarts.
+type JobState struct {
+	LastScheduled time.Time `json:"lastScheduled"` // trigger time of the last run
+	LastStart     time.Time `json:"lastStart"`
+	LastEnd       time.Time `json:"lastEnd"`
+	LastStatus    string    `json:"lastStatus"` // "running", "success", "failure", "interrupted" or "standby"
+	LastError     string    `json:"lastError,omitempty"`
+}
+
+// State is the persisted last-run state of every job, stored as JSON.
+type State struct {
+	path string
+	mu   sync.Mutex
+	jobs map[string]JobState
+}
+
+// LoadState reads the state file at path. A missing file yields empty state.
+func LoadState(path string) (*State, error) {
+	s := &State{path: path, jobs: map[string]JobState{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read schedule state: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.jobs); err != nil {
+		return nil, fmt.Errorf("parse schedule state: %w", err)
+	}
+
+	return s, nil
+}
+
+// Get returns the recorded state of a job.
+func (s *State) Get(name string) (JobState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	js, ok := s.jobs[name]
+	return js, ok
+}
+
+// Put records the state of a job and saves the file atomically.
+func (s *State) Put(name string, js JobState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[name] = js
+
+	data, err := json.MarshalIndent(s.jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode schedule state: %w", err)
+	}
+
+	if err := fsutil.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("save schedule state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Trigger computes fire times. Implementations anchor to wall-clock time, so
+// the next fire time never depends on how long the previous run took.
+type Trigger interface {
+	// Next returns the first fire time strictly after t, or the zero time if
+	// there is none.
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// Interval fires at every multiple of Every counted from local midnight
+// (1h fires at the top of each hour, 6h at 00:00, 06:00, 12:00 and 18:00).
+// The count starts again each midnight, so an Every that does not divide
+// a day, such as 7h, fires at 00:00, 07:00, 14:00 and 21:00 every day.
+// An Every of a day or more is counted from midnight on 1970-01-01 in local
+// time, so 48h fires on even days since then and 168h on Thursdays.
+type Interval struct {
+	Every time.Duration
+}
+
+// Next returns the first firing time after t.
+func (i Interval) Next(t time.Time) time.Time {
+	if i.Every <= 0 {
+		return time.Time{}
+	}
+	if i.Every >= 24*time.Hour {
+		// Count on the wall clock from 1970-01-01 00:00, so a DST change
+		// does not move the fire time off midnight. Truncate would count
+		// from year 1, which shifts periods that are not a whole number
+		// of two days, such as a week.
+		y, m, d := t.Date()
+		hh, mm, ss := t.Clock()
+		wall := time.Date(y, m, d, hh, mm, ss, t.Nanosecond(), time.UTC)
+		rem := wall.Sub(time.Unix(0, 0)) % i.Every
+		if rem < 0 {
+			rem += i.Every
+		}
+		next := wall.Add(i.Every - rem)
+		y, m, d = next.Date()
+		hh, mm, ss = next.Clock()
+		return time.Date(y, m, d, hh, mm, ss, next.Nanosecond(), t.Location())
+	}
+	// Multiples are of the wall clock, so on a day with a DST change 6h
+	// still fires at 06:00, 12:00 and 18:00.
+	y, m, d := t.Date()
+	hh, mm, ss := t.Clock()
+	wall := time.Duration(hh)*time.Hour + time.Duration(mm)*time.Minute +
+		time.Duration(ss)*time.Second + time.Duration(t.Nanosecond())
+	for k := wall/i.Every + 1; ; k++ {
+		if k*i.Every >= 24*time.Hour {
+			return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		}
+		// A time in a DST gap or repeated hour may not come after t.
+		if next := time.Date(y, m, d, 0, 0, 0, int(k*i.Every), t.Location()); next.After(t) {
+			return next
+		}
+	}
+}
+
+func (i Interval) String() string {
+	return "every " + i.Every.String()
+}
+
+// Daily returns a trigger firing once a day at hh:mm local time.
+func Daily(hhmm string) (Trigger, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return nil, fmt.Errorf("parse daily time (expected HH:MM): %w", err)
+	}
+	return ParseCron(fmt.Sprintf("%d %d * * *", t.Minute(), t.Hour()))
+}
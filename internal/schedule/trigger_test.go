@@ -0,0 +1,76 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntervalNext(t *testing.T) {
+	ny := newYork(t)
+	ist := time.FixedZone("IST", 5*3600+1800)
+	at := func(loc *time.Location, y int, m time.Month, d, hh, mm int) time.Time {
+		return time.Date(y, m, d, hh, mm, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name  string
+		every time.Duration
+		from  time.Time
+		want  time.Time
+	}{
+		{"zero", 0, at(time.UTC, 2026, 10, 19, 10, 0), time.Time{}},
+		{"negative", -time.Hour, at(time.UTC, 2026, 10, 19, 10, 0), time.Time{}},
+		{"hourly", time.Hour, at(time.UTC, 2026, 10, 19, 10, 20), at(time.UTC, 2026, 10, 19, 11, 0)},
+		{"strictly after", time.Hour, at(time.UTC, 2026, 10, 19, 10, 0), at(time.UTC, 2026, 10, 19, 11, 0)},
+		{"six hours", 6 * time.Hour, at(time.UTC, 2026, 10, 19, 13, 0), at(time.UTC, 2026, 10, 19, 18, 0)},
+		{"to midnight", 6 * time.Hour, at(time.UTC, 2026, 10, 19, 19, 0), at(time.UTC, 2026, 10, 20, 0, 0)},
+		{"uneven restarts at midnight", 7 * time.Hour, at(time.UTC, 2026, 10, 19, 22, 0), at(time.UTC, 2026, 10, 20, 0, 0)},
+		{"uneven", 7 * time.Hour, at(time.UTC, 2026, 10, 19, 8, 0), at(time.UTC, 2026, 10, 19, 14, 0)},
+		{"local midnight", 6 * time.Hour, at(ist, 2026, 10, 19, 1, 0), at(ist, 2026, 10, 19, 6, 0)},
+		{"minutes", 90 * time.Minute, at(ist, 2026, 10, 19, 1, 0), at(ist, 2026, 10, 19, 1, 30)},
+		{"daily", 24 * time.Hour, at(time.UTC, 2026, 10, 19, 13, 0), at(time.UTC, 2026, 10, 20, 0, 0)},
+		{"daily local", 24 * time.Hour, at(ist, 2026, 10, 19, 13, 0), at(ist, 2026, 10, 20, 0, 0)},
+		// 2026-10-19 is day 20745 since 1970-01-01, a Thursday, so two-day
+		// periods start on day 20746 and weeks on Thursday 2026-10-22.
+		{"two days", 48 * time.Hour, at(time.UTC, 2026, 10, 19, 13, 0), at(time.UTC, 2026, 10, 20, 0, 0)},
+		{"two days from start", 48 * time.Hour, at(time.UTC, 2026, 10, 20, 0, 0), at(time.UTC, 2026, 10, 22, 0, 0)},
+		{"two days local", 48 * time.Hour, at(ist, 2026, 10, 20, 3, 0), at(ist, 2026, 10, 22, 0, 0)},
+		{"week", 7 * 24 * time.Hour, at(time.UTC, 2026, 10, 19, 13, 0), at(time.UTC, 2026, 10, 22, 0, 0)},
+		{"week from start", 7 * 24 * time.Hour, at(time.UTC, 2026, 10, 22, 0, 0), at(time.UTC, 2026, 10, 29, 0, 0)},
+		{"week local", 7 * 24 * time.Hour, at(ist, 2026, 10, 22, 0, 0), at(ist, 2026, 10, 29, 0, 0)},
+		{"week across fall change", 7 * 24 * time.Hour, at(ny, 2026, 10, 30, 12, 0), at(ny, 2026, 11, 5, 0, 0)},
+		{"daily across spring change", 24 * time.Hour, at(ny, 2026, 3, 7, 12, 0), at(ny, 2026, 3, 8, 0, 0)},
+		{"daily on spring change", 24 * time.Hour, at(ny, 2026, 3, 8, 12, 0), at(ny, 2026, 3, 9, 0, 0)},
+		{"before the epoch", 48 * time.Hour, at(time.UTC, 1969, 12, 30, 12, 0), at(time.UTC, 1970, 1, 1, 0, 0)},
+		{"wall clock after spring change", 6 * time.Hour, at(ny, 2026, 3, 8, 1, 0), at(ny, 2026, 3, 8, 6, 0)},
+		{"gap", time.Hour, at(ny, 2026, 3, 8, 1, 30), at(ny, 2026, 3, 8, 3, 0)},
+		{"wall clock after autumn change", 6 * time.Hour, at(ny, 2026, 11, 1, 1, 0), at(ny, 2026, 11, 1, 6, 0)},
+		{"repeated hour, second", 30 * time.Minute, at(ny, 2026, 11, 1, 1, 15).Add(time.Hour), at(ny, 2026, 11, 1, 2, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Interval{Every: tt.every}.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDaily(t *testing.T) {
+	tr, err := Daily("02:30")
+	if err != nil {
+		t.Fatalf("Daily: %v", err)
+	}
+	from := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	if got, want := tr.Next(from), time.Date(2026, 10, 20, 2, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"", "2:3", "24:00", "02:60", "noon"} {
+		if _, err := Daily(bad); err == nil {
+			t.Errorf("Daily(%q) succeeded, want an error", bad)
+		}
+	}
+}
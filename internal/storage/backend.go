@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+	"github.com/bhagashetti/db-backup-cli/internal/throttle"
+)
+
+// Backend stores small objects by key, such as the chunks and indexes of a
+// backup repository. Keys use "/" as separator.
+type Backend interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error) // ErrNotFound if missing
+	List(ctx context.Context, prefix string) ([]Object, error)
+	Delete(ctx context.Context, key string) error
+	String() string
+}
+
+// Object describes a stored object.
+type Object struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+}
+
+// OpenBackend returns the backend for location: "s3://bucket/prefix" or a
+// local directory. region is only used for S3; empty means the AWS default.
+func OpenBackend(ctx context.Context, location, region string) (Backend, error) {
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("no bucket in %q", location)
+		}
+		return NewS3Backend(ctx, bucket, region, prefix)
+	}
+	if location == "" {
+		return nil, errors.New("no repository location")
+	}
+	return &LocalBackend{Dir: location}, nil
+}
+
+// Throttled returns b with its writes limited by l. With a nil limiter it
+// returns b.
+func Throttled(b Backend, l *throttle.Limiter) Backend {
+	if l == nil {
+		return b
+	}
+	return &throttled{b, l}
+}
+
+type throttled struct {
+	Backend
+	l *throttle.Limiter
+}
+
+func (t *throttled) Put(ctx context.Context, key string, data []byte) error {
+	if err := t.l.Wait(ctx, len(data)); err != nil {
+		return err
+	}
+	return t.Backend.Put(ctx, key, data)
+}
+
+// LocalBackend keeps objects as files below Dir.
+type LocalBackend struct {
+	Dir string
+}
+
+func (b *LocalBackend) path(key string) string {
+	return filepath.Join(b.Dir, filepath.FromSlash(key))
+}
+
+func (b *LocalBackend) Put(ctx context.Context, key string, data []byte) error {
+	p := b.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	return fsutil.WriteFile(p, data, 0600)
+}
+
+func (b *LocalBackend) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(b.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return data, err
+}
+
+func (b *LocalBackend) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	root := b.path(prefix)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == root {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Skip the temporary files of unfinished writes.
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(b.Dir, p)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: filepath.ToSlash(rel), Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	return objects, err
+}
+
+func (b *LocalBackend) Delete(ctx context.Context, key string) error {
+	err := os.Remove(b.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (b *LocalBackend) String() string { return b.Dir }
+
+// S3Backend keeps objects in a bucket below a key prefix.
+type S3Backend struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Backend returns a backend for bucket, with keys below prefix.
+func NewS3Backend(ctx context.Context, bucket, region, prefix string) (*S3Backend, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &S3Backend{client: s3.NewFromConfig(cfg), bucket: bucket, prefix: prefix}, nil
+}
+
+func (b *S3Backend) Put(ctx context.Context, key string, data []byte) error {
+	_, err := b.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        &b.bucket,
+		Key:           aws.String(b.prefix + key),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ACL:           types.ObjectCannedACLPrivate,
+	})
+	if err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	return nil
+}
+
+func (b *S3Backend) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := b.client.GetObject(ctx, &s3.GetObjectInput{Bucket: &b.bucket, Key: aws.String(b.prefix + key)})
+	if err != nil {
+		var missing *types.NoSuchKey
+		if errors.As(err, &missing) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (b *S3Backend) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	p := s3.NewListObjectsV2Paginator(b.client, &s3.ListObjectsV2Input{
+		Bucket: &b.bucket,
+		Prefix: aws.String(b.prefix + prefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, err)
+		}
+		for _, o := range page.Contents {
+			objects = append(objects, Object{
+				Key:      strings.TrimPrefix(aws.ToString(o.Key), b.prefix),
+				Size:     aws.ToInt64(o.Size),
+				Modified: aws.ToTime(o.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	_, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &b.bucket, Key: aws.String(b.prefix + key)})
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (b *S3Backend) String() string {
+	return "s3://" + path.Join(b.bucket, b.prefix)
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLocalBackend(t *testing.T) {
+	ctx := context.Background()
+	b := &LocalBackend{Dir: t.TempDir()}
+
+	objects := map[string]string{
+		"config":                "{}",
+		"chunks/ab/abcdef":      "chunk one",
+		"chunks/cd/cdef01":      "chunk two",
+		"snapshots/2026-10-19":  "index",
+		"snapshots/keep/nested": "deeper",
+	}
+	for key, data := range objects {
+		if err := b.Put(ctx, key, []byte(data)); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+	// Overwriting replaces the object.
+	if err := b.Put(ctx, "config", []byte(`{"version":1}`)); err != nil {
+		t.Fatalf("Put config again: %v", err)
+	}
+	if data, err := b.Get(ctx, "config"); err != nil || string(data) != `{"version":1}` {
+		t.Errorf("Get config = %q, %v", data, err)
+	}
+	if data, err := b.Get(ctx, "chunks/ab/abcdef"); err != nil || string(data) != "chunk one" {
+		t.Errorf("Get chunk = %q, %v", data, err)
+	}
+	if _, err := b.Get(ctx, "chunks/ff/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+
+	// A write cut short leaves a dot-file that List must not report.
+	if err := os.WriteFile(filepath.Join(b.Dir, "chunks", "ab", ".abcdef.tmp123"), []byte("part"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"chunks", []string{"chunks/ab/abcdef", "chunks/cd/cdef01"}},
+		{"snapshots", []string{"snapshots/2026-10-19", "snapshots/keep/nested"}},
+		{"locks", nil},
+	}
+	for _, tt := range tests {
+		list, err := b.List(ctx, tt.prefix)
+		if err != nil {
+			t.Fatalf("List %s: %v", tt.prefix, err)
+		}
+		var keys []string
+		for _, o := range list {
+			keys = append(keys, o.Key)
+			if want := int64(len(objects[o.Key])); o.Size != want {
+				t.Errorf("%s size = %d, want %d", o.Key, o.Size, want)
+			}
+			if o.Modified.IsZero() {
+				t.Errorf("%s has no modification time", o.Key)
+			}
+		}
+		slices.Sort(keys)
+		if !slices.Equal(keys, tt.want) {
+			t.Errorf("List %s = %q, want %q", tt.prefix, keys, tt.want)
+		}
+	}
+
+	if err := b.Delete(ctx, "chunks/ab/abcdef"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := b.Get(ctx, "chunks/ab/abcdef"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	// Deleting twice is not an error, so an interrupted gc can run again.
+	if err := b.Delete(ctx, "chunks/ab/abcdef"); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+}
+
+func TestOpenBackend(t *testing.T) {
+	// Keep the S3 cases away from any real AWS configuration.
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	dir := t.TempDir()
+	tests := []struct {
+		location string
+		want     string
+		wantErr  string
+	}{
+		{dir, dir, ""},
+		{"s3://backups", "s3://backups", ""},
+		{"s3://backups/shop", "s3://backups/shop", ""},
+		{"s3://backups/shop/", "s3://backups/shop", ""},
+		{"s3:///shop", "", "no bucket"},
+		{"", "", "no repository location"},
+	}
+	for _, tt := range tests {
+		b, err := OpenBackend(context.Background(), tt.location, "eu-west-1")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("OpenBackend(%q) error = %v, want one containing %q", tt.location, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("OpenBackend(%q): %v", tt.location, err)
+			continue
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("OpenBackend(%q) = %s, want %s", tt.location, got, tt.want)
+		}
+	}
+
+	b, err := OpenBackend(context.Background(), "s3://backups/shop", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := b.(*S3Backend).prefix; p != "shop/" {
+		t.Errorf("S3 prefix = %q, want %q", p, "shop/")
+	}
+}
@@ -2,19 +2,40 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/bhagashetti/db-backup-cli/internal/console"
+	"github.com/bhagashetti/db-backup-cli/internal/fsutil"
+	"github.com/bhagashetti/db-backup-cli/internal/progress"
+	"github.com/bhagashetti/db-backup-cli/internal/throttle"
 )
 
-// UploadToS3 uploads the given filePath to the given bucket/region with the provided key.
-func UploadToS3(bucket, region, key, filePath string) error {
-	ctx := context.Background()
+const (
+	// Files larger than this are sent as a multipart upload.
+	multipartThreshold = 64 * 1024 * 1024
+	minPartSize        = 16 * 1024 * 1024
+	maxParts           = 10000
+
+	// abortTimeout bounds the cleanup call after a failed or cancelled
+	// multipart upload; it runs after ctx is already done.
+	abortTimeout = 30 * time.Second
+)
 
+// UploadToS3 uploads the given filePath to the given bucket/region with the provided key.
+// Cancelling ctx stops the upload; an unfinished multipart upload is aborted
+// so no orphaned parts are left in the bucket. limit, if not nil, caps the
+// upload rate.
+func UploadToS3(ctx context.Context, bucket, region, key, filePath string, limit *throttle.Limiter) error {
 	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
 	if err != nil {
 		return fmt.Errorf("load AWS config: %w", err)
@@ -28,15 +49,24 @@ func UploadToS3(bucket, region, key, filePath string) error {
 	}
 	defer f.Close()
 
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat file for S3 upload: %w", err)
+	}
+
 	// if key empty, just use file name
 	if key == "" {
 		key = filepath.Base(filePath)
 	}
 
+	if info.Size() > multipartThreshold {
+		return uploadMultipart(ctx, client, bucket, key, f, info.Size(), limit)
+	}
+
 	_, err = client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket: &bucket,
 		Key:    &key,
-		Body:   f,
+		Body:   progress.FromContext(ctx).ReadSeeker(throttle.ReadSeeker(ctx, f, limit)),
 		ACL:    types.ObjectCannedACLPrivate,
 	})
 	if err != nil {
@@ -45,3 +75,102 @@ func UploadToS3(bucket, region, key, filePath string) error {
 
 	return nil
 }
+
+func uploadMultipart(ctx context.Context, client *s3.Client, bucket, key string, f *os.File, size int64, limit *throttle.Limiter) error {
+	partSize := int64(minPartSize)
+	for size/partSize >= maxParts {
+		partSize *= 2
+	}
+
+	created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: &bucket,
+		Key:    &key,
+		ACL:    types.ObjectCannedACLPrivate,
+	})
+	if err != nil {
+		return fmt.Errorf("create multipart upload: %w", err)
+	}
+	uploadID := created.UploadId
+
+	var parts []types.CompletedPart
+	for offset, number := int64(0), int32(1); offset < size; offset, number = offset+partSize, number+1 {
+		n := min(partSize, size-offset)
+		out, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        &bucket,
+			Key:           &key,
+			UploadId:      uploadID,
+			PartNumber:    aws.Int32(number),
+			Body:          progress.FromContext(ctx).ReadSeeker(throttle.ReadSeeker(ctx, io.NewSectionReader(f, offset, n), limit)),
+			ContentLength: aws.Int64(n),
+		})
+		if err != nil {
+			abortMultipart(client, bucket, key, uploadID)
+			return fmt.Errorf("upload part %d: %w", number, err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(number)})
+	}
+
+	_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &bucket,
+		Key:             &key,
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		abortMultipart(client, bucket, key, uploadID)
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+
+	return nil
+}
+
+func abortMultipart(client *s3.Client, bucket, key string, uploadID *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+
+	if _, err := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &bucket,
+		Key:      &key,
+		UploadId: uploadID,
+	}); err != nil {
+		console.Println("Warning: could not abort multipart upload", aws.ToString(uploadID)+":", err)
+	}
+}
+
+// ErrNotFound reports that an object does not exist in the bucket.
+var ErrNotFound = errors.New("object not found")
+
+// DownloadFromS3 writes the object at key to filePath. filePath only appears
+// once the download is complete. A missing object returns ErrNotFound.
+func DownloadFromS3(ctx context.Context, bucket, region, key, filePath string) error {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
+	if err != nil {
+		return fmt.Errorf("load AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(cfg)
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		var missing *types.NoSuchKey
+		if errors.As(err, &missing) {
+			return fmt.Errorf("s3://%s/%s: %w", bucket, key, ErrNotFound)
+		}
+		return fmt.Errorf("get object from S3: %w", err)
+	}
+	defer out.Body.Close()
+
+	f, err := fsutil.Create(filePath, 0600)
+	if err != nil {
+		return fmt.Errorf("create file for S3 download: %w", err)
+	}
+	defer f.Abort()
+
+	if _, err := io.Copy(f, out.Body); err != nil {
+		return fmt.Errorf("download s3://%s/%s: %w", bucket, key, err)
+	}
+	return f.Commit()
+}
@@ -0,0 +1,208 @@
+// Package throttle limits the rate of byte streams, with optional
+// time-of-day windows that change the limit, e.g. to go faster overnight.
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Window overrides the base rate between two times of day, local time.
+// From after To wraps past midnight.
+type Window struct {
+	From time.Duration // since midnight
+	To   time.Duration
+	Rate int64 // bytes per second, 0 for unlimited
+}
+
+func (w Window) contains(t time.Time) bool {
+	y, m, d := t.Date()
+	since := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	if w.From <= w.To {
+		return since >= w.From && since < w.To
+	}
+	return since >= w.From || since < w.To
+}
+
+// Limiter is a token bucket shared by every stream it limits, holding up
+// to one second of traffic. A nil *Limiter does not limit.
+type Limiter struct {
+	base    int64
+	windows []Window
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// New returns a limiter of base bytes per second, changed by the first
+// matching window. It returns nil if nothing is ever limited.
+func New(base int64, windows []Window) *Limiter {
+	limited := base > 0
+	for _, w := range windows {
+		limited = limited || w.Rate > 0
+	}
+	if !limited {
+		return nil
+	}
+	return &Limiter{base: base, windows: windows}
+}
+
+// Rate returns the limit in force at t, 0 meaning unlimited.
+func (l *Limiter) Rate(t time.Time) int64 {
+	if l == nil {
+		return 0
+	}
+	for _, w := range l.windows {
+		if w.contains(t) {
+			return w.Rate
+		}
+	}
+	return l.base
+}
+
+// Wait blocks until n more bytes may pass.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	for n > 0 {
+		now := time.Now()
+		rate := l.Rate(now)
+		if rate <= 0 {
+			return nil
+		}
+		take := min(int64(n), rate)
+
+		l.mu.Lock()
+		if !l.last.IsZero() {
+			l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+		}
+		l.tokens = min(l.tokens, float64(rate))
+		l.last = now
+		l.tokens -= float64(take)
+		wait := time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+		l.mu.Unlock()
+
+		if wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+		}
+		n -= int(take)
+	}
+	return nil
+}
+
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *Limiter
+}
+
+// Reader limits reads from r. With a nil limiter it returns r.
+func Reader(ctx context.Context, r io.Reader, l *Limiter) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{ctx, r, l}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if werr := r.l.Wait(r.ctx, n); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+type readSeeker struct {
+	reader
+	s io.Seeker
+}
+
+// ReadSeeker limits reads from rs and keeps it seekable, as the S3 client
+// wants for request bodies. With a nil limiter it returns rs.
+func ReadSeeker(ctx context.Context, rs io.ReadSeeker, l *Limiter) io.ReadSeeker {
+	if l == nil {
+		return rs
+	}
+	return &readSeeker{reader{ctx, rs, l}, rs}
+}
+
+func (r *readSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.s.Seek(offset, whence)
+}
+
+type writer struct {
+	ctx context.Context
+	w   io.Writer
+	l   *Limiter
+}
+
+// Writer limits writes to w. With a nil limiter it returns w.
+func Writer(ctx context.Context, w io.Writer, l *Limiter) io.Writer {
+	if l == nil {
+		return w
+	}
+	return &writer{ctx, w, l}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if err := w.l.Wait(w.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// ParseRate parses a rate in bytes per second: a plain number, or one with
+// a unit such as "512KiB", "20MB" or "1G" ("/s" may follow). "", "0" and
+// "unlimited" mean no limit.
+func ParseRate(s string) (int64, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if s == "" || s == "0" || strings.EqualFold(s, "unlimited") {
+		return 0, nil
+	}
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], strings.TrimSpace(s[i:])
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	mult, ok := units[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("invalid rate %q: unknown unit %q", s, unit)
+	}
+	return int64(v * mult), nil
+}
+
+var units = map[string]float64{
+	"": 1, "b": 1,
+	"k": 1e3, "kb": 1e3, "kib": 1 << 10,
+	"m": 1e6, "mb": 1e6, "mib": 1 << 20,
+	"g": 1e9, "gb": 1e9, "gib": 1 << 30,
+}
+
+// ParseClock parses a time of day, "HH:MM", as the time since midnight.
+// "24:00" is allowed as the end of a day.
+func ParseClock(s string) (time.Duration, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hours, herr := strconv.Atoi(h)
+	minutes, merr := strconv.Atoi(m)
+	if !ok || herr != nil || merr != nil || hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
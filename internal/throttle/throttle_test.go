@@ -0,0 +1,207 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"unlimited", 0, false},
+		{" Unlimited ", 0, false},
+		{"1000", 1000, false},
+		{"1000/s", 1000, false},
+		{"512B", 512, false},
+		{"20k", 20e3, false},
+		{"20KB", 20e3, false},
+		{"512KiB", 512 << 10, false},
+		{"20MB", 20e6, false},
+		{"20 MB/s", 20e6, false},
+		{"1.5MiB", 3 << 19, false},
+		{"1G", 1e9, false},
+		{"2GiB", 2 << 30, false},
+		{"0.5k", 500, false},
+		{"fast", 0, true},
+		{"MB", 0, true},
+		{"10TB", 0, true},
+		{"10 bits", 0, true},
+		{"-5MB", 0, true},
+		{"1.2.3", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRate(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"9:05", 9*time.Hour + 5*time.Minute, false},
+		{" 23:59 ", 23*time.Hour + 59*time.Minute, false},
+		{"24:00", 24 * time.Hour, false},
+		{"24:01", 0, true},
+		{"25:00", 0, true},
+		{"12:60", 0, true},
+		{"-1:00", 0, true},
+		{"12", 0, true},
+		{"12:", 0, true},
+		{":30", 0, true},
+		{"noon", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseClock(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseClock(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseClock(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	night := Window{From: 22 * time.Hour, To: 6 * time.Hour, Rate: 100e6}
+	lunch := Window{From: 12 * time.Hour, To: 13 * time.Hour, Rate: 0}
+	l := New(10e6, []Window{night, lunch})
+	at := func(hh, mm int) time.Time { return time.Date(2026, 10, 19, hh, mm, 0, 0, time.UTC) }
+
+	tests := []struct {
+		at   time.Time
+		want int64
+	}{
+		{at(9, 0), 10e6},
+		{at(21, 59), 10e6},
+		{at(22, 0), 100e6},
+		{at(0, 0), 100e6},
+		{at(5, 59), 100e6},
+		{at(6, 0), 10e6},
+		{at(12, 0), 0},
+		{at(12, 59), 0},
+		{at(13, 0), 10e6},
+	}
+	for _, tt := range tests {
+		if got := l.Rate(tt.at); got != tt.want {
+			t.Errorf("Rate(%s) = %d, want %d", tt.at.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    int64
+		windows []Window
+		wantNil bool
+	}{
+		{"nothing", 0, nil, true},
+		{"unlimited windows", 0, []Window{{From: 0, To: time.Hour}}, true},
+		{"base", 1000, nil, false},
+		{"window only", 0, []Window{{From: 0, To: time.Hour, Rate: 1000}}, false},
+	}
+	for _, tt := range tests {
+		if got := New(tt.base, tt.windows); (got == nil) != tt.wantNil {
+			t.Errorf("%s: New = %v, want nil %v", tt.name, got, tt.wantNil)
+		}
+	}
+
+	var l *Limiter
+	if got := l.Rate(time.Now()); got != 0 {
+		t.Errorf("nil Rate = %d, want 0", got)
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	allDay := []Window{{From: 0, To: 24 * time.Hour, Rate: 0}}
+	tests := []struct {
+		name  string
+		l     *Limiter
+		sizes []int
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"nil", nil, []int{1 << 30}, 0, 50 * time.Millisecond},
+		{"unlimited now", New(1000, allDay), []int{1 << 30}, 0, 50 * time.Millisecond},
+		{"one wait", New(10000, nil), []int{1000}, 90 * time.Millisecond, 500 * time.Millisecond},
+		{"shared bucket", New(10000, nil), []int{500, 500, 500, 500}, 180 * time.Millisecond, 700 * time.Millisecond},
+		{"larger than a second of traffic", New(10000, nil), []int{15000}, 1400 * time.Millisecond, 2500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			for _, n := range tt.sizes {
+				if err := tt.l.Wait(context.Background(), n); err != nil {
+					t.Fatalf("Wait(%d): %v", n, err)
+				}
+			}
+			if took := time.Since(start); took < tt.min || took > tt.max {
+				t.Errorf("took %v, want between %v and %v", took, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestLimiterWaitCancel(t *testing.T) {
+	l := New(1000, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := l.Wait(ctx, 10000)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Wait returned after %v, want soon after the deadline", took)
+	}
+}
+
+func TestReaderWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 2000)
+	l := New(20000, nil)
+
+	start := time.Now()
+	var got bytes.Buffer
+	if _, err := io.Copy(Writer(context.Background(), &got, l), Reader(context.Background(), bytes.NewReader(data), l)); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Error("data changed in transit")
+	}
+	// Both ends share the limiter, so 4000 bytes pass at 20000 B/s.
+	if took := time.Since(start); took < 150*time.Millisecond {
+		t.Errorf("copy took %v, want at least 150ms", took)
+	}
+
+	rs := ReadSeeker(context.Background(), bytes.NewReader(data), l)
+	if pos, err := rs.Seek(-10, io.SeekEnd); err != nil || pos != 1990 {
+		t.Errorf("Seek = %d, %v, want 1990", pos, err)
+	}
+
+	r := bytes.NewReader(data)
+	if Reader(context.Background(), r, nil) != io.Reader(r) {
+		t.Error("Reader with a nil limiter wraps r")
+	}
+}